@@ -3,10 +3,16 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"os/user"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,48 +21,94 @@ import (
 	"github.com/charmbracelet/wish"
 	"github.com/charmbracelet/wish/bubbletea"
 	"github.com/charmbracelet/wish/logging"
-	"github.com/charmbracelet/wish/scp"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	
+	"battleship-arena/internal/config"
+	"battleship-arena/internal/logs"
+	"battleship-arena/internal/metrics"
 	"battleship-arena/internal/runner"
 	"battleship-arena/internal/server"
 	"battleship-arena/internal/storage"
 	"battleship-arena/internal/tui"
 )
 
-type Config struct {
-	Host             string
-	SSHPort          string
-	WebPort          string
-	UploadDir        string
-	ResultsDB        string
-	AdminPasscode    string
-	ExternalURL      string
+// loadConfig reads the file named by BATTLESHIP_CONFIG, or
+// battleship-arena.toml when it exists, under any BATTLESHIP_* overrides
+func loadConfig() (config.Config, error) {
+	return config.Load(config.Path(), os.Getenv("BATTLESHIP_CONFIG") != "")
 }
 
-func loadConfig() Config {
-	cfg := Config{
-		Host:             getEnv("BATTLESHIP_HOST", "0.0.0.0"),
-		SSHPort:          getEnv("BATTLESHIP_SSH_PORT", "2222"),
-		WebPort:          getEnv("BATTLESHIP_WEB_PORT", "8081"),
-		UploadDir:        getEnv("BATTLESHIP_UPLOAD_DIR", "./submissions"),
-		ResultsDB:        getEnv("BATTLESHIP_RESULTS_DB", "./results.db"),
-		AdminPasscode:    getEnv("BATTLESHIP_ADMIN_PASSCODE", "battleship-admin-override"),
-		ExternalURL:      getEnv("BATTLESHIP_EXTERNAL_URL", "http://localhost:8081"),
-	}
-	return cfg
+// applyConfig hands the settings each package reads to it
+func applyConfig(cfg config.Config) {
+	runner.Configure(cfg)
+	storage.DefaultGamesPerMatch = cfg.Engine.GamesPerMatch
+	server.SetLeaderboardSize(cfg.Web.LeaderboardSize)
+	tui.Configure(cfg)
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+const configUsage = `usage: battleship-arena config check [file]
+  validates the config file (default: $BATTLESHIP_CONFIG or battleship-arena.toml)
+  with environment overrides applied, and prints the result with secrets redacted`
+
+// runConfigCommand checks a config file without starting the server
+func runConfigCommand(args []string) error {
+	if len(args) == 0 || args[0] != "check" || len(args) > 2 {
+		return errors.New(configUsage)
+	}
+	path, explicit := config.Path(), os.Getenv("BATTLESHIP_CONFIG") != ""
+	if len(args) == 2 {
+		path, explicit = args[1], true
+	}
+
+	cfg, err := config.Load(path, explicit)
+	if err != nil {
+		return err
+	}
+	dump, err := cfg.Redacted().Encode()
+	if err != nil {
+		return err
 	}
-	return defaultValue
+	fmt.Print(dump)
+	if _, err := os.Stat(path); err != nil {
+		log.Printf("✓ Configuration is valid (no %s; defaults and environment only)", path)
+	} else {
+		log.Printf("✓ %s is valid", path)
+	}
+	return nil
 }
 
 func main() {
-	cfg := loadConfig()
+	// Checking the config shouldn't need a working database
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfigCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := logs.Setup(cfg.Log.Level, cfg.Log.Format); err != nil {
+		log.Fatal(err)
+	}
+	applyConfig(cfg)
+
+	// Migrations are inspected before InitDB would apply them
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(cfg, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "db" {
+		if err := runDBCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	
 	if err := initStorage(cfg); err != nil {
 		log.Fatal(err)
@@ -71,28 +123,76 @@ func main() {
 				log.Fatalf("Failed to recalculate ratings: %v", err)
 			}
 			log.Println("✓ Ratings recalculated successfully")
+			if err := audit("recalculate_ratings", "", ""); err != nil {
+				log.Fatal(err)
+			}
 			return
+		case "season":
+			if err := runSeasonCommand(cfg, os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "arena":
+			if err := runArenaCommand(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "roster", "invite", "user":
+			if err := runRegistrationCommand(os.Args[1], os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "admin":
+			if err := runAdminCommand(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "jobs":
+			if err := runJobsCommand(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	logs.StartCapture()
+	slog.Info("configuration", "config", cfg)
+
+	if len(cfg.Bots.Reference) > 0 {
+		if err := runner.SeedReferenceBots(cfg.Bots.Dir, cfg.Storage.UploadDir, cfg.Bots.Reference, cfg.Bots.Ratings); err != nil {
+			slog.Error("seeding reference bots failed", "err", err)
 		}
 	}
 
 	server.InitSSE()
-	server.SetConfig(cfg.AdminPasscode, cfg.ExternalURL)
+	server.SetConfig(cfg.Admin.Passcode, cfg.Server.ExternalURL)
+	server.SetUploadLimits(cfg.Uploads.MaxFiles, cfg.Uploads.MaxBytes)
+	if err := server.SetRegistrationMode(cfg.Server.Registration); err != nil {
+		log.Fatal(err)
+	}
 
 	workerCtx, workerCancel := context.WithCancel(context.Background())
 	defer workerCancel()
-	go runner.StartWorker(workerCtx, cfg.UploadDir, server.BroadcastProgress, server.NotifyLeaderboardUpdate, server.BroadcastProgressComplete)
+	workerDone := make(chan struct{})
+	go func() {
+		runner.StartWorker(workerCtx, cfg.Server.ShutdownTimeout.Duration, cfg.Storage.UploadDir, server.BroadcastProgress, server.NotifyLeaderboardUpdate, server.BroadcastProgressComplete)
+		close(workerDone)
+	}()
 
-	toClient, fromClient := server.NewSCPHandlers(cfg.UploadDir)
 	sshServer, err := wish.NewServer(
-		wish.WithAddress(cfg.Host + ":" + cfg.SSHPort),
-		wish.WithHostKeyPath(".ssh/battleship_arena"),
+		wish.WithAddress(cfg.Server.Host + ":" + cfg.Server.SSHPort),
+		wish.WithHostKeyPath(cfg.Server.HostKeyPath),
 		wish.WithPublicKeyAuth(server.PublicKeyAuthHandler),
 		wish.WithPasswordAuth(server.PasswordAuthHandler),
-		wish.WithSubsystem("sftp", server.SFTPHandler(cfg.UploadDir)),
+		wish.WithKeyboardInteractiveAuth(server.KeyboardInteractiveHandler),
+		wish.WithSubsystem("sftp", server.SFTPHandler(cfg.Storage.UploadDir)),
 		wish.WithMiddleware(
-			scp.Middleware(toClient, fromClient),
+			server.SCPMiddleware(cfg.Storage.UploadDir),
+			server.CommandMiddleware(cfg.Storage.UploadDir),
 			bubbletea.Middleware(teaHandler),
 			logging.Middleware(),
+			server.MetricsMiddleware(),
+			server.SessionMiddleware(),
 		),
 	)
 	if err != nil {
@@ -102,8 +202,7 @@ func main() {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
-	log.Printf("SSH server listening on %s:%s", cfg.Host, cfg.SSHPort)
-	log.Printf("Web leaderboard at %s", cfg.ExternalURL)
+	slog.Info("SSH server listening", "addr", cfg.Server.Host+":"+cfg.Server.SSHPort)
 
 	go func() {
 		if err := sshServer.ListenAndServe(); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
@@ -111,30 +210,564 @@ func main() {
 		}
 	}()
 
-	go func() {
-		<-done
-		log.Println("Shutting down servers...")
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		if err := sshServer.Shutdown(ctx); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
-			log.Fatal(err)
-		}
-		os.Exit(0)
-	}()
-
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Mount("/events/", server.SSEServer)
-	r.Get("/api/leaderboard", server.HandleAPILeaderboard)
-	r.Get("/api/rating-history/{player}", server.HandleRatingHistory)
-	r.Get("/player/{player}", server.HandlePlayerPage)
-	r.Get("/user/{username}", server.HandleUserProfile)
+	r.Handle("/metrics", metrics.Handler())
 	r.Get("/users", server.HandleUsers)
-	r.Get("/", server.HandleLeaderboard)
+	r.Mount("/admin", server.AdminRouter(cfg.Storage.UploadDir))
+
+	// Every arena serves the same pages under /a/{arena}; the default arena
+	// is also served from the root
+	arenaRoutes := func(r chi.Router) {
+		r.Mount("/api/v1", server.APIRouter())
+		r.Get("/api/leaderboard", server.HandleAPILeaderboard)
+		r.Get("/api/rating-history/{player}", server.HandleRatingHistory)
+		r.Get("/api/season/{id}", server.HandleAPISeasonStandings)
+		r.Get("/player/{player}", server.HandlePlayerPage)
+		r.Get("/user/{username}", server.HandleUserProfile)
+		r.Get("/matrix", server.HandleMatrix)
+		r.Get("/match/{id}", server.HandleMatchPage)
+		r.Get("/match/{id}/replay/{game}", server.HandleMatchReplay)
+		r.Get("/seasons", server.HandleSeasons)
+		r.Get("/season/{id}", server.HandleSeasonPage)
+		r.Get("/", server.HandleLeaderboard)
+	}
+	arenaRoutes(r)
+	r.Route("/a/{arena}", arenaRoutes)
+
+	httpServer := &http.Server{Addr: ":" + cfg.Server.WebPort, Handler: r}
+	// Event streams never end on their own, so close them once the listener
+	// has stopped taking connections
+	httpServer.RegisterOnShutdown(server.CloseSSE)
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	slog.Info("web server listening", "addr", httpServer.Addr, "url", cfg.Server.ExternalURL)
+
+	<-done
+	// A second signal kills the process outright
+	signal.Stop(done)
+	shutdown(sshServer, httpServer, workerCancel, workerDone)
+}
+
+// shutdown stops taking new work, lets the running job finish or checkpoint
+// it, then closes the servers and the database. Queued jobs stay in the
+// database and resume on the next start.
+func shutdown(sshServer *ssh.Server, httpServer *http.Server, stopWorker context.CancelFunc, workerDone <-chan struct{}) {
+	slog.Info("shutting down, no longer accepting uploads")
+	server.StopUploads()
+
+	// TUI sessions stay open indefinitely, so give them a moment and then
+	// drop them
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := sshServer.Shutdown(ctx); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
+		slog.Warn("SSH sessions still open, closing them", "err", err)
+		sshServer.Close()
+	}
+	cancel()
+
+	slog.Info("waiting for the running job to finish")
+	stopWorker()
+	<-workerDone
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	if err := httpServer.Shutdown(ctx); err != nil {
+		slog.Warn("web server did not shut down cleanly", "err", err)
+		httpServer.Close()
+	}
+	cancel()
+
+	logs.StopCapture()
+	if err := storage.Close(); err != nil {
+		slog.Error("closing database failed", "err", err)
+	}
+	slog.Info("shutdown complete")
+}
+
+// runSeasonCommand handles "season list", "season close" and "season open <name>"
+func runSeasonCommand(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: battleship-arena season list|close|open <name>")
+	}
+
+	switch args[0] {
+	case "list":
+		seasons, err := storage.GetSeasons()
+		if err != nil {
+			return err
+		}
+		for _, s := range seasons {
+			ended := "-"
+			if !s.EndedAt.IsZero() {
+				ended = s.EndedAt.Format("2006-01-02")
+			}
+			fmt.Printf("%3d  %-8s %s → %s  %s\n", s.ID, s.Status, s.StartedAt.Format("2006-01-02"), ended, s.Name)
+		}
+		return nil
+
+	case "close":
+		season, err := storage.CloseSeason()
+		if err != nil {
+			return fmt.Errorf("failed to close season: %v", err)
+		}
+		log.Printf("✓ Closed %s; final standings archived", season.Name)
+		return audit("close_season", season.Name, "")
+
+	case "open":
+		if len(args) < 2 {
+			return errors.New("usage: battleship-arena season open <name>")
+		}
+		season, err := storage.OpenSeason(strings.Join(args[1:], " "))
+		if err != nil {
+			return fmt.Errorf("failed to open season: %v", err)
+		}
+		log.Printf("✓ Opened %s", season.Name)
+		if err := audit("open_season", season.Name, ""); err != nil {
+			return err
+		}
+
+		// Reference bots carry over so the new ladder has anchors from day one
+		if len(cfg.Bots.Reference) > 0 {
+			if err := runner.SeedReferenceBots(cfg.Bots.Dir, cfg.Storage.UploadDir, cfg.Bots.Reference, cfg.Bots.Ratings); err != nil {
+				log.Printf("Failed to seed reference bots: %v", err)
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown season command %q", args[0])
+}
+
+const arenaUsage = `usage: battleship-arena arena <command>
+  list
+  create <name> --engine <dir> [--title "Display Name"] [--games N] [--roster]
+  members <name>
+  add <name> <username> [member|admin]
+  remove <name> <username>`
+
+// runArenaCommand manages arenas and their rosters
+func runArenaCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(arenaUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		arenas, err := storage.GetArenas()
+		if err != nil {
+			return err
+		}
+		for _, a := range arenas {
+			access := "open"
+			if a.RosterOnly {
+				access = "roster"
+			}
+			engine := a.EnginePath
+			if engine == "" {
+				engine = "(default engine)"
+			}
+			fmt.Printf("%-16s %-6s %5d games  %-30s %s\n", a.Slug, access, a.GamesPerMatch, engine, a.Name)
+		}
+		return nil
+
+	case "create":
+		if len(args) < 2 {
+			return errors.New(arenaUsage)
+		}
+		fs := flag.NewFlagSet("arena create", flag.ContinueOnError)
+		engine := fs.String("engine", "", "engine directory for this arena")
+		title := fs.String("title", "", "display name")
+		games := fs.Int("games", storage.DefaultGamesPerMatch, "games per head-to-head match")
+		roster := fs.Bool("roster", false, "only roster members may submit")
+		if err := fs.Parse(args[2:]); err != nil {
+			return err
+		}
+		arena, err := storage.CreateArena(args[1], *title, *engine, *games, *roster)
+		if err != nil {
+			return err
+		}
+		log.Printf("✓ Created arena %s (%s); uploads go to host:%s/", arena.Slug, arena.Name, arena.Slug)
+		return audit("create_arena", arena.Slug, fmt.Sprintf("engine=%s games=%d roster=%v", arena.EnginePath, arena.GamesPerMatch, arena.RosterOnly))
+
+	case "members", "add", "remove":
+		if len(args) < 2 {
+			return errors.New(arenaUsage)
+		}
+		arena, err := storage.GetArena(args[1])
+		if err != nil {
+			return err
+		}
+		if arena == nil {
+			return fmt.Errorf("unknown arena %q", args[1])
+		}
+
+		switch args[0] {
+		case "members":
+			members, err := storage.GetArenaMembers(arena.ID)
+			if err != nil {
+				return err
+			}
+			for _, m := range members {
+				fmt.Printf("%-20s %s\n", m.Username, m.Role)
+			}
+			return nil
+		case "add":
+			if len(args) < 3 {
+				return errors.New(arenaUsage)
+			}
+			role := storage.ArenaRoleMember
+			if len(args) > 3 {
+				role = args[3]
+			}
+			if err := storage.AddArenaMember(arena.ID, args[2], role); err != nil {
+				return err
+			}
+			log.Printf("✓ Added %s to %s as %s", args[2], arena.Slug, role)
+			return audit("add_arena_member", args[2], arena.Slug+" as "+role)
+		default:
+			if len(args) < 3 {
+				return errors.New(arenaUsage)
+			}
+			if err := storage.RemoveArenaMember(arena.ID, args[2]); err != nil {
+				return err
+			}
+			log.Printf("✓ Removed %s from %s", args[2], arena.Slug)
+			return audit("remove_arena_member", args[2], arena.Slug)
+		}
+	}
+
+	return fmt.Errorf("unknown arena command %q\n%s", args[0], arenaUsage)
+}
+
+const registrationUsage = `usage: battleship-arena <command>
+  roster import <file.csv>     columns: username, email, name (username defaults to the email's local part)
+  roster list
+  invite create [N] [--note "text"]
+  invite list
+  user revoke <username>
+  user restore <username>`
+
+// runRegistrationCommand manages who may create accounts and revokes
+// existing ones
+func runRegistrationCommand(command string, args []string) error {
+	if len(args) == 0 {
+		return errors.New(registrationUsage)
+	}
+
+	switch command + " " + args[0] {
+	case "roster import":
+		if len(args) < 2 {
+			return errors.New(registrationUsage)
+		}
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		count, err := storage.ImportRoster(f)
+		if err != nil {
+			return err
+		}
+		log.Printf("✓ Imported %d roster entries", count)
+		return audit("import_roster", "", fmt.Sprintf("%d entries from %s", count, args[1]))
+
+	case "roster list":
+		entries, err := storage.GetRoster()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			fmt.Printf("%-20s %-30s %s\n", e.Username, e.Email, e.Name)
+		}
+		return nil
+
+	case "invite create":
+		fs := flag.NewFlagSet("invite create", flag.ContinueOnError)
+		note := fs.String("note", "", "what the codes are for")
+		n := 1
+		rest := args[1:]
+		if len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+			var err error
+			if n, err = strconv.Atoi(rest[0]); err != nil || n <= 0 {
+				return fmt.Errorf("invalid invite count %q", rest[0])
+			}
+			rest = rest[1:]
+		}
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		codes, err := storage.CreateInviteCodes(n, *note)
+		if err != nil {
+			return err
+		}
+		for _, code := range codes {
+			fmt.Println(code)
+		}
+		return audit("create_invites", "", fmt.Sprintf("%d codes: %s", len(codes), *note))
+
+	case "invite list":
+		codes, err := storage.GetInviteCodes()
+		if err != nil {
+			return err
+		}
+		for _, c := range codes {
+			used := "unused"
+			if c.UsedBy != "" {
+				used = fmt.Sprintf("used by %s on %s", c.UsedBy, c.UsedAt.Format("2006-01-02"))
+			}
+			fmt.Printf("%s  %-32s %s\n", c.Code, used, c.Note)
+		}
+		return nil
+
+	case "user revoke", "user restore":
+		if len(args) < 2 {
+			return errors.New(registrationUsage)
+		}
+		if args[0] == "revoke" {
+			if err := storage.RevokeUser(args[1]); err != nil {
+				return err
+			}
+			log.Printf("✓ Revoked %s; their submissions are off the ladder", args[1])
+			return audit("revoke_user", args[1], "")
+		}
+		if err := storage.RestoreUser(args[1]); err != nil {
+			return err
+		}
+		log.Printf("✓ Restored %s", args[1])
+		return audit("restore_user", args[1], "")
+	}
+
+	return fmt.Errorf("unknown %s command %q\n%s", command, args[0], registrationUsage)
+}
+
+const adminUsage = `usage: battleship-arena admin <command>
+  list
+  grant <username> [fingerprint]   without a fingerprint, all of the user's current keys become admin keys
+  revoke <username>
+  audit [N]                        show the last N audit log entries (default 50)`
+
+// runAdminCommand manages admin roles and shows the audit log
+func runAdminCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(adminUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		admins, err := storage.GetAdmins()
+		if err != nil {
+			return err
+		}
+		for _, a := range admins {
+			keys, err := storage.GetUserKeys(a.Username)
+			if err != nil {
+				return err
+			}
+			fmt.Println(a.Username)
+			for _, k := range keys {
+				if k.IsAdmin {
+					fmt.Printf("  %s  %s\n", k.Fingerprint, k.Label)
+				}
+			}
+		}
+		return nil
+
+	case "grant":
+		if len(args) < 2 {
+			return errors.New(adminUsage)
+		}
+		fingerprint := ""
+		if len(args) > 2 {
+			fingerprint = args[2]
+		}
+		if err := storage.GrantAdmin(args[1], fingerprint); err != nil {
+			return err
+		}
+		log.Printf("✓ %s is now an admin", args[1])
+		return audit("grant_admin", args[1], fingerprint)
+
+	case "revoke":
+		if len(args) < 2 {
+			return errors.New(adminUsage)
+		}
+		if err := storage.RevokeAdmin(args[1]); err != nil {
+			return err
+		}
+		log.Printf("✓ %s is no longer an admin", args[1])
+		return audit("revoke_admin", args[1], "")
+
+	case "audit":
+		limit := 50
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid entry count %q", args[1])
+			}
+			limit = n
+		}
+		entries, err := storage.GetAuditLog(limit)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			fmt.Printf("%s  %-16s %-20s %-16s %s\n", e.CreatedAt.Format("2006-01-02 15:04"), e.Actor, e.Action, e.Target, e.Detail)
+		}
+		return nil
+	}
 
-	log.Println("Server running at " + cfg.ExternalURL)
-	http.ListenAndServe(":"+cfg.WebPort, r)
+	return fmt.Errorf("unknown admin command %q\n%s", args[0], adminUsage)
+}
+
+const migrateUsage = `usage: battleship-arena migrate <command>
+  status    list schema migrations and whether each is applied
+  up        apply pending migrations (the server also does this on start)`
+
+// runMigrateCommand shows or applies schema migrations
+func runMigrateCommand(cfg config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	db, err := storage.Open(cfg.Storage.ResultsDB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "status":
+		states, err := storage.MigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		pending := 0
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04")
+			} else {
+				pending++
+			}
+			fmt.Printf("%4d  %-16s %s\n", s.Version, applied, s.Name)
+		}
+		fmt.Printf("%d pending; latest version is %d\n", pending, storage.LatestSchemaVersion())
+		return nil
+
+	case "up":
+		done, err := storage.Migrate(db)
+		for _, m := range done {
+			log.Printf("✓ Applied migration %d: %s", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			log.Printf("✓ Already at version %d", storage.LatestSchemaVersion())
+			return nil
+		}
+		storage.Use(db)
+		return audit("migrate", "", fmt.Sprintf("to version %d", storage.LatestSchemaVersion()))
+	}
+
+	return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+}
+
+const dbUsage = `usage: battleship-arena db <command>
+  copy <from> <to>   copy every row into a new, empty database; each side is
+                     a SQLite file or a postgres:// URL`
+
+// runDBCommand moves the arena's data between databases, for example from
+// SQLite to PostgreSQL
+func runDBCommand(args []string) error {
+	if len(args) != 3 || args[0] != "copy" {
+		return errors.New(dbUsage)
+	}
+
+	src, err := storage.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := storage.Open(args[2])
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	copied, err := storage.Copy(src, dst)
+	if err != nil {
+		return err
+	}
+	total := 0
+	for _, t := range copied {
+		fmt.Printf("%-20s %d\n", t.Name, t.Rows)
+		total += t.Rows
+	}
+	log.Printf("✓ Copied %d rows from %s to %s", total, src.Backend(), dst.Backend())
+
+	storage.Use(dst)
+	return audit("db_copy", config.RedactURL(args[2]), "from "+config.RedactURL(args[1]))
+}
+
+const jobsUsage = `usage: battleship-arena jobs <command>
+  list [queued|running|done|dead]   show the latest jobs, optionally only those in one state
+  retry <id>                        give a dead job another set of attempts`
+
+// runJobsCommand shows the worker's job queue and revives dead jobs
+func runJobsCommand(args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch args[0] {
+	case "list":
+		status := ""
+		if len(args) > 1 {
+			status = args[1]
+		}
+		jobs, err := storage.GetJobs(status, 100)
+		if err != nil {
+			return err
+		}
+		for _, j := range jobs {
+			fmt.Printf("%5d  %-8s %-28s %d/%d  %s", j.ID, j.Status, j.Key, j.Attempts, j.MaxAttempts, j.UpdatedAt.Format("2006-01-02 15:04"))
+			if j.LastError != "" && j.Status != storage.JobDone {
+				fmt.Printf("  %s", strings.SplitN(j.LastError, "\n", 2)[0])
+			}
+			fmt.Println()
+		}
+		return nil
+
+	case "retry":
+		if len(args) < 2 {
+			return errors.New(jobsUsage)
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid job id %q", args[1])
+		}
+		if err := storage.RetryJob(id); err != nil {
+			return err
+		}
+		log.Printf("✓ Job %d queued again; the running server picks it up within 30 seconds", id)
+		return audit("retry_job", args[1], "")
+	}
+
+	return fmt.Errorf("unknown jobs command %q\n%s", args[0], jobsUsage)
+}
+
+// audit records an admin action taken from the command line, attributed to
+// the operating system user who ran it
+func audit(action, target, detail string) error {
+	actor := "cli"
+	if u, err := user.Current(); err == nil {
+		actor = "cli:" + u.Username
+	}
+	return storage.Audit(actor, action, target, detail)
 }
 
 func teaHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
@@ -167,24 +800,26 @@ func teaHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
 			publicKey = val.(string)
 		}
 		
-		m := tui.NewOnboardingModel(s.User(), publicKey, pty.Window.Width, pty.Window.Height, renderer)
+		needsInvite, _ := s.Context().Value("needs_invite").(bool)
+		
+		m := tui.NewOnboardingModel(s.User(), publicKey, needsInvite, pty.Window.Width, pty.Window.Height, renderer)
 		return m, opts
 	}
 
-	m := tui.InitialModel(s.User(), pty.Window.Width, pty.Window.Height, renderer)
+	m := tui.InitialModel(s.User(), server.IsAdminSession(s.Context()), pty.Window.Width, pty.Window.Height, renderer)
 	return m, opts
 }
 
-func initStorage(cfg Config) error {
-	if err := os.MkdirAll(cfg.UploadDir, 0755); err != nil {
+func initStorage(cfg config.Config) error {
+	if err := os.MkdirAll(cfg.Storage.UploadDir, 0755); err != nil {
 		return err
 	}
 	
-	db, err := storage.InitDB(cfg.ResultsDB)
+	db, err := storage.InitDB(cfg.Storage.ResultsDB)
 	if err != nil {
 		return err
 	}
-	storage.DB = db
+	storage.Use(db)
 	
 	return nil
 }
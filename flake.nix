@@ -49,6 +49,7 @@
               mkdir -p $out/share/battleship-arena/battleship-engine
               cp -r ${self}/battleship-engine/src $out/share/battleship-arena/battleship-engine/
               mkdir -p $out/share/battleship-arena/battleship-engine/build
+              cp -r ${self}/scripts/test-submissions $out/share/battleship-arena/reference-bots
             '';
 
             meta = with pkgs.lib; {
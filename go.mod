@@ -3,12 +3,14 @@ module battleship-arena
 go 1.25.4
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/alexandrevicenzi/go-sse v1.6.0
 	github.com/charmbracelet/bubbletea v1.3.10
 	github.com/charmbracelet/lipgloss v1.1.0
 	github.com/charmbracelet/ssh v0.0.0-20250826160808-ebfa259c7309
 	github.com/charmbracelet/wish v1.4.7
 	github.com/go-chi/chi/v5 v5.2.3
+	github.com/lib/pq v1.10.9
 	github.com/mattn/go-sqlite3 v1.14.32
 	github.com/pkg/sftp v1.13.10
 	golang.org/x/crypto v0.41.0
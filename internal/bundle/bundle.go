@@ -0,0 +1,311 @@
+// Package bundle reads multi-file submissions, uploaded as an archive or a
+// directory, and checks them before anything is stored or compiled. A bundle
+// has a manifest at its top naming the memory_functions_* entrypoint; its
+// other sources in the same language are built into the same AI.
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ManifestName is the file at the top of a bundle naming its entrypoint
+const ManifestName = "manifest.toml"
+
+// entrypointPattern is the name every submission's entrypoint has, from
+// which its function names are derived. The extension picks the language it
+// is built as, one of the runner's language drivers.
+var entrypointPattern = regexp.MustCompile(`^memory_functions_\w+\.(cpp|c|py)$`)
+
+// Limits bound what a bundle may hold
+type Limits struct {
+	MaxFiles int
+	// MaxBytes is the most all files may hold together, uncompressed
+	MaxBytes int64
+}
+
+// File is one file of a bundle, by its slash separated path in the bundle.
+// Only sources in the entrypoint's language are built; headers and anything
+// else they use come along.
+type File struct {
+	Path    string
+	Content []byte
+}
+
+// Bundle is a checked multi-file submission
+type Bundle struct {
+	// Entrypoint is the name of the memory_functions_* source at the top
+	Entrypoint string
+	// Files includes the manifest and the entrypoint, sorted by path
+	Files []File
+}
+
+type manifest struct {
+	Entrypoint string `toml:"entrypoint"`
+}
+
+// IsEntrypoint reports whether a file name is one a submission's entrypoint
+// may have, such as memory_functions_you.cpp
+func IsEntrypoint(name string) bool {
+	return entrypointPattern.MatchString(name)
+}
+
+// IsArchive reports whether an upload's name is one of the archive formats
+// read by ReadArchive
+func IsArchive(name string) bool {
+	return archiveExt(name) != ""
+}
+
+func archiveExt(name string) string {
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(name, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// CheckPath rejects a path that could reach outside the bundle
+func CheckPath(name string) error {
+	if strings.Contains(name, `\`) || !filepath.IsLocal(name) || path.Clean(name) != name {
+		return fmt.Errorf("%s: paths must stay inside the bundle", name)
+	}
+	return nil
+}
+
+// isHidden reports whether a path is, or is in, a hidden file or directory
+// such as .git or the ._ files macOS adds to archives. They are left out.
+func isHidden(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadArchive reads a tar, gzipped tar or zip archive. Everything may also
+// sit in one directory at the top of the archive, as "tar czf x.tgz dir"
+// makes it.
+func ReadArchive(name string, r io.Reader, limits Limits) (*Bundle, error) {
+	// Compression can't make an archive bigger, except by a little framing
+	data, err := io.ReadAll(io.LimitReader(r, limits.MaxBytes+64<<10))
+	if err != nil {
+		return nil, err
+	}
+
+	c := collector{limits: limits}
+	switch archiveExt(name) {
+	case ".tar.gz", ".tgz":
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		err = c.readTar(gz)
+		if err == nil {
+			err = gz.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+	case ".tar":
+		if err := c.readTar(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+	case ".zip":
+		if err := c.readZip(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%s is not a .tar, .tar.gz, .tgz or .zip archive", name)
+	}
+	return c.bundle(true)
+}
+
+// ReadDir reads a bundle uploaded as a directory
+func ReadDir(dir string, limits Limits) (*Bundle, error) {
+	c := collector{limits: limits}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		switch {
+		case d.IsDir():
+			return nil
+		case !d.Type().IsRegular():
+			return fmt.Errorf("%s: only regular files are accepted", name)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return c.add(name, f)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.bundle(false)
+}
+
+// collector gathers files within the limits
+type collector struct {
+	limits Limits
+	files  []File
+	total  int64
+}
+
+func (c *collector) add(name string, r io.Reader) error {
+	if err := CheckPath(name); err != nil {
+		return err
+	}
+	if isHidden(name) {
+		return nil
+	}
+	if len(c.files) == c.limits.MaxFiles {
+		return fmt.Errorf("more than %d files", c.limits.MaxFiles)
+	}
+	for _, f := range c.files {
+		if f.Path == name {
+			return fmt.Errorf("%s appears twice", name)
+		}
+	}
+	// Read one byte past the limit to tell a file that fits exactly from
+	// one that doesn't
+	content, err := io.ReadAll(io.LimitReader(r, c.limits.MaxBytes-c.total+1))
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	c.total += int64(len(content))
+	if c.total > c.limits.MaxBytes {
+		return fmt.Errorf("files larger than %d bytes in total", c.limits.MaxBytes)
+	}
+	c.files = append(c.files, File{Path: name, Content: content})
+	return nil
+}
+
+func (c *collector) readTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg:
+		case tar.TypeXGlobalHeader:
+			// pax headers, such as the commit git archive records
+			continue
+		default:
+			return fmt.Errorf("%s: only regular files are accepted", hdr.Name)
+		}
+		if err := c.add(strings.TrimPrefix(hdr.Name, "./"), tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *collector) readZip(data []byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+		if !zf.Mode().IsRegular() {
+			return fmt.Errorf("%s: only regular files are accepted", zf.Name)
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %v", zf.Name, err)
+		}
+		err = c.add(zf.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bundle checks the collected files make up a bundle. Archives may wrap
+// everything in one directory, which is removed.
+func (c *collector) bundle(unwrap bool) (*Bundle, error) {
+	files := c.files
+	if unwrap && !hasFile(files, ManifestName) && len(files) > 0 {
+		top, _, _ := strings.Cut(files[0].Path, "/")
+		prefix := top + "/"
+		wrapped := true
+		for _, f := range files {
+			wrapped = wrapped && strings.HasPrefix(f.Path, prefix)
+		}
+		if wrapped {
+			for i := range files {
+				files[i].Path = strings.TrimPrefix(files[i].Path, prefix)
+			}
+		}
+	}
+
+	var m manifest
+	var content []byte
+	for _, f := range files {
+		if f.Path == ManifestName {
+			content = f.Content
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("no %s naming the entrypoint, e.g. entrypoint = \"memory_functions_you.cpp\"", ManifestName)
+	}
+	meta, err := toml.Decode(string(content), &m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", ManifestName, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("%s: unknown setting %s", ManifestName, undecoded[0])
+	}
+	switch {
+	case m.Entrypoint == "":
+		return nil, fmt.Errorf("%s: entrypoint must be set", ManifestName)
+	case !entrypointPattern.MatchString(m.Entrypoint):
+		return nil, fmt.Errorf("%s: entrypoint %q must be a memory_functions_*.cpp, .c or .py at the top of the bundle", ManifestName, m.Entrypoint)
+	case !hasFile(files, m.Entrypoint):
+		return nil, fmt.Errorf("%s: entrypoint %s is not in the bundle", ManifestName, m.Entrypoint)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return &Bundle{Entrypoint: m.Entrypoint, Files: files}, nil
+}
+
+func hasFile(files []File, name string) bool {
+	for _, f := range files {
+		if f.Path == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,283 @@
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckPath(t *testing.T) {
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"memory_functions_you.cpp", true},
+		{"lib/helpers.h", true},
+		{"", false},
+		{"../memory_functions_you.cpp", false},
+		{"lib/../../etc/passwd", false},
+		{"lib/../helpers.h", false},
+		{"/etc/passwd", false},
+		{"./manifest.toml", false},
+		{"lib//helpers.h", false},
+		{`lib\helpers.h`, false},
+		{`..\..\evil.cpp`, false},
+	}
+	for _, tt := range tests {
+		err := CheckPath(tt.path)
+		if tt.ok && err != nil {
+			t.Errorf("CheckPath(%q) = %v, want ok", tt.path, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("CheckPath(%q) accepted a path outside the bundle", tt.path)
+		}
+	}
+}
+
+// testFile is one archive entry; a symlink points at target instead of
+// holding content
+type testFile struct {
+	name, content, target string
+}
+
+func tarArchive(t *testing.T, files []testFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content)), Typeflag: tar.TypeReg}
+		if f.target != "" {
+			hdr = &tar.Header{Name: f.name, Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: f.target}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tgzArchive(t *testing.T, files []testFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(tarArchive(t, files)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, files []testFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &zip.FileHeader{Name: f.name, Method: zip.Deflate}
+		content := f.content
+		if f.target != "" {
+			hdr.SetMode(fs.ModeSymlink | 0777)
+			content = f.target
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const (
+	testManifest   = `entrypoint = "memory_functions_you.cpp"`
+	testEntrypoint = "#include \"helpers.h\"\n"
+)
+
+func TestReadArchive(t *testing.T) {
+	limits := Limits{MaxFiles: 4, MaxBytes: 1 << 10}
+	tests := []struct {
+		name    string
+		files   []testFile
+		want    []string // file paths in the bundle
+		wantErr string
+	}{
+		{
+			name: "bundle",
+			files: []testFile{
+				{name: "manifest.toml", content: testManifest},
+				{name: "memory_functions_you.cpp", content: testEntrypoint},
+				{name: "lib/helpers.h", content: "int helper();\n"},
+			},
+			want: []string{"lib/helpers.h", "manifest.toml", "memory_functions_you.cpp"},
+		},
+		{
+			name: "wrapped in a directory",
+			files: []testFile{
+				{name: "you/manifest.toml", content: testManifest},
+				{name: "you/memory_functions_you.cpp", content: testEntrypoint},
+			},
+			want: []string{"manifest.toml", "memory_functions_you.cpp"},
+		},
+		{
+			name: "hidden files left out",
+			files: []testFile{
+				{name: "manifest.toml", content: testManifest},
+				{name: "memory_functions_you.cpp", content: testEntrypoint},
+				{name: "._memory_functions_you.cpp", content: "resource fork"},
+				{name: ".git/config", content: "[core]"},
+			},
+			want: []string{"manifest.toml", "memory_functions_you.cpp"},
+		},
+		{
+			name: "parent directory",
+			files: []testFile{
+				{name: "manifest.toml", content: testManifest},
+				{name: "../memory_functions_you.cpp", content: testEntrypoint},
+			},
+			wantErr: "paths must stay inside the bundle",
+		},
+		{
+			name: "absolute path",
+			files: []testFile{
+				{name: "manifest.toml", content: testManifest},
+				{name: "/tmp/memory_functions_you.cpp", content: testEntrypoint},
+			},
+			wantErr: "paths must stay inside the bundle",
+		},
+		{
+			name: "symlink",
+			files: []testFile{
+				{name: "manifest.toml", content: testManifest},
+				{name: "memory_functions_you.cpp", target: "/etc/passwd"},
+			},
+			wantErr: "only regular files are accepted",
+		},
+		{
+			name: "too many files",
+			files: []testFile{
+				{name: "manifest.toml", content: testManifest},
+				{name: "memory_functions_you.cpp", content: testEntrypoint},
+				{name: "a.h"}, {name: "b.h"}, {name: "c.h"},
+			},
+			wantErr: "more than 4 files",
+		},
+		{
+			name: "too large",
+			files: []testFile{
+				{name: "manifest.toml", content: testManifest},
+				{name: "memory_functions_you.cpp", content: strings.Repeat("x", 1<<10)},
+			},
+			wantErr: "larger than 1024 bytes in total",
+		},
+		{
+			name: "duplicate file",
+			files: []testFile{
+				{name: "manifest.toml", content: testManifest},
+				{name: "memory_functions_you.cpp", content: testEntrypoint},
+				{name: "memory_functions_you.cpp", content: testEntrypoint},
+			},
+			wantErr: "appears twice",
+		},
+		{
+			name:    "no manifest",
+			files:   []testFile{{name: "memory_functions_you.cpp", content: testEntrypoint}},
+			wantErr: "no manifest.toml",
+		},
+		{
+			name: "entrypoint not set",
+			files: []testFile{
+				{name: "manifest.toml", content: "# nothing here\n"},
+				{name: "memory_functions_you.cpp", content: testEntrypoint},
+			},
+			wantErr: "entrypoint must be set",
+		},
+		{
+			name: "entrypoint outside the top",
+			files: []testFile{
+				{name: "manifest.toml", content: `entrypoint = "../memory_functions_you.cpp"`},
+				{name: "memory_functions_you.cpp", content: testEntrypoint},
+			},
+			wantErr: "must be a memory_functions_*.cpp, .c or .py",
+		},
+		{
+			name: "entrypoint in another language",
+			files: []testFile{
+				{name: "manifest.toml", content: `entrypoint = "memory_functions_you.rs"`},
+				{name: "memory_functions_you.rs", content: "fn main() {}\n"},
+			},
+			wantErr: "must be a memory_functions_*.cpp, .c or .py",
+		},
+		{
+			name: "entrypoint missing",
+			files: []testFile{
+				{name: "manifest.toml", content: `entrypoint = "memory_functions_me.cpp"`},
+				{name: "memory_functions_you.cpp", content: testEntrypoint},
+			},
+			wantErr: "entrypoint memory_functions_me.cpp is not in the bundle",
+		},
+		{
+			name: "unknown setting",
+			files: []testFile{
+				{name: "manifest.toml", content: testManifest + "\nlanguage = \"cpp\"\n"},
+				{name: "memory_functions_you.cpp", content: testEntrypoint},
+			},
+			wantErr: "unknown setting language",
+		},
+	}
+
+	formats := []struct {
+		ext  string
+		make func(*testing.T, []testFile) []byte
+	}{
+		{".tar", tarArchive},
+		{".tar.gz", tgzArchive},
+		{".zip", zipArchive},
+	}
+	for _, format := range formats {
+		for _, tt := range tests {
+			t.Run(format.ext+"/"+tt.name, func(t *testing.T) {
+				archive := format.make(t, tt.files)
+				b, err := ReadArchive("you"+format.ext, bytes.NewReader(archive), limits)
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				var paths []string
+				for _, f := range b.Files {
+					paths = append(paths, f.Path)
+				}
+				if b.Entrypoint != "memory_functions_you.cpp" || !reflect.DeepEqual(paths, tt.want) {
+					t.Errorf("bundle has entrypoint %s and files %v, want memory_functions_you.cpp and %v", b.Entrypoint, paths, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestReadArchiveRejectsOtherFormats(t *testing.T) {
+	if _, err := ReadArchive("you.rar", bytes.NewReader(nil), Limits{MaxFiles: 4, MaxBytes: 1 << 10}); err == nil {
+		t.Error("read a .rar as an archive")
+	}
+}
@@ -0,0 +1,493 @@
+// Package config loads the arena's settings from a TOML file, applies
+// BATTLESHIP_* environment overrides on top and validates the result.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// DefaultPath is read when no config file is named; it may be missing
+const DefaultPath = "battleship-arena.toml"
+
+type Config struct {
+	Server  ServerConfig  `toml:"server"`
+	Storage StorageConfig `toml:"storage"`
+	Uploads UploadsConfig `toml:"uploads"`
+	Admin   AdminConfig   `toml:"admin"`
+	Engine  EngineConfig  `toml:"engine"`
+	Sandbox SandboxConfig `toml:"sandbox"`
+	Worker  WorkerConfig  `toml:"worker"`
+	Bots    BotsConfig    `toml:"bots"`
+	Web     WebConfig     `toml:"web"`
+	TUI     TUIConfig     `toml:"tui"`
+	Log     LogConfig     `toml:"log"`
+}
+
+type ServerConfig struct {
+	Host            string   `toml:"host"`
+	SSHPort         string   `toml:"ssh_port"`
+	WebPort         string   `toml:"web_port"`
+	ExternalURL     string   `toml:"external_url"`
+	Registration    string   `toml:"registration"`
+	HostKeyPath     string   `toml:"host_key_path"`
+	ShutdownTimeout Duration `toml:"shutdown_timeout"`
+}
+
+type StorageConfig struct {
+	UploadDir string `toml:"upload_dir"`
+	// ResultsDB is a SQLite file path or a postgres:// URL
+	ResultsDB string `toml:"results_db" secret:"password"`
+}
+
+// UploadsConfig bounds multi-file submissions, uploaded as an archive or a
+// directory
+type UploadsConfig struct {
+	MaxFiles int `toml:"max_files"`
+	// MaxBytes is the most all of a submission's files may hold, uncompressed
+	MaxBytes int `toml:"max_bytes"`
+}
+
+type AdminConfig struct {
+	// Passcode is the deprecated shared admin passcode; empty disables it
+	Passcode string `toml:"passcode" secret:"true"`
+}
+
+type EngineConfig struct {
+	Path          string `toml:"path"`
+	GamesPerMatch int    `toml:"games_per_match"`
+	// Python is the interpreter Python submissions run in
+	Python string `toml:"python"`
+}
+
+// SandboxConfig bounds every systemd-run unit that compiles or runs
+// submitted code
+type SandboxConfig struct {
+	MemoryMax               string   `toml:"memory_max"`
+	CPUQuota                string   `toml:"cpu_quota"`
+	TasksMax                int      `toml:"tasks_max"`
+	CompileTimeout          Duration `toml:"compile_timeout"`
+	MatchCompileTimeout     Duration `toml:"match_compile_timeout"`
+	MatchTimeout            Duration `toml:"match_timeout"`
+	BenchmarkCompileTimeout Duration `toml:"benchmark_compile_timeout"`
+	BenchmarkTimeout        Duration `toml:"benchmark_timeout"`
+}
+
+type WorkerConfig struct {
+	SweepInterval Duration `toml:"sweep_interval"`
+	JobLease      Duration `toml:"job_lease"`
+	JobHeartbeat  Duration `toml:"job_heartbeat"`
+}
+
+type BotsConfig struct {
+	Dir       string             `toml:"dir"`
+	Reference []string           `toml:"reference"`
+	Ratings   map[string]float64 `toml:"ratings"`
+}
+
+type WebConfig struct {
+	LeaderboardSize int `toml:"leaderboard_size"`
+}
+
+type TUIConfig struct {
+	RefreshInterval Duration `toml:"refresh_interval"`
+}
+
+type LogConfig struct {
+	Level  string `toml:"level"`
+	Format string `toml:"format"`
+}
+
+// Duration is a time.Duration written as "90s" or "5m" in the file
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Default is the configuration used for anything the file and environment
+// leave unset
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Host:            "0.0.0.0",
+			SSHPort:         "2222",
+			WebPort:         "8081",
+			ExternalURL:     "http://localhost:8081",
+			Registration:    "open",
+			HostKeyPath:     ".ssh/battleship_arena",
+			ShutdownTimeout: Duration{2 * time.Minute},
+		},
+		Storage: StorageConfig{
+			UploadDir: "./submissions",
+			ResultsDB: "./results.db",
+		},
+		Uploads: UploadsConfig{
+			MaxFiles: 32,
+			MaxBytes: 1 << 20,
+		},
+		Engine: EngineConfig{
+			Path:          "./battleship-engine",
+			GamesPerMatch: 1000,
+			Python:        "python3",
+		},
+		Sandbox: SandboxConfig{
+			MemoryMax:               "512M",
+			CPUQuota:                "200%",
+			TasksMax:                50,
+			CompileTimeout:          Duration{60 * time.Second},
+			MatchCompileTimeout:     Duration{120 * time.Second},
+			MatchTimeout:            Duration{300 * time.Second},
+			BenchmarkCompileTimeout: Duration{120 * time.Second},
+			BenchmarkTimeout:        Duration{300 * time.Second},
+		},
+		Worker: WorkerConfig{
+			SweepInterval: Duration{30 * time.Second},
+			JobLease:      Duration{10 * time.Minute},
+			JobHeartbeat:  Duration{time.Minute},
+		},
+		Bots: BotsConfig{
+			Dir: "./scripts/test-submissions",
+			// The test submissions that anchor the ladder
+			Reference: []string{"random", "hunter", "parity", "probability"},
+			Ratings:   map[string]float64{},
+		},
+		Web: WebConfig{LeaderboardSize: 50},
+		TUI: TUIConfig{RefreshInterval: Duration{5 * time.Second}},
+		Log: LogConfig{Level: "info", Format: "text"},
+	}
+}
+
+// Path is the config file to read: BATTLESHIP_CONFIG, or DefaultPath
+func Path() string {
+	if path := os.Getenv("BATTLESHIP_CONFIG"); path != "" {
+		return path
+	}
+	return DefaultPath
+}
+
+// Load reads the file at path over the defaults, then the environment, and
+// validates the result. A missing file is only an error if it was named
+// explicitly.
+func Load(path string, explicit bool) (Config, error) {
+	cfg := Default()
+
+	var errs []error
+	meta, err := toml.DecodeFile(path, &cfg)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+	case err != nil:
+		return cfg, fmt.Errorf("config %s: %v", path, err)
+	default:
+		// Most likely a typo, which would otherwise silently keep the default
+		for _, key := range meta.Undecoded() {
+			errs = append(errs, fmt.Errorf("%s: unknown setting", key))
+		}
+	}
+
+	errs = append(errs, cfg.applyEnv(os.Getenv)...)
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return cfg, fmt.Errorf("invalid config:\n  %s", strings.Join(errorStrings(errs), "\n  "))
+	}
+	return cfg, nil
+}
+
+func errorStrings(errs []error) []string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return lines
+}
+
+// applyEnv overrides settings from BATTLESHIP_* variables. The original
+// variable names are kept, so existing deployments need no file.
+func (c *Config) applyEnv(getenv func(string) string) []error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v := getenv(name); v != "" {
+			*dst = v
+		}
+	}
+	integer := func(name string, dst *int) {
+		if v := getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a whole number", name, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	duration := func(name string, dst *Duration) {
+		if v := getenv(name); v != "" {
+			if err := dst.UnmarshalText([]byte(v)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a duration like 90s or 5m", name, v))
+			}
+		}
+	}
+
+	str("BATTLESHIP_HOST", &c.Server.Host)
+	str("BATTLESHIP_SSH_PORT", &c.Server.SSHPort)
+	str("BATTLESHIP_WEB_PORT", &c.Server.WebPort)
+	str("BATTLESHIP_EXTERNAL_URL", &c.Server.ExternalURL)
+	str("BATTLESHIP_REGISTRATION", &c.Server.Registration)
+	str("BATTLESHIP_HOST_KEY_PATH", &c.Server.HostKeyPath)
+	duration("BATTLESHIP_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	str("BATTLESHIP_UPLOAD_DIR", &c.Storage.UploadDir)
+	str("BATTLESHIP_RESULTS_DB", &c.Storage.ResultsDB)
+	integer("BATTLESHIP_UPLOAD_MAX_FILES", &c.Uploads.MaxFiles)
+	integer("BATTLESHIP_UPLOAD_MAX_BYTES", &c.Uploads.MaxBytes)
+	str("BATTLESHIP_ADMIN_PASSCODE", &c.Admin.Passcode)
+	str("BATTLESHIP_ENGINE_PATH", &c.Engine.Path)
+	integer("BATTLESHIP_GAMES_PER_MATCH", &c.Engine.GamesPerMatch)
+	str("BATTLESHIP_PYTHON", &c.Engine.Python)
+	str("BATTLESHIP_SANDBOX_MEMORY_MAX", &c.Sandbox.MemoryMax)
+	str("BATTLESHIP_SANDBOX_CPU_QUOTA", &c.Sandbox.CPUQuota)
+	integer("BATTLESHIP_SANDBOX_TASKS_MAX", &c.Sandbox.TasksMax)
+	duration("BATTLESHIP_COMPILE_TIMEOUT", &c.Sandbox.CompileTimeout)
+	duration("BATTLESHIP_MATCH_COMPILE_TIMEOUT", &c.Sandbox.MatchCompileTimeout)
+	duration("BATTLESHIP_MATCH_TIMEOUT", &c.Sandbox.MatchTimeout)
+	duration("BATTLESHIP_BENCHMARK_COMPILE_TIMEOUT", &c.Sandbox.BenchmarkCompileTimeout)
+	duration("BATTLESHIP_BENCHMARK_TIMEOUT", &c.Sandbox.BenchmarkTimeout)
+	duration("BATTLESHIP_SWEEP_INTERVAL", &c.Worker.SweepInterval)
+	duration("BATTLESHIP_JOB_LEASE", &c.Worker.JobLease)
+	duration("BATTLESHIP_JOB_HEARTBEAT", &c.Worker.JobHeartbeat)
+	str("BATTLESHIP_BOTS_DIR", &c.Bots.Dir)
+	if v := getenv("BATTLESHIP_REFERENCE_BOTS"); v != "" {
+		c.Bots.Reference = parseList(v)
+	}
+	if v := getenv("BATTLESHIP_BOT_RATINGS"); v != "" {
+		ratings, err := parseRatings(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("BATTLESHIP_BOT_RATINGS: %v", err))
+		}
+		c.Bots.Ratings = ratings
+	}
+	integer("BATTLESHIP_LEADERBOARD_SIZE", &c.Web.LeaderboardSize)
+	duration("BATTLESHIP_TUI_REFRESH", &c.TUI.RefreshInterval)
+	str("BATTLESHIP_LOG_LEVEL", &c.Log.Level)
+	str("BATTLESHIP_LOG_FORMAT", &c.Log.Format)
+	return errs
+}
+
+// parseList splits a comma separated list; "none" disables it entirely
+func parseList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" && item != "none" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseRatings reads pinned bot ratings in the form "random=1000,hunter=1400"
+func parseRatings(value string) (map[string]float64, error) {
+	ratings := make(map[string]float64)
+	for _, item := range parseList(value) {
+		name, rating, ok := strings.Cut(item, "=")
+		if !ok {
+			return ratings, fmt.Errorf("%q is not name=rating", item)
+		}
+		r, err := strconv.ParseFloat(strings.TrimSpace(rating), 64)
+		if err != nil {
+			return ratings, fmt.Errorf("%q: rating is not a number", item)
+		}
+		ratings[strings.TrimSpace(name)] = r
+	}
+	return ratings, nil
+}
+
+var (
+	memoryPattern = regexp.MustCompile(`^(\d+[KMGT]?|infinity)$`)
+	quotaPattern  = regexp.MustCompile(`^\d+%$`)
+)
+
+// validate reports every problem at once, named by its key in the file
+func (c *Config) validate() []error {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+	port := func(key, value string) {
+		if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+			fail(key, "%q is not a port number", value)
+		}
+	}
+	positive := func(key string, d Duration) {
+		if d.Duration <= 0 {
+			fail(key, "must be longer than zero")
+		}
+	}
+	required := func(key, value string) {
+		if strings.TrimSpace(value) == "" {
+			fail(key, "must be set")
+		}
+	}
+
+	required("server.host", c.Server.Host)
+	port("server.ssh_port", c.Server.SSHPort)
+	port("server.web_port", c.Server.WebPort)
+	if u, err := url.Parse(c.Server.ExternalURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fail("server.external_url", "%q is not an http(s) URL", c.Server.ExternalURL)
+	}
+	switch c.Server.Registration {
+	case "open", "roster", "invite":
+	default:
+		fail("server.registration", "%q must be open, roster or invite", c.Server.Registration)
+	}
+	required("server.host_key_path", c.Server.HostKeyPath)
+	if c.Server.ShutdownTimeout.Duration < 0 {
+		fail("server.shutdown_timeout", "must not be negative")
+	}
+
+	required("storage.upload_dir", c.Storage.UploadDir)
+	required("storage.results_db", c.Storage.ResultsDB)
+
+	// The manifest and the entrypoint are the least a bundle holds
+	if c.Uploads.MaxFiles < 2 {
+		fail("uploads.max_files", "must be at least 2")
+	}
+	if c.Uploads.MaxBytes < 1 {
+		fail("uploads.max_bytes", "must be at least 1")
+	}
+
+	required("engine.path", c.Engine.Path)
+	required("engine.python", c.Engine.Python)
+	if c.Engine.GamesPerMatch < 1 {
+		fail("engine.games_per_match", "must be at least 1")
+	}
+
+	if !memoryPattern.MatchString(c.Sandbox.MemoryMax) {
+		fail("sandbox.memory_max", "%q must be bytes with an optional K/M/G/T suffix, or infinity", c.Sandbox.MemoryMax)
+	}
+	if !quotaPattern.MatchString(c.Sandbox.CPUQuota) {
+		fail("sandbox.cpu_quota", "%q must be a percentage like 200%%", c.Sandbox.CPUQuota)
+	}
+	if c.Sandbox.TasksMax < 1 {
+		fail("sandbox.tasks_max", "must be at least 1")
+	}
+	positive("sandbox.compile_timeout", c.Sandbox.CompileTimeout)
+	positive("sandbox.match_compile_timeout", c.Sandbox.MatchCompileTimeout)
+	positive("sandbox.match_timeout", c.Sandbox.MatchTimeout)
+	positive("sandbox.benchmark_compile_timeout", c.Sandbox.BenchmarkCompileTimeout)
+	positive("sandbox.benchmark_timeout", c.Sandbox.BenchmarkTimeout)
+
+	positive("worker.sweep_interval", c.Worker.SweepInterval)
+	positive("worker.job_heartbeat", c.Worker.JobHeartbeat)
+	if c.Worker.JobLease.Duration <= c.Worker.JobHeartbeat.Duration {
+		fail("worker.job_lease", "must be longer than worker.job_heartbeat (%s), or running jobs lose their lease", c.Worker.JobHeartbeat)
+	}
+
+	for name, rating := range c.Bots.Ratings {
+		if rating <= 0 {
+			fail("bots.ratings."+name, "must be positive")
+		}
+	}
+
+	if c.Web.LeaderboardSize < 1 {
+		fail("web.leaderboard_size", "must be at least 1")
+	}
+	positive("tui.refresh_interval", c.TUI.RefreshInterval)
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		fail("log.level", "%q must be debug, info, warn or error", c.Log.Level)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		fail("log.format", "%q must be text or json", c.Log.Format)
+	}
+	return errs
+}
+
+// Redacted is a copy safe to print: secrets that are set read "REDACTED",
+// as do passwords in database URLs
+func (c Config) Redacted() Config {
+	redactSecrets(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+func redactSecrets(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct && v.Type().Field(i).Type != reflect.TypeOf(Duration{}):
+			redactSecrets(field)
+		case v.Type().Field(i).Tag.Get("secret") == "true" && field.String() != "":
+			field.SetString("REDACTED")
+		case v.Type().Field(i).Tag.Get("secret") == "password":
+			field.SetString(RedactURL(field.String()))
+		}
+	}
+}
+
+// dsnPassword matches the password in a key=value DSN such as
+// "host=db user=arena password='s3 cret'", quoted or not
+var dsnPassword = regexp.MustCompile(`(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|[^\s']\S*)`)
+
+// RedactURL hides the password in a URL such as a postgres:// DSN, including
+// one passed as a query parameter, or in a key=value DSN; anything else is
+// returned as it is
+func RedactURL(s string) string {
+	if u, err := url.Parse(s); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "REDACTED")
+			s = u.String()
+		}
+	}
+	return dsnPassword.ReplaceAllString(s, "${1}REDACTED")
+}
+
+// Encode writes the configuration as TOML
+func (c Config) Encode() (string, error) {
+	var b strings.Builder
+	err := toml.NewEncoder(&b).Encode(c)
+	return b.String(), err
+}
+
+// LogValue logs the redacted configuration as one group per section, keyed
+// like the file
+func (c Config) LogValue() slog.Value {
+	return groupValue(reflect.ValueOf(c.Redacted()))
+}
+
+func groupValue(v reflect.Value) slog.Value {
+	var attrs []slog.Attr
+	for i := 0; i < v.NumField(); i++ {
+		key := strings.Split(v.Type().Field(i).Tag.Get("toml"), ",")[0]
+		field := v.Field(i)
+		switch {
+		case field.Type() == reflect.TypeOf(Duration{}):
+			attrs = append(attrs, slog.String(key, field.Interface().(Duration).String()))
+		case field.Kind() == reflect.Struct:
+			attrs = append(attrs, slog.Attr{Key: key, Value: groupValue(field)})
+		default:
+			attrs = append(attrs, slog.Any(key, field.Interface()))
+		}
+	}
+	return slog.GroupValue(attrs...)
+}
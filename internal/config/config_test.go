@@ -0,0 +1,44 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactURL(t *testing.T) {
+	tests := []struct {
+		name, dsn, want string
+	}{
+		{"sqlite path", "./data/results.db", "./data/results.db"},
+		{"url", "postgres://arena:hunter2@db:5432/arena?sslmode=disable", "postgres://arena:REDACTED@db:5432/arena?sslmode=disable"},
+		{"url without password", "postgres://arena@db/arena", "postgres://arena@db/arena"},
+		{"url query parameter", "postgres://db/arena?user=arena&password=hunter2", "postgres://db/arena?user=arena&password=REDACTED"},
+		{"key=value", "host=db user=arena password=hunter2 dbname=arena", "host=db user=arena password=REDACTED dbname=arena"},
+		{"key = value", "host=db password = hunter2 dbname=arena", "host=db password = REDACTED dbname=arena"},
+		{"quoted", `host=db password='hunter 2' dbname=arena`, "host=db password=REDACTED dbname=arena"},
+		{"escaped quote", `password='it\'s secret' host=db`, "password=REDACTED host=db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactURL(tt.dsn); got != tt.want {
+				t.Errorf("RedactURL(%q) = %q, want %q", tt.dsn, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactedHidesDatabasePassword(t *testing.T) {
+	for _, dsn := range []string{
+		"postgres://arena:hunter2@db/arena",
+		"host=db user=arena password=hunter2",
+	} {
+		var c Config
+		c.Storage.ResultsDB = dsn
+		if got := c.Redacted().Storage.ResultsDB; strings.Contains(got, "hunter2") {
+			t.Errorf("Redacted() shows results_db as %q", got)
+		}
+		if c.Storage.ResultsDB != dsn {
+			t.Errorf("Redacted() changed the original to %q", c.Storage.ResultsDB)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Package logs sets up structured logging for the server and keeps a copy
+// of every line about a submission, so its owner can follow it from upload
+// through compile and matches.
+package logs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"battleship-arena/internal/storage"
+)
+
+// Setup makes slog's default logger, and through it the log package, write
+// at the given level ("debug", "info", "warn" or "error") in the given format
+// ("text" or "json")
+func Setup(level, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown log format %q, want text or json", format)
+	}
+
+	slog.SetDefault(slog.New(&captureHandler{next: handler, submissionID: -1}))
+	return nil
+}
+
+type loggerKey struct{}
+
+// With returns a context carrying a logger with the given attributes added,
+// and that logger
+func With(ctx context.Context, args ...any) (context.Context, *slog.Logger) {
+	logger := FromContext(ctx).With(args...)
+	return context.WithValue(ctx, loggerKey{}, logger), logger
+}
+
+// FromContext returns the logger stored by With, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Lines carrying a submission_id are copied to the submission's log by a
+// background writer, so logging never waits on the database
+var (
+	captureMu   sync.Mutex
+	captureCh   chan storage.SubmissionLogLine
+	captureDone chan struct{}
+)
+
+// StartCapture begins recording submission log lines in the database
+func StartCapture() {
+	captureMu.Lock()
+	defer captureMu.Unlock()
+	if captureCh != nil {
+		return
+	}
+	captureCh = make(chan storage.SubmissionLogLine, 1024)
+	captureDone = make(chan struct{})
+	go writeCaptured(captureCh, captureDone)
+}
+
+// StopCapture writes out any buffered lines and stops recording
+func StopCapture() {
+	captureMu.Lock()
+	ch, done := captureCh, captureDone
+	captureCh = nil
+	captureMu.Unlock()
+	if ch == nil {
+		return
+	}
+	close(ch)
+	<-done
+}
+
+func capture(line storage.SubmissionLogLine) {
+	captureMu.Lock()
+	defer captureMu.Unlock()
+	if captureCh == nil {
+		return
+	}
+	select {
+	case captureCh <- line:
+	default:
+		// Dropping a line beats stalling the worker behind a slow disk
+	}
+}
+
+func writeCaptured(ch <-chan storage.SubmissionLogLine, done chan<- struct{}) {
+	defer close(done)
+	for line := range ch {
+		// Write whatever else is already waiting in the same transaction
+		batch := []storage.SubmissionLogLine{line}
+		for len(batch) < 100 && len(ch) > 0 {
+			next, ok := <-ch
+			if !ok {
+				break
+			}
+			batch = append(batch, next)
+		}
+		if err := storage.AppendSubmissionLogs(batch); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to record %d submission log lines: %v\n", len(batch), err)
+		}
+	}
+}
+
+// captureHandler passes records on to the real handler and copies those
+// about a submission to its log
+type captureHandler struct {
+	next         slog.Handler
+	attrs        []slog.Attr
+	submissionID int // from With, or -1
+}
+
+func (h *captureHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *captureHandler) Handle(ctx context.Context, r slog.Record) error {
+	err := h.next.Handle(ctx, r)
+
+	submissionID := h.submissionID
+	var attrs []slog.Attr
+	r.Attrs(func(a slog.Attr) bool {
+		if id, ok := submissionIDOf(a); ok {
+			submissionID = id
+		} else {
+			attrs = append(attrs, a)
+		}
+		return true
+	})
+	if submissionID >= 0 {
+		capture(storage.SubmissionLogLine{
+			SubmissionID: submissionID,
+			LoggedAt:     r.Time,
+			Level:        r.Level.String(),
+			Line:         formatLine(r.Message, append(append([]slog.Attr(nil), h.attrs...), attrs...)),
+		})
+	}
+	return err
+}
+
+func (h *captureHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := &captureHandler{
+		next:         h.next.WithAttrs(attrs),
+		attrs:        append([]slog.Attr(nil), h.attrs...),
+		submissionID: h.submissionID,
+	}
+	for _, a := range attrs {
+		if id, ok := submissionIDOf(a); ok {
+			next.submissionID = id
+		} else {
+			next.attrs = append(next.attrs, a)
+		}
+	}
+	return next
+}
+
+func (h *captureHandler) WithGroup(name string) slog.Handler {
+	return &captureHandler{next: h.next.WithGroup(name), attrs: h.attrs, submissionID: h.submissionID}
+}
+
+func submissionIDOf(a slog.Attr) (int, bool) {
+	if a.Key != "submission_id" {
+		return 0, false
+	}
+	switch v := a.Value.Resolve(); v.Kind() {
+	case slog.KindInt64:
+		return int(v.Int64()), true
+	case slog.KindString:
+		id, err := strconv.Atoi(v.String())
+		return id, err == nil
+	}
+	return 0, false
+}
+
+// formatLine renders a captured record for its owner: the message and its
+// attributes, minus the user they already know
+func formatLine(msg string, attrs []slog.Attr) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, a := range attrs {
+		if a.Key == "user" {
+			continue
+		}
+		value := a.Value.Resolve().String()
+		if value == "" || strings.ContainsAny(value, " \"=\n") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %s=%s", a.Key, value)
+	}
+	return b.String()
+}
+
+// Since is a convenience for logging durations rounded for people
+func Since(start time.Time) slog.Attr {
+	return slog.Duration("duration", time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,226 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"battleship-arena/internal/logs"
+	"battleship-arena/internal/storage"
+)
+
+// BoardSetVersion names the fixed set of seeded boards every submission is
+// benchmarked on. Bump it whenever BenchmarkBoards or the seeding scheme in
+// generateBenchmarkMain changes; the worker re-benchmarks every active
+// submission that has no result for the current version. The version itself
+// lives in storage, which shows only results on the current set.
+const BoardSetVersion = storage.BoardSetVersion
+
+// BenchmarkBoards is the number of boards in the shared set (seeds 1..N)
+const BenchmarkBoards = 500
+
+type BenchmarkResult struct {
+	Boards     int
+	TotalShots int
+	MinShots   int
+	MaxShots   int
+}
+
+func (r BenchmarkResult) AvgShots() float64 {
+	if r.Boards == 0 {
+		return 0
+	}
+	return float64(r.TotalShots) / float64(r.Boards)
+}
+
+// RunBenchmark plays a compiled submission solo against every board in the
+// shared set and records how many shots it needed to sink all ships
+func RunBenchmark(ctx context.Context, sub storage.Submission) error {
+	driver, prefix, err := detectLanguage(sub.Filename)
+	if err != nil {
+		return err
+	}
+
+	arena, err := arenaFor(sub)
+	if err != nil {
+		return err
+	}
+	engine := engineDir(arena)
+
+	srcPath, sources, err := sourcePaths(engine, sub)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(srcPath)
+	if err != nil {
+		return err
+	}
+
+	suffix, err := driver.FunctionSuffix(prefix, content)
+	if err != nil {
+		return fmt.Errorf("failed to parse function names: %v", err)
+	}
+
+	buildDir := filepath.Join(engine, "build")
+	binary := filepath.Join(buildDir, "bench_"+prefix)
+	mainPath := filepath.Join(engine, "src", fmt.Sprintf("bench_%s.cpp", prefix))
+	if err := os.WriteFile(mainPath, []byte(generateBenchmarkMain(prefix, suffix)), 0644); err != nil {
+		return err
+	}
+
+	compileArgs := []string{
+		"g++", "-std=c++11", "-O3",
+		"-I", filepath.Join(engine, "src"),
+		"-o", binary,
+		mainPath,
+		filepath.Join(engine, "src", "battleship_light.cpp"),
+	}
+	compileArgs = append(compileArgs, driver.HarnessArgs(engine, prefix, sources)...)
+	output, err := runSandboxed(ctx, "compile-bench-"+prefix, compileArgs, sandbox.BenchmarkCompileTimeout.Duration)
+	if err != nil {
+		return fmt.Errorf("benchmark compilation failed: %s", output)
+	}
+
+	output, err = runSandboxed(ctx, "run-bench-"+prefix, []string{binary, strconv.Itoa(BenchmarkBoards)}, sandbox.BenchmarkTimeout.Duration)
+	if err != nil {
+		return fmt.Errorf("benchmark execution failed: %v\n%s", err, output)
+	}
+
+	result := parseBenchmarkOutput(string(output))
+	if result.Boards == 0 {
+		return fmt.Errorf("benchmark produced no results: %s", output)
+	}
+
+	logs.FromContext(ctx).Info("benchmarked", "avg_shots", fmt.Sprintf("%.2f", result.AvgShots()), "boards", result.Boards, "min_shots", result.MinShots, "max_shots", result.MaxShots)
+	return storage.SaveBenchmark(sub.ID, BoardSetVersion, result.Boards, result.AvgShots(), result.MinShots, result.MaxShots)
+}
+
+// BenchmarkStaleSubmissions queues a benchmark for every active submission
+// that has no result for the current board set. A benchmark that was
+// dead-lettered is not queued again; retry it with "jobs retry".
+func BenchmarkStaleSubmissions() error {
+	submissions, err := storage.GetSubmissionsNeedingBenchmark(BoardSetVersion)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range submissions {
+		if err := enqueueBenchmark(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueueBenchmark queues a submission's benchmark on the current board set
+// unless it has already been run or given up on
+func enqueueBenchmark(sub storage.Submission) error {
+	key := storage.BenchmarkJobKey(sub.ID, BoardSetVersion)
+	queued, err := storage.HasJob(key)
+	if err != nil || queued {
+		return err
+	}
+	_, err = storage.EnqueueJob(storage.JobBenchmark, key, storage.CompilePayload{SubmissionID: sub.ID})
+	return err
+}
+
+func generateBenchmarkMain(prefix, suffix string) string {
+	return fmt.Sprintf(`#include "battleship_light.h"
+#include "memory.h"
+#include "memory_functions_%s.h"
+#include <iostream>
+#include <cstdlib>
+
+using namespace std;
+
+struct BenchmarkStats {
+    int boards = 0;
+    long long totalShots = 0;
+    int minShots = 999999;
+    int maxShots = 0;
+};
+
+// Plays one board to completion. The board layout depends only on the seed,
+// so every submission faces exactly the same fleet placements.
+int playBoard(unsigned int seed) {
+    srand(seed);
+
+    Board board;
+    ComputerMemory memory;
+    initializeBoard(board);
+    initMemory%s(memory);
+
+    int shipsSunk = 0;
+    int shots = 0;
+
+    while (shipsSunk < 5) {
+        shots++;
+
+        string move = smartMove%s(memory);
+        int row, col;
+        int check = checkMove(move, board, row, col);
+        while (check != VALID_MOVE) {
+            move = randomMove();
+            check = checkMove(move, board, row, col);
+        }
+
+        int result = playMove(row, col, board);
+        updateMemory%s(row, col, result, memory);
+
+        if (isASunk(result)) shipsSunk++;
+    }
+
+    return shots;
+}
+
+int main(int argc, char* argv[]) {
+    if (argc < 2) {
+        cerr << "Usage: " << argv[0] << " <num_boards>" << endl;
+        return 1;
+    }
+
+    int numBoards = atoi(argv[1]);
+    if (numBoards <= 0) numBoards = 100;
+
+    setDebugMode(false);
+
+    BenchmarkStats stats;
+    for (int seed = 1; seed <= numBoards; seed++) {
+        int shots = playBoard(seed);
+        stats.boards++;
+        stats.totalShots += shots;
+        if (shots < stats.minShots) stats.minShots = shots;
+        if (shots > stats.maxShots) stats.maxShots = shots;
+    }
+
+    cout << "BENCH_BOARDS=" << stats.boards << endl;
+    cout << "BENCH_TOTAL_SHOTS=" << stats.totalShots << endl;
+    cout << "BENCH_MIN_SHOTS=" << stats.minShots << endl;
+    cout << "BENCH_MAX_SHOTS=" << stats.maxShots << endl;
+
+    return 0;
+}
+`, prefix, suffix, suffix, suffix)
+}
+
+func parseBenchmarkOutput(output string) BenchmarkResult {
+	var result BenchmarkResult
+
+	lines := strings.Split(output, "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, "BENCH_BOARDS=") {
+			fmt.Sscanf(line, "BENCH_BOARDS=%d", &result.Boards)
+		} else if strings.HasPrefix(line, "BENCH_TOTAL_SHOTS=") {
+			fmt.Sscanf(line, "BENCH_TOTAL_SHOTS=%d", &result.TotalShots)
+		} else if strings.HasPrefix(line, "BENCH_MIN_SHOTS=") {
+			fmt.Sscanf(line, "BENCH_MIN_SHOTS=%d", &result.MinShots)
+		} else if strings.HasPrefix(line, "BENCH_MAX_SHOTS=") {
+			fmt.Sscanf(line, "BENCH_MAX_SHOTS=%d", &result.MaxShots)
+		}
+	}
+
+	return result
+}
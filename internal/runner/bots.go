@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"battleship-arena/internal/storage"
+)
+
+// BotUsername is the reserved, system-owned username for a reference bot
+func BotUsername(name string) string {
+	return storage.BotUsernamePrefix + name
+}
+
+// SeedReferenceBots makes sure every reference bot has a registered user and
+// an active submission built from memory_functions_<name>.cpp in botsDir.
+// A bot is only re-submitted when its source changes, so restarts don't
+// throw away its matches. pinned maps bot names to a fixed rating.
+// Bots play in the default arena only.
+func SeedReferenceBots(botsDir, uploadDir string, names []string, pinned map[string]float64) error {
+	arena, err := storage.GetDefaultArena()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		srcPath := filepath.Join(botsDir, fmt.Sprintf("memory_functions_%s.cpp", name))
+		content, err := os.ReadFile(srcPath)
+		if err != nil {
+			return fmt.Errorf("reference bot %s: %v", name, err)
+		}
+
+		username := BotUsername(name)
+		if err := storage.RegisterReferenceBot(username, filepath.Base(srcPath), pinned[name]); err != nil {
+			return fmt.Errorf("reference bot %s: %v", name, err)
+		}
+
+		// Bots get their own filename prefix so they never collide with a
+		// student's upload of the same test submission in engine/src. The test
+		// submissions don't include their generated header, so add it here.
+		filename := fmt.Sprintf("memory_functions_bot_%s.cpp", name)
+		content = append([]byte(fmt.Sprintf("#include \"memory_functions_bot_%s.h\"\n", name)), content...)
+		userDir := arena.UserDir(uploadDir, username)
+		dstPath := filepath.Join(userDir, filename)
+
+		if existing, err := os.ReadFile(dstPath); err == nil && bytes.Equal(existing, content) && hasActiveSubmission(arena.ID, username) {
+			continue
+		}
+
+		if err := os.MkdirAll(userDir, 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dstPath, content, 0644); err != nil {
+			return err
+		}
+
+		submissionID, err := storage.AddUpload(uploadDir, arena, username, filename)
+		if err != nil {
+			return fmt.Errorf("reference bot %s: %v", name, err)
+		}
+		slog.Info("queued reference bot", "submission_id", submissionID, "user", username)
+	}
+
+	// Pins may have changed even if no source did
+	return storage.RecalculateAllGlicko2Ratings()
+}
+
+func hasActiveSubmission(arenaID int, username string) bool {
+	submissions, err := storage.GetUserSubmissions(username)
+	if err != nil {
+		return false
+	}
+	for _, sub := range submissions {
+		if sub.IsActive && sub.ArenaID == arenaID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package runner
+
+import (
+	"battleship-arena/internal/config"
+)
+
+// Sandbox limits, timeouts and worker intervals, from the config file
+var (
+	enginePath     = config.Default().Engine.Path
+	pythonPath     = config.Default().Engine.Python
+	sandbox        = config.Default().Sandbox
+	workerSettings = config.Default().Worker
+)
+
+// Configure applies the engine, sandbox and worker settings; call it before
+// StartWorker
+func Configure(cfg config.Config) {
+	enginePath = cfg.Engine.Path
+	pythonPath = cfg.Engine.Python
+	sandbox = cfg.Sandbox
+	workerSettings = cfg.Worker
+}
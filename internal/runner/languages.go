@@ -0,0 +1,320 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// LanguageDriver builds the submissions written in one language. The match
+// and benchmark harnesses are C++ and call each player's initMemory,
+// smartMove and updateMemory through the header generated for it, so a
+// driver's job is to make those calls reach the submission.
+type LanguageDriver interface {
+	// Name is the language as players know it
+	Name() string
+	// Extension is the file extension of the entrypoint and of every other
+	// source the driver builds
+	Extension() string
+	// FunctionSuffix names the harness's functions for a submission, from
+	// its entrypoint's source
+	FunctionSuffix(prefix string, entrypoint []byte) (string, error)
+	// WriteBindings writes whatever else the harness needs to call the
+	// submission, such as glue code, into the engine's src directory
+	WriteBindings(engine, prefix, suffix, entrypoint string) error
+	// CompileCommand checks that a submission builds
+	CompileCommand(engine, prefix, entrypoint string, sources []string) []string
+	// HarnessArgs are added to the g++ command that builds a match or
+	// benchmark binary with the submission in it
+	HarnessArgs(engine, prefix string, sources []string) []string
+}
+
+// languageDrivers are the languages submissions may be written in
+var languageDrivers = []LanguageDriver{cppDriver{}, cDriver{}, pythonDriver{}}
+
+var submissionName = regexp.MustCompile(`^memory_functions_(\w+)(\.\w+)$`)
+
+// detectLanguage picks the driver for a submission from its entrypoint's
+// name and returns the name's prefix, which names everything generated for it
+func detectLanguage(filename string) (LanguageDriver, string, error) {
+	matches := submissionName.FindStringSubmatch(filename)
+	if matches == nil {
+		return nil, "", fmt.Errorf("invalid filename format")
+	}
+	for _, driver := range languageDrivers {
+		if driver.Extension() == matches[2] {
+			return driver, matches[1], nil
+		}
+	}
+	return nil, "", fmt.Errorf("%s: no language is built from %s files", filename, matches[2])
+}
+
+// writeGenerated writes a generated file unless it is already there. The
+// file is renamed into place, so a build running alongside never reads it
+// half written.
+func writeGenerated(path string, content []byte) error {
+	if existing, err := os.ReadFile(path); err == nil && string(existing) == string(content) {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// bindingPath is where the glue between the harness and a submission in
+// another language is generated
+func bindingPath(engine, prefix string) string {
+	return filepath.Join(engine, "src", fmt.Sprintf("memory_functions_%s_binding.cpp", prefix))
+}
+
+// cppDriver builds C++ submissions, which the harness calls directly
+type cppDriver struct{}
+
+func (cppDriver) Name() string      { return "C++" }
+func (cppDriver) Extension() string { return ".cpp" }
+
+func (cppDriver) FunctionSuffix(prefix string, entrypoint []byte) (string, error) {
+	return parseFunctionNames(string(entrypoint))
+}
+
+func (cppDriver) WriteBindings(engine, prefix, suffix, entrypoint string) error {
+	return nil
+}
+
+func (cppDriver) CompileCommand(engine, prefix, entrypoint string, sources []string) []string {
+	args := []string{"g++", "-std=c++11", "-c", "-O3"}
+	if len(sources) > 1 {
+		// A multi-file submission's sources are linked into one object
+		args = []string{"g++", "-std=c++11", "-r", "-nostdlib", "-O3"}
+	}
+	args = append(args,
+		"-I", filepath.Join(engine, "src"),
+		"-o", filepath.Join(engine, "build", "ai_"+prefix+".o"),
+	)
+	return append(args, sources...)
+}
+
+func (cppDriver) HarnessArgs(engine, prefix string, sources []string) []string {
+	return sources
+}
+
+// cDriver builds C submissions. Players include the generated memory_c.h,
+// which declares ComputerMemory and the engine's constants for C, and write
+//
+//	void initMemoryX(ComputerMemory *memory);
+//	const char *smartMoveX(const ComputerMemory *memory);
+//	void updateMemoryX(int row, int col, int result, ComputerMemory *memory);
+//
+// A generated C++ binding gives the harness the functions it calls.
+type cDriver struct{}
+
+func (cDriver) Name() string      { return "C" }
+func (cDriver) Extension() string { return ".c" }
+
+func (cDriver) FunctionSuffix(prefix string, entrypoint []byte) (string, error) {
+	return parseFunctionNames(string(entrypoint))
+}
+
+func (cDriver) WriteBindings(engine, prefix, suffix, entrypoint string) error {
+	if err := writeGenerated(filepath.Join(engine, "src", "memory_c.h"), []byte(generateCHeader())); err != nil {
+		return err
+	}
+	return writeGenerated(bindingPath(engine, prefix), []byte(generateCBinding(prefix, suffix)))
+}
+
+func (d cDriver) CompileCommand(engine, prefix, entrypoint string, sources []string) []string {
+	// The binding is compiled too, so a memory.h the C view no longer
+	// matches fails here rather than in every match
+	args := []string{"g++", "-r", "-nostdlib", "-O3",
+		"-I", filepath.Join(engine, "src"),
+		"-o", filepath.Join(engine, "build", "ai_"+prefix+".o"),
+	}
+	return append(args, d.HarnessArgs(engine, prefix, sources)...)
+}
+
+func (cDriver) HarnessArgs(engine, prefix string, sources []string) []string {
+	// g++ goes back to C++ for a .c file after the first, so every
+	// source needs its own -x c
+	var args []string
+	for _, source := range sources {
+		args = append(args, "-x", "c", source)
+	}
+	return append(args, "-x", "none", bindingPath(engine, prefix))
+}
+
+// memoryField is one field of ComputerMemory, as declared in memory.h. The
+// C view and the Python bindings are generated from these, and the
+// generated code checks every offset against the real struct.
+type memoryField struct {
+	name string
+	char bool
+	dims []int
+}
+
+var memoryFields = []memoryField{
+	{name: "hitRow"},
+	{name: "hitCol"},
+	{name: "hitShip"},
+	{name: "fireDir"},
+	{name: "fireDist"},
+	{name: "lastResult"},
+	{name: "mode"},
+	{name: "grid", char: true, dims: []int{10, 10}},
+	{name: "depth"},
+	{name: "hitRows", dims: []int{5}},
+	{name: "hitCols", dims: []int{5}},
+	{name: "hitShips", dims: []int{5}},
+	{name: "fireDirs", dims: []int{5}},
+	{name: "fireDists", dims: []int{5}},
+	{name: "lastResults", dims: []int{5}},
+	{name: "modes", dims: []int{5}},
+}
+
+func (f memoryField) size() int {
+	n := 4
+	if f.char {
+		n = 1
+	}
+	for _, d := range f.dims {
+		n *= d
+	}
+	return n
+}
+
+// memoryLayout returns each field's offset in ComputerMemory and its size,
+// laid out the way gcc lays out a struct of ints and chars
+func memoryLayout() ([]int, int) {
+	align := func(n int) int { return (n + 3) &^ 3 }
+	offsets := make([]int, len(memoryFields))
+	offset := 0
+	for i, f := range memoryFields {
+		if !f.char {
+			offset = align(offset)
+		}
+		offsets[i] = offset
+		offset += f.size()
+	}
+	return offsets, align(offset)
+}
+
+// layoutAsserts fails a binding's compile if memory.h has changed from
+// memoryFields
+func layoutAsserts() string {
+	var b strings.Builder
+	offsets, size := memoryLayout()
+	for i, f := range memoryFields {
+		fmt.Fprintf(&b, "static_assert(offsetof(ComputerMemory, %s) == %d, \"ComputerMemory in memory.h has changed\");\n", f.name, offsets[i])
+	}
+	fmt.Fprintf(&b, "static_assert(sizeof(ComputerMemory) == %d, \"ComputerMemory in memory.h has changed\");\n", size)
+	return b.String()
+}
+
+// forEachElement repeats a C statement for every element of a field, with
+// %s standing for the element
+func (f memoryField) forEachElement(stmt string) string {
+	index := "memory." + f.name
+	var loops, indent string
+	for i, d := range f.dims {
+		v := string(rune('i' + i))
+		loops += fmt.Sprintf("%s    for (int %s = 0; %s < %d; %s++)\n", indent, v, v, d, v)
+		index += "[" + v + "]"
+		indent += "    "
+	}
+	return loops + indent + "    " + fmt.Sprintf(stmt, index) + "\n"
+}
+
+// engineConstants are the constants of kasbs.h and memory.h players use
+var engineConstants = []struct {
+	name  string
+	value string
+}{
+	{"BOARDSIZE", "10"},
+	{"HORZ", "0"}, {"VERT", "1"},
+	{"AC", "1"}, {"BS", "2"}, {"CR", "3"}, {"SB", "4"}, {"DS", "5"},
+	{"AC_SIZE", "5"}, {"BS_SIZE", "4"}, {"CR_SIZE", "3"}, {"SB_SIZE", "3"}, {"DS_SIZE", "2"},
+	{"HIT_MARKER", "'H'"}, {"MISS_MARKER", "'*'"}, {"SUNK_MARKER", "'X'"}, {"EMPTY_MARKER", "' '"},
+	{"AC_MARKER", "'A'"}, {"BS_MARKER", "'B'"}, {"CR_MARKER", "'C'"}, {"SB_MARKER", "'S'"}, {"DS_MARKER", "'D'"},
+	{"MISS", "0"}, {"SHIP", "7"}, {"HIT", "8"}, {"SUNK", "16"},
+	{"RANDOM", "1"}, {"SEARCH", "2"}, {"DESTROY", "3"},
+	{"NONE", "0"}, {"NORTH", "1"}, {"SOUTH", "2"}, {"EAST", "3"}, {"WEST", "4"},
+}
+
+// generateCHeader is memory_c.h, the C view of kasbs.h and memory.h
+func generateCHeader() string {
+	var b strings.Builder
+	b.WriteString(`/* Generated by battleship-arena: ComputerMemory and the engine's constants
+ * for submissions written in C. */
+#ifndef MEMORY_C_H
+#define MEMORY_C_H
+
+`)
+	for _, c := range engineConstants {
+		fmt.Fprintf(&b, "#define %-13s %s\n", c.name, c.value)
+	}
+	b.WriteString("\ntypedef struct ComputerMemory {\n")
+	for _, f := range memoryFields {
+		typ := "int "
+		if f.char {
+			typ = "char"
+		}
+		dims := ""
+		for _, d := range f.dims {
+			dims += fmt.Sprintf("[%d]", d)
+		}
+		fmt.Fprintf(&b, "\t%s %s%s;\n", typ, f.name, dims)
+	}
+	b.WriteString(`} ComputerMemory;
+
+/* Read the result playMove gave a shot */
+static inline int isAMiss(int result) { return !(result & HIT); }
+static inline int isAHit(int result)  { return (result & HIT) != 0; }
+static inline int isASunk(int result) { return (result & SUNK) != 0; }
+static inline int isShip(int result)  { return result & SHIP; }
+
+#endif /* MEMORY_C_H */
+`)
+	return b.String()
+}
+
+// generateCBinding gives the harness C++ functions calling a C submission's
+func generateCBinding(prefix, suffix string) string {
+	return fmt.Sprintf(`// Generated by battleship-arena: calls the C submission memory_functions_%[1]s.c
+#include "memory_functions_%[1]s.h"
+#include <cstddef>
+
+%[3]s
+extern "C" {
+void initMemory%[2]s(ComputerMemory *memory);
+const char *smartMove%[2]s(const ComputerMemory *memory);
+void updateMemory%[2]s(int row, int col, int result, ComputerMemory *memory);
+}
+
+void initMemory%[2]s(ComputerMemory &memory) {
+    initMemory%[2]s(&memory);
+}
+
+std::string smartMove%[2]s(const ComputerMemory &memory) {
+    const char *move = smartMove%[2]s(&memory);
+    return move ? move : "";
+}
+
+void updateMemory%[2]s(int row, int col, int result, ComputerMemory &memory) {
+    updateMemory%[2]s(row, col, result, &memory);
+}
+`, prefix, suffix, layoutAsserts())
+}
@@ -0,0 +1,258 @@
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testEngine copies the engine's headers into a scratch engine directory
+func testEngine(t *testing.T) string {
+	t.Helper()
+	engine := t.TempDir()
+	for _, dir := range []string{"src", "build"} {
+		if err := os.MkdirAll(filepath.Join(engine, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"kasbs.h", "memory.h", "battleship_light.h"} {
+		content, err := os.ReadFile(filepath.Join("..", "..", "battleship-engine", "src", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(engine, "src", name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return engine
+}
+
+func needTool(t *testing.T, name string) string {
+	t.Helper()
+	path, err := exec.LookPath(name)
+	if err != nil {
+		t.Skipf("%s is not installed", name)
+	}
+	return path
+}
+
+// stage writes a player's entrypoint and everything its driver generates
+// for it, the way writeSources does, and returns its driver, prefix and
+// function suffix
+func stage(t *testing.T, engine, filename, source string) (LanguageDriver, string, string) {
+	t.Helper()
+	driver, prefix, err := detectLanguage(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entrypoint := filepath.Join(engine, "src", filename)
+	if err := os.WriteFile(entrypoint, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	suffix, err := driver.FunctionSuffix(prefix, []byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := "memory_functions_" + prefix + ".h"
+	if err := os.WriteFile(filepath.Join(engine, "src", header), []byte(generateHeader(header, suffix)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.WriteBindings(engine, prefix, suffix, entrypoint); err != nil {
+		t.Fatal(err)
+	}
+	return driver, prefix, suffix
+}
+
+// playerMain drives a player through the calls a match makes and prints
+// what it answered and remembered
+func playerMain(prefix, suffix string) string {
+	return strings.NewReplacer("PREFIX", prefix, "SUFFIX", suffix).Replace(`#include "memory_functions_PREFIX.h"
+#include <iostream>
+
+int main() {
+    ComputerMemory memory;
+    initMemorySUFFIX(memory);
+    std::cout << smartMoveSUFFIX(memory) << " " << memory.mode << "\n";
+    updateMemorySUFFIX(3, 4, HIT, memory);
+    std::cout << smartMoveSUFFIX(memory) << " " << memory.mode << " " << memory.hitRow << " "
+              << memory.hitCol << " " << memory.grid[3][4] << memory.grid[9][9] << " " << memory.modes[4] << "\n";
+    return 0;
+}
+`)
+}
+
+// buildAndRun compiles playerMain with the driver's harness arguments, as a
+// match binary is built, and returns what it printed
+func buildAndRun(t *testing.T, engine string, driver LanguageDriver, prefix, suffix, entrypoint string) string {
+	t.Helper()
+	mainPath := filepath.Join(engine, "src", "main_"+prefix+".cpp")
+	if err := os.WriteFile(mainPath, []byte(playerMain(prefix, suffix)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(engine, "build", "player_"+prefix)
+	args := []string{"-std=c++11", "-I", filepath.Join(engine, "src"), "-o", binary, mainPath}
+	args = append(args, driver.HarnessArgs(engine, prefix, []string{entrypoint})...)
+	if output, err := exec.Command("g++", args...).CombinedOutput(); err != nil {
+		t.Fatalf("building the harness: %v\n%s", err, output)
+	}
+	output, err := exec.Command(binary).Output()
+	if err != nil {
+		t.Fatalf("running the harness: %v", err)
+	}
+	return string(output)
+}
+
+// Both players remember the hit they're told about, mark it on the grid and
+// aim next to it, so the second line shows memory surviving each call
+const wantPlayerOutput = "A1 2\nD6 3 3 4 H  7\n"
+
+const cPlayer = `#include "memory_c.h"
+#include <stdio.h>
+
+void initMemoryCTest(ComputerMemory *memory) {
+    memory->mode = SEARCH;
+    for (int row = 0; row < BOARDSIZE; row++)
+        for (int col = 0; col < BOARDSIZE; col++)
+            memory->grid[row][col] = EMPTY_MARKER;
+}
+
+const char *smartMoveCTest(const ComputerMemory *memory) {
+    static char move[4];
+    if (memory->mode != DESTROY)
+        return "A1";
+    snprintf(move, sizeof move, "%c%d", 'A' + memory->hitRow, memory->hitCol + 2);
+    return move;
+}
+
+void updateMemoryCTest(int row, int col, int result, ComputerMemory *memory) {
+    if (isAHit(result)) {
+        memory->mode = DESTROY;
+        memory->hitRow = row;
+        memory->hitCol = col;
+        memory->grid[row][col] = HIT_MARKER;
+        memory->modes[4] = 7;
+    }
+}
+`
+
+func TestCDriver(t *testing.T) {
+	needTool(t, "g++")
+	engine := testEngine(t)
+	driver, prefix, suffix := stage(t, engine, "memory_functions_ctest.c", cPlayer)
+
+	entrypoint := filepath.Join(engine, "src", "memory_functions_ctest.c")
+	compile := driver.CompileCommand(engine, prefix, entrypoint, []string{entrypoint})
+	if output, err := exec.Command(compile[0], compile[1:]...).CombinedOutput(); err != nil {
+		t.Fatalf("%s: %v\n%s", strings.Join(compile, " "), err, output)
+	}
+
+	if got := buildAndRun(t, engine, driver, prefix, suffix, entrypoint); got != wantPlayerOutput {
+		t.Errorf("C player answered\n%q\nwant\n%q", got, wantPlayerOutput)
+	}
+}
+
+const pythonPlayer = `from memory import *
+
+
+def initMemory(memory):
+    memory.mode = SEARCH
+
+
+def smartMove(memory):
+    if memory.mode != DESTROY:
+        return "A1"
+    return "%s%d" % (chr(ord("A") + memory.hitRow), memory.hitCol + 2)
+
+
+def updateMemory(row, col, result, memory):
+    print("debug output goes to stderr")
+    if isAHit(result):
+        memory.mode = DESTROY
+        memory.hitRow = row
+        memory.hitCol = col
+        memory.grid[row][col] = HIT_MARKER
+        memory.modes[4] = 7
+`
+
+// usePython runs Python players in the python3 on PATH for the rest of the
+// test
+func usePython(t *testing.T) {
+	t.Helper()
+	configured := pythonPath
+	pythonPath = needTool(t, "python3")
+	t.Cleanup(func() { pythonPath = configured })
+}
+
+func TestPythonDriver(t *testing.T) {
+	needTool(t, "g++")
+	usePython(t)
+	engine := testEngine(t)
+	driver, prefix, suffix := stage(t, engine, "memory_functions_pytest.py", pythonPlayer)
+
+	entrypoint := filepath.Join(engine, "src", "memory_functions_pytest.py")
+	check := driver.CompileCommand(engine, prefix, entrypoint, []string{entrypoint})
+	output, err := exec.Command(check[0], check[1:]...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", strings.Join(check, " "), err, output)
+	}
+	if !strings.Contains(string(output), "first move A1") {
+		t.Errorf("--check printed %q", output)
+	}
+
+	if got := buildAndRun(t, engine, driver, prefix, suffix, entrypoint); got != wantPlayerOutput {
+		t.Errorf("Python player answered\n%q\nwant\n%q", got, wantPlayerOutput)
+	}
+}
+
+func TestPythonCheckRejectsIncompletePlayer(t *testing.T) {
+	usePython(t)
+	engine := testEngine(t)
+	source := strings.Replace(pythonPlayer, "def updateMemory", "def updateMemoryMisspelled", 1)
+	driver, prefix, _ := stage(t, engine, "memory_functions_broken.py", source)
+
+	entrypoint := filepath.Join(engine, "src", "memory_functions_broken.py")
+	check := driver.CompileCommand(engine, prefix, entrypoint, []string{entrypoint})
+	output, err := exec.Command(check[0], check[1:]...).CombinedOutput()
+	if err == nil {
+		t.Fatal("--check accepted a player without updateMemory")
+	}
+	if !strings.Contains(string(output), "does not define updateMemory()") {
+		t.Errorf("--check printed %q", output)
+	}
+}
+
+func TestBindingsCatchChangedMemoryLayout(t *testing.T) {
+	needTool(t, "g++")
+	engine := testEngine(t)
+
+	memoryH := filepath.Join(engine, "src", "memory.h")
+	content, err := os.ReadFile(memoryH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := strings.Replace(string(content), "int  depth;", "int  depth;\n\tint  shotsFired;", 1)
+	if changed == string(content) {
+		t.Fatal("memory.h no longer declares depth where the test expects it")
+	}
+	if err := os.WriteFile(memoryH, []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filename := range []string{"memory_functions_ctest.c", "memory_functions_pytest.py"} {
+		source := cPlayer
+		if strings.HasSuffix(filename, ".py") {
+			source = pythonPlayer
+		}
+		_, prefix, _ := stage(t, engine, filename, source)
+		output, err := exec.Command("g++", "-std=c++11", "-fsyntax-only", "-I", filepath.Join(engine, "src"), bindingPath(engine, prefix)).CombinedOutput()
+		if err == nil {
+			t.Errorf("%s binding compiled against a changed ComputerMemory", filename)
+			continue
+		}
+		if !strings.Contains(string(output), "ComputerMemory in memory.h has changed") {
+			t.Errorf("%s binding failed for another reason:\n%s", filename, output)
+		}
+	}
+}
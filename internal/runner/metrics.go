@@ -0,0 +1,33 @@
+package runner
+
+import "battleship-arena/internal/metrics"
+
+var (
+	compileDuration = metrics.NewHistogram(
+		"battleship_compile_duration_seconds",
+		"Time to compile a submission in the sandbox",
+		[]float64{0.5, 1, 2, 5, 10, 20, 30, 60},
+	)
+	compileFailures = metrics.NewCounter(
+		"battleship_compile_failures_total",
+		"Submissions that failed to compile",
+	)
+	matchDuration = metrics.NewHistogram(
+		"battleship_match_duration_seconds",
+		"Time to build and play a head-to-head match, by kind",
+		[]float64{1, 2, 5, 10, 20, 30, 60, 120, 300},
+		"kind",
+	)
+	gamesPlayed = metrics.NewCounter(
+		"battleship_games_played_total",
+		"Games played in head-to-head matches",
+	)
+	gamesPerSecond = metrics.NewGauge(
+		"battleship_games_per_second",
+		"Games per second in the most recent head-to-head match",
+	)
+	sandboxTimeouts = metrics.NewCounter(
+		"battleship_sandbox_timeouts_total",
+		"Sandboxed commands killed for running past their time limit",
+	)
+)
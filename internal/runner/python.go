@@ -0,0 +1,364 @@
+package runner
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// pythonDriver runs Python submissions in an interpreter of their own,
+// started by a generated C++ binding the first time the harness calls the
+// player. Players write
+//
+//	from memory import *
+//
+//	def initMemory(memory): ...
+//	def smartMove(memory): return "A1"
+//	def updateMemory(row, col, result, memory): ...
+//
+// and the binding sends the ComputerMemory over a pipe with every call, so a
+// Python player keeps its state where a C++ player does.
+type pythonDriver struct{}
+
+func (pythonDriver) Name() string      { return "Python" }
+func (pythonDriver) Extension() string { return ".py" }
+
+// FunctionSuffix is made up, since Python players' functions have no suffix
+func (pythonDriver) FunctionSuffix(prefix string, entrypoint []byte) (string, error) {
+	return "_py_" + prefix, nil
+}
+
+func (pythonDriver) WriteBindings(engine, prefix, suffix, entrypoint string) error {
+	src := filepath.Join(engine, "src")
+	if err := writeGenerated(filepath.Join(src, "memory.py"), []byte(generatePythonMemory())); err != nil {
+		return err
+	}
+	if err := writeGenerated(filepath.Join(src, "python_player.py"), []byte(generatePythonHost())); err != nil {
+		return err
+	}
+	binding := generatePythonBinding(prefix, suffix, filepath.Join(src, "python_player.py"), entrypoint)
+	return writeGenerated(bindingPath(engine, prefix), []byte(binding))
+}
+
+// CompileCommand loads the player and plays one shot, which catches syntax
+// errors and missing functions before any match
+func (pythonDriver) CompileCommand(engine, prefix, entrypoint string, sources []string) []string {
+	return []string{pythonPath, filepath.Join(engine, "src", "python_player.py"), "--check", entrypoint}
+}
+
+func (pythonDriver) HarnessArgs(engine, prefix string, sources []string) []string {
+	return []string{bindingPath(engine, prefix)}
+}
+
+// generatePythonMemory is memory.py, the Python view of kasbs.h and memory.h
+func generatePythonMemory() string {
+	var b strings.Builder
+	b.WriteString(`"""Generated by battleship-arena: ComputerMemory and the engine's constants
+for submissions written in Python."""
+
+`)
+	for _, c := range engineConstants {
+		fmt.Fprintf(&b, "%s = %s\n", c.name, c.value)
+	}
+	b.WriteString(`
+
+class ComputerMemory:
+    def __init__(self):
+`)
+	for _, f := range memoryFields {
+		value := "0"
+		if f.char {
+			value = "EMPTY_MARKER"
+		}
+		switch len(f.dims) {
+		case 0:
+			fmt.Fprintf(&b, "        self.%s = %s\n", f.name, value)
+		case 1:
+			fmt.Fprintf(&b, "        self.%s = [%s] * %d\n", f.name, value, f.dims[0])
+		case 2:
+			fmt.Fprintf(&b, "        self.%s = [[%s] * %d for _ in range(%d)]\n", f.name, value, f.dims[1], f.dims[0])
+		}
+	}
+	b.WriteString(`
+
+# Read the result playMove gave a shot
+def isAMiss(result):
+    return not (result & HIT)
+
+
+def isAHit(result):
+    return (result & HIT) != 0
+
+
+def isASunk(result):
+    return (result & SUNK) != 0
+
+
+def isShip(result):
+    return result & SHIP
+`)
+	return b.String()
+}
+
+// generatePythonHost is python_player.py, which loads a player and answers
+// the binding's calls. Its stdout belongs to the binding, so what the player
+// prints goes to stderr and ends up in the match's output.
+func generatePythonHost() string {
+	var fields []string
+	for _, f := range memoryFields {
+		var dims []string
+		for _, d := range f.dims {
+			dims = append(dims, strconv.Itoa(d)+",")
+		}
+		char := "False"
+		if f.char {
+			char = "True"
+		}
+		fields = append(fields, fmt.Sprintf("    (%q, %s, (%s)),", f.name, char, strings.Join(dims, " ")))
+	}
+	return fmt.Sprintf(`"""Generated by battleship-arena: runs a Python player for the match and
+benchmark harnesses.
+
+    python_player.py [--check] memory_functions_<name>.py
+
+The harness writes one call per line and reads one answer per line:
+
+    init                          -> memory
+    move <memory>                 -> the move
+    update <row> <col> <result> <memory> -> memory
+
+where memory is every field of ComputerMemory as integers, in order."""
+
+import importlib.util
+import os
+import sys
+
+import memory
+
+# name, whether it holds chars, dimensions
+FIELDS = [
+%s
+]
+
+
+def flatten(value, dims):
+    if not dims:
+        return [value]
+    if len(value) != dims[0]:
+        raise ValueError("expected %%d elements, found %%d" %% (dims[0], len(value)))
+    return [v for item in value for v in flatten(item, dims[1:])]
+
+
+def nest(values, dims, convert):
+    if not dims:
+        return convert(values.pop())
+    return [nest(values, dims[1:], convert) for _ in range(dims[0])]
+
+
+def encode(m):
+    values = []
+    for name, char, dims in FIELDS:
+        try:
+            elements = flatten(getattr(m, name), dims)
+            values += [ord(v) if char else int(v) for v in elements]
+        except (TypeError, ValueError) as e:
+            raise ValueError("memory.%%s: %%s" %% (name, e)) from None
+    return " ".join(map(str, values))
+
+
+def decode(words):
+    values = [int(w) for w in reversed(words)]
+    m = memory.ComputerMemory()
+    for name, char, dims in FIELDS:
+        setattr(m, name, nest(values, dims, chr if char else int))
+    return m
+
+
+def load(path):
+    sys.path.insert(0, os.path.dirname(os.path.abspath(path)))
+    spec = importlib.util.spec_from_file_location("player", path)
+    player = importlib.util.module_from_spec(spec)
+    spec.loader.exec_module(player)
+    for name in ("initMemory", "smartMove", "updateMemory"):
+        if not callable(getattr(player, name, None)):
+            sys.exit("%%s does not define %%s()" %% (os.path.basename(path), name))
+    return player
+
+
+def call(player, words):
+    if words[0] == "init":
+        m = memory.ComputerMemory()
+        player.initMemory(m)
+        return encode(m)
+    if words[0] == "move":
+        move = player.smartMove(decode(words[1:]))
+        return " ".join(str(move).split())
+    if words[0] == "update":
+        row, col, result = (int(w) for w in words[1:4])
+        m = decode(words[4:])
+        player.updateMemory(row, col, result, m)
+        return encode(m)
+    raise ValueError("unknown call %%r" %% words[0])
+
+
+def main():
+    args = sys.argv[1:]
+    check = args[:1] == ["--check"]
+    if check:
+        args = args[1:]
+    if len(args) != 1:
+        sys.exit("usage: python_player.py [--check] <player.py>")
+
+    answers = sys.stdout
+    sys.stdout = sys.stderr
+    player = load(args[0])
+    if check:
+        m = call(player, ["init"]).split()
+        move = call(player, ["move"] + m)
+        call(player, ["update", "0", "0", str(memory.MISS)] + m)
+        print("%%s loaded, first move %%s" %% (os.path.basename(args[0]), move))
+        return
+
+    for line in sys.stdin:
+        answers.write(call(player, line.split()) + "\n")
+        answers.flush()
+
+
+if __name__ == "__main__":
+    main()
+`, strings.Join(fields, "\n"))
+}
+
+// generatePythonBinding gives the harness C++ functions that pass each call
+// to a Python player's interpreter. A player that stops answering ends the
+// match, as a C++ player that crashes would.
+func generatePythonBinding(prefix, suffix, host, entrypoint string) string {
+	var encode, decode strings.Builder
+	for _, f := range memoryFields {
+		put := "put(line, %s);"
+		get := "%s = next(p);"
+		if f.char {
+			put = "put(line, (unsigned char)%s);"
+			get = "%s = (char)next(p);"
+		}
+		encode.WriteString(f.forEachElement(put))
+		decode.WriteString(f.forEachElement(get))
+	}
+
+	return fmt.Sprintf(`// Generated by battleship-arena: calls the Python submission memory_functions_%[1]s.py
+#include "memory_functions_%[1]s.h"
+#include <cstddef>
+#include <cstdio>
+#include <cstdlib>
+#include <string>
+#include <fcntl.h>
+#include <signal.h>
+#include <unistd.h>
+
+%[3]s
+namespace {
+
+FILE *toPlayer;
+FILE *fromPlayer;
+
+void fail(const char *what) {
+    fprintf(stderr, "Python player %[1]s %%s\n", what);
+    exit(1);
+}
+
+void start() {
+    if (toPlayer) {
+        return;
+    }
+    // A player that exits shows up as a failed read, not a signal
+    signal(SIGPIPE, SIG_IGN);
+    int in[2], out[2];
+    if (pipe(in) != 0 || pipe(out) != 0) {
+        fail("could not be started");
+    }
+    fcntl(in[1], F_SETFD, FD_CLOEXEC);
+    fcntl(out[0], F_SETFD, FD_CLOEXEC);
+    fflush(stdout);
+    pid_t pid = fork();
+    if (pid < 0) {
+        fail("could not be started");
+    }
+    if (pid == 0) {
+        dup2(in[0], 0);
+        dup2(out[1], 1);
+        close(in[0]);
+        close(out[1]);
+        execlp(%[4]s, %[4]s, %[5]s, %[6]s, (char *)NULL);
+        _exit(127);
+    }
+    close(in[0]);
+    close(out[1]);
+    toPlayer = fdopen(in[1], "w");
+    fromPlayer = fdopen(out[0], "r");
+}
+
+std::string call(const std::string &line) {
+    start();
+    if (fputs(line.c_str(), toPlayer) == EOF || fputc('\n', toPlayer) == EOF || fflush(toPlayer) != 0) {
+        fail("stopped");
+    }
+    char *answer = NULL;
+    size_t size = 0;
+    ssize_t length = getline(&answer, &size, fromPlayer);
+    if (length < 0) {
+        free(answer);
+        fail("stopped");
+    }
+    std::string result(answer, length);
+    free(answer);
+    if (!result.empty() && result[result.size() - 1] == '\n') {
+        result.erase(result.size() - 1);
+    }
+    return result;
+}
+
+void put(std::string &line, int value) {
+    char number[16];
+    snprintf(number, sizeof number, " %%d", value);
+    line += number;
+}
+
+std::string encode(const ComputerMemory &memory) {
+    std::string line;
+%[7]s    return line;
+}
+
+long next(const char *&p) {
+    char *end;
+    long value = strtol(p, &end, 10);
+    if (end == p) {
+        fail("sent back a malformed ComputerMemory");
+    }
+    p = end;
+    return value;
+}
+
+void decode(const std::string &line, ComputerMemory &memory) {
+    const char *p = line.c_str();
+%[8]s}
+
+}
+
+void initMemory%[2]s(ComputerMemory &memory) {
+    decode(call("init"), memory);
+}
+
+std::string smartMove%[2]s(const ComputerMemory &memory) {
+    return call("move" + encode(memory));
+}
+
+void updateMemory%[2]s(int row, int col, int result, ComputerMemory &memory) {
+    std::string line = "update";
+    put(line, row);
+    put(line, col);
+    put(line, result);
+    decode(call(line + encode(memory)), memory);
+}
+`, prefix, suffix, layoutAsserts(), strconv.Quote(pythonPath), strconv.Quote(host), strconv.Quote(entrypoint), encode.String(), decode.String())
+}
@@ -2,8 +2,11 @@ package runner
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
+	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -13,22 +16,14 @@ import (
 	"syscall"
 	"time"
 
+	"battleship-arena/internal/logs"
 	"battleship-arena/internal/storage"
 )
 
-var enginePath = getEnginePath()
-
-func getEnginePath() string {
-	if path := os.Getenv("BATTLESHIP_ENGINE_PATH"); path != "" {
-		return path
-	}
-	return "./battleship-engine"
-}
-
 // runSandboxed executes a command in a systemd-run sandbox with resource limits
-func runSandboxed(ctx context.Context, name string, args []string, timeoutSec int) ([]byte, error) {
+func runSandboxed(ctx context.Context, name string, args []string, timeout time.Duration) ([]byte, error) {
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutSec)*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 	
 	// Build systemd-run command with security properties
@@ -41,9 +36,9 @@ func runSandboxed(ctx context.Context, name string, args []string, timeoutSec in
 		"--collect",        // Automatically clean up after exit
 		"--service-type=exec",  // Run until process exits
 		"--working-directory=/var/lib/battleship-arena",  // Ensure proper working directory
-		"--property=MemoryMax=512M",        // Max 512MB RAM
-		"--property=CPUQuota=200%",         // Max 2 CPU cores worth
-		"--property=TasksMax=50",           // Max 50 processes/threads
+		"--property=MemoryMax=" + sandbox.MemoryMax,                // Max RAM
+		"--property=CPUQuota=" + sandbox.CPUQuota,                  // Max CPU cores worth
+		"--property=TasksMax=" + strconv.Itoa(sandbox.TasksMax),    // Max processes/threads
 		"--property=PrivateNetwork=true",   // Isolate network (no internet)
 		"--property=PrivateTmp=true",       // Private /tmp
 		"--property=NoNewPrivileges=true",  // Prevent privilege escalation
@@ -59,75 +54,100 @@ func runSandboxed(ctx context.Context, name string, args []string, timeoutSec in
 		Setpgid: true,
 	}
 	
+	// Killing systemd-run leaves the unit it started running, still holding
+	// our output pipe, so stop the unit as well
+	cmd.Cancel = func() error {
+		stopUnit(name)
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 10 * time.Second
+	
 	output, err := cmd.CombinedOutput()
 	
 	// Check for timeout
 	if ctx.Err() == context.DeadlineExceeded {
-		return output, fmt.Errorf("command timed out after %d seconds", timeoutSec)
+		sandboxTimeouts.Inc()
+		return output, fmt.Errorf("command timed out after %s", timeout)
+	}
+	if ctx.Err() == context.Canceled {
+		return output, fmt.Errorf("command cancelled")
 	}
 	
 	return output, err
 }
 
-func CompileSubmission(sub storage.Submission, uploadDir string) error {
-	storage.UpdateSubmissionStatus(sub.ID, "testing")
+// stopUnit stops a transient sandbox unit whose systemd-run was killed
+func stopUnit(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if output, err := exec.CommandContext(ctx, "systemctl", "stop", name+".service").CombinedOutput(); err != nil {
+		slog.Error("stopping sandbox unit failed", "unit", name, "err", err, "output", strings.TrimSpace(string(output)))
+	}
+}
 
-	re := regexp.MustCompile(`memory_functions_(\w+)\.cpp`)
-	matches := re.FindStringSubmatch(sub.Filename)
-	if len(matches) < 2 {
-		return fmt.Errorf("invalid filename format")
+// arenaFor resolves the arena a submission was uploaded to
+func arenaFor(sub storage.Submission) (*storage.Arena, error) {
+	arena, err := storage.GetArenaByID(sub.ArenaID)
+	if err != nil {
+		return nil, err
+	}
+	if arena == nil {
+		return nil, fmt.Errorf("submission %d belongs to unknown arena %d", sub.ID, sub.ArenaID)
 	}
-	prefix := matches[1]
+	return arena, nil
+}
 
-	buildDir := filepath.Join(enginePath, "build")
-	os.MkdirAll(buildDir, 0755)
-	
-	srcDir := filepath.Join(enginePath, "src")
-	os.MkdirAll(srcDir, 0755)
+// engineDir is the engine checkout an arena's submissions compile and play in
+func engineDir(arena *storage.Arena) string {
+	if arena.EnginePath != "" {
+		return arena.EnginePath
+	}
+	return enginePath
+}
 
-	srcPath := filepath.Join(uploadDir, sub.Username, sub.Filename)
-	dstPath := filepath.Join(enginePath, "src", sub.Filename)
-	
-	log.Printf("Copying %s to %s", srcPath, dstPath)
-	input, err := os.ReadFile(srcPath)
+func CompileSubmission(ctx context.Context, sub storage.Submission, uploadDir string) error {
+	logger := logs.FromContext(ctx)
+	storage.UpdateSubmissionStatus(sub.ID, "testing")
+
+	arena, err := arenaFor(sub)
 	if err != nil {
 		return err
 	}
-	
-	// Remove any #include "battleship.h" lines that conflict with battleship_light.h
-	inputStr := string(input)
-	inputStr = regexp.MustCompile(`(?m)^\s*#include\s+"battleship\.h"\s*$`).ReplaceAllString(inputStr, "")
-	input = []byte(inputStr)
-	
-	if err := os.WriteFile(dstPath, input, 0644); err != nil {
+	engine := engineDir(arena)
+
+	driver, prefix, err := detectLanguage(sub.Filename)
+	if err != nil {
 		return err
 	}
 
-	functionSuffix, err := parseFunctionNames(string(input))
+	buildDir := filepath.Join(engine, "build")
+	os.MkdirAll(buildDir, 0755)
+	
+	srcDir := filepath.Join(engine, "src")
+	os.MkdirAll(srcDir, 0755)
+
+	logger.Debug("copying sources into engine", "hash", sub.ContentHash)
+	functionSuffix, err := writeSources(engine, uploadDir, sub)
 	if err != nil {
-		return fmt.Errorf("failed to parse function names: %v", err)
+		return err
 	}
 	
-	log.Printf("Detected function suffix: %s", functionSuffix)
+	logger.Debug("detected function suffix", "suffix", functionSuffix)
 
-	headerFilename := fmt.Sprintf("memory_functions_%s.h", prefix)
-	headerPath := filepath.Join(enginePath, "src", headerFilename)
-	headerContent := generateHeader(headerFilename, functionSuffix)
-	if err := os.WriteFile(headerPath, []byte(headerContent), 0644); err != nil {
+	entrypoint, sources, err := sourcePaths(engine, sub)
+	if err != nil {
 		return err
 	}
 
-	log.Printf("Compiling submission %d for %s", sub.ID, prefix)
+	logger.Debug("compiling in sandbox", "prefix", prefix, "language", driver.Name(), "sources", len(sources))
 	
 	// Compile in sandbox with 60 second timeout
-	compileArgs := []string{
-		"g++", "-std=c++11", "-c", "-O3",
-		"-I", filepath.Join(enginePath, "src"),
-		"-o", filepath.Join(buildDir, "ai_"+prefix+".o"),
-		filepath.Join(enginePath, "src", sub.Filename),
-	}
+	compileArgs := driver.CompileCommand(engine, prefix, entrypoint, sources)
 	
-	output, err := runSandboxed(context.Background(), "compile-"+prefix, compileArgs, 60)
+	start := time.Now()
+	output, err := runSandboxed(ctx, "compile-"+prefix, compileArgs, sandbox.CompileTimeout.Duration)
+	compileDuration.Since(start)
+	storage.SaveCompileLog(sub.ID, string(output))
 	if err != nil {
 		return fmt.Errorf("compilation failed: %s", output)
 	}
@@ -135,226 +155,493 @@ func CompileSubmission(sub storage.Submission, uploadDir string) error {
 	return nil
 }
 
-func RunHeadToHead(player1, player2 storage.Submission, numGames int) (int, int, int) {
-	re := regexp.MustCompile(`memory_functions_(\w+)\.cpp`)
-	matches1 := re.FindStringSubmatch(player1.Filename)
-	matches2 := re.FindStringSubmatch(player2.Filename)
-	
-	if len(matches1) < 2 || len(matches2) < 2 {
-		return 0, 0, 0
+// RunHeadToHead plays numGames between two submissions from the given seed,
+// returning each side's wins, the moves of all games and how the match went
+func RunHeadToHead(ctx context.Context, engine string, player1, player2 storage.Submission, numGames int, seed int64) (int, int, int, storage.MatchDetails) {
+	logger := logs.FromContext(ctx)
+	driver1, prefix1, err := detectLanguage(player1.Filename)
+	if err != nil {
+		logger.Error("building player 1 failed", "err", err)
+		return 0, 0, 0, storage.MatchDetails{}
+	}
+	driver2, prefix2, err := detectLanguage(player2.Filename)
+	if err != nil {
+		logger.Error("building player 2 failed", "err", err)
+		return 0, 0, 0, storage.MatchDetails{}
 	}
 	
-	prefix1 := matches1[1]
-	prefix2 := matches2[1]
-	
-	cpp1Path := filepath.Join(enginePath, "src", player1.Filename)
-	cpp2Path := filepath.Join(enginePath, "src", player2.Filename)
+	entry1Path, sources1, err := sourcePaths(engine, player1)
+	if err != nil {
+		logger.Error("listing player 1 sources failed", "err", err)
+		return 0, 0, 0, storage.MatchDetails{}
+	}
+	entry2Path, sources2, err := sourcePaths(engine, player2)
+	if err != nil {
+		logger.Error("listing player 2 sources failed", "err", err)
+		return 0, 0, 0, storage.MatchDetails{}
+	}
 	
 	// Ensure both files exist in engine/src (copy from uploads if missing)
-	if _, err := os.Stat(cpp1Path); os.IsNotExist(err) {
-		log.Printf("Player1 file missing in engine/src, skipping: %s", cpp1Path)
-		return 0, 0, 0
+	if _, err := os.Stat(entry1Path); os.IsNotExist(err) {
+		logger.Warn("player 1 source missing in engine, skipping", "path", entry1Path)
+		return 0, 0, 0, storage.MatchDetails{}
 	}
 	
-	if _, err := os.Stat(cpp2Path); os.IsNotExist(err) {
-		log.Printf("Player2 file missing in engine/src, skipping: %s", cpp2Path)
-		return 0, 0, 0
+	if _, err := os.Stat(entry2Path); os.IsNotExist(err) {
+		logger.Warn("player 2 source missing in engine, skipping", "path", entry2Path)
+		return 0, 0, 0, storage.MatchDetails{}
 	}
 	
-	cpp1Content, err := os.ReadFile(cpp1Path)
+	entry1Content, err := os.ReadFile(entry1Path)
 	if err != nil {
-		log.Printf("Failed to read %s: %v", cpp1Path, err)
-		return 0, 0, 0
+		logger.Error("reading player 1 source failed", "path", entry1Path, "err", err)
+		return 0, 0, 0, storage.MatchDetails{}
 	}
 	
-	cpp2Content, err := os.ReadFile(cpp2Path)
+	entry2Content, err := os.ReadFile(entry2Path)
 	if err != nil {
-		log.Printf("Failed to read %s: %v", cpp2Path, err)
-		return 0, 0, 0
+		logger.Error("reading player 2 source failed", "path", entry2Path, "err", err)
+		return 0, 0, 0, storage.MatchDetails{}
 	}
 	
-	suffix1, err := parseFunctionNames(string(cpp1Content))
+	suffix1, err := driver1.FunctionSuffix(prefix1, entry1Content)
 	if err != nil {
-		log.Printf("Failed to parse function names for %s: %v", player1.Filename, err)
-		return 0, 0, 0
+		logger.Warn("parsing function names failed", "file", player1.Filename, "err", err)
+		return 0, 0, 0, storage.MatchDetails{}
 	}
 	
-	suffix2, err := parseFunctionNames(string(cpp2Content))
+	suffix2, err := driver2.FunctionSuffix(prefix2, entry2Content)
 	if err != nil {
-		log.Printf("Failed to parse function names for %s: %v", player2.Filename, err)
-		return 0, 0, 0
+		logger.Warn("parsing function names failed", "file", player2.Filename, "err", err)
+		return 0, 0, 0, storage.MatchDetails{}
 	}
 	
-	buildDir := filepath.Join(enginePath, "build")
+	buildDir := filepath.Join(engine, "build")
 	combinedBinary := filepath.Join(buildDir, fmt.Sprintf("match_%s_vs_%s", prefix1, prefix2))
 	
 	mainContent := generateMatchMain(prefix1, prefix2, suffix1, suffix2)
-	mainPath := filepath.Join(enginePath, "src", fmt.Sprintf("match_%s_vs_%s.cpp", prefix1, prefix2))
+	mainPath := filepath.Join(engine, "src", fmt.Sprintf("match_%s_vs_%s.cpp", prefix1, prefix2))
 	if err := os.WriteFile(mainPath, []byte(mainContent), 0644); err != nil {
-		log.Printf("Failed to write match main: %v", err)
-		return 0, 0, 0
+		logger.Error("writing match main failed", "err", err)
+		return 0, 0, 0, storage.MatchDetails{}
 	}
 	
-	// Compile match binary in sandbox with 120 second timeout
+	// Compile match binary in sandbox with 120 second timeout. Sources of
+	// multi-file submissions sit in their own directories and find the
+	// engine's headers through -I. Each player's driver adds its sources,
+	// or the binding that reaches them.
 	compileArgs := []string{"g++"}
 	compileArgs = append(compileArgs, "-std=c++11", "-O3",
+		"-I", filepath.Join(engine, "src"),
 		"-o", combinedBinary,
 		mainPath,
-		filepath.Join(enginePath, "src", "battleship_light.cpp"),
+		filepath.Join(engine, "src", "battleship_light.cpp"),
 	)
 	
-	if prefix1 == prefix2 {
-		compileArgs = append(compileArgs, filepath.Join(enginePath, "src", fmt.Sprintf("memory_functions_%s.cpp", prefix1)))
-	} else {
-		compileArgs = append(compileArgs,
-			filepath.Join(enginePath, "src", fmt.Sprintf("memory_functions_%s.cpp", prefix1)),
-			filepath.Join(enginePath, "src", fmt.Sprintf("memory_functions_%s.cpp", prefix2)),
-		)
+	compileArgs = append(compileArgs, driver1.HarnessArgs(engine, prefix1, sources1)...)
+	if prefix1 != prefix2 {
+		compileArgs = append(compileArgs, driver2.HarnessArgs(engine, prefix2, sources2)...)
 	}
 	
-	output, err := runSandboxed(context.Background(), "compile-match", compileArgs, 120)
+	output, err := runSandboxed(ctx, "compile-match", compileArgs, sandbox.MatchCompileTimeout.Duration)
 	if err != nil {
-		log.Printf("Failed to compile match binary (err=%v): %s", err, output)
-		return 0, 0, 0
+		logger.Warn("compiling match binary failed", "err", err, "output", string(output))
+		return 0, 0, 0, storage.MatchDetails{}
 	}
 	
-	log.Printf("Match compilation output: %s", output)
+	logger.Debug("compiled match binary", "output", string(output))
 	
 	// Check if binary was actually created
 	if _, err := os.Stat(combinedBinary); os.IsNotExist(err) {
-		log.Printf("Match binary was not created at %s, compilation succeeded but no binary found", combinedBinary)
-		return 0, 0, 0
+		logger.Error("compilation succeeded but no match binary was created", "path", combinedBinary)
+		return 0, 0, 0, storage.MatchDetails{}
 	}
 	
 	// Run match in sandbox with 300 second timeout (1000 games should be ~60s, give headroom)
-	runArgs := []string{combinedBinary, strconv.Itoa(numGames)}
-	output, err = runSandboxed(context.Background(), "run-match", runArgs, 300)
+	runArgs := []string{combinedBinary, strconv.Itoa(numGames), strconv.FormatInt(seed, 10)}
+	start := time.Now()
+	output, err = runSandboxed(ctx, "run-match", runArgs, sandbox.MatchTimeout.Duration)
 	if err != nil {
-		log.Printf("Match execution failed: %v\n%s", err, output)
-		return 0, 0, 0
+		logger.Warn("match execution failed", "err", err, "output", string(output))
+		return 0, 0, 0, storage.MatchDetails{}
 	}
 	
-	return parseMatchOutput(string(output))
+	player1Wins, player2Wins, totalMoves, details := parseMatchOutput(string(output))
+	details.Seed = seed
+	details.EngineVersion = engineVersion(engine)
+	details.Runtime = time.Since(start)
+	return player1Wins, player2Wins, totalMoves, details
 }
 
-func RunRoundRobinMatches(newSub storage.Submission, uploadDir string, broadcastFunc func(string, int, int, time.Time, []string)) {
-	activeSubmissions, err := storage.GetActiveSubmissions()
+// stageSubmission makes sure a submission's sources and generated header are
+// in the engine's src directory. Opponents compiled before a restart, or in
+// another engine, may be missing.
+func stageSubmission(engine, uploadDir string, sub storage.Submission) error {
+	dstPath, _, err := sourcePaths(engine, sub)
 	if err != nil {
-		log.Printf("Failed to get active submissions: %v", err)
-		return
+		return err
+	}
+	if _, err := os.Stat(dstPath); err == nil {
+		return nil
+	}
+	_, err = writeSources(engine, uploadDir, sub)
+	return err
+}
+
+// battleshipInclude matches #include "battleship.h" lines, which conflict
+// with battleship_light.h
+var battleshipInclude = regexp.MustCompile(`(?m)^\s*#include\s+"battleship\.h"\s*$`)
+
+// writeSources copies a submission's sources into the engine's src directory,
+// with the header generated for its entrypoint and its language's bindings,
+// and returns the entrypoint's function suffix. The files of a multi-file
+// submission get a directory of their own, so two players' helpers never
+// overwrite each other.
+func writeSources(engine, uploadDir string, sub storage.Submission) (string, error) {
+	driver, prefix, err := detectLanguage(sub.Filename)
+	if err != nil {
+		return "", err
+	}
+	files, err := storage.GetSubmissionFiles(sub.ID)
+	if err != nil {
+		return "", err
 	}
+	
+	var entrypoint []byte
+	if len(files) == 0 {
+		content, err := storage.ReadSource(uploadDir, sub)
+		if err != nil {
+			return "", err
+		}
+		entrypoint = battleshipInclude.ReplaceAll(content, nil)
+		if err := os.WriteFile(filepath.Join(engine, "src", sub.Filename), entrypoint, 0644); err != nil {
+			return "", err
+		}
+	} else {
+		dir := filepath.Join(engine, "src", storage.BundleDir(sub.Filename))
+		if err := os.RemoveAll(dir); err != nil {
+			return "", err
+		}
+		for _, f := range files {
+			content, err := os.ReadFile(storage.SourcePath(uploadDir, f.ContentHash))
+			if err != nil {
+				return "", fmt.Errorf("the source of %s in submission %d is missing", f.Path, sub.ID)
+			}
+			content = battleshipInclude.ReplaceAll(content, nil)
+			dst := filepath.Join(dir, filepath.FromSlash(f.Path))
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return "", err
+			}
+			if err := os.WriteFile(dst, content, 0644); err != nil {
+				return "", err
+			}
+			if f.Path == sub.Filename {
+				entrypoint = content
+			}
+		}
+	}
+	
+	functionSuffix, err := driver.FunctionSuffix(prefix, entrypoint)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse function names: %v", err)
+	}
+	headerFilename := fmt.Sprintf("memory_functions_%s.h", prefix)
+	headerContent := generateHeader(headerFilename, functionSuffix)
+	if err := os.WriteFile(filepath.Join(engine, "src", headerFilename), []byte(headerContent), 0644); err != nil {
+		return "", err
+	}
+	entrypointPath, _, err := sourcePaths(engine, sub)
+	if err != nil {
+		return "", err
+	}
+	if err := driver.WriteBindings(engine, prefix, functionSuffix, entrypointPath); err != nil {
+		return "", err
+	}
+	return functionSuffix, nil
+}
 
-	var unplayedOpponents []storage.Submission
+// sourcePaths returns where a submission's staged entrypoint is and every
+// source file its language builds into its AI
+func sourcePaths(engine string, sub storage.Submission) (string, []string, error) {
+	driver, _, err := detectLanguage(sub.Filename)
+	if err != nil {
+		return "", nil, err
+	}
+	files, err := storage.GetSubmissionFiles(sub.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(files) == 0 {
+		p := filepath.Join(engine, "src", sub.Filename)
+		return p, []string{p}, nil
+	}
+	
+	dir := filepath.Join(engine, "src", storage.BundleDir(sub.Filename))
+	var sources []string
+	for _, f := range files {
+		if strings.HasSuffix(f.Path, driver.Extension()) {
+			sources = append(sources, filepath.Join(dir, filepath.FromSlash(f.Path)))
+		}
+	}
+	return filepath.Join(dir, sub.Filename), sources, nil
+}
+
+// enqueueRoundRobin queues one head-to-head job per active opponent the
+// submission hasn't played yet
+func enqueueRoundRobin(sub storage.Submission) (int, error) {
+	activeSubmissions, err := storage.GetActiveSubmissions(sub.ArenaID)
+	if err != nil {
+		return 0, err
+	}
+	
+	queued := 0
 	for _, opponent := range activeSubmissions {
-		if opponent.ID == newSub.ID {
+		if opponent.ID == sub.ID {
 			continue
 		}
 		
-		hasMatch, err := storage.HasMatchBetween(newSub.ID, opponent.ID)
+		hasMatch, err := storage.HasMatchBetween(sub.ID, opponent.ID)
+		if err != nil {
+			return queued, err
+		}
+		if hasMatch {
+			continue
+		}
+		// The opponent's own round-robin may already have this pairing queued
+		reverse, err := storage.IsJobPending(storage.PairJobKey(opponent.ID, sub.ID))
 		if err != nil {
-			log.Printf("Error checking match history: %v", err)
+			return queued, err
+		}
+		if reverse {
 			continue
 		}
 		
-		if !hasMatch {
-			// Ensure opponent file exists in engine/src
-			opponentSrcPath := filepath.Join(uploadDir, opponent.Username, opponent.Filename)
-			opponentDstPath := filepath.Join(enginePath, "src", opponent.Filename)
-			
-			if _, err := os.Stat(opponentDstPath); os.IsNotExist(err) {
-				// Copy opponent file to engine/src
-				opponentContent, err := os.ReadFile(opponentSrcPath)
-				if err != nil {
-					log.Printf("Failed to read opponent file %s: %v", opponentSrcPath, err)
-					continue
-				}
-				if err := os.WriteFile(opponentDstPath, opponentContent, 0644); err != nil {
-					log.Printf("Failed to copy opponent file to engine: %v", err)
-					continue
-				}
-				
-				// Generate opponent header if missing
-				re := regexp.MustCompile(`memory_functions_(\w+)\.cpp`)
-				matches := re.FindStringSubmatch(opponent.Filename)
-				if len(matches) >= 2 {
-					prefix := matches[1]
-					functionSuffix, err := parseFunctionNames(string(opponentContent))
-					if err == nil {
-						headerFilename := fmt.Sprintf("memory_functions_%s.h", prefix)
-						headerPath := filepath.Join(enginePath, "src", headerFilename)
-						headerContent := generateHeader(headerFilename, functionSuffix)
-						os.WriteFile(headerPath, []byte(headerContent), 0644)
-					}
-				}
+		added, err := storage.EnqueueJob(storage.JobRoundRobinPair, storage.PairJobKey(sub.ID, opponent.ID),
+			storage.PairPayload{SubmissionID: sub.ID, OpponentID: opponent.ID})
+		if err != nil {
+			return queued, err
+		}
+		if added {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// EnqueueMissingRoundRobins queues the head-to-heads that a round-robin
+// interrupted before the job queue existed never got to
+func EnqueueMissingRoundRobins() (int, error) {
+	arenas, err := storage.GetArenas()
+	if err != nil {
+		return 0, err
+	}
+	
+	total := 0
+	for _, arena := range arenas {
+		submissions, err := storage.GetActiveSubmissions(arena.ID)
+		if err != nil {
+			return total, err
+		}
+		for _, sub := range submissions {
+			n, err := enqueueRoundRobin(sub)
+			total += n
+			if err != nil {
+				return total, err
 			}
-			
-			unplayedOpponents = append(unplayedOpponents, opponent)
 		}
 	}
+	return total, nil
+}
+
+// playMatch runs a head-to-head from a fresh seed and picks the winner,
+// flipping a coin on a tie. An error means the games never ran, so the job
+// should be retried.
+func playMatch(ctx context.Context, kind, engine string, player1, player2 storage.Submission, numGames int) (winnerID, player1Wins, player2Wins, avgMoves int, details *storage.MatchDetails, err error) {
+	start := time.Now()
+	player1Wins, player2Wins, totalMoves, played := RunHeadToHead(ctx, engine, player1, player2, numGames, int64(rand.Int31()))
+	if player1Wins+player2Wins == 0 {
+		return 0, 0, 0, 0, nil, fmt.Errorf("%s vs %s produced no games", player1.Username, player2.Username)
+	}
+	elapsed := time.Since(start).Seconds()
+	matchDuration.Observe(elapsed, kind)
+	gamesPlayed.Add(float64(player1Wins + player2Wins))
+	gamesPerSecond.Set(float64(player1Wins+player2Wins) / elapsed)
+	avgMoves = totalMoves / numGames
+	
+	switch {
+	case player1Wins > player2Wins:
+		winnerID = player1.ID
+	case player2Wins > player1Wins:
+		winnerID = player2.ID
+	case totalMoves%2 == 0:
+		winnerID = player1.ID
+	default:
+		winnerID = player2.ID
+	}
+	return winnerID, player1Wins, player2Wins, avgMoves, &played, nil
+}
+
+// runPairJob plays one head-to-head of a submission's round-robin
+func (w *worker) runPairJob(ctx context.Context, job *storage.Job) error {
+	var payload storage.PairPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	newSub, err := storage.GetSubmissionByID(payload.SubmissionID)
+	if err != nil {
+		return err
+	}
+	opponent, err := storage.GetSubmissionByID(payload.OpponentID)
+	if err != nil {
+		return err
+	}
+	ctx, _ = logs.With(ctx, "user", newSub.Username)
 	
-	totalMatches := len(unplayedOpponents)
-	if totalMatches <= 0 {
-		log.Printf("No new opponents for %s, all matches already played", newSub.Username)
-		return
+	// Either side may have been replaced, cancelled or banned since
+	if !newSub.IsActive || !opponent.IsActive || newSub.Status != "completed" || opponent.Status != "completed" {
+		return nil
+	}
+	hasMatch, err := storage.HasMatchBetween(newSub.ID, opponent.ID)
+	if err != nil || hasMatch {
+		return err
+	}
+	
+	arena, err := arenaFor(newSub)
+	if err != nil {
+		return err
+	}
+	engine := engineDir(arena)
+	if err := stageSubmission(engine, w.uploadDir, opponent); err != nil {
+		return fmt.Errorf("staging opponent %s: %v", opponent.Username, err)
+	}
+	
+	total, finished, startTime, err := storage.RoundRobinProgress(newSub.ID)
+	if err != nil {
+		return err
 	}
+	matchNum := finished + 1
+	w.broadcastFunc(newSub.Username, matchNum, total, startTime, storage.GetQueuedPlayerNames())
+	
+	winnerID, player1Wins, player2Wins, avgMoves, details, err := playMatch(ctx, "round_robin", engine, newSub, opponent, arena.GamesPerMatch)
+	if err != nil {
+		return err
+	}
+	
+	matchID, err := storage.AddMatch(newSub.ID, opponent.ID, winnerID, player1Wins, player2Wins, avgMoves, avgMoves, details)
+	if err != nil {
+		return err
+	}
+	
+	// Log the result from each side, so it shows up in both submissions' logs
+	result := func(sub storage.Submission, wins, losses int) string {
+		switch {
+		case winnerID != sub.ID:
+			return "lost"
+		case wins == losses:
+			return "won coin flip"
+		}
+		return "won"
+	}
+	logs.FromContext(ctx).Info("round-robin match played",
+		"match_id", matchID, "progress", fmt.Sprintf("%d/%d", matchNum, total), "opponent", opponent.Username,
+		"result", result(newSub, player1Wins, player2Wins), "wins", player1Wins, "losses", player2Wins, "avg_moves", avgMoves)
+	slog.Info("round-robin match played",
+		"submission_id", opponent.ID, "user", opponent.Username, "match_id", matchID, "opponent", newSub.Username,
+		"result", result(opponent, player2Wins, player1Wins), "wins", player2Wins, "losses", player1Wins, "avg_moves", avgMoves)
+	return nil
+}
 
-	log.Printf("Starting round-robin for %s (%d opponents)", newSub.Username, totalMatches)
-	matchNum := 0
-	startTime := time.Now()
+// finishRoundRobin updates ratings once the last head-to-head of a
+// submission's round-robin has been played or given up on, so all of its
+// matches land in one rating period
+func (w *worker) finishRoundRobin(ctx context.Context, submissionID int) {
+	total, finished, _, err := storage.RoundRobinProgress(submissionID)
+	if err != nil || total == 0 || finished < total {
+		return
+	}
+	
+	logger := logs.FromContext(ctx)
+	logger.Info("round-robin complete, updating ratings", "matches", total)
+	if err := storage.RecalculateAllGlicko2Ratings(); err != nil {
+		logger.Error("updating Glicko-2 ratings failed", "err", err)
+	} else {
+		logger.Info("Glicko-2 ratings updated")
+	}
+}
 
-	for _, opponent := range unplayedOpponents {
-		matchNum++
-		
-		queuedPlayers := storage.GetQueuedPlayerNames()
-		broadcastFunc(newSub.Username, matchNum, totalMatches, startTime, queuedPlayers)
-		
-		player1Wins, player2Wins, totalMoves := RunHeadToHead(newSub, opponent, 1000)
-		
-		var winnerID int
-		avgMoves := totalMoves / 1000
-		
-		if player1Wins > player2Wins {
-			winnerID = newSub.ID
-			log.Printf("[%d/%d] %s defeats %s (%d-%d, %d moves avg)", matchNum, totalMatches, newSub.Username, opponent.Username, player1Wins, player2Wins, avgMoves)
-		} else if player2Wins > player1Wins {
-			winnerID = opponent.ID
-			log.Printf("[%d/%d] %s defeats %s (%d-%d, %d moves avg)", matchNum, totalMatches, opponent.Username, newSub.Username, player2Wins, player1Wins, avgMoves)
-		} else {
-			if totalMoves%2 == 0 {
-				winnerID = newSub.ID
-			} else {
-				winnerID = opponent.ID
-			}
-			log.Printf("[%d/%d] Tie %d-%d, coin flip winner: %s", matchNum, totalMatches, player1Wins, player2Wins, 
-				map[int]string{newSub.ID: newSub.Username, opponent.ID: opponent.Username}[winnerID])
+// runTournamentMatchJob plays one bracket match and advances the bracket
+// when it completes a round
+func (w *worker) runTournamentMatchJob(ctx context.Context, job *storage.Job) error {
+	var payload storage.TournamentMatchPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	pending, err := storage.GetPendingBracketMatches(payload.TournamentID)
+	if err != nil {
+		return err
+	}
+	var match *storage.BracketMatch
+	for i := range pending {
+		if pending[i].ID == payload.MatchID {
+			match = &pending[i]
 		}
-		
-		_, err := storage.AddMatch(newSub.ID, opponent.ID, winnerID, player1Wins, player2Wins, avgMoves, avgMoves)
-		if err != nil {
-			log.Printf("Failed to store match result: %v", err)
+	}
+	if match == nil {
+		// Already played, or the tournament was cancelled
+		return nil
+	}
+	
+	player1, err := storage.GetSubmissionByID(match.Player1ID)
+	if err != nil {
+		return err
+	}
+	player2, err := storage.GetSubmissionByID(match.Player2ID)
+	if err != nil {
+		return err
+	}
+	arena, err := arenaFor(player1)
+	if err != nil {
+		return err
+	}
+	engine := engineDir(arena)
+	for _, sub := range []storage.Submission{player1, player2} {
+		if err := stageSubmission(engine, w.uploadDir, sub); err != nil {
+			return fmt.Errorf("staging %s: %v", sub.Username, err)
 		}
 	}
 	
-	log.Printf("✓ Round-robin complete for %s (%d matches)", newSub.Username, totalMatches)
+	winnerID, player1Wins, player2Wins, avgMoves, _, err := playMatch(ctx, "tournament", engine, player1, player2, arena.GamesPerMatch)
+	if err != nil {
+		return err
+	}
+	// Each player's log gets the result
+	for _, p := range []struct {
+		sub          storage.Submission
+		opponent     string
+		wins, losses int
+	}{
+		{player1, player2.Username, player1Wins, player2Wins},
+		{player2, player1.Username, player2Wins, player1Wins},
+	} {
+		slog.Info("tournament match played",
+			"submission_id", p.sub.ID, "user", p.sub.Username, "tournament_id", payload.TournamentID, "match_id", match.ID,
+			"round", match.Round, "opponent", p.opponent, "won", winnerID == p.sub.ID, "wins", p.wins, "losses", p.losses)
+	}
 	
-	// Update Glicko-2 ratings using proper rating periods (batch all matches together)
-	log.Printf("Updating Glicko-2 ratings (proper rating period)...")
-	if err := storage.RecalculateAllGlicko2Ratings(); err != nil {
-		log.Printf("Failed to update Glicko-2 ratings: %v", err)
-	} else {
-		log.Printf("✓ Glicko-2 ratings updated")
+	if err := storage.UpdateBracketMatchResult(match.ID, winnerID, player1Wins, player2Wins, avgMoves, avgMoves); err != nil {
+		return err
+	}
+	complete, err := storage.IsRoundComplete(payload.TournamentID, match.Round)
+	if err != nil || !complete {
+		return err
 	}
+	return storage.AdvanceWinners(payload.TournamentID, match.Round)
 }
 
 func recordRatingSnapshot(submissionID, matchID int) {
-	var rating, rd, volatility float64
-	err := storage.DB.QueryRow(
-		"SELECT glicko_rating, glicko_rd, glicko_volatility FROM submissions WHERE id = ?",
-		submissionID,
-	).Scan(&rating, &rd, &volatility)
-	
+	rating, err := storage.GetRating(submissionID)
 	if err == nil {
-		storage.RecordRatingHistory(submissionID, matchID, rating, rd, volatility)
+		storage.RecordRatingHistory(submissionID, matchID, rating.Rating, rating.RD, rating.Volatility)
 	}
 }
 
@@ -393,21 +680,41 @@ func generateMatchMain(prefix1, prefix2, suffix1, suffix2 string) string {
 #include <iostream>
 #include <cstdlib>
 #include <ctime>
+#include <map>
 
 using namespace std;
 
+struct GameCounts {
+    int player1Wins = 0;
+    int player2Wins = 0;
+    int ties = 0;
+};
+
 struct MatchResult {
     int player1Wins = 0;
     int player2Wins = 0;
     int ties = 0;
     int totalMoves = 0;
+    int player1Invalid = 0;
+    int player2Invalid = 0;
+    map<int, GameCounts> moveCounts;
 };
 
-MatchResult runMatch(int numGames) {
+// Shots are written as row letter, column number and M, H or S
+string shotString(int row, int col, int result) {
+    char outcome = isASunk(result) ? 'S' : (isAHit(result) ? 'H' : 'M');
+    return string(1, (char)('A' + row)) + numToString(col + 1) + outcome;
+}
+
+MatchResult runMatch(int numGames, unsigned int seed) {
     MatchResult result;
-    srand(time(NULL));
+    srand(seed);
     
     for (int game = 0; game < numGames; game++) {
+        // The first and last games are kept as replays
+        bool sampled = game == 0 || game == numGames - 1;
+        string shots;
+
         Board board1, board2;
         ComputerMemory memory1, memory2;
         
@@ -426,6 +733,7 @@ MatchResult runMatch(int numGames) {
             string move1 = smartMove%s(memory1);
             int row1, col1;
             int check1 = checkMove(move1, board2, row1, col1);
+            if (check1 != VALID_MOVE) result.player1Invalid++;
             while (check1 != VALID_MOVE) {
                 move1 = randomMove();
                 check1 = checkMove(move1, board2, row1, col1);
@@ -434,6 +742,7 @@ MatchResult runMatch(int numGames) {
             string move2 = smartMove%s(memory2);
             int row2, col2;
             int check2 = checkMove(move2, board1, row2, col2);
+            if (check2 != VALID_MOVE) result.player2Invalid++;
             while (check2 != VALID_MOVE) {
                 move2 = randomMove();
                 check2 = checkMove(move2, board1, row2, col2);
@@ -441,6 +750,9 @@ MatchResult runMatch(int numGames) {
             
             int result1 = playMove(row1, col1, board2);
             int result2 = playMove(row2, col2, board1);
+            if (sampled) {
+                shots += " " + shotString(row1, col1, result1) + " " + shotString(row2, col2, result2);
+            }
             
             updateMemory%s(row1, col1, result1, memory1);
             updateMemory%s(row2, col2, result2, memory2);
@@ -455,12 +767,23 @@ MatchResult runMatch(int numGames) {
         
         result.totalMoves += moveCount;
         
+        int winner;
+        GameCounts &counts = result.moveCounts[moveCount];
         if (shipsSunk1 == 5 && shipsSunk2 == 5) {
             result.ties++;
+            counts.ties++;
+            winner = 0;
         } else if (shipsSunk1 == 5) {
             result.player1Wins++;
+            counts.player1Wins++;
+            winner = 1;
         } else {
             result.player2Wins++;
+            counts.player2Wins++;
+            winner = 2;
+        }
+        if (sampled) {
+            cout << "REPLAY=" << (game + 1) << " " << winner << shots << endl;
         }
     }
     
@@ -468,22 +791,28 @@ MatchResult runMatch(int numGames) {
 }
 
 int main(int argc, char* argv[]) {
-    if (argc < 2) {
-        cerr << "Usage: " << argv[0] << " <num_games>" << endl;
+    if (argc < 3) {
+        cerr << "Usage: " << argv[0] << " <num_games> <seed>" << endl;
         return 1;
     }
     
     int numGames = atoi(argv[1]);
     if (numGames <= 0) numGames = 10;
+    unsigned int seed = (unsigned int)strtoul(argv[2], NULL, 10);
     
     setDebugMode(false);
     
-    MatchResult result = runMatch(numGames);
+    MatchResult result = runMatch(numGames, seed);
     
     cout << "PLAYER1_WINS=" << result.player1Wins << endl;
     cout << "PLAYER2_WINS=" << result.player2Wins << endl;
     cout << "TIES=" << result.ties << endl;
     cout << "TOTAL_MOVES=" << result.totalMoves << endl;
+    cout << "PLAYER1_INVALID=" << result.player1Invalid << endl;
+    cout << "PLAYER2_INVALID=" << result.player2Invalid << endl;
+    for (map<int, GameCounts>::iterator it = result.moveCounts.begin(); it != result.moveCounts.end(); ++it) {
+        cout << "MOVES=" << it->first << " " << it->second.player1Wins << " " << it->second.player2Wins << " " << it->second.ties << endl;
+    }
     cout << "AVG_MOVES=" << (result.totalMoves / numGames) << endl;
     
     return 0;
@@ -491,10 +820,19 @@ int main(int argc, char* argv[]) {
 `, prefix1, prefix2, suffix1, suffix2, suffix1, suffix2, suffix1, suffix2)
 }
 
-func parseMatchOutput(output string) (int, int, int) {
+// maxMatchOutput caps how much stray output a match keeps, since a player
+// printing on every move would otherwise fill the database
+const maxMatchOutput = 4096
+
+// parseMatchOutput reads the results the match binary prints. Lines it
+// doesn't recognise are the players' own output, or the engine's errors, and
+// are kept in the details.
+func parseMatchOutput(output string) (int, int, int, storage.MatchDetails) {
 	player1Wins := 0
 	player2Wins := 0
 	totalMoves := 0
+	var details storage.MatchDetails
+	var other []string
 	
 	lines := strings.Split(output, "\n")
 	for _, line := range lines {
@@ -504,8 +842,63 @@ func parseMatchOutput(output string) (int, int, int) {
 			fmt.Sscanf(line, "PLAYER2_WINS=%d", &player2Wins)
 		} else if strings.HasPrefix(line, "TOTAL_MOVES=") {
 			fmt.Sscanf(line, "TOTAL_MOVES=%d", &totalMoves)
+		} else if strings.HasPrefix(line, "TIES=") {
+			fmt.Sscanf(line, "TIES=%d", &details.Ties)
+		} else if strings.HasPrefix(line, "PLAYER1_INVALID=") {
+			fmt.Sscanf(line, "PLAYER1_INVALID=%d", &details.Player1Invalid)
+		} else if strings.HasPrefix(line, "PLAYER2_INVALID=") {
+			fmt.Sscanf(line, "PLAYER2_INVALID=%d", &details.Player2Invalid)
+		} else if strings.HasPrefix(line, "MOVES=") {
+			var c storage.MoveCount
+			if _, err := fmt.Sscanf(line, "MOVES=%d %d %d %d", &c.Moves, &c.Player1Wins, &c.Player2Wins, &c.Ties); err == nil {
+				details.MoveCounts = append(details.MoveCounts, c)
+			}
+		} else if strings.HasPrefix(line, "AVG_MOVES=") {
+			// Worked out from TOTAL_MOVES
+		} else if strings.HasPrefix(line, "REPLAY=") {
+			if replay, err := parseReplay(strings.TrimPrefix(line, "REPLAY=")); err == nil {
+				details.Replays = append(details.Replays, replay)
+			}
+		} else if strings.TrimSpace(line) != "" {
+			other = append(other, line)
 		}
 	}
 	
-	return player1Wins, player2Wins, totalMoves
+	details.Games = player1Wins + player2Wins + details.Ties
+	details.Output = strings.Join(other, "\n")
+	if len(details.Output) > maxMatchOutput {
+		details.Output = details.Output[:maxMatchOutput] + "\n[truncated]"
+	}
+	return player1Wins, player2Wins, totalMoves, details
+}
+
+// parseReplay reads "<game> <winner> <shots...>"
+func parseReplay(line string) (storage.Replay, error) {
+	var replay storage.Replay
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 3 {
+		return replay, fmt.Errorf("bad replay %q", line)
+	}
+	var err error
+	if replay.Game, err = strconv.Atoi(fields[0]); err != nil {
+		return replay, err
+	}
+	if replay.Winner, err = strconv.Atoi(fields[1]); err != nil {
+		return replay, err
+	}
+	replay.Shots, err = storage.ParseShots(fields[2])
+	return replay, err
+}
+
+// engineVersion identifies the engine sources and the match harness a
+// match was played with, so results from different rules can be told apart
+func engineVersion(engine string) string {
+	h := sha256.New()
+	for _, name := range []string{"battleship_light.h", "battleship_light.cpp", "kasbs.h", "memory.h"} {
+		if content, err := os.ReadFile(filepath.Join(engine, "src", name)); err == nil {
+			h.Write(content)
+		}
+	}
+	h.Write([]byte(generateMatchMain("p1", "p2", "P1", "P2")))
+	return hex.EncodeToString(h.Sum(nil))[:12]
 }
@@ -2,82 +2,268 @@ package runner
 
 import (
 	"context"
-	"log"
-	"sync"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
 	"time"
 
+	"battleship-arena/internal/logs"
 	"battleship-arena/internal/storage"
 )
 
-var workerMutex sync.Mutex
+type worker struct {
+	owner         string
+	uploadDir     string
+	broadcastFunc func(string, int, int, time.Time, []string)
+	notifyFunc    func()
+	completeFunc  func()
+}
 
-func StartWorker(ctx context.Context, uploadDir string, broadcastFunc func(string, int, int, time.Time, []string), notifyFunc func(), completeFunc func()) {
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
+// StartWorker runs jobs from the jobs table until ctx is cancelled. Work
+// interrupted by a crash or restart is recovered first.
+//
+// Cancelling ctx stops the worker claiming new jobs. The job in flight gets
+// up to drainTimeout to finish; after that its sandbox is stopped and the job
+// goes back in the queue for the next start. StartWorker returns once it has
+// done either.
+func StartWorker(ctx context.Context, drainTimeout time.Duration, uploadDir string, broadcastFunc func(string, int, int, time.Time, []string), notifyFunc func(), completeFunc func()) {
+	hostname, _ := os.Hostname()
+	w := &worker{
+		owner:         fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		uploadDir:     uploadDir,
+		broadcastFunc: broadcastFunc,
+		notifyFunc:    notifyFunc,
+		completeFunc:  completeFunc,
+	}
 
+	if n, err := storage.RecoverJobs(); err != nil {
+		slog.Error("job recovery failed", "err", err)
+	} else if n > 0 {
+		slog.Info("recovered interrupted submission jobs", "count", n)
+	}
+	if n, err := EnqueueMissingRoundRobins(); err != nil {
+		slog.Error("queueing unplayed round-robin matches failed", "err", err)
+	} else if n > 0 {
+		slog.Info("queued unplayed round-robin matches", "count", n)
+	}
+
+	// Jobs run under their own context, so shutting down lets the one in
+	// flight finish before cutting it off
+	jobCtx, abortJobs := context.WithCancel(context.Background())
+	defer abortJobs()
 	go func() {
-		if err := processSubmissionsWithLock(uploadDir, broadcastFunc, notifyFunc, completeFunc); err != nil {
-			log.Printf("Worker error (submissions): %v", err)
+		select {
+		case <-jobCtx.Done():
+			return
+		case <-ctx.Done():
+		}
+		timer := time.NewTimer(drainTimeout)
+		defer timer.Stop()
+		select {
+		case <-jobCtx.Done():
+		case <-timer.C:
+			slog.Warn("drain timeout reached, checkpointing the running job", "timeout", drainTimeout)
+			abortJobs()
 		}
 	}()
 
+	// The sweep wakes the worker without a signal, to pick up retries that
+	// have come due and stale benchmarks
+	ticker := time.NewTicker(workerSettings.SweepInterval.Duration)
+	defer ticker.Stop()
+
 	for {
+		w.runJobs(ctx, jobCtx)
+
 		select {
 		case <-ctx.Done():
 			return
+		case <-storage.JobSignal():
 		case <-ticker.C:
-			go func() {
-				if err := processSubmissionsWithLock(uploadDir, broadcastFunc, notifyFunc, completeFunc); err != nil {
-					log.Printf("Worker error (submissions): %v", err)
-				}
-			}()
+			// Catch up on submissions benchmarked against an older board set
+			if err := BenchmarkStaleSubmissions(); err != nil {
+				slog.Error("queueing stale benchmarks failed", "err", err)
+			}
 		}
 	}
 }
 
-func processSubmissionsWithLock(uploadDir string, broadcastFunc func(string, int, int, time.Time, []string), notifyFunc func(), completeFunc func()) error {
-	if !workerMutex.TryLock() {
-		// Silently skip if worker is already running
-		return nil
+// runJobs works through every runnable job, one at a time, until ctx is
+// cancelled. Jobs themselves run under jobCtx.
+func (w *worker) runJobs(ctx, jobCtx context.Context) {
+	ranAny := false
+	for ctx.Err() == nil {
+		// A claimed job is leased to this worker and the heartbeat renews the
+		// lease while it runs, so only a worker that died or hung loses its jobs
+		job, err := storage.ClaimJob(w.owner, workerSettings.JobLease.Duration)
+		if err != nil {
+			slog.Error("claiming job failed", "err", err)
+			return
+		}
+		if job == nil {
+			break
+		}
+		ranAny = true
+		w.runJob(jobCtx, job)
+	}
+
+	if ranAny {
+		if pending, err := storage.HasPendingJobs(); err == nil && !pending {
+			w.completeFunc()
+		}
+	}
+}
+
+func (w *worker) runJob(ctx context.Context, job *storage.Job) {
+	ctx, logger := logs.With(ctx, "job_id", job.ID, "job_type", job.Type)
+	// Lines about a submission's jobs belong in its log
+	var ref storage.CompilePayload
+	if job.Decode(&ref) == nil && ref.SubmissionID > 0 {
+		ctx, logger = logs.With(ctx, "submission_id", ref.SubmissionID)
+	}
+	start := time.Now()
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(workerSettings.JobHeartbeat.Duration)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := storage.HeartbeatJob(job.ID, w.owner, workerSettings.JobLease.Duration); err != nil {
+					logger.Warn("job heartbeat failed", "err", err)
+				}
+			}
+		}
+	}()
+
+	var err error
+	switch job.Type {
+	case storage.JobCompile:
+		err = w.runCompileJob(ctx, job)
+	case storage.JobRoundRobinPair:
+		err = w.runPairJob(ctx, job)
+	case storage.JobTournamentMatch:
+		err = w.runTournamentMatchJob(ctx, job)
+	case storage.JobBenchmark:
+		err = w.runBenchmarkJob(ctx, job)
+	default:
+		err = fmt.Errorf("unknown job type %q", job.Type)
+	}
+	close(stop)
+
+	if err != nil && ctx.Err() != nil {
+		// Cut off by a shutdown rather than failed, so don't count it
+		if err := storage.ReleaseJob(job.ID, w.owner); err != nil {
+			logger.Error("checkpointing job failed", "err", err)
+		} else {
+			logger.Info("job interrupted by shutdown, will resume on next start")
+		}
+		return
+	}
+
+	if err == nil {
+		if err := storage.CompleteJob(job.ID, w.owner); errors.Is(err, storage.ErrLeaseLost) {
+			logger.Warn("job finished after its lease ran out, leaving it to its new owner")
+		} else if err != nil {
+			logger.Error("completing job failed", "err", err)
+		} else {
+			logger.Debug("job done", logs.Since(start))
+		}
+	} else {
+		dead, failErr := storage.FailJob(job, w.owner, err)
+		switch {
+		case errors.Is(failErr, storage.ErrLeaseLost):
+			logger.Warn("job failed after its lease ran out, leaving it to its new owner", "err", err)
+		case failErr != nil:
+			logger.Error("recording job failure failed", "err", failErr)
+		case dead:
+			logger.Error("job failed too many times, giving up", "attempts", job.Attempts, "err", err)
+		default:
+			logger.Warn("job failed, will retry", "attempts", job.Attempts, "err", err)
+		}
+	}
+
+	if job.Type == storage.JobRoundRobinPair {
+		var payload storage.PairPayload
+		if job.Decode(&payload) == nil {
+			w.finishRoundRobin(ctx, payload.SubmissionID)
+		}
 	}
-	defer workerMutex.Unlock()
-	
-	return ProcessSubmissions(uploadDir, broadcastFunc, notifyFunc, completeFunc)
+	w.notifyFunc()
 }
 
-func ProcessSubmissions(uploadDir string, broadcastFunc func(string, int, int, time.Time, []string), notifyFunc func(), completeFunc func()) error {
-	submissions, err := storage.GetPendingSubmissions()
+// runCompileJob compiles a new submission, then queues its benchmark and
+// round-robin
+func (w *worker) runCompileJob(ctx context.Context, job *storage.Job) error {
+	var payload storage.CompilePayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	sub, err := storage.GetSubmissionByID(payload.SubmissionID)
 	if err != nil {
 		return err
 	}
-	
-	// Only do work if there are pending submissions
-	if len(submissions) == 0 {
+	// Replaced by a newer upload, or cancelled by an admin
+	if !sub.IsActive || sub.Status == "cancelled" {
 		return nil
 	}
 
-	for _, sub := range submissions {
-		log.Printf("⚙️  Compiling %s (%s)", sub.Username, sub.Filename)
-		
-		if err := CompileSubmission(sub, uploadDir); err != nil {
-			log.Printf("❌ Compilation failed for %s: %v", sub.Username, err)
-			storage.UpdateSubmissionStatus(sub.ID, "compilation_failed")
-			notifyFunc()
-			continue
+	ctx, logger := logs.With(ctx, "user", sub.Username)
+	logger.Info("compiling", "file", sub.Filename)
+
+	if err := CompileSubmission(ctx, sub, w.uploadDir); err != nil {
+		if ctx.Err() != nil {
+			return err
 		}
-		
-		log.Printf("✓ Compiled %s", sub.Username)
-		storage.UpdateSubmissionStatus(sub.ID, "completed")
-		
-		RunRoundRobinMatches(sub, uploadDir, broadcastFunc)
-		notifyFunc()
+		// Retrying won't fix the submission's own compile errors
+		logger.Warn("compilation failed", "err", err)
+		compileFailures.Inc()
+		storage.SaveCompileLog(sub.ID, err.Error())
+		storage.UpdateSubmissionStatus(sub.ID, "compilation_failed")
+		return nil
 	}
-	
-	// Check if queue is now empty
-	queuedPlayers := storage.GetQueuedPlayerNames()
-	if len(queuedPlayers) == 0 {
-		completeFunc()
+
+	if storage.IsCancelled(sub.ID) {
+		logger.Info("submission was cancelled")
+		return nil
 	}
 
+	logger.Info("compiled")
+	if err := storage.UpdateSubmissionStatus(sub.ID, "completed"); err != nil {
+		return err
+	}
+
+	if err := enqueueBenchmark(sub); err != nil {
+		return err
+	}
+	n, err := enqueueRoundRobin(sub)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		logger.Info("no new opponents, all matches already played")
+	} else {
+		logger.Info("starting round-robin", "opponents", n)
+	}
 	return nil
 }
+
+func (w *worker) runBenchmarkJob(ctx context.Context, job *storage.Job) error {
+	var payload storage.CompilePayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	sub, err := storage.GetSubmissionByID(payload.SubmissionID)
+	if err != nil {
+		return err
+	}
+	if !sub.IsActive || sub.Status != "completed" {
+		return nil
+	}
+	ctx, _ = logs.With(ctx, "user", sub.Username)
+	return RunBenchmark(ctx, sub)
+}
@@ -0,0 +1,773 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"battleship-arena/internal/diff"
+	"battleship-arena/internal/storage"
+)
+
+const adminCookie = "battleship_admin"
+
+type adminSessionKey struct{}
+
+// AdminRouter serves the web admin dashboard under /admin. Admins sign in
+// with a single-use link from "ssh host admin-login"; every change is a POST
+// carrying the session's CSRF token and is written to the audit log first.
+func AdminRouter(uploadDir string) http.Handler {
+	h := &adminHandlers{uploadDir: uploadDir}
+
+	r := chi.NewRouter()
+	r.Get("/login", h.login)
+	r.Group(func(r chi.Router) {
+		r.Use(requireAdmin)
+		r.Get("/", h.dashboard)
+		r.Get("/submission/{id}", h.submission)
+		r.Get("/submission/{id}/download", h.download)
+		r.Post("/submission/{id}/requeue", h.requeue)
+		r.Post("/submission/{id}/cancel", h.cancel)
+		r.Post("/submission/{id}/restore", h.restore)
+		r.Get("/submission/{id}/diff/{other}", h.diff)
+		r.Post("/match/{id}/invalidate", h.invalidate)
+		r.Post("/user/{username}/ban", h.ban)
+		r.Post("/user/{username}/unban", h.unban)
+		r.Post("/logout", h.logout)
+	})
+	return r
+}
+
+type adminHandlers struct {
+	uploadDir string
+}
+
+// requireAdmin loads the session from its cookie and checks the CSRF token
+// on anything that isn't a plain read
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var session *storage.AdminSession
+		if cookie, err := r.Cookie(adminCookie); err == nil {
+			var lookupErr error
+			session, lookupErr = storage.GetAdminSession(cookie.Value)
+			if lookupErr != nil {
+				http.Error(w, "Error loading session", http.StatusInternalServerError)
+				return
+			}
+		}
+		if session == nil {
+			http.Error(w, "Not signed in; get a login link with: ssh <host> admin-login", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			token := r.PostFormValue("csrf_token")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) != 1 {
+				http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminSessionKey{}, session)))
+	})
+}
+
+func adminSession(r *http.Request) *storage.AdminSession {
+	session, _ := r.Context().Value(adminSessionKey{}).(*storage.AdminSession)
+	return session
+}
+
+func (h *adminHandlers) login(w http.ResponseWriter, r *http.Request) {
+	session, token, err := storage.RedeemAdminLoginToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := storage.Audit(session.Username, "web_login", session.Username, r.RemoteAddr); err != nil {
+		slog.Error("audit log unavailable", "err", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     adminCookie,
+		Value:    token,
+		Path:     "/admin",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(externalURL, "https://"),
+		SameSite: http.SameSiteStrictMode,
+	})
+	// Drop the token from the address bar and browser history
+	http.Redirect(w, r, "/admin/", http.StatusSeeOther)
+}
+
+func (h *adminHandlers) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(adminCookie); err == nil {
+		storage.DeleteAdminSession(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: adminCookie, Value: "", Path: "/admin", MaxAge: -1})
+	fmt.Fprintln(w, "Signed out.")
+}
+
+// act audits an admin action and then runs it, redirecting back with the
+// outcome. Nothing happens if the audit entry can't be written.
+func (h *adminHandlers) act(w http.ResponseWriter, r *http.Request, back, action, target, detail string, fn func() (string, error)) {
+	session := adminSession(r)
+	detail = strings.TrimSpace(detail + " via web")
+	if err := storage.Audit(session.Username, action, target, detail); err != nil {
+		http.Error(w, "Audit log unavailable, action refused", http.StatusInternalServerError)
+		return
+	}
+
+	message, err := fn()
+	if err != nil {
+		message = "Error: " + err.Error()
+	}
+	http.Redirect(w, r, back+"?msg="+url.QueryEscape(message), http.StatusSeeOther)
+}
+
+func submissionFromRequest(w http.ResponseWriter, r *http.Request) *storage.Submission {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid submission", http.StatusBadRequest)
+		return nil
+	}
+	sub, err := storage.GetSubmissionByID(id)
+	if err != nil {
+		http.Error(w, "Submission not found", http.StatusNotFound)
+		return nil
+	}
+	return &sub
+}
+
+// submissionPath is where an upload is kept on disk
+func (h *adminHandlers) submissionPath(sub *storage.Submission) (string, error) {
+	return storage.SubmissionSourcePath(h.uploadDir, *sub)
+}
+
+func (h *adminHandlers) dashboard(w http.ResponseWriter, r *http.Request) {
+	queue, err := storage.GetQueue()
+	if err != nil {
+		http.Error(w, "Error loading queue", http.StatusInternalServerError)
+		return
+	}
+	failures, _ := storage.GetFailedSubmissions(20)
+	recent, _ := storage.GetRecentSubmissions(30)
+	users, _ := storage.GetAllUsers()
+	audit, _ := storage.GetAuditLog(50)
+
+	data := struct {
+		Session  *storage.AdminSession
+		Message  string
+		Queue    []storage.Submission
+		Failures []storage.Submission
+		Recent   []storage.Submission
+		Users    []storage.User
+		Audit    []storage.AuditEntry
+	}{
+		Session:  adminSession(r),
+		Message:  r.URL.Query().Get("msg"),
+		Queue:    queue,
+		Failures: failures,
+		Recent:   recent,
+		Users:    users,
+		Audit:    audit,
+	}
+	adminTmpl.ExecuteTemplate(w, "dashboard", data)
+}
+
+func (h *adminHandlers) submission(w http.ResponseWriter, r *http.Request) {
+	sub := submissionFromRequest(w, r)
+	if sub == nil {
+		return
+	}
+
+	compileLog, _ := storage.GetCompileLog(sub.ID)
+	logLines, _ := storage.GetSubmissionLog(sub.ID)
+	matches, err := storage.GetSubmissionMatches(sub.ID)
+	if err != nil {
+		http.Error(w, "Error loading matches", http.StatusInternalServerError)
+		return
+	}
+	source := ""
+	if content, err := storage.ReadSource(h.uploadDir, *sub); err == nil {
+		source = string(content)
+	}
+	versions, err := storage.GetUserSubmissionsWithStats(sub.ArenaID, sub.Username, -1)
+	if err != nil {
+		http.Error(w, "Error loading versions", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Session    *storage.AdminSession
+		Message    string
+		Submission *storage.Submission
+		CompileLog string
+		Log        []storage.SubmissionLogLine
+		Source     string
+		Matches    []storage.SubmissionMatch
+		Versions   []storage.SubmissionWithStats
+	}{
+		Session:    adminSession(r),
+		Message:    r.URL.Query().Get("msg"),
+		Submission: sub,
+		CompileLog: compileLog,
+		Log:        logLines,
+		Source:     source,
+		Matches:    matches,
+		Versions:   versions,
+	}
+	adminTmpl.ExecuteTemplate(w, "submission", data)
+}
+
+// diff compares a submission's source with another of the same user's,
+// older first
+func (h *adminHandlers) diff(w http.ResponseWriter, r *http.Request) {
+	sub := submissionFromRequest(w, r)
+	if sub == nil {
+		return
+	}
+	otherID, err := strconv.Atoi(chi.URLParam(r, "other"))
+	if err != nil {
+		http.Error(w, "Invalid submission", http.StatusBadRequest)
+		return
+	}
+	other, err := storage.GetSubmissionByID(otherID)
+	if err != nil || other.Username != sub.Username {
+		http.Error(w, "Submission not found", http.StatusNotFound)
+		return
+	}
+
+	older, newer := other, *sub
+	if older.ID > newer.ID {
+		older, newer = newer, older
+	}
+	var sources [2]string
+	for i, s := range []storage.Submission{older, newer} {
+		content, err := storage.ReadSource(h.uploadDir, s)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Source of submission %d not found", s.ID), http.StatusNotFound)
+			return
+		}
+		sources[i] = string(content)
+	}
+	unified, err := diff.Unified(
+		fmt.Sprintf("#%d/%s", older.ID, older.Filename),
+		fmt.Sprintf("#%d/%s", newer.ID, newer.Filename),
+		sources[0], sources[1],
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Session *storage.AdminSession
+		Message string
+		Older   storage.Submission
+		Newer   storage.Submission
+		Lines   []diffLine
+	}{
+		Session: adminSession(r),
+		Message: r.URL.Query().Get("msg"),
+		Older:   older,
+		Newer:   newer,
+		Lines:   diffLines(unified),
+	}
+	adminTmpl.ExecuteTemplate(w, "diff", data)
+}
+
+// diffLine is one line of a unified diff, with the class that colours it
+type diffLine struct {
+	Text  string
+	Class string
+}
+
+func diffLines(unified string) []diffLine {
+	var lines []diffLine
+	for _, text := range strings.Split(strings.TrimSuffix(unified, "\n"), "\n") {
+		if text == "" {
+			continue
+		}
+		class := ""
+		switch {
+		case strings.HasPrefix(text, "+++"), strings.HasPrefix(text, "---"):
+			class = "muted"
+		case strings.HasPrefix(text, "@@"):
+			class = "hunk"
+		case strings.HasPrefix(text, "+"):
+			class = "added"
+		case strings.HasPrefix(text, "-"):
+			class = "removed"
+		}
+		lines = append(lines, diffLine{text, class})
+	}
+	return lines
+}
+
+func (h *adminHandlers) download(w http.ResponseWriter, r *http.Request) {
+	sub := submissionFromRequest(w, r)
+	if sub == nil {
+		return
+	}
+	path, err := h.submissionPath(sub)
+	if err != nil {
+		http.Error(w, "Error locating submission", http.StatusInternalServerError)
+		return
+	}
+	if err := storage.Audit(adminSession(r).Username, "download_submission", sub.Username, fmt.Sprintf("submission %d (%s) via web", sub.ID, sub.Filename)); err != nil {
+		http.Error(w, "Audit log unavailable, download refused", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", sub.Filename))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeFile(w, r, path)
+}
+
+func (h *adminHandlers) requeue(w http.ResponseWriter, r *http.Request) {
+	sub := submissionFromRequest(w, r)
+	if sub == nil {
+		return
+	}
+	back := fmt.Sprintf("/admin/submission/%d", sub.ID)
+	h.act(w, r, back, "rerun_submission", sub.Username, fmt.Sprintf("submission %d (%s)", sub.ID, sub.Filename), func() (string, error) {
+		if err := storage.RequeueSubmission(sub.ID); err != nil {
+			return "", err
+		}
+		if err := storage.RecalculateAllGlicko2Ratings(); err != nil {
+			return "", err
+		}
+		NotifyLeaderboardUpdate()
+		return fmt.Sprintf("Submission %d queued to rerun", sub.ID), nil
+	})
+}
+
+// restore makes an older version of a submission the user's active one,
+// tested from scratch like a new upload
+func (h *adminHandlers) restore(w http.ResponseWriter, r *http.Request) {
+	sub := submissionFromRequest(w, r)
+	if sub == nil {
+		return
+	}
+	back := fmt.Sprintf("/admin/submission/%d", sub.ID)
+	h.act(w, r, back, "restore_submission", sub.Username, fmt.Sprintf("submission %d (%s)", sub.ID, sub.Filename), func() (string, error) {
+		id, err := storage.RestoreVersion(h.uploadDir, *sub)
+		if err != nil {
+			return "", err
+		}
+		NotifyLeaderboardUpdate()
+		return fmt.Sprintf("Restored as submission %d, queued for testing", id), nil
+	})
+}
+
+func (h *adminHandlers) cancel(w http.ResponseWriter, r *http.Request) {
+	sub := submissionFromRequest(w, r)
+	if sub == nil {
+		return
+	}
+	h.act(w, r, "/admin/", "cancel_submission", sub.Username, fmt.Sprintf("submission %d (%s)", sub.ID, sub.Filename), func() (string, error) {
+		return fmt.Sprintf("Cancelled submission %d", sub.ID), storage.CancelSubmission(sub.ID)
+	})
+}
+
+func (h *adminHandlers) invalidate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid match", http.StatusBadRequest)
+		return
+	}
+	// Return to the submission page the button was on
+	back := "/admin/"
+	if sub, err := strconv.Atoi(r.PostFormValue("submission")); err == nil {
+		back = fmt.Sprintf("/admin/submission/%d", sub)
+	}
+	h.act(w, r, back, "invalidate_match", strconv.Itoa(id), fmt.Sprintf("match %d", id), func() (string, error) {
+		if err := storage.InvalidateMatch(id); err != nil {
+			return "", err
+		}
+		if err := storage.RecalculateAllGlicko2Ratings(); err != nil {
+			return "", err
+		}
+		NotifyLeaderboardUpdate()
+		return fmt.Sprintf("Match %d invalidated and ratings recalculated", id), nil
+	})
+}
+
+func (h *adminHandlers) ban(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	if username == adminSession(r).Username {
+		http.Error(w, "You can't ban yourself", http.StatusBadRequest)
+		return
+	}
+	h.act(w, r, "/admin/", "revoke_user", username, "", func() (string, error) {
+		if err := storage.RevokeUser(username); err != nil {
+			return "", err
+		}
+		NotifyLeaderboardUpdate()
+		return "Banned " + username, nil
+	})
+}
+
+func (h *adminHandlers) unban(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	h.act(w, r, "/admin/", "restore_user", username, "", func() (string, error) {
+		return "Restored " + username, storage.RestoreUser(username)
+	})
+}
+
+var adminTmpl = template.Must(template.New("admin").Parse(adminHTML))
+
+const adminHTML = `
+{{define "head"}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>Admin - Battleship Arena</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="robots" content="noindex">
+    <link rel="icon" href="data:image/svg+xml,<svg xmlns=%22http://www.w3.org/2000/svg%22 viewBox=%220 0 100 100%22><text y=%22.9em%22 font-size=%2290%22>⚓</text></svg>">
+    <style>
+        * {
+            margin: 0;
+            padding: 0;
+            box-sizing: border-box;
+        }
+
+        body {
+            font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif;
+            background: #0f172a;
+            color: #e2e8f0;
+            min-height: 100vh;
+            padding: 2rem 1rem;
+        }
+
+        .container {
+            max-width: 1200px;
+            margin: 0 auto;
+        }
+
+        h1 {
+            font-size: 2.5rem;
+            font-weight: 700;
+            margin-bottom: 0.5rem;
+            background: linear-gradient(135deg, #60a5fa 0%, #a78bfa 100%);
+            -webkit-background-clip: text;
+            -webkit-text-fill-color: transparent;
+        }
+
+        h2 {
+            font-size: 1.25rem;
+            margin: 2rem 0 0.75rem;
+        }
+
+        a {
+            color: #60a5fa;
+            text-decoration: none;
+        }
+
+        a:hover {
+            text-decoration: underline;
+        }
+
+        .topbar {
+            display: flex;
+            justify-content: space-between;
+            align-items: center;
+            color: #94a3b8;
+            font-size: 0.9rem;
+            margin-bottom: 1rem;
+        }
+
+        .message {
+            background: #1e293b;
+            border: 1px solid #334155;
+            border-left: 4px solid #10b981;
+            border-radius: 8px;
+            padding: 0.75rem 1rem;
+            margin: 1rem 0;
+        }
+
+        table {
+            width: 100%;
+            border-collapse: collapse;
+            background: #1e293b;
+            border: 1px solid #334155;
+            border-radius: 12px;
+            overflow: hidden;
+            font-size: 0.9rem;
+        }
+
+        th, td {
+            text-align: left;
+            padding: 0.5rem 0.75rem;
+            border-bottom: 1px solid #334155;
+        }
+
+        th {
+            color: #94a3b8;
+            font-weight: 600;
+        }
+
+        form {
+            display: inline;
+        }
+
+        button {
+            background: #334155;
+            color: #e2e8f0;
+            border: 1px solid #475569;
+            border-radius: 6px;
+            padding: 0.2rem 0.6rem;
+            cursor: pointer;
+            font-size: 0.8rem;
+        }
+
+        button.danger {
+            border-color: #ef4444;
+            color: #fca5a5;
+        }
+
+        pre {
+            background: #1e293b;
+            border: 1px solid #334155;
+            border-radius: 8px;
+            padding: 1rem;
+            overflow-x: auto;
+            font-size: 0.8rem;
+            max-height: 30rem;
+        }
+
+        .muted {
+            color: #64748b;
+        }
+
+        .bad {
+            color: #f87171;
+        }
+
+        .added {
+            color: #4ade80;
+        }
+
+        .removed {
+            color: #f87171;
+        }
+
+        .hunk {
+            color: #38bdf8;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="topbar">
+            <a href="/admin/">Admin dashboard</a>
+            <span>
+                Signed in as {{.Session.Username}}
+                <form method="post" action="/admin/logout">
+                    <input type="hidden" name="csrf_token" value="{{.Session.CSRFToken}}">
+                    <button>Sign out</button>
+                </form>
+            </span>
+        </div>
+        {{if .Message}}<div class="message">{{.Message}}</div>{{end}}
+{{end}}
+
+{{define "foot"}}
+    </div>
+</body>
+</html>
+{{end}}
+
+{{define "dashboard"}}
+{{template "head" .}}
+        <h1>Admin</h1>
+
+        <h2>Worker queue</h2>
+        <table>
+            <tr><th>ID</th><th>User</th><th>File</th><th>Status</th><th>Uploaded</th><th></th></tr>
+            {{range .Queue}}
+            <tr>
+                <td><a href="/admin/submission/{{.ID}}">{{.ID}}</a></td>
+                <td>{{.Username}}</td>
+                <td>{{.Filename}}</td>
+                <td>{{.Status}}</td>
+                <td>{{.UploadTime.Format "Jan 2 15:04"}}</td>
+                <td>
+                    <form method="post" action="/admin/submission/{{.ID}}/cancel">
+                        <input type="hidden" name="csrf_token" value="{{$.Session.CSRFToken}}">
+                        <button class="danger">Cancel</button>
+                    </form>
+                </td>
+            </tr>
+            {{else}}
+            <tr><td colspan="6" class="muted">Queue is empty</td></tr>
+            {{end}}
+        </table>
+
+        <h2>Sandbox failures</h2>
+        <table>
+            <tr><th>ID</th><th>User</th><th>File</th><th>Uploaded</th></tr>
+            {{range .Failures}}
+            <tr>
+                <td><a href="/admin/submission/{{.ID}}">{{.ID}}</a></td>
+                <td>{{.Username}}</td>
+                <td>{{.Filename}}</td>
+                <td>{{.UploadTime.Format "Jan 2 15:04"}}</td>
+            </tr>
+            {{else}}
+            <tr><td colspan="4" class="muted">No failures</td></tr>
+            {{end}}
+        </table>
+
+        <h2>Recent submissions</h2>
+        <table>
+            <tr><th>ID</th><th>User</th><th>File</th><th>Status</th><th>Uploaded</th><th></th></tr>
+            {{range .Recent}}
+            <tr>
+                <td><a href="/admin/submission/{{.ID}}">{{.ID}}</a></td>
+                <td>{{.Username}}</td>
+                <td>{{.Filename}}</td>
+                <td>{{.Status}}{{if not .IsActive}} <span class="muted">(replaced)</span>{{end}}</td>
+                <td>{{.UploadTime.Format "Jan 2 15:04"}}</td>
+                <td><a href="/admin/submission/{{.ID}}/download">Download</a></td>
+            </tr>
+            {{end}}
+        </table>
+
+        <h2>Users</h2>
+        <table>
+            <tr><th>Username</th><th>Name</th><th>Role</th><th>State</th><th></th></tr>
+            {{range .Users}}
+            <tr>
+                <td>{{.Username}}</td>
+                <td>{{.Name}}</td>
+                <td>{{.Role}}</td>
+                <td>{{if .IsRevoked}}<span class="bad">banned</span>{{else}}active{{end}}</td>
+                <td>
+                    {{if .IsRevoked}}
+                    <form method="post" action="/admin/user/{{.Username}}/unban">
+                        <input type="hidden" name="csrf_token" value="{{$.Session.CSRFToken}}">
+                        <button>Restore</button>
+                    </form>
+                    {{else if ne .Username $.Session.Username}}
+                    <form method="post" action="/admin/user/{{.Username}}/ban" onsubmit="return confirm('Ban {{.Username}}?')">
+                        <input type="hidden" name="csrf_token" value="{{$.Session.CSRFToken}}">
+                        <button class="danger">Ban</button>
+                    </form>
+                    {{end}}
+                </td>
+            </tr>
+            {{end}}
+        </table>
+
+        <h2>Audit log</h2>
+        <table>
+            <tr><th>When</th><th>Actor</th><th>Action</th><th>Target</th><th>Detail</th></tr>
+            {{range .Audit}}
+            <tr>
+                <td>{{.CreatedAt.Format "Jan 2 15:04:05"}}</td>
+                <td>{{.Actor}}</td>
+                <td>{{.Action}}</td>
+                <td>{{.Target}}</td>
+                <td class="muted">{{.Detail}}</td>
+            </tr>
+            {{end}}
+        </table>
+{{template "foot" .}}
+{{end}}
+
+{{define "submission"}}
+{{template "head" .}}
+        {{with .Submission}}
+        <h1>Submission {{.ID}}</h1>
+        <p class="muted">{{.Username}} · {{.Filename}} · {{.Status}}{{if not .IsActive}} (replaced){{end}} · uploaded {{.UploadTime.Format "Jan 2, 2006 15:04"}}{{if .RestoredFrom}} · restored from <a href="/admin/submission/{{.RestoredFrom}}">{{.RestoredFrom}}</a>{{end}}</p>
+        <p style="margin-top: 1rem;">
+            <a href="/admin/submission/{{.ID}}/download">Download</a>
+            {{if .IsActive}}
+            <form method="post" action="/admin/submission/{{.ID}}/requeue" onsubmit="return confirm('Throw away the matches of this submission and rerun them?')">
+                <input type="hidden" name="csrf_token" value="{{$.Session.CSRFToken}}">
+                <button>Rerun matches</button>
+            </form>
+            {{else if .ContentHash}}
+            <form method="post" action="/admin/submission/{{.ID}}/restore" onsubmit="return confirm('Make this version active again? The current one is replaced and this one is tested from scratch.')">
+                <input type="hidden" name="csrf_token" value="{{$.Session.CSRFToken}}">
+                <button>Restore this version</button>
+            </form>
+            {{end}}
+        </p>
+        {{end}}
+
+        <h2>Versions</h2>
+        <table>
+            <tr><th>ID</th><th>Uploaded</th><th>Hash</th><th>Status</th><th>Rating</th><th>W-L</th><th></th></tr>
+            {{range .Versions}}
+            <tr>
+                <td>{{if eq .ID $.Submission.ID}}{{.ID}}{{else}}<a href="/admin/submission/{{.ID}}">{{.ID}}</a>{{end}}</td>
+                <td>{{.UploadTime.Format "Jan 2 15:04"}}</td>
+                <td>{{if .ContentHash}}<code>{{slice .ContentHash 0 8}}</code>{{else}}<span class="muted">-</span>{{end}}</td>
+                <td>{{.Status}}{{if .IsActive}} (active){{end}}{{if .RestoredFrom}} <span class="muted">from {{.RestoredFrom}}</span>{{end}}</td>
+                <td>{{if .HasMatches}}{{.Rating}}{{end}}</td>
+                <td>{{if .HasMatches}}{{.Wins}}-{{.Losses}}{{end}}</td>
+                <td>{{if ne .ID $.Submission.ID}}<a href="/admin/submission/{{$.Submission.ID}}/diff/{{.ID}}">Diff</a>{{end}}</td>
+            </tr>
+            {{end}}
+        </table>
+
+        <h2>Compile log</h2>
+        {{if .CompileLog}}<pre>{{.CompileLog}}</pre>{{else}}<p class="muted">Empty</p>{{end}}
+
+        <h2>Log</h2>
+        {{if .Log}}<pre>{{range .Log}}{{.LoggedAt.Format "2006-01-02 15:04:05"}} {{printf "%-5s" .Level}} {{.Line}}
+{{end}}</pre>{{else}}<p class="muted">Empty</p>{{end}}
+
+        <h2>Matches</h2>
+        <table>
+            <tr><th>ID</th><th>Opponent</th><th>Wins</th><th>Losses</th><th>Avg moves</th><th>Played</th><th></th></tr>
+            {{range .Matches}}
+            <tr>
+                <td>{{.ID}}</td>
+                <td>{{.Opponent}}</td>
+                <td>{{.Wins}}</td>
+                <td>{{.Losses}}</td>
+                <td>{{.AvgMoves}}</td>
+                <td>{{.Timestamp.Format "Jan 2 15:04"}}</td>
+                <td>
+                    {{if .IsValid}}
+                    <form method="post" action="/admin/match/{{.ID}}/invalidate">
+                        <input type="hidden" name="csrf_token" value="{{$.Session.CSRFToken}}">
+                        <input type="hidden" name="submission" value="{{$.Submission.ID}}">
+                        <button class="danger">Invalidate</button>
+                    </form>
+                    {{else}}<span class="muted">invalid</span>{{end}}
+                </td>
+            </tr>
+            {{else}}
+            <tr><td colspan="7" class="muted">No matches</td></tr>
+            {{end}}
+        </table>
+
+        <h2>Source</h2>
+        {{if .Source}}<pre>{{.Source}}</pre>{{else}}<p class="muted">Source file not found</p>{{end}}
+{{template "foot" .}}
+{{end}}
+
+{{define "diff"}}
+{{template "head" .}}
+        <h1>Submission {{.Older.ID}} → {{.Newer.ID}}</h1>
+        <p class="muted">{{.Newer.Username}} · <a href="/admin/submission/{{.Older.ID}}">{{.Older.ID}}</a> uploaded {{.Older.UploadTime.Format "Jan 2, 2006 15:04"}} · <a href="/admin/submission/{{.Newer.ID}}">{{.Newer.ID}}</a> uploaded {{.Newer.UploadTime.Format "Jan 2, 2006 15:04"}}</p>
+        {{if .Lines}}<pre>{{range .Lines}}<span class="{{.Class}}">{{.Text}}</span>
+{{end}}</pre>{{else}}<p class="muted">The sources are the same</p>{{end}}
+{{template "foot" .}}
+{{end}}
+`
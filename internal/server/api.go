@@ -0,0 +1,923 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"battleship-arena/internal/storage"
+)
+
+// The /api/v1 responses. Field names are snake_case and part of the API
+// contract: add fields freely, but never rename or remove one within v1.
+// Times are RFC 3339; a time or value that doesn't exist yet is null.
+
+type apiPlayer struct {
+	Rank              int        `json:"rank"`
+	Username          string     `json:"username"`
+	Rating            int        `json:"rating"`
+	RD                int        `json:"rd"`
+	Wins              int        `json:"wins"`
+	Losses            int        `json:"losses"`
+	WinPct            float64    `json:"win_pct"`
+	AvgMoves          float64    `json:"avg_moves"`
+	BenchmarkShots    *float64   `json:"benchmark_shots"`
+	BenchmarkBoardSet string     `json:"benchmark_board_set"`
+	Pending           bool       `json:"pending"`
+	Broken            bool       `json:"broken"`
+	IsBot             bool       `json:"is_bot"`
+	LastPlayed        *time.Time `json:"last_played"`
+}
+
+type apiPlayerDetail struct {
+	Username         string         `json:"username"`
+	Name             string         `json:"name"`
+	Bio              string         `json:"bio"`
+	Link             string         `json:"link"`
+	JoinedAt         *time.Time     `json:"joined_at"`
+	Standing         *apiPlayer     `json:"standing"`
+	ActiveSubmission *apiSubmission `json:"active_submission"`
+}
+
+type apiSubmission struct {
+	ID         int                 `json:"id"`
+	Username   string              `json:"username"`
+	Filename   string              `json:"filename"`
+	UploadedAt time.Time           `json:"uploaded_at"`
+	Status     string              `json:"status"`
+	Active     bool                `json:"active"`
+	Stats      *apiSubmissionStats `json:"stats"`
+}
+
+type apiSubmissionStats struct {
+	Rating         int        `json:"rating"`
+	RD             int        `json:"rd"`
+	Wins           int        `json:"wins"`
+	Losses         int        `json:"losses"`
+	WinPct         float64    `json:"win_pct"`
+	AvgMoves       float64    `json:"avg_moves"`
+	BenchmarkShots *float64   `json:"benchmark_shots"`
+	LastPlayed     *time.Time `json:"last_played"`
+}
+
+type apiMatchSide struct {
+	SubmissionID int    `json:"submission_id"`
+	Username     string `json:"username"`
+	Wins         int    `json:"wins"`
+	AvgMoves     int    `json:"avg_moves"`
+}
+
+type apiMatch struct {
+	ID       int          `json:"id"`
+	Player1  apiMatchSide `json:"player1"`
+	Player2  apiMatchSide `json:"player2"`
+	Winner   string       `json:"winner"`
+	PlayedAt time.Time    `json:"played_at"`
+}
+
+type apiHeadToHead struct {
+	Player     string     `json:"player"`
+	Opponent   string     `json:"opponent"`
+	Matches    int        `json:"matches"`
+	Wins       int        `json:"wins"`
+	Losses     int        `json:"losses"`
+	Ties       int        `json:"ties"`
+	GamesWon   int        `json:"games_won"`
+	GamesLost  int        `json:"games_lost"`
+	LastPlayed *time.Time `json:"last_played"`
+}
+
+type apiRatingPoint struct {
+	Rating     int       `json:"rating"`
+	RD         int       `json:"rd"`
+	Volatility float64   `json:"volatility"`
+	MatchID    int       `json:"match_id"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+type apiTournament struct {
+	ID                 int       `json:"id"`
+	Status             string    `json:"status"`
+	CurrentRound       int       `json:"current_round"`
+	CreatedAt          time.Time `json:"created_at"`
+	Winner             *string   `json:"winner"`
+	WinnerSubmissionID *int      `json:"winner_submission_id"`
+}
+
+type apiBracketSide struct {
+	SubmissionID int    `json:"submission_id"`
+	Username     string `json:"username"`
+	Wins         int    `json:"wins"`
+}
+
+type apiBracketMatch struct {
+	ID       int             `json:"id"`
+	Round    int             `json:"round"`
+	Position int             `json:"position"`
+	Status   string          `json:"status"`
+	Player1  *apiBracketSide `json:"player1"`
+	Player2  *apiBracketSide `json:"player2"`
+	Winner   *string         `json:"winner"`
+}
+
+type apiMatrixPlayer struct {
+	Username     string `json:"username"`
+	SubmissionID int    `json:"submission_id"`
+	Rating       int    `json:"rating"`
+	IsBot        bool   `json:"is_bot"`
+}
+
+type apiMatrixCell struct {
+	MatchID int     `json:"match_id"`
+	Wins    int     `json:"wins"`
+	Losses  int     `json:"losses"`
+	WinPct  float64 `json:"win_pct"`
+}
+
+// apiMatrix is cells[i][j] for players[i] against players[j], null where
+// they haven't played and on the diagonal
+type apiMatrix struct {
+	Players []apiMatrixPlayer  `json:"players"`
+	Cells   [][]*apiMatrixCell `json:"cells"`
+}
+
+type apiJobCounts struct {
+	Queued  int `json:"queued"`
+	Running int `json:"running"`
+	Dead    int `json:"dead"`
+}
+
+type apiJob struct {
+	ID        int       `json:"id"`
+	Type      string    `json:"type"`
+	Attempts  int       `json:"attempts"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type apiQueue struct {
+	QueuedPlayers []string     `json:"queued_players"`
+	Jobs          apiJobCounts `json:"jobs"`
+	Running       []apiJob     `json:"running"`
+}
+
+// apiPage is the paging part of every paginated list. Next is the URL of the
+// following page, or null on the last one.
+type apiPage struct {
+	Total  int     `json:"total"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+	Next   *string `json:"next"`
+}
+
+type apiPlayerPage struct {
+	apiPage
+	Items []apiPlayer `json:"items"`
+}
+
+type apiMatchPage struct {
+	apiPage
+	Items []apiMatch `json:"items"`
+}
+
+type apiErrorBody struct {
+	Error apiError `json:"error"`
+}
+
+// apiError is what every failed request gets back, with the status it names
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func apiBadRequest(format string, args ...interface{}) *apiError {
+	return &apiError{Status: http.StatusBadRequest, Code: "bad_request", Message: fmt.Sprintf(format, args...)}
+}
+
+func apiNotFound(format string, args ...interface{}) *apiError {
+	return &apiError{Status: http.StatusNotFound, Code: "not_found", Message: fmt.Sprintf(format, args...)}
+}
+
+// Page sizes for paginated lists
+const (
+	apiDefaultLimit = 50
+	apiMaxLimit     = 200
+)
+
+// apiHandler serves one endpoint. It returns the response body, or an
+// error: an *apiError is passed on as is, anything else is logged and
+// reported as an internal error.
+type apiHandler func(r *http.Request, arena *storage.Arena) (interface{}, error)
+
+// apiParam is a query or path parameter, as listed in the OpenAPI document
+type apiParam struct {
+	Name        string
+	In          string // "query" or "path"
+	Type        string // "string", "integer" or "date-time"
+	Description string
+}
+
+// apiRoute is one endpoint. The router and the OpenAPI document are both
+// built from apiRoutes, so the document can't drift from what is served.
+type apiRoute struct {
+	Path     string
+	Summary  string
+	Params   []apiParam
+	Response interface{} // a value of the response type, for its schema
+	Handler  apiHandler
+}
+
+var (
+	pageParams = []apiParam{
+		{Name: "limit", In: "query", Type: "integer", Description: fmt.Sprintf("Page size, 1 to %d (default %d)", apiMaxLimit, apiDefaultLimit)},
+		{Name: "offset", In: "query", Type: "integer", Description: "Items to skip (default 0)"},
+	}
+	usernameParam = apiParam{Name: "username", In: "path", Type: "string"}
+	idParam       = apiParam{Name: "id", In: "path", Type: "integer"}
+)
+
+var apiRoutes []apiRoute
+
+func init() {
+	apiRoutes = []apiRoute{
+		{
+			Path:    "/players",
+			Summary: "Leaderboard of the arena's current season",
+			Params: append([]apiParam{
+				{Name: "sort", In: "query", Type: "string", Description: "rating (default) or benchmark"},
+				{Name: "bots", In: "query", Type: "string", Description: "hide to leave out reference bots"},
+			}, pageParams...),
+			Response: apiPlayerPage{},
+			Handler:  apiListPlayers,
+		},
+		{
+			Path:     "/players/{username}",
+			Summary:  "A player's profile, standing and active submission",
+			Params:   []apiParam{usernameParam},
+			Response: apiPlayerDetail{},
+			Handler:  apiGetPlayer,
+		},
+		{
+			Path:     "/players/{username}/submissions",
+			Summary:  "A player's latest submissions with their stats, newest first",
+			Params:   []apiParam{usernameParam},
+			Response: []apiSubmission{},
+			Handler:  apiPlayerSubmissions,
+		},
+		{
+			Path:     "/players/{username}/rating-history",
+			Summary:  "Rating after each match of the player's active submission",
+			Params:   []apiParam{usernameParam},
+			Response: []apiRatingPoint{},
+			Handler:  apiRatingHistory,
+		},
+		{
+			Path:     "/players/{username}/head-to-head",
+			Summary:  "The player's record against each opponent",
+			Params:   []apiParam{usernameParam},
+			Response: []apiHeadToHead{},
+			Handler:  apiPlayerHeadToHead,
+		},
+		{
+			Path:     "/head-to-head/{username}/{opponent}",
+			Summary:  "One player's record against another",
+			Params:   []apiParam{usernameParam, {Name: "opponent", In: "path", Type: "string"}},
+			Response: apiHeadToHead{},
+			Handler:  apiHeadToHeadPair,
+		},
+		{
+			Path:     "/submissions/{id}",
+			Summary:  "One submission",
+			Params:   []apiParam{idParam},
+			Response: apiSubmission{},
+			Handler:  apiGetSubmission,
+		},
+		{
+			Path:    "/matches",
+			Summary: "Valid round-robin matches, newest first",
+			Params: append([]apiParam{
+				{Name: "player", In: "query", Type: "string", Description: "Only matches this user played"},
+				{Name: "opponent", In: "query", Type: "string", Description: "Only matches against this user"},
+				{Name: "since", In: "query", Type: "date-time", Description: "Played at or after this time (RFC 3339 or YYYY-MM-DD)"},
+				{Name: "until", In: "query", Type: "date-time", Description: "Played before this time (RFC 3339 or YYYY-MM-DD)"},
+			}, pageParams...),
+			Response: apiMatchPage{},
+			Handler:  apiListMatches,
+		},
+		{
+			Path:     "/matches/{id}",
+			Summary:  "One match",
+			Params:   []apiParam{idParam},
+			Response: apiMatch{},
+			Handler:  apiGetMatch,
+		},
+		{
+			Path:    "/matrix",
+			Summary: "Every active submission's win percentage against every other",
+			Params: []apiParam{
+				{Name: "sort", In: "query", Type: "string", Description: "rating (default) or name"},
+			},
+			Response: apiMatrix{},
+			Handler:  apiGetMatrix,
+		},
+		{
+			Path:     "/tournaments",
+			Summary:  "The arena's tournaments, newest first",
+			Response: []apiTournament{},
+			Handler:  apiListTournaments,
+		},
+		{
+			Path:     "/tournaments/{id}",
+			Summary:  "One tournament",
+			Params:   []apiParam{idParam},
+			Response: apiTournament{},
+			Handler:  apiGetTournament,
+		},
+		{
+			Path:     "/tournaments/{id}/bracket",
+			Summary:  "A tournament's bracket, by round and position",
+			Params:   []apiParam{idParam},
+			Response: []apiBracketMatch{},
+			Handler:  apiTournamentBracket,
+		},
+		{
+			Path:     "/queue",
+			Summary:  "Submissions waiting to be tested and the state of the server-wide job queue",
+			Response: apiQueue{},
+			Handler:  apiQueueStatus,
+		},
+		{
+			Path:     "/openapi.json",
+			Summary:  "This document",
+			Response: map[string]interface{}{},
+			Handler:  apiOpenAPI,
+		},
+	}
+}
+
+// APIRouter serves /api/v1 for the arena of the enclosing route
+func APIRouter() http.Handler {
+	r := chi.NewRouter()
+	for _, route := range apiRoutes {
+		r.Get(route.Path, serveAPI(route.Handler))
+	}
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, apiNotFound("no such endpoint: %s", r.URL.Path))
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, &apiError{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: "the API is read-only; use GET"})
+	})
+	return r
+}
+
+func serveAPI(handler apiHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug := chi.URLParam(r, "arena")
+		if slug == "" {
+			slug = storage.DefaultArenaSlug
+		}
+		arena, err := storage.GetArena(slug)
+		if err == nil && arena == nil {
+			err = apiNotFound("no arena %q", slug)
+		}
+		var body interface{}
+		if err == nil {
+			body, err = handler(r, arena)
+		}
+		if err != nil {
+			apiErr, ok := err.(*apiError)
+			if !ok {
+				slog.Error("API request failed", "path", r.URL.Path, "err", err)
+				apiErr = &apiError{Status: http.StatusInternalServerError, Code: "internal", Message: "internal error"}
+			}
+			writeAPIError(w, apiErr)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, err *apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(apiErrorBody{Error: *err})
+}
+
+// apiPaging reads ?limit= and ?offset=
+func apiPaging(r *http.Request) (apiPage, error) {
+	page := apiPage{Limit: apiDefaultLimit}
+	for _, p := range []struct {
+		name  string
+		value *int
+		min   int
+		max   int
+	}{
+		{"limit", &page.Limit, 1, apiMaxLimit},
+		{"offset", &page.Offset, 0, 1<<31 - 1},
+	} {
+		s := r.URL.Query().Get(p.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < p.min || n > p.max {
+			return page, apiBadRequest("%s must be a whole number from %d to %d", p.name, p.min, p.max)
+		}
+		*p.value = n
+	}
+	return page, nil
+}
+
+// finish fills in the total and the link to the next page, if there is one
+func (p apiPage) finish(r *http.Request, total int) apiPage {
+	p.Total = total
+	if p.Offset+p.Limit < total {
+		next := *r.URL
+		q := next.Query()
+		q.Set("offset", strconv.Itoa(p.Offset+p.Limit))
+		q.Set("limit", strconv.Itoa(p.Limit))
+		next.RawQuery = q.Encode()
+		link := next.String()
+		p.Next = &link
+	}
+	return p
+}
+
+// apiTimeParam reads an RFC 3339 time or a plain date from the query string
+func apiTimeParam(r *http.Request, name string) (time.Time, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, apiBadRequest("%s must be an RFC 3339 time or a YYYY-MM-DD date", name)
+}
+
+func apiIDParam(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		return 0, apiNotFound("no such id %q", chi.URLParam(r, "id"))
+	}
+	return id, nil
+}
+
+// apiTimePtr is nil for the zero time, which the API reports as null
+func apiTimePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func toAPIPlayer(rank int, e storage.LeaderboardEntry) apiPlayer {
+	p := apiPlayer{
+		Rank:       rank,
+		Username:   e.Username,
+		Rating:     e.Rating,
+		RD:         e.RD,
+		Wins:       e.Wins,
+		Losses:     e.Losses,
+		WinPct:     e.WinPct,
+		AvgMoves:   e.AvgMoves,
+		Pending:    e.IsPending,
+		Broken:     e.IsBroken,
+		IsBot:      e.IsBot,
+		LastPlayed: apiTimePtr(e.LastPlayed),
+	}
+	if e.HasBenchmark {
+		shots := e.BenchmarkShots
+		p.BenchmarkShots = &shots
+		p.BenchmarkBoardSet = e.BenchmarkBoardSet
+	}
+	return p
+}
+
+func toAPISubmission(s storage.Submission) apiSubmission {
+	return apiSubmission{
+		ID:         s.ID,
+		Username:   s.Username,
+		Filename:   s.Filename,
+		UploadedAt: s.UploadTime,
+		Status:     s.Status,
+		Active:     s.IsActive,
+	}
+}
+
+func toAPISubmissionWithStats(s storage.SubmissionWithStats) apiSubmission {
+	sub := toAPISubmission(s.Submission)
+	sub.Stats = &apiSubmissionStats{
+		Rating:     s.Rating,
+		RD:         s.RD,
+		Wins:       s.Wins,
+		Losses:     s.Losses,
+		WinPct:     s.WinPct,
+		AvgMoves:   s.AvgMoves,
+		LastPlayed: apiTimePtr(s.LastPlayed),
+	}
+	if s.HasBenchmark {
+		shots := s.BenchmarkShots
+		sub.Stats.BenchmarkShots = &shots
+	}
+	return sub
+}
+
+func toAPIMatch(m storage.Match) apiMatch {
+	return apiMatch{
+		ID:       m.ID,
+		Player1:  apiMatchSide{SubmissionID: m.Player1ID, Username: m.Player1, Wins: m.Player1Wins, AvgMoves: m.Player1Moves},
+		Player2:  apiMatchSide{SubmissionID: m.Player2ID, Username: m.Player2, Wins: m.Player2Wins, AvgMoves: m.Player2Moves},
+		Winner:   m.Winner,
+		PlayedAt: m.Timestamp,
+	}
+}
+
+func toAPITournament(t storage.Tournament) (apiTournament, error) {
+	tournament := apiTournament{
+		ID:           t.ID,
+		Status:       t.Status,
+		CurrentRound: t.CurrentRound,
+		CreatedAt:    t.CreatedAt,
+	}
+	if t.WinnerID != 0 {
+		winner, err := storage.GetSubmissionByID(t.WinnerID)
+		if err != nil {
+			return tournament, err
+		}
+		tournament.Winner = &winner.Username
+		tournament.WinnerSubmissionID = &winner.ID
+	}
+	return tournament, nil
+}
+
+func apiListPlayers(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	page, err := apiPaging(r)
+	if err != nil {
+		return nil, err
+	}
+	query := leaderboardQuery(r, -1)
+	query.ArenaID = arena.ID
+	entries, err := storage.QueryLeaderboard(query)
+	if err != nil {
+		return nil, err
+	}
+
+	players := []apiPlayer{}
+	for i := page.Offset; i < len(entries) && i < page.Offset+page.Limit; i++ {
+		players = append(players, toAPIPlayer(i+1, entries[i]))
+	}
+	return apiPlayerPage{apiPage: page.finish(r, len(entries)), Items: players}, nil
+}
+
+func apiGetPlayer(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	username := chi.URLParam(r, "username")
+	user, err := storage.GetUserByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	sub, err := storage.GetActiveSubmission(arena.ID, username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil && sub == nil {
+		return nil, apiNotFound("no player %q", username)
+	}
+
+	player := apiPlayerDetail{Username: username}
+	if user != nil {
+		player.Name = user.Name
+		player.Bio = user.Bio
+		player.Link = user.Link
+		player.JoinedAt = apiTimePtr(user.CreatedAt)
+	}
+	if sub != nil {
+		active := toAPISubmission(*sub)
+		player.ActiveSubmission = &active
+	}
+
+	query := storage.LeaderboardQuery{ArenaID: arena.ID, Limit: -1}
+	entries, err := storage.QueryLeaderboard(query)
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entries {
+		if e.Username == username {
+			standing := toAPIPlayer(i+1, e)
+			player.Standing = &standing
+			break
+		}
+	}
+	return player, nil
+}
+
+func apiPlayerSubmissions(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	subs, err := storage.GetUserSubmissionsWithStats(arena.ID, chi.URLParam(r, "username"), -1)
+	if err != nil {
+		return nil, err
+	}
+	list := []apiSubmission{}
+	for _, s := range subs {
+		list = append(list, toAPISubmissionWithStats(s))
+	}
+	return list, nil
+}
+
+func apiRatingHistory(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	username := chi.URLParam(r, "username")
+	sub, err := storage.GetActiveSubmission(arena.ID, username)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, apiNotFound("%s has no active submission", username)
+	}
+	history, err := storage.GetRatingHistory(sub.ID)
+	if err != nil {
+		return nil, err
+	}
+	points := []apiRatingPoint{}
+	for _, h := range history {
+		points = append(points, apiRatingPoint{
+			Rating:     h.Rating,
+			RD:         h.RD,
+			Volatility: h.Volatility,
+			MatchID:    h.MatchID,
+			RecordedAt: h.Timestamp,
+		})
+	}
+	return points, nil
+}
+
+// headToHead totals a player's matches by opponent, in order of first
+// appearance in matches. A tied match counts as a tie rather than going to
+// the side that won the coin flip.
+func headToHead(player string, matches []storage.Match) []apiHeadToHead {
+	var records []apiHeadToHead
+	index := map[string]int{}
+	for _, m := range matches {
+		opponent, wins, losses := m.Player2, m.Player1Wins, m.Player2Wins
+		if m.Player2 == player {
+			opponent, wins, losses = m.Player1, m.Player2Wins, m.Player1Wins
+		}
+		i, ok := index[opponent]
+		if !ok {
+			i = len(records)
+			index[opponent] = i
+			records = append(records, apiHeadToHead{Player: player, Opponent: opponent})
+		}
+		rec := &records[i]
+		rec.Matches++
+		rec.GamesWon += wins
+		rec.GamesLost += losses
+		switch {
+		case wins == losses:
+			rec.Ties++
+		case m.Winner == player:
+			rec.Wins++
+		case m.Winner == opponent:
+			rec.Losses++
+		}
+		if rec.LastPlayed == nil || m.Timestamp.After(*rec.LastPlayed) {
+			rec.LastPlayed = apiTimePtr(m.Timestamp)
+		}
+	}
+	return records
+}
+
+func apiPlayerHeadToHead(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	username := chi.URLParam(r, "username")
+	matches, _, err := storage.QueryMatches(storage.MatchQuery{ArenaID: arena.ID, Player: username, Limit: -1})
+	if err != nil {
+		return nil, err
+	}
+	records := headToHead(username, matches)
+	if records == nil {
+		records = []apiHeadToHead{}
+	}
+	return records, nil
+}
+
+func apiHeadToHeadPair(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	username, opponent := chi.URLParam(r, "username"), chi.URLParam(r, "opponent")
+	matches, _, err := storage.QueryMatches(storage.MatchQuery{ArenaID: arena.ID, Player: username, Opponent: opponent, Limit: -1})
+	if err != nil {
+		return nil, err
+	}
+	records := headToHead(username, matches)
+	if len(records) == 0 {
+		return apiHeadToHead{Player: username, Opponent: opponent}, nil
+	}
+	return records[0], nil
+}
+
+func apiGetSubmission(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	id, err := apiIDParam(r)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := storage.GetSubmissionByID(id)
+	if err == sql.ErrNoRows || (err == nil && sub.ArenaID != arena.ID) {
+		return nil, apiNotFound("no submission %d in this arena", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	subs, err := storage.GetUserSubmissionsWithStats(arena.ID, sub.Username, -1)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range subs {
+		if s.ID == id {
+			return toAPISubmissionWithStats(s), nil
+		}
+	}
+	return toAPISubmission(sub), nil
+}
+
+func apiListMatches(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	page, err := apiPaging(r)
+	if err != nil {
+		return nil, err
+	}
+	since, err := apiTimeParam(r, "since")
+	if err != nil {
+		return nil, err
+	}
+	until, err := apiTimeParam(r, "until")
+	if err != nil {
+		return nil, err
+	}
+
+	query := storage.MatchQuery{
+		ArenaID:  arena.ID,
+		Player:   r.URL.Query().Get("player"),
+		Opponent: r.URL.Query().Get("opponent"),
+		Since:    since,
+		Until:    until,
+		Limit:    page.Limit,
+		Offset:   page.Offset,
+	}
+	matches, total, err := storage.QueryMatches(query)
+	if err != nil {
+		return nil, err
+	}
+	items := []apiMatch{}
+	for _, m := range matches {
+		items = append(items, toAPIMatch(m))
+	}
+	return apiMatchPage{apiPage: page.finish(r, total), Items: items}, nil
+}
+
+func apiGetMatch(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	id, err := apiIDParam(r)
+	if err != nil {
+		return nil, err
+	}
+	m, err := storage.GetMatch(id)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || !m.Valid || m.ArenaID != arena.ID {
+		return nil, apiNotFound("no valid match %d in this arena", id)
+	}
+	return toAPIMatch(*m), nil
+}
+
+func apiGetMatrix(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	matrix, err := storage.GetMatrix(arena.ID, matrixSort(r))
+	if err != nil {
+		return nil, err
+	}
+	result := apiMatrix{Players: []apiMatrixPlayer{}, Cells: [][]*apiMatrixCell{}}
+	for i, p := range matrix.Players {
+		result.Players = append(result.Players, apiMatrixPlayer{Username: p.Username, SubmissionID: p.SubmissionID, Rating: p.Rating, IsBot: p.IsBot})
+		row := make([]*apiMatrixCell, len(matrix.Players))
+		for j, cell := range matrix.Cells[i] {
+			if cell != nil {
+				row[j] = &apiMatrixCell{MatchID: cell.MatchID, Wins: cell.Wins, Losses: cell.Losses, WinPct: cell.WinPct()}
+			}
+		}
+		result.Cells = append(result.Cells, row)
+	}
+	return result, nil
+}
+
+func apiListTournaments(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	tournaments, err := storage.GetTournaments(arena.ID)
+	if err != nil {
+		return nil, err
+	}
+	list := []apiTournament{}
+	for _, t := range tournaments {
+		tournament, err := toAPITournament(t)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, tournament)
+	}
+	return list, nil
+}
+
+// requestTournament loads the {id} tournament if it belongs to arena
+func requestTournament(r *http.Request, arena *storage.Arena) (*storage.Tournament, error) {
+	id, err := apiIDParam(r)
+	if err != nil {
+		return nil, err
+	}
+	t, err := storage.GetTournament(id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || t.ArenaID != arena.ID {
+		return nil, apiNotFound("no tournament %d in this arena", id)
+	}
+	return t, nil
+}
+
+func apiGetTournament(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	t, err := requestTournament(r, arena)
+	if err != nil {
+		return nil, err
+	}
+	return toAPITournament(*t)
+}
+
+func apiTournamentBracket(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	t, err := requestTournament(r, arena)
+	if err != nil {
+		return nil, err
+	}
+	bracket, err := storage.GetAllBracketMatches(t.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []apiBracketMatch{}
+	for _, bm := range bracket {
+		match := apiBracketMatch{ID: bm.ID, Round: bm.Round, Position: bm.Position, Status: bm.Status}
+		if bm.Player1ID != 0 {
+			match.Player1 = &apiBracketSide{SubmissionID: bm.Player1ID, Username: bm.Player1Name, Wins: bm.Player1Wins}
+		}
+		if bm.Player2ID != 0 {
+			match.Player2 = &apiBracketSide{SubmissionID: bm.Player2ID, Username: bm.Player2Name, Wins: bm.Player2Wins}
+		}
+		switch bm.WinnerID {
+		case 0:
+		case bm.Player1ID:
+			match.Winner = &bm.Player1Name
+		case bm.Player2ID:
+			match.Winner = &bm.Player2Name
+		}
+		list = append(list, match)
+	}
+	return list, nil
+}
+
+func apiQueueStatus(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	queue := apiQueue{QueuedPlayers: append([]string{}, storage.GetQueuedPlayerNames()...), Running: []apiJob{}}
+	for _, c := range []struct {
+		status string
+		count  *int
+	}{
+		{storage.JobQueued, &queue.Jobs.Queued},
+		{storage.JobRunning, &queue.Jobs.Running},
+		{storage.JobDead, &queue.Jobs.Dead},
+	} {
+		n, err := storage.CountJobs(c.status)
+		if err != nil {
+			return nil, err
+		}
+		*c.count = n
+	}
+
+	running, err := storage.GetJobs(storage.JobRunning, apiMaxLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range running {
+		queue.Running = append(queue.Running, apiJob{ID: job.ID, Type: job.Type, Attempts: job.Attempts, UpdatedAt: job.UpdatedAt})
+	}
+	return queue, nil
+}
+
+func apiOpenAPI(r *http.Request, arena *storage.Arena) (interface{}, error) {
+	base := strings.TrimSuffix(r.URL.Path, "/openapi.json")
+	return openAPIDocument(base), nil
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"battleship-arena/internal/storage"
+)
+
+// requestArena resolves the {arena} URL parameter; routes outside /a/{arena}
+// get the default arena. It writes an error response and returns nil if the
+// arena can't be loaded.
+func requestArena(w http.ResponseWriter, r *http.Request) *storage.Arena {
+	slug := chi.URLParam(r, "arena")
+	if slug == "" {
+		slug = storage.DefaultArenaSlug
+	}
+
+	arena, err := storage.GetArena(slug)
+	if err != nil {
+		http.Error(w, "Error loading arena", http.StatusInternalServerError)
+		return nil
+	}
+	if arena == nil {
+		http.Error(w, "Arena not found", http.StatusNotFound)
+		return nil
+	}
+	return arena
+}
+
+// arenaPath is the URL prefix for an arena's pages; the default arena lives
+// at the root so links from before arenas existed keep working
+func arenaPath(slug string) string {
+	if slug == storage.DefaultArenaSlug {
+		return ""
+	}
+	return "/a/" + slug
+}
+
+// arenaChannel is the SSE channel carrying an arena's leaderboard updates
+func arenaChannel(slug string) string {
+	return "/events" + arenaPath(slug) + "/updates"
+}
+
+// uploadArena works out which arena an upload targets from the directory it
+// was sent to: "scp file host:cs101/" or "put file cs101/" in SFTP. The home
+// directory and bare filenames go to the default arena.
+func uploadArena(username, dir string) (*storage.Arena, error) {
+	dir = filepath.ToSlash(filepath.Clean(dir))
+	dir = strings.TrimPrefix(dir, "~")
+	dir = strings.Trim(dir, "/")
+	slug, _, _ := strings.Cut(dir, "/")
+
+	if slug == "" || slug == "." || isUploadName(slug) {
+		slug = storage.DefaultArenaSlug
+	}
+
+	arena, err := storage.GetArena(slug)
+	if err != nil {
+		return nil, err
+	}
+	if arena == nil {
+		return nil, fmt.Errorf("unknown arena %q", slug)
+	}
+
+	allowed, err := storage.CanSubmit(arena, username)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, fmt.Errorf("you are not on the roster for arena %q", slug)
+	}
+	return arena, nil
+}
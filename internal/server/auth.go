@@ -3,7 +3,7 @@ package server
 import (
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 
 	"github.com/charmbracelet/ssh"
@@ -14,8 +14,17 @@ import (
 )
 
 var (
-	adminPasscode string
-	externalURL   string
+	adminPasscode    string
+	externalURL      string
+	registrationMode = RegistrationOpen
+	leaderboardSize  = 50
+)
+
+// Registration modes decide who may create an account over SSH
+const (
+	RegistrationOpen   = "open"   // any unused username
+	RegistrationRoster = "roster" // only usernames on the imported roster
+	RegistrationInvite = "invite" // roster usernames, or anyone with an invite code
 )
 
 func GetServerURL() string {
@@ -26,95 +35,351 @@ func GetServerURL() string {
 	return url
 }
 
+// SetLeaderboardSize sets how many rows the web leaderboard shows
+func SetLeaderboardSize(n int) {
+	leaderboardSize = n
+}
+
 func SetConfig(passcode, url string) {
 	adminPasscode = passcode
 	externalURL = url
-	log.Printf("✓ Config loaded: url=%s\n", url)
+	slog.Info("config loaded", "url", url)
+	if passcode != "" {
+		slog.Warn("shared admin passcode is enabled; prefer admin keys (battleship-arena admin grant)")
+	}
+}
+
+// adminActor names the admin behind a session that is acting on someone
+// else's behalf, or "" for an ordinary session
+func adminActor(ctx ssh.Context) string {
+	actor, _ := ctx.Value("admin_actor").(string)
+	return actor
+}
+
+// IsAdminSession reports whether a session logged in as an admin with one of
+// their admin keys
+func IsAdminSession(ctx ssh.Context) bool {
+	isAdmin, _ := ctx.Value("is_admin").(bool)
+	return isAdmin
+}
+
+func SetRegistrationMode(mode string) error {
+	switch mode {
+	case RegistrationOpen, RegistrationRoster, RegistrationInvite:
+		registrationMode = mode
+		slog.Info("registration mode", "mode", mode)
+		return nil
+	}
+	return fmt.Errorf("unknown registration mode %q (want open, roster or invite)", mode)
+}
+
+// rejectAuth records why a key was turned away. The SSH protocol has no way
+// to attach a message to a failed public key attempt, so the reason is shown
+// by KeyboardInteractiveHandler, which clients try next.
+func rejectAuth(ctx ssh.Context, format string, args ...interface{}) bool {
+	ctx.SetValue("auth_rejection", fmt.Sprintf(format, args...))
+	return false
+}
+
+// KeyboardInteractiveHandler never lets anyone in; it only exists to tell
+// users why their key was rejected instead of a bare "Permission denied"
+func KeyboardInteractiveHandler(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool {
+	if reason, ok := ctx.Value("auth_rejection").(string); ok && reason != "" {
+		// Clients retry keyboard-interactive; only explain once
+		ctx.SetValue("auth_rejection", "")
+		challenger("", reason+"\n", nil, nil)
+	}
+	return false
+}
+
+// requireAccount stops file transfers from connections that haven't finished
+// onboarding, since they may still owe an invite code
+func requireAccount(ctx ssh.Context) error {
+	if needs, ok := ctx.Value("needs_onboarding").(bool); ok && needs {
+		return fmt.Errorf("no account for %s yet; log in over ssh to register before uploading", ctx.User())
+	}
+	return nil
+}
+
+// Extensions PublicKeyAuthHandler puts on the permissions it grants a key.
+// Clients offer several keys before signing with one, and the SSH library
+// keeps only the permissions of the key that signed, so setupSession reads
+// these instead of anything decided while keys were merely being offered.
+const (
+	publicKeyExt   = "battleship-arena/public-key"
+	needsInviteExt = "battleship-arena/needs-invite"
+)
+
+// clearAuth forgets what an earlier authentication attempt on the connection
+// decided, so a key that was offered but never signed with grants nothing
+func clearAuth(ctx ssh.Context) {
+	for _, key := range []string{"user_id", "is_admin", "admin_override", "admin_actor", "public_key", "needs_onboarding", "needs_invite"} {
+		ctx.SetValue(key, nil)
+	}
 }
 
+// acceptKey lets a key in, leaving what the login means to setupSession
+func acceptKey(ctx ssh.Context, publicKeyStr string, needsInvite bool) bool {
+	perms := ctx.Permissions()
+	if perms.Extensions == nil {
+		perms.Extensions = map[string]string{}
+	}
+	perms.Extensions[publicKeyExt] = publicKeyStr
+	if needsInvite {
+		perms.Extensions[needsInviteExt] = "true"
+	}
+	return true
+}
+
+// PublicKeyAuthHandler decides whether a key may log in. It runs for every
+// key a client offers, before the client has proven it holds any of them,
+// so it only looks things up; setupSession acts on the key that signed.
 func PublicKeyAuthHandler(ctx ssh.Context, key ssh.PublicKey) bool {
+	clearAuth(ctx)
 	publicKeyStr := strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key)))
 	
-	log.Printf("Auth attempt: user=%s, key_fingerprint=%s", ctx.User(), gossh.FingerprintSHA256(key))
+	slog.Debug("auth attempt", "user", ctx.User(), "key_fingerprint", gossh.FingerprintSHA256(key))
 	
 	// Try to find user by public key
 	user, err := storage.GetUserByPublicKey(publicKeyStr)
 	if err != nil {
-		log.Printf("Error looking up user by public key: %v", err)
+		slog.Error("looking up user by public key failed", "err", err)
 		return false
 	}
 	
 	if user != nil {
 		// Existing user - verify username matches
-		log.Printf("Found existing user: %s (trying to login as: %s)", user.Username, ctx.User())
+		slog.Debug("key belongs to existing user", "user", user.Username, "login_as", ctx.User())
 		if user.Username == ctx.User() {
-			ctx.SetValue("user_id", user.ID)
-			ctx.SetValue("needs_onboarding", false)
-			storage.UpdateUserLastLogin(user.Username)
-			log.Printf("✓ Authenticated %s", user.Username)
-			return true
+			if user.IsRevoked() {
+				slog.Info("revoked user tried to log in", "user", user.Username)
+				return rejectAuth(ctx, "The account %s has been revoked. Contact your instructor.", user.Username)
+			}
+			return acceptKey(ctx, publicKeyStr, false)
 		}
+		
+		// Admin keys may log in as another user to act on their behalf
+		if isAdmin, _ := storage.IsAdminKey(publicKeyStr); isAdmin {
+			target, err := storage.GetUserByUsername(ctx.User())
+			if err != nil {
+				slog.Error("looking up username failed", "err", err)
+				return false
+			}
+			if target == nil {
+				return rejectAuth(ctx, "There is no user %s to act as.", ctx.User())
+			}
+			if target.IsRevoked() {
+				return rejectAuth(ctx, "The account %s has been revoked.", target.Username)
+			}
+			return acceptKey(ctx, publicKeyStr, false)
+		}
+		
 		// Public key registered to different username
-		log.Printf("❌ Public key registered to %s, but trying to auth as %s", user.Username, ctx.User())
-		return false
+		slog.Info("public key belongs to another user", "user", user.Username, "login_as", ctx.User())
+		return rejectAuth(ctx, "This key is registered to %s. Log in as %s instead.", user.Username, user.Username)
 	}
 	
-	log.Printf("New user detected: %s", ctx.User())
+	slog.Debug("new user detected", "user", ctx.User())
+	
+	if storage.IsReservedUsername(ctx.User()) {
+		slog.Info("reserved username refused", "user", ctx.User())
+		return rejectAuth(ctx, "Usernames starting with %s are reserved for reference bots. Pick another username.", storage.BotUsernamePrefix)
+	}
+	
+	if deleted, err := storage.IsDeletedUsername(ctx.User()); err != nil {
+		slog.Error("checking deleted usernames failed", "err", err)
+		return false
+	} else if deleted {
+		slog.Info("deleted username refused", "user", ctx.User())
+		return rejectAuth(ctx, "The username %s belonged to a deleted account. Pick another username.", ctx.User())
+	}
 	
 	// New user - check if username is taken
 	existingUser, err := storage.GetUserByUsername(ctx.User())
 	if err != nil {
-		log.Printf("Error looking up username: %v", err)
+		slog.Error("looking up username failed", "err", err)
 		return false
 	}
 	
 	if existingUser != nil {
 		// Username taken by someone else
-		log.Printf("❌ Username %s already taken", ctx.User())
-		return false
+		slog.Info("username already taken", "user", ctx.User())
+		return rejectAuth(ctx, "The username %s is taken and this key isn't registered to it. Pick another username.", ctx.User())
 	}
 	
-	// New user with available username - allow and mark for onboarding
-	log.Printf("✓ New user %s allowed for onboarding", ctx.User())
-	ctx.SetValue("public_key", publicKeyStr)
-	ctx.SetValue("needs_onboarding", true)
-	return true
+	// Restricted registration: roster members get straight in, everyone
+	// else needs an invite code (if those are in use) or is turned away
+	needsInvite := false
+	if registrationMode != RegistrationOpen {
+		onRoster, err := storage.IsOnRoster(ctx.User())
+		if err != nil {
+			slog.Error("checking roster failed", "user", ctx.User(), "err", err)
+			return false
+		}
+		if !onRoster {
+			if registrationMode == RegistrationRoster {
+				slog.Info("user is not on the roster", "user", ctx.User())
+				return rejectAuth(ctx, "%s is not on the class roster. Use your roster username, or ask your instructor to add you.", ctx.User())
+			}
+			needsInvite = true
+		}
+	}
+	
+	slog.Debug("new user allowed for onboarding", "user", ctx.User(), "invite_required", needsInvite)
+	return acceptKey(ctx, publicKeyStr, needsInvite)
+}
+
+// setupSession turns the key a connection authenticated with into its
+// account, admin rights and onboarding state. It runs once per connection,
+// from SessionMiddleware and the SFTP subsystem, which bypasses middleware.
+func setupSession(ctx ssh.Context) error {
+	ctx.Lock()
+	defer ctx.Unlock()
+	if ready, _ := ctx.Value("session_ready").(bool); ready {
+		return nil
+	}
+	
+	// Passcode logins are settled by PasswordAuthHandler
+	publicKeyStr := ctx.Permissions().Extensions[publicKeyExt]
+	if publicKeyStr == "" {
+		ctx.SetValue("session_ready", true)
+		return nil
+	}
+	
+	user, err := storage.GetUserByPublicKey(publicKeyStr)
+	if err != nil {
+		return fmt.Errorf("looking up your key: %v", err)
+	}
+	switch {
+	case user != nil && user.Username == ctx.User():
+		isAdmin, err := storage.IsAdminKey(publicKeyStr)
+		if err != nil {
+			slog.Error("checking admin key failed", "user", user.Username, "err", err)
+		}
+		ctx.SetValue("user_id", user.ID)
+		ctx.SetValue("needs_onboarding", false)
+		ctx.SetValue("is_admin", isAdmin)
+		storage.UpdateUserLastLogin(user.Username)
+		storage.MarkKeyUsed(publicKeyStr)
+		slog.Info("authenticated", "user", user.Username, "admin", isAdmin)
+		
+	case user != nil:
+		if isAdmin, _ := storage.IsAdminKey(publicKeyStr); !isAdmin {
+			return fmt.Errorf("this key is registered to %s; log in as %s instead", user.Username, user.Username)
+		}
+		if err := impersonate(ctx, user.Username); err != nil {
+			return err
+		}
+		
+	default:
+		if existing, err := storage.GetUserByUsername(ctx.User()); err != nil {
+			return fmt.Errorf("looking up %s: %v", ctx.User(), err)
+		} else if existing != nil {
+			return fmt.Errorf("the username %s was just taken; pick another username", ctx.User())
+		}
+		needsInvite := ctx.Permissions().Extensions[needsInviteExt] == "true"
+		slog.Info("new user allowed for onboarding", "user", ctx.User(), "invite_required", needsInvite)
+		ctx.SetValue("public_key", publicKeyStr)
+		ctx.SetValue("needs_onboarding", true)
+		ctx.SetValue("needs_invite", needsInvite)
+	}
+	
+	ctx.SetValue("session_ready", true)
+	return nil
 }
 
+// SessionMiddleware sets up the account behind a connection before any
+// other middleware looks at it. List it last so it runs first.
+func SessionMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if err := setupSession(s.Context()); err != nil {
+				wish.Fatalln(s, err)
+				return
+			}
+			next(s)
+		}
+	}
+}
+
+// impersonate lets an admin into an existing account, recording it in the
+// audit log; uploads made in the session are audited again individually
+func impersonate(ctx ssh.Context, admin string) error {
+	target, err := storage.GetUserByUsername(ctx.User())
+	if err != nil {
+		return fmt.Errorf("looking up %s: %v", ctx.User(), err)
+	}
+	if target == nil {
+		return fmt.Errorf("there is no user %s to act as", ctx.User())
+	}
+	if target.IsRevoked() {
+		return fmt.Errorf("the account %s has been revoked", target.Username)
+	}
+	if err := storage.Audit(admin, "impersonate", target.Username, "ssh login"); err != nil {
+		slog.Error("writing audit log failed", "err", err)
+		return errors.New("could not record this login in the audit log")
+	}
+	
+	ctx.SetValue("user_id", target.ID)
+	ctx.SetValue("needs_onboarding", false)
+	ctx.SetValue("admin_override", true)
+	ctx.SetValue("admin_actor", admin)
+	slog.Info("admin authenticated as user", "admin", admin, "user", target.Username)
+	return nil
+}
+
+// PasswordAuthHandler accepts the legacy shared admin passcode, which is off
+// unless BATTLESHIP_ADMIN_PASSCODE is set. Every use is audited.
 func PasswordAuthHandler(ctx ssh.Context, password string) bool {
+	clearAuth(ctx)
+	if adminPasscode == "" {
+		return false
+	}
+	
 	// Check for admin passcode override
 	if password == adminPasscode {
-		log.Printf("🔑 Admin passcode used for user: %s", ctx.User())
+		slog.Info("admin passcode used", "user", ctx.User())
 		
 		// Check if user exists
 		user, err := storage.GetUserByUsername(ctx.User())
 		if err != nil {
-			log.Printf("Error looking up username: %v", err)
+			slog.Error("looking up username failed", "err", err)
 			return false
 		}
 		
 		if user != nil {
 			// Existing user - allow login
+			if err := storage.Audit("passcode", "impersonate", user.Username, "ssh login with shared passcode"); err != nil {
+				slog.Error("writing audit log failed", "err", err)
+				return false
+			}
 			ctx.SetValue("user_id", user.ID)
 			ctx.SetValue("needs_onboarding", false)
 			ctx.SetValue("admin_override", true)
-			log.Printf("✓ Admin authenticated as %s", user.Username)
+			ctx.SetValue("admin_actor", "passcode")
+			slog.Info("admin passcode authenticated as user", "user", user.Username)
 			return true
 		}
 		
 		// New user - create with dummy key
-		log.Printf("✓ Admin creating new user: %s", ctx.User())
+		slog.Info("admin passcode creating user", "user", ctx.User())
 		dummyKey := fmt.Sprintf("admin-override-%s", ctx.User())
 		newUser, err := storage.CreateUser(ctx.User(), ctx.User(), "Admin created user", "", dummyKey)
 		if err != nil {
-			log.Printf("Error creating user: %v", err)
+			slog.Error("creating user failed", "user", ctx.User(), "err", err)
+			return false
+		}
+		
+		if err := storage.Audit("passcode", "create_user", newUser.Username, "created by shared passcode login"); err != nil {
+			slog.Error("writing audit log failed", "err", err)
 			return false
 		}
 		
 		ctx.SetValue("user_id", newUser.ID)
 		ctx.SetValue("needs_onboarding", false)
 		ctx.SetValue("admin_override", true)
-		log.Printf("✓ Admin created and authenticated as %s", ctx.User())
+		ctx.SetValue("admin_actor", "passcode")
+		slog.Info("admin passcode created user", "user", ctx.User())
 		return true
 	}
 	
@@ -185,7 +450,7 @@ func runOnboarding(s ssh.Session) error {
 	}
 	
 	wish.Println(s, "\n✅ Account created successfully!")
-	wish.Println(s, "You can now upload your battleship AI and compete!\n")
+	wish.Println(s, "You can now upload your battleship AI and compete!")
 	
 	// Update context
 	s.Context().SetValue("needs_onboarding", false)
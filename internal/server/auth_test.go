@@ -0,0 +1,177 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+
+	"battleship-arena/internal/storage"
+)
+
+// sessionState is what a session saw of its login
+type sessionState struct {
+	userID  int
+	actor   string
+	isAdmin bool
+}
+
+func newSigner(t *testing.T) gossh.Signer {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func authorizedKey(signer gossh.Signer) string {
+	return strings.TrimSpace(string(gossh.MarshalAuthorizedKey(signer.PublicKey())))
+}
+
+// offerOnly offers a key it doesn't hold: the server accepts the offer,
+// then turns down the signature and lets the client try its next key
+type offerOnly struct {
+	key gossh.PublicKey
+}
+
+func (o offerOnly) PublicKey() gossh.PublicKey { return o.key }
+
+func (o offerOnly) Sign(io.Reader, []byte) (*gossh.Signature, error) {
+	return &gossh.Signature{Format: "unsigned"}, nil
+}
+
+// startSSH runs the SSH server's authentication and session setup against a
+// fresh database, reporting what each session saw
+func startSSH(t *testing.T) (string, <-chan sessionState) {
+	t.Helper()
+	s, err := storage.InitDB(filepath.Join(t.TempDir(), "arena.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	storage.Use(s)
+	t.Cleanup(func() {
+		s.Close()
+		storage.Use(nil)
+	})
+
+	states := make(chan sessionState, 1)
+	srv, err := wish.NewServer(
+		wish.WithHostKeyPath(filepath.Join(t.TempDir(), "host_key")),
+		wish.WithPublicKeyAuth(PublicKeyAuthHandler),
+		wish.WithMiddleware(
+			func(next ssh.Handler) ssh.Handler {
+				return func(s ssh.Session) {
+					userID, _ := s.Context().Value("user_id").(int)
+					states <- sessionState{userID, adminActor(s.Context()), IsAdminSession(s.Context())}
+				}
+			},
+			SessionMiddleware(),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+	return listener.Addr().String(), states
+}
+
+// login connects as user, offering signers in order, and returns what the
+// session saw
+func login(t *testing.T, addr string, states <-chan sessionState, user string, signers ...gossh.Signer) sessionState {
+	t.Helper()
+	client, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+		User:            user,
+		Auth:            []gossh.AuthMethod{gossh.PublicKeys(signers...)},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatalf("logging in as %s: %v", user, err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err := session.Run("true"); err != nil {
+		t.Fatalf("running a session as %s: %v", user, err)
+	}
+	return <-states
+}
+
+func TestUnsignedAdminKeyGrantsNothing(t *testing.T) {
+	addr, states := startSSH(t)
+	adminKey, bobKey := newSigner(t), newSigner(t)
+	if _, err := storage.CreateUser("teacher", "Teacher", "", "", authorizedKey(adminKey)); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.GrantAdmin("teacher", ""); err != nil {
+		t.Fatal(err)
+	}
+	bob, err := storage.CreateUser("bob", "Bob", "", "", authorizedKey(bobKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The admin key is offered for bob and accepted, but the client can't
+	// sign with it and falls back to bob's own key
+	got := login(t, addr, states, "bob", offerOnly{adminKey.PublicKey()}, bobKey)
+	if got.userID != bob.ID || got.actor != "" || got.isAdmin {
+		t.Errorf("session saw %+v, want bob's own login with no admin", got)
+	}
+	entries, err := storage.GetAuditLog(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("audit log has %+v, want nothing", entries)
+	}
+}
+
+func TestAdminKeyImpersonates(t *testing.T) {
+	addr, states := startSSH(t)
+	adminKey := newSigner(t)
+	if _, err := storage.CreateUser("teacher", "Teacher", "", "", authorizedKey(adminKey)); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.GrantAdmin("teacher", ""); err != nil {
+		t.Fatal(err)
+	}
+	bob, err := storage.CreateUser("bob", "Bob", "", "", authorizedKey(newSigner(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := login(t, addr, states, "bob", adminKey)
+	if got.userID != bob.ID || got.actor != "teacher" {
+		t.Errorf("session saw %+v, want teacher acting as bob", got)
+	}
+	entries, err := storage.GetAuditLog(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "teacher" || entries[0].Action != "impersonate" || entries[0].Target != "bob" {
+		t.Errorf("audit log has %+v, want one impersonation of bob by teacher", entries)
+	}
+
+	if got := login(t, addr, states, "teacher", adminKey); got.actor != "" || !got.isAdmin {
+		t.Errorf("teacher's own login saw %+v, want an admin session", got)
+	}
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/scp"
+
+	"battleship-arena/internal/bundle"
+	"battleship-arena/internal/storage"
+)
+
+// uploadPrefix starts the name of every upload: a source, an archive or a
+// directory
+const uploadPrefix = "memory_functions_"
+
+// errUploadName is the answer to an upload by any other name
+var errUploadName = fmt.Errorf("only memory_functions_* sources (.cpp, .c or .py), archives of them (.tar, .tar.gz, .tgz, .zip) and memory_functions_* directories are accepted")
+
+var uploadLimits = bundle.Limits{MaxFiles: 32, MaxBytes: 1 << 20}
+
+// SetUploadLimits bounds submissions uploaded as an archive or a directory
+func SetUploadLimits(maxFiles, maxBytes int) {
+	uploadLimits = bundle.Limits{MaxFiles: maxFiles, MaxBytes: int64(maxBytes)}
+}
+
+// isUploadName reports whether a file name is one that is submitted when it
+// is uploaded
+func isUploadName(filename string) bool {
+	return bundle.IsEntrypoint(filename) || (strings.HasPrefix(filename, uploadPrefix) && bundle.IsArchive(filename))
+}
+
+// submitUpload queues a file just written to the user's directory, reading
+// it as a multi-file submission if it is an archive
+func submitUpload(uploadDir string, arena *storage.Arena, username, filename string) (int64, error) {
+	if !bundle.IsArchive(filename) {
+		return storage.AddUpload(uploadDir, arena, username, filename)
+	}
+	f, err := os.Open(filepath.Join(arena.UserDir(uploadDir, username), filename))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	b, err := bundle.ReadArchive(filename, f, uploadLimits)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", filename, err)
+	}
+	return storage.AddBundle(uploadDir, arena, username, b)
+}
+
+// splitBundlePath splits a cleaned path inside a memory_functions_*
+// directory into the directory's path and the file's path in it
+func splitBundlePath(name string) (dir, rel string, ok bool) {
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		if strings.HasPrefix(elem, uploadPrefix) && !isUploadName(elem) {
+			return strings.Join(elems[:i+1], "/"), strings.Join(elems[i+1:], "/"), true
+		}
+	}
+	return "", "", false
+}
+
+type pendingBundlesKey struct{}
+
+// pendingBundles are the directories uploaded in one scp or sftp session.
+// Neither protocol says when a directory is complete, so they are submitted
+// when the session ends.
+type pendingBundles struct {
+	mu        sync.Mutex
+	files     userFiles
+	uploadDir string
+	protocol  string
+	actor     string // admin acting as the user, if any
+	dirs      []*pendingBundle
+	failed    bool
+}
+
+type pendingBundle struct {
+	dir   string // cleaned path in the user's view
+	arena *storage.Arena
+	files int
+}
+
+func newPendingBundles(uploadDir, username, actor, protocol string) *pendingBundles {
+	return &pendingBundles{
+		files:     userFiles{uploadDir: uploadDir, username: username},
+		uploadDir: uploadDir,
+		protocol:  protocol,
+		actor:     actor,
+	}
+}
+
+// prepare checks a file or directory arriving in a bundle directory and
+// returns where it goes on disk. The first one in a session replaces the
+// directory's previous contents, so files left out of an upload don't linger.
+func (p *pendingBundles) prepare(dir, rel string, isDir bool) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	parent, name := path.Split(dir)
+	if strings.Contains(strings.Trim(parent, "/"), "/") {
+		return "", fmt.Errorf("%s: directories go at the top or in an arena's directory", dir)
+	}
+	if rel != "" && !isDir {
+		if err := bundle.CheckPath(rel); err != nil {
+			return "", err
+		}
+	}
+
+	var pending *pendingBundle
+	for _, b := range p.dirs {
+		if b.dir == dir {
+			pending = b
+		}
+	}
+	if pending == nil {
+		if err := checkUploadsOpen(); err != nil {
+			return "", err
+		}
+		if season, err := storage.GetCurrentSeason(); err == nil && season == nil {
+			return "", fmt.Errorf("submissions are closed between seasons")
+		}
+		arena, err := uploadArena(p.files.username, parent)
+		if err != nil {
+			slog.Info("rejected upload", "user", p.files.username, "protocol", p.protocol, "path", dir, "err", err)
+			return "", err
+		}
+		if err := os.RemoveAll(p.files.realPath(dir)); err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(p.files.realPath(dir), 0755); err != nil {
+			return "", err
+		}
+		pending = &pendingBundle{dir: dir, arena: arena}
+		p.dirs = append(p.dirs, pending)
+		slog.Debug("receiving directory upload", "user", p.files.username, "protocol", p.protocol, "dir", name, "arena", arena.Slug)
+	}
+
+	if !isDir {
+		if pending.files == uploadLimits.MaxFiles {
+			return "", fmt.Errorf("%s: more than %d files", dir, uploadLimits.MaxFiles)
+		}
+		pending.files++
+	}
+	return p.files.realPath(path.Join(dir, rel)), nil
+}
+
+// fail keeps the session's directories from being submitted after a failed
+// upload, which may have left them half written
+func (p *pendingBundles) fail() {
+	p.mu.Lock()
+	p.failed = true
+	p.mu.Unlock()
+}
+
+// submit queues each directory uploaded in the session, reporting what
+// happened to w, and returns whether they all were
+func (p *pendingBundles) submit(w io.Writer) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failed {
+		return false
+	}
+
+	ok := true
+	username := p.files.username
+	for _, pending := range p.dirs {
+		name := path.Base(pending.dir)
+		b, err := bundle.ReadDir(p.files.realPath(pending.dir), uploadLimits)
+		if err == nil && storage.BundleDir(b.Entrypoint) != name {
+			err = fmt.Errorf("the directory must be named after its entrypoint, %s", storage.BundleDir(b.Entrypoint))
+		}
+		if err == nil && p.actor != "" {
+			if auditErr := storage.Audit(p.actor, "upload_as", username, fmt.Sprintf("%s/ to arena %s via %s", name, pending.arena.Slug, p.protocol)); auditErr != nil {
+				slog.Error("writing audit log failed", "err", auditErr)
+				err = fmt.Errorf("upload refused: audit log unavailable")
+			}
+		}
+		var submissionID int64
+		if err == nil {
+			submissionID, err = storage.AddBundle(p.uploadDir, pending.arena, username, b)
+		}
+		if err != nil {
+			slog.Info("rejected directory upload", "user", username, "protocol", p.protocol, "dir", pending.dir, "err", err)
+			fmt.Fprintf(w, "%s: not submitted: %v\n", name, err)
+			ok = false
+			continue
+		}
+		slog.Info("uploaded, queued for testing", "submission_id", submissionID, "user", username, "protocol", p.protocol, "dir", pending.dir, "files", len(b.Files), "arena", pending.arena.Slug)
+		uploadsTotal.Inc(p.protocol)
+		fmt.Fprintf(w, "%s: queued for testing as submission %d\n", name, submissionID)
+	}
+	p.dirs = nil
+	return ok
+}
+
+// SCPMiddleware serves scp downloads and uploads. Directories uploaded with
+// scp -r are submitted once the copy has finished.
+func SCPMiddleware(uploadDir string) wish.Middleware {
+	copyMiddleware := scp.Middleware(NewSCPHandlers(uploadDir))
+	return func(next ssh.Handler) ssh.Handler {
+		handler := copyMiddleware(next)
+		return func(s ssh.Session) {
+			pending := newPendingBundles(uploadDir, s.User(), adminActor(s.Context()), "scp")
+			s.Context().SetValue(pendingBundlesKey{}, pending)
+			handler(s)
+			// A dropped connection may have cut an upload short
+			if s.Context().Err() == nil && !pending.submit(s.Stderr()) {
+				s.Exit(1)
+			}
+		}
+	}
+}
+
+// sessionBundles is the scp session's pendingBundles
+func sessionBundles(s ssh.Session) *pendingBundles {
+	pending, _ := s.Context().Value(pendingBundlesKey{}).(*pendingBundles)
+	return pending
+}
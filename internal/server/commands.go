@@ -0,0 +1,322 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+
+	"battleship-arena/internal/diff"
+	"battleship-arena/internal/storage"
+)
+
+const keysUsage = `usage:
+  ssh <host> keys                       list your keys
+  cat key.pub | ssh <host> keys add [label]
+  ssh <host> keys add "ssh-ed25519 AAAA... [comment]"
+  ssh <host> keys remove <number|fingerprint>`
+
+const logsUsage = `usage:
+  ssh <host> logs                       log of your latest submission
+  ssh <host> logs list                  your recent submissions
+  ssh <host> logs <submission id>`
+
+const versionsUsage = `usage:
+  ssh <host> versions                   every submission you've uploaded
+  ssh <host> versions show <id>         the source of one of them
+  ssh <host> versions diff <id> <id>    what changed between two`
+
+// CommandMiddleware answers non-interactive commands such as
+// "ssh host keys add"; anything it doesn't recognise goes to the next handler
+func CommandMiddleware(uploadDir string) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			var run func(ssh.Session, []string) error
+			if len(cmd) > 0 {
+				switch cmd[0] {
+				case "keys":
+					run = runKeysCommand
+				case "admin-login":
+					run = runAdminLoginCommand
+				case "logs":
+					run = runLogsCommand
+				case "versions":
+					run = func(s ssh.Session, args []string) error {
+						return runVersionsCommand(s, uploadDir, args)
+					}
+				}
+			}
+			if run == nil {
+				next(s)
+				return
+			}
+
+			if err := requireAccount(s.Context()); err != nil {
+				wish.Errorln(s, err)
+				s.Exit(1)
+				return
+			}
+			if err := run(s, cmd[1:]); err != nil {
+				wish.Errorln(s, err)
+				s.Exit(1)
+				return
+			}
+			s.Exit(0)
+		}
+	}
+}
+
+func runKeysCommand(s ssh.Session, args []string) error {
+	username := s.User()
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch args[0] {
+	case "list":
+		keys, err := storage.GetUserKeys(username)
+		if err != nil {
+			return err
+		}
+		for i, k := range keys {
+			used := "never used"
+			if !k.LastUsedAt.IsZero() {
+				used = "last used " + k.LastUsedAt.Format("2006-01-02")
+			}
+			if k.IsAdmin {
+				used += " (admin)"
+			}
+			wish.Println(s, fmt.Sprintf("%d  %s  %-20s %s", i+1, k.Fingerprint, k.Label, used))
+		}
+		return nil
+
+	case "add":
+		// The key can come inline or on stdin; anything inline that isn't a
+		// key is the label
+		var keyText, label string
+		inline := strings.Join(args[1:], " ")
+		if _, _, _, err := storage.ParsePublicKey(inline); err == nil {
+			keyText = inline
+		} else {
+			label = inline
+			data, err := io.ReadAll(io.LimitReader(s, 16*1024))
+			if err != nil {
+				return err
+			}
+			keyText = string(data)
+		}
+
+		key, err := storage.AddUserKey(username, keyText, label)
+		if err != nil {
+			return err
+		}
+		wish.Println(s, fmt.Sprintf("✓ Added key %s", key.Fingerprint))
+		return nil
+
+	case "remove", "rm":
+		if len(args) < 2 {
+			return errors.New(keysUsage)
+		}
+		key, err := storage.RemoveUserKey(username, args[1])
+		if err != nil {
+			return err
+		}
+		wish.Println(s, fmt.Sprintf("✓ Removed key %s", key.Fingerprint))
+		return nil
+	}
+
+	return fmt.Errorf("unknown keys command %q\n%s", args[0], keysUsage)
+}
+
+// runAdminLoginCommand prints a single-use link that signs the admin in to
+// the web dashboard. Only sessions that logged in with an admin key get one.
+func runAdminLoginCommand(s ssh.Session, args []string) error {
+	if !IsAdminSession(s.Context()) {
+		return errors.New("admin-login needs an admin key")
+	}
+
+	username := s.User()
+	if err := storage.Audit(username, "issue_web_login", username, "via ssh"); err != nil {
+		return fmt.Errorf("audit log unavailable, refusing: %v", err)
+	}
+	token, err := storage.CreateAdminLoginToken(username)
+	if err != nil {
+		return err
+	}
+
+	wish.Println(s, fmt.Sprintf("%s/admin/login?token=%s", strings.TrimSuffix(externalURL, "/"), token))
+	wish.Println(s, fmt.Sprintf("The link works once and expires in %s.", storage.AdminLoginTTL))
+	return nil
+}
+
+// runLogsCommand prints what happened to a submission: upload, compile,
+// benchmark and every match. Admins signed in with an admin key may read any
+// submission's log.
+func runLogsCommand(s ssh.Session, args []string) error {
+	username := s.User()
+	submissions, err := storage.GetUserSubmissions(username)
+	if err != nil {
+		return err
+	}
+
+	var sub storage.Submission
+	switch {
+	case len(args) == 0:
+		if len(submissions) == 0 {
+			return errors.New("you haven't uploaded anything yet")
+		}
+		sub = submissions[0]
+
+	case args[0] == "list":
+		for _, sub := range submissions {
+			wish.Println(s, fmt.Sprintf("%5d  %s  %-20s %s", sub.ID, sub.UploadTime.Format("2006-01-02 15:04"), sub.Status, sub.Filename))
+		}
+		return nil
+
+	default:
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.New(logsUsage)
+		}
+		sub, err = storage.GetSubmissionByID(id)
+		if err != nil || (sub.Username != username && !IsAdminSession(s.Context())) {
+			return fmt.Errorf("no submission %d of yours", id)
+		}
+	}
+
+	lines, err := storage.GetSubmissionLog(sub.ID)
+	if err != nil {
+		return err
+	}
+	wish.Println(s, fmt.Sprintf("Submission %d by %s (%s), %s", sub.ID, sub.Username, sub.Filename, sub.Status))
+	if len(lines) == 0 {
+		wish.Println(s, "No log lines yet.")
+	}
+	for _, l := range lines {
+		wish.Println(s, fmt.Sprintf("%s %-5s %s", l.LoggedAt.Format("2006-01-02 15:04:05"), l.Level, l.Line))
+	}
+	return nil
+}
+
+// runVersionsCommand lists every submission a user has uploaded, with its
+// stats, and shows or compares their sources. As with logs, admins signed in
+// with an admin key may read anyone's.
+func runVersionsCommand(s ssh.Session, uploadDir string, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		return listVersions(s)
+	}
+
+	switch args[0] {
+	case "show":
+		if len(args) != 2 {
+			return errors.New(versionsUsage)
+		}
+		sub, err := ownSubmission(s, args[1])
+		if err != nil {
+			return err
+		}
+		source, err := storage.ReadSource(uploadDir, sub)
+		if err != nil {
+			return err
+		}
+		_, err = s.Write(source)
+		return err
+
+	case "diff":
+		if len(args) != 3 {
+			return errors.New(versionsUsage)
+		}
+		var subs [2]storage.Submission
+		var sources [2]string
+		for i, arg := range args[1:] {
+			sub, err := ownSubmission(s, arg)
+			if err != nil {
+				return err
+			}
+			source, err := storage.ReadSource(uploadDir, sub)
+			if err != nil {
+				return err
+			}
+			subs[i], sources[i] = sub, string(source)
+		}
+		out, err := diff.Unified(
+			fmt.Sprintf("#%d/%s", subs[0].ID, subs[0].Filename),
+			fmt.Sprintf("#%d/%s", subs[1].ID, subs[1].Filename),
+			sources[0], sources[1],
+		)
+		if err != nil {
+			return err
+		}
+		if out == "" {
+			wish.Println(s, fmt.Sprintf("Submissions %d and %d have the same source.", subs[0].ID, subs[1].ID))
+			return nil
+		}
+		wish.Print(s, out)
+		return nil
+	}
+
+	return fmt.Errorf("unknown versions command %q\n%s", args[0], versionsUsage)
+}
+
+// ownSubmission looks up a submission by ID for the session's user
+func ownSubmission(s ssh.Session, arg string) (storage.Submission, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return storage.Submission{}, errors.New(versionsUsage)
+	}
+	sub, err := storage.GetSubmissionByID(id)
+	if err != nil || (sub.Username != s.User() && !IsAdminSession(s.Context())) {
+		return storage.Submission{}, fmt.Errorf("no submission %d of yours", id)
+	}
+	return sub, nil
+}
+
+func listVersions(s ssh.Session) error {
+	arenas, err := storage.GetArenas()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, arena := range arenas {
+		subs, err := storage.GetUserSubmissionsWithStats(arena.ID, s.User(), -1)
+		if err != nil {
+			return err
+		}
+		if len(subs) == 0 {
+			continue
+		}
+		if found {
+			wish.Println(s, "")
+		}
+		found = true
+
+		wish.Println(s, fmt.Sprintf("%s (%d versions)", arena.Name, len(subs)))
+		for _, sub := range subs {
+			hash := "-"
+			if sub.ContentHash != "" {
+				hash = sub.ContentHash[:8]
+			}
+			stats := ""
+			if sub.HasMatches {
+				stats = fmt.Sprintf("%4d  %d-%d", sub.Rating, sub.Wins, sub.Losses)
+			}
+			line := fmt.Sprintf("%5d  %s  %-8s  %-20s %-16s", sub.ID, sub.UploadTime.Format("2006-01-02 15:04"), hash, sub.Status, stats)
+			if sub.IsActive {
+				line += " active"
+			}
+			if sub.RestoredFrom != 0 {
+				line += fmt.Sprintf(" (restored from %d)", sub.RestoredFrom)
+			}
+			wish.Println(s, strings.TrimRight(line, " "))
+		}
+	}
+	if !found {
+		return errors.New("you haven't uploaded anything yet")
+	}
+	return nil
+}
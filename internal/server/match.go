@@ -0,0 +1,743 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"battleship-arena/internal/storage"
+)
+
+// boardSize is the engine's BOARDSIZE
+const boardSize = 10
+
+// maxMoveBars is how many bars the move distribution is squeezed into
+const maxMoveBars = 25
+
+// matchFromRequest loads the match named by the {id} URL parameter, writing
+// an error response and returning nil if it can't or if it belongs to
+// another arena
+func matchFromRequest(w http.ResponseWriter, r *http.Request, arena *storage.Arena) *storage.Match {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid match", http.StatusBadRequest)
+		return nil
+	}
+	match, err := storage.GetMatch(id)
+	if err != nil {
+		http.Error(w, "Error loading match", http.StatusInternalServerError)
+		return nil
+	}
+	if match == nil || match.ArenaID != arena.ID {
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return nil
+	}
+	return match
+}
+
+// matchSide is one player's half of the match page
+type matchSide struct {
+	Prefix       string
+	Submission   storage.Submission
+	Wins         int
+	AvgMoves     int
+	Won          bool
+	Rated        bool // false once the submission has been replaced, and for pinned bots
+	RatingChange float64
+}
+
+// moveBar is one bar of the game length chart. The widths are percentages
+// of the longest bar.
+type moveBar struct {
+	Label                                 string
+	Player1Wins, Player2Wins, Ties        int
+	Player1Width, Player2Width, TiesWidth float64
+}
+
+// moveBars groups games by length into at most maxMoveBars bars
+func moveBars(counts []storage.MoveCount) []moveBar {
+	if len(counts) == 0 {
+		return nil
+	}
+	first, last := counts[0].Moves, counts[len(counts)-1].Moves
+	size := (last-first)/maxMoveBars + 1
+	start := first - first%size
+
+	bars := make([]moveBar, (last-start)/size+1)
+	for i := range bars {
+		low := start + i*size
+		bars[i].Label = strconv.Itoa(low)
+		if size > 1 {
+			bars[i].Label = fmt.Sprintf("%d–%d", low, low+size-1)
+		}
+	}
+	for _, c := range counts {
+		bar := &bars[(c.Moves-start)/size]
+		bar.Player1Wins += c.Player1Wins
+		bar.Player2Wins += c.Player2Wins
+		bar.Ties += c.Ties
+	}
+
+	longest := 0
+	for _, bar := range bars {
+		longest = max(longest, bar.Player1Wins+bar.Player2Wins+bar.Ties)
+	}
+	for i := range bars {
+		bar := &bars[i]
+		bar.Player1Width = 100 * float64(bar.Player1Wins) / float64(longest)
+		bar.Player2Width = 100 * float64(bar.Player2Wins) / float64(longest)
+		bar.TiesWidth = 100 * float64(bar.Ties) / float64(longest)
+	}
+	return bars
+}
+
+var matchFuncs = template.FuncMap{
+	"signed": func(f float64) string {
+		return fmt.Sprintf("%+.1f", f)
+	},
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+	"turns": func(replay storage.Replay) int {
+		return len(replay.Shots) / 2
+	},
+}
+
+var matchTmpl = template.Must(template.New("match").Funcs(matchFuncs).Parse(matchHTML))
+
+func HandleMatchPage(w http.ResponseWriter, r *http.Request) {
+	arena := requestArena(w, r)
+	if arena == nil {
+		return
+	}
+	match := matchFromRequest(w, r, arena)
+	if match == nil {
+		return
+	}
+
+	details, err := storage.GetMatchDetails(match.ID)
+	if err != nil {
+		slog.Error("loading match details failed", "match_id", match.ID, "err", err)
+	}
+	changes, err := storage.MatchRatingChanges(match)
+	if err != nil {
+		slog.Error("working out rating changes failed", "match_id", match.ID, "err", err)
+	}
+
+	prefix := arenaPath(arena.Slug)
+	sides := []*matchSide{
+		{Prefix: prefix, Wins: match.Player1Wins, AvgMoves: match.Player1Moves, Won: match.WinnerID == match.Player1ID},
+		{Prefix: prefix, Wins: match.Player2Wins, AvgMoves: match.Player2Moves, Won: match.WinnerID == match.Player2ID},
+	}
+	for i, id := range []int{match.Player1ID, match.Player2ID} {
+		if sides[i].Submission, err = storage.GetSubmissionByID(id); err != nil {
+			http.Error(w, "Error loading submissions", http.StatusInternalServerError)
+			return
+		}
+		sides[i].RatingChange, sides[i].Rated = changes[id]
+	}
+
+	var bars []moveBar
+	if details != nil {
+		bars = moveBars(details.MoveCounts)
+	}
+
+	data := struct {
+		Arena    *storage.Arena
+		Prefix   string
+		Match    *storage.Match
+		Player1  *matchSide
+		Player2  *matchSide
+		CoinFlip bool
+		Details  *storage.MatchDetails
+		Bars     []moveBar
+	}{
+		Arena:    arena,
+		Prefix:   prefix,
+		Match:    match,
+		Player1:  sides[0],
+		Player2:  sides[1],
+		CoinFlip: match.Player1Wins == match.Player2Wins,
+		Details:  details,
+		Bars:     bars,
+	}
+	if err := matchTmpl.Execute(w, data); err != nil {
+		http.Error(w, fmt.Sprintf("Template error: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// boardCell is one square of a replay board: the shot at it, if any, and
+// whether it was the latest
+type boardCell struct {
+	Result byte
+	Latest bool
+}
+
+// replayBoard marks the shots at one board up to the given turn. Player 1's
+// shots are the even ones.
+func replayBoard(shots []storage.Shot, player, turn int) [boardSize][boardSize]boardCell {
+	var board [boardSize][boardSize]boardCell
+	for i := player; i < 2*turn && i < len(shots); i += 2 {
+		shot := shots[i]
+		if shot.Row < 0 || shot.Row >= boardSize || shot.Col < 0 || shot.Col >= boardSize {
+			continue
+		}
+		board[shot.Row][shot.Col] = boardCell{Result: shot.Result, Latest: i >= 2*turn-2}
+	}
+	return board
+}
+
+// replayTurn is one row of a replay's shot log
+type replayTurn struct {
+	Turn    int
+	Player1 string
+	Player2 string
+}
+
+func shotLabel(shot storage.Shot) string {
+	result := map[byte]string{storage.ShotMiss: "miss", storage.ShotHit: "hit", storage.ShotSunk: "sunk"}[shot.Result]
+	return fmt.Sprintf("%c%d %s", 'A'+shot.Row, shot.Col+1, result)
+}
+
+var replayTmpl = template.Must(template.New("replay").Funcs(matchFuncs).Funcs(template.FuncMap{
+	"rowLabel": func(row int) string {
+		return string(rune('A' + row))
+	},
+	"cellClass": func(cell boardCell) string {
+		class := map[byte]string{storage.ShotMiss: "miss", storage.ShotHit: "hit", storage.ShotSunk: "sunk"}[cell.Result]
+		if cell.Latest {
+			class += " latest"
+		}
+		return class
+	},
+}).Parse(replayHTML))
+
+func HandleMatchReplay(w http.ResponseWriter, r *http.Request) {
+	arena := requestArena(w, r)
+	if arena == nil {
+		return
+	}
+	match := matchFromRequest(w, r, arena)
+	if match == nil {
+		return
+	}
+
+	details, err := storage.GetMatchDetails(match.ID)
+	if err != nil {
+		http.Error(w, "Error loading replay", http.StatusInternalServerError)
+		return
+	}
+	game, _ := strconv.Atoi(chi.URLParam(r, "game"))
+	var replay *storage.Replay
+	if details != nil {
+		for i := range details.Replays {
+			if details.Replays[i].Game == game {
+				replay = &details.Replays[i]
+			}
+		}
+	}
+	if replay == nil {
+		http.Error(w, "Replay not found", http.StatusNotFound)
+		return
+	}
+
+	// ?turn= steps through the game; it opens on the final position
+	total := len(replay.Shots) / 2
+	turn := total
+	if t, err := strconv.Atoi(r.URL.Query().Get("turn")); err == nil && t >= 0 && t <= total {
+		turn = t
+	}
+
+	var log []replayTurn
+	for t := 0; t < total; t++ {
+		log = append(log, replayTurn{Turn: t + 1, Player1: shotLabel(replay.Shots[2*t]), Player2: shotLabel(replay.Shots[2*t+1])})
+	}
+
+	data := struct {
+		Arena   *storage.Arena
+		Prefix  string
+		Match   *storage.Match
+		Replay  *storage.Replay
+		Turn    int
+		Prev    int
+		Next    int
+		Total   int
+		Boards  [2][boardSize][boardSize]boardCell
+		Columns []int
+		Log     []replayTurn
+	}{
+		Arena:  arena,
+		Prefix: arenaPath(arena.Slug),
+		Match:  match,
+		Replay: replay,
+		Turn:   turn,
+		Prev:   turn - 1,
+		Next:   turn + 1,
+		Total:  total,
+		Boards: [2][boardSize][boardSize]boardCell{
+			replayBoard(replay.Shots, 0, turn),
+			replayBoard(replay.Shots, 1, turn),
+		},
+		Columns: []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		Log:     log,
+	}
+	if err := replayTmpl.Execute(w, data); err != nil {
+		http.Error(w, fmt.Sprintf("Template error: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// matchStyles are shared by the match and replay pages
+const matchStyles = `
+        * {
+            margin: 0;
+            padding: 0;
+            box-sizing: border-box;
+        }
+
+        body {
+            font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif;
+            background: #0f172a;
+            color: #e2e8f0;
+            min-height: 100vh;
+            padding: 2rem 1rem;
+        }
+
+        .container {
+            max-width: 1100px;
+            margin: 0 auto;
+        }
+
+        h1 {
+            font-size: 2.5rem;
+            font-weight: 700;
+            margin-bottom: 0.5rem;
+            background: linear-gradient(135deg, #60a5fa 0%, #a78bfa 100%);
+            -webkit-background-clip: text;
+            -webkit-text-fill-color: transparent;
+        }
+
+        h2 {
+            font-size: 1.1rem;
+            margin-bottom: 1rem;
+        }
+
+        a {
+            color: #60a5fa;
+            text-decoration: none;
+        }
+
+        a:hover {
+            text-decoration: underline;
+        }
+
+        .back-link {
+            display: inline-block;
+            margin-bottom: 2rem;
+            font-size: 0.9rem;
+        }
+
+        .subtitle {
+            color: #94a3b8;
+            margin-bottom: 2rem;
+        }
+
+        .badge {
+            display: inline-block;
+            padding: 0.15rem 0.5rem;
+            border-radius: 999px;
+            font-size: 0.75rem;
+            background: #78350f;
+            color: #fde68a;
+            margin-left: 0.5rem;
+        }
+
+        .card {
+            background: #1e293b;
+            border: 1px solid #334155;
+            border-radius: 12px;
+            padding: 1.5rem;
+            margin-bottom: 1.5rem;
+        }
+
+        .muted {
+            color: #94a3b8;
+        }
+
+        .p1 {
+            color: #60a5fa;
+        }
+
+        .p2 {
+            color: #a78bfa;
+        }
+`
+
+const matchHTML = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>{{.Match.Player1}} vs {{.Match.Player2}} - Battleship Arena</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <link rel="icon" href="data:image/svg+xml,<svg xmlns=%22http://www.w3.org/2000/svg%22 viewBox=%220 0 100 100%22><text y=%22.9em%22 font-size=%2290%22>⚓</text></svg>">
+    <style>` + matchStyles + `
+        .sides {
+            display: grid;
+            grid-template-columns: 1fr auto 1fr;
+            gap: 1rem;
+            align-items: stretch;
+            margin-bottom: 1.5rem;
+        }
+
+        .side {
+            margin-bottom: 0;
+        }
+
+        .side.winner {
+            border-color: #10b981;
+        }
+
+        .side .name {
+            font-size: 1.5rem;
+            font-weight: 700;
+        }
+
+        .side .wins {
+            font-size: 3rem;
+            font-weight: 700;
+            margin: 0.5rem 0;
+        }
+
+        .side dl {
+            display: grid;
+            grid-template-columns: auto 1fr;
+            gap: 0.25rem 1rem;
+            font-size: 0.875rem;
+        }
+
+        .side dt {
+            color: #94a3b8;
+        }
+
+        .vs {
+            align-self: center;
+            color: #64748b;
+            font-weight: 700;
+        }
+
+        .up {
+            color: #10b981;
+        }
+
+        .down {
+            color: #ef4444;
+        }
+
+        .facts {
+            display: grid;
+            grid-template-columns: repeat(auto-fit, minmax(160px, 1fr));
+            gap: 1rem;
+        }
+
+        .fact-label {
+            font-size: 0.8rem;
+            color: #94a3b8;
+            margin-bottom: 0.25rem;
+        }
+
+        .fact-value {
+            font-size: 1.25rem;
+            font-weight: 600;
+        }
+
+        .mono {
+            font-family: Monaco, monospace;
+            font-size: 1rem;
+        }
+
+        .bars {
+            display: grid;
+            grid-template-columns: auto 1fr auto;
+            gap: 0.2rem 0.75rem;
+            font-size: 0.8rem;
+            align-items: center;
+        }
+
+        .bar {
+            display: flex;
+            height: 0.9rem;
+        }
+
+        .bar span {
+            display: block;
+            height: 100%;
+        }
+
+        .bar .p1 {
+            background: #60a5fa;
+        }
+
+        .bar .p2 {
+            background: #a78bfa;
+        }
+
+        .bar .tie {
+            background: #64748b;
+        }
+
+        .legend {
+            margin-top: 1rem;
+            font-size: 0.8rem;
+        }
+
+        .legend span::before {
+            content: "■ ";
+        }
+
+        pre {
+            background: #0f172a;
+            border: 1px solid #334155;
+            border-radius: 8px;
+            padding: 1rem;
+            overflow-x: auto;
+            font-size: 0.8rem;
+            margin-top: 1rem;
+        }
+
+        ul.replays li {
+            list-style: none;
+            padding: 0.25rem 0;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <a href="{{.Prefix}}/" class="back-link">← Back to Leaderboard</a>
+        <h1>Match #{{.Match.ID}}</h1>
+        <p class="subtitle">
+            {{.Arena.Name}} · played {{.Match.Timestamp.Format "Jan 2, 2006 3:04 PM"}}
+            {{if not .Match.Valid}}<span class="badge">superseded — one side has uploaded a new version since</span>{{end}}
+        </p>
+
+        <div class="sides">
+            {{template "side" .Player1}}
+            <div class="vs">vs</div>
+            {{template "side" .Player2}}
+        </div>
+        {{if .CoinFlip}}<p class="muted" style="margin: -0.75rem 0 1.5rem;">Level on games; the winner was decided by a coin flip.</p>{{end}}
+
+        <div class="card">
+            <h2>Match</h2>
+            {{if .Details}}
+            <div class="facts">
+                <div><div class="fact-label">Games</div><div class="fact-value">{{.Details.Games}}</div></div>
+                <div><div class="fact-label">Ties</div><div class="fact-value">{{.Details.Ties}}</div></div>
+                <div><div class="fact-label">Seed</div><div class="fact-value mono">{{.Details.Seed}}</div></div>
+                <div><div class="fact-label">Engine version</div><div class="fact-value mono">{{.Details.EngineVersion}}</div></div>
+                <div><div class="fact-label">Runtime</div><div class="fact-value">{{duration .Details.Runtime}}</div></div>
+            </div>
+            {{else}}
+            <p class="muted">This match was played before game counts, seeds and replays were recorded.</p>
+            {{end}}
+        </div>
+
+        {{if .Bars}}
+        <div class="card">
+            <h2>Game length</h2>
+            <div class="bars">
+                {{range .Bars}}
+                <span class="muted">{{.Label}}</span>
+                <div class="bar" title="{{$.Match.Player1}} {{.Player1Wins}} · {{$.Match.Player2}} {{.Player2Wins}} · ties {{.Ties}}">
+                    <span class="p1" style="width: {{printf "%.1f" .Player1Width}}%"></span><span class="p2" style="width: {{printf "%.1f" .Player2Width}}%"></span><span class="tie" style="width: {{printf "%.1f" .TiesWidth}}%"></span>
+                </div>
+                <span class="muted">{{.Player1Wins}}/{{.Player2Wins}}{{if .Ties}}/{{.Ties}}{{end}}</span>
+                {{end}}
+            </div>
+            <div class="legend muted">
+                Moves per game, split by who won it:
+                <span class="p1">{{.Match.Player1}}</span> · <span class="p2">{{.Match.Player2}}</span> · <span style="color: #64748b;">tie</span>
+            </div>
+        </div>
+        {{end}}
+
+        {{if .Details}}
+        <div class="card">
+            <h2>Errors</h2>
+            {{if or .Details.Player1Invalid .Details.Player2Invalid .Details.Output}}
+            {{if .Details.Player1Invalid}}<p><span class="p1">{{.Match.Player1}}</span> made {{.Details.Player1Invalid}} invalid move{{if ne .Details.Player1Invalid 1}}s{{end}}, replaced with random shots.</p>{{end}}
+            {{if .Details.Player2Invalid}}<p><span class="p2">{{.Match.Player2}}</span> made {{.Details.Player2Invalid}} invalid move{{if ne .Details.Player2Invalid 1}}s{{end}}, replaced with random shots.</p>{{end}}
+            {{if .Details.Output}}<p class="muted" style="margin-top: 0.5rem;">Other output from the match:</p><pre>{{.Details.Output}}</pre>{{end}}
+            {{else}}
+            <p class="muted">None — every move was valid and nothing else was printed.</p>
+            {{end}}
+        </div>
+
+        {{if .Details.Replays}}
+        <div class="card">
+            <h2>Replays</h2>
+            <ul class="replays">
+                {{range .Details.Replays}}
+                <li><a href="{{$.Prefix}}/match/{{$.Match.ID}}/replay/{{.Game}}">Game {{.Game}}</a> —
+                    {{if eq .Winner 1}}won by <span class="p1">{{$.Match.Player1}}</span>{{else if eq .Winner 2}}won by <span class="p2">{{$.Match.Player2}}</span>{{else}}tied{{end}}
+                    in {{turns .}} turns</li>
+                {{end}}
+            </ul>
+        </div>
+        {{end}}
+        {{end}}
+
+        <p class="muted" style="font-size: 0.85rem;">
+            <a href="{{.Prefix}}/api/v1/matches/{{.Match.ID}}">JSON</a> ·
+            <a href="{{.Prefix}}/matrix?player={{.Match.Player1}}">{{.Match.Player1}} in the matrix</a> ·
+            <a href="{{.Prefix}}/matrix?player={{.Match.Player2}}">{{.Match.Player2}} in the matrix</a>
+        </p>
+    </div>
+</body>
+</html>
+
+{{define "side"}}
+<div class="card side{{if .Won}} winner{{end}}">
+    <div class="name"><a href="{{$.Prefix}}/user/{{.Submission.Username}}">{{.Submission.Username}}</a>{{if .Won}} 🏆{{end}}</div>
+    <div class="wins">{{.Wins}}</div>
+    <dl>
+        <dt>Submission</dt><dd>#{{.Submission.ID}} {{.Submission.Filename}}</dd>
+        <dt>Uploaded</dt><dd>{{.Submission.UploadTime.Format "Jan 2, 3:04 PM"}}</dd>
+        <dt>Avg moves</dt><dd>{{.AvgMoves}}</dd>
+        <dt>Rating change</dt><dd>{{if .Rated}}<span class="{{if ge .RatingChange 0.0}}up{{else}}down{{end}}">{{signed .RatingChange}}</span>{{else}}<span class="muted">not rated</span>{{end}}</dd>
+    </dl>
+</div>
+{{end}}
+`
+
+const replayHTML = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>Game {{.Replay.Game}} of {{.Match.Player1}} vs {{.Match.Player2}} - Battleship Arena</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <link rel="icon" href="data:image/svg+xml,<svg xmlns=%22http://www.w3.org/2000/svg%22 viewBox=%220 0 100 100%22><text y=%22.9em%22 font-size=%2290%22>⚓</text></svg>">
+    <style>` + matchStyles + `
+        .nav {
+            display: flex;
+            gap: 1rem;
+            align-items: center;
+            margin-bottom: 1.5rem;
+        }
+
+        .boards {
+            display: grid;
+            grid-template-columns: repeat(auto-fit, minmax(300px, 1fr));
+            gap: 1.5rem;
+        }
+
+        table.board {
+            border-collapse: separate;
+            border-spacing: 2px;
+            font-size: 0.75rem;
+        }
+
+        table.board th {
+            color: #64748b;
+            font-weight: 400;
+            width: 1.75rem;
+        }
+
+        table.board td {
+            width: 1.75rem;
+            height: 1.75rem;
+            background: #0f172a;
+            border-radius: 3px;
+            text-align: center;
+        }
+
+        td.miss::after {
+            content: "·";
+            color: #64748b;
+        }
+
+        td.hit {
+            background: #b45309;
+        }
+
+        td.sunk {
+            background: #b91c1c;
+        }
+
+        td.latest {
+            outline: 2px solid #fbbf24;
+        }
+
+        table.log {
+            width: 100%;
+            border-collapse: collapse;
+            font-size: 0.85rem;
+        }
+
+        table.log td, table.log th {
+            padding: 0.3rem 0.5rem;
+            border-bottom: 1px solid #334155;
+            text-align: left;
+        }
+
+        table.log tr.current {
+            background: #334155;
+        }
+
+        .log-wrap {
+            max-height: 24rem;
+            overflow-y: auto;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <a href="{{.Prefix}}/match/{{.Match.ID}}" class="back-link">← Back to match #{{.Match.ID}}</a>
+        <h1>Game {{.Replay.Game}}</h1>
+        <p class="subtitle">
+            <span class="p1">{{.Match.Player1}}</span> vs <span class="p2">{{.Match.Player2}}</span> ·
+            {{if eq .Replay.Winner 1}}won by {{.Match.Player1}}{{else if eq .Replay.Winner 2}}won by {{.Match.Player2}}{{else}}tied{{end}} in {{.Total}} turns
+        </p>
+
+        <div class="nav">
+            <a href="?turn=0">⏮</a>
+            {{if gt .Turn 0}}<a href="?turn={{.Prev}}">◀ Prev</a>{{end}}
+            <span>Turn {{.Turn}} of {{.Total}}</span>
+            {{if lt .Turn .Total}}<a href="?turn={{.Next}}">Next ▶</a>{{end}}
+            <a href="?turn={{.Total}}">⏭</a>
+        </div>
+
+        <div class="boards">
+            {{range $player, $board := .Boards}}
+            <div class="card">
+                <h2>{{if eq $player 0}}<span class="p1">{{$.Match.Player1}}</span>'s shots{{else}}<span class="p2">{{$.Match.Player2}}</span>'s shots{{end}}</h2>
+                <table class="board">
+                    <tr><th></th>{{range $.Columns}}<th>{{.}}</th>{{end}}</tr>
+                    {{range $row, $cells := $board}}
+                    <tr><th>{{rowLabel $row}}</th>{{range $cells}}<td class="{{cellClass .}}"></td>{{end}}</tr>
+                    {{end}}
+                </table>
+            </div>
+            {{end}}
+        </div>
+
+        <div class="card">
+            <h2>Shots</h2>
+            <div class="log-wrap">
+                <table class="log">
+                    <tr><th>Turn</th><th class="p1">{{.Match.Player1}}</th><th class="p2">{{.Match.Player2}}</th></tr>
+                    {{range .Log}}
+                    <tr{{if eq .Turn $.Turn}} class="current"{{end}}><td><a href="?turn={{.Turn}}">{{.Turn}}</a></td><td>{{.Player1}}</td><td>{{.Player2}}</td></tr>
+                    {{end}}
+                </table>
+            </div>
+        </div>
+    </div>
+</body>
+</html>
+`
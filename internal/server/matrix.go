@@ -0,0 +1,348 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+
+	"battleship-arena/internal/storage"
+)
+
+// matrixSort reads ?sort=, defaulting to rating
+func matrixSort(r *http.Request) string {
+	if r.URL.Query().Get("sort") == storage.MatrixByName {
+		return storage.MatrixByName
+	}
+	return storage.MatrixByRating
+}
+
+// weakSpot is an opponent a player has lost more games to than they've won
+type weakSpot struct {
+	Opponent string
+	Cell     *storage.MatrixCell
+}
+
+// weakSpots lists the row player's losing pairings, worst first
+func weakSpots(matrix *storage.Matrix, row int) []weakSpot {
+	var spots []weakSpot
+	for j, cell := range matrix.Cells[row] {
+		if cell != nil && cell.Wins < cell.Losses {
+			spots = append(spots, weakSpot{Opponent: matrix.Players[j].Username, Cell: cell})
+		}
+	}
+	sort.SliceStable(spots, func(a, b int) bool { return spots[a].Cell.WinPct() < spots[b].Cell.WinPct() })
+	return spots
+}
+
+var matrixTmpl = template.Must(template.New("matrix").Funcs(template.FuncMap{
+	// cellColor runs from red at 0% through amber to green at 100%
+	"cellColor": func(cell *storage.MatrixCell) template.CSS {
+		return template.CSS(fmt.Sprintf("background: hsl(%.0f, 65%%, 32%%)", cell.WinPct()*1.2))
+	},
+	"pct": func(cell *storage.MatrixCell) string {
+		return fmt.Sprintf("%.0f", cell.WinPct())
+	},
+}).Parse(matrixHTML))
+
+func HandleMatrix(w http.ResponseWriter, r *http.Request) {
+	arena := requestArena(w, r)
+	if arena == nil {
+		return
+	}
+
+	sortBy := matrixSort(r)
+	matrix, err := storage.GetMatrix(arena.ID, sortBy)
+	if err != nil {
+		http.Error(w, "Error loading matrix", http.StatusInternalServerError)
+		return
+	}
+
+	// ?player= highlights one row and lists where that player is weak
+	player := r.URL.Query().Get("player")
+	row := -1
+	for i, p := range matrix.Players {
+		if p.Username == player {
+			row = i
+		}
+	}
+	var weak []weakSpot
+	if row >= 0 {
+		weak = weakSpots(matrix, row)
+	}
+
+	data := struct {
+		Arena  *storage.Arena
+		Prefix string
+		Matrix *storage.Matrix
+		SortBy string
+		Player string
+		Row    int
+		Weak   []weakSpot
+	}{
+		Arena:  arena,
+		Prefix: arenaPath(arena.Slug),
+		Matrix: matrix,
+		SortBy: sortBy,
+		Player: player,
+		Row:    row,
+		Weak:   weak,
+	}
+	if err := matrixTmpl.Execute(w, data); err != nil {
+		http.Error(w, fmt.Sprintf("Template error: %v", err), http.StatusInternalServerError)
+	}
+}
+
+const matrixHTML = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>Head-to-Head - Battleship Arena</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <link rel="icon" href="data:image/svg+xml,<svg xmlns=%22http://www.w3.org/2000/svg%22 viewBox=%220 0 100 100%22><text y=%22.9em%22 font-size=%2290%22>⚓</text></svg>">
+    <style>
+        * {
+            margin: 0;
+            padding: 0;
+            box-sizing: border-box;
+        }
+
+        body {
+            font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif;
+            background: #0f172a;
+            color: #e2e8f0;
+            min-height: 100vh;
+            padding: 2rem 1rem;
+        }
+
+        .container {
+            max-width: 1400px;
+            margin: 0 auto;
+        }
+
+        h1 {
+            font-size: 2.5rem;
+            font-weight: 700;
+            margin-bottom: 0.5rem;
+            background: linear-gradient(135deg, #60a5fa 0%, #a78bfa 100%);
+            -webkit-background-clip: text;
+            -webkit-text-fill-color: transparent;
+        }
+
+        .back-link {
+            display: inline-block;
+            margin-bottom: 2rem;
+            color: #60a5fa;
+            text-decoration: none;
+            font-size: 0.9rem;
+        }
+
+        .back-link:hover {
+            text-decoration: underline;
+        }
+
+        .subtitle {
+            color: #94a3b8;
+            margin-bottom: 1.5rem;
+        }
+
+        .controls {
+            display: flex;
+            gap: 1.5rem;
+            align-items: center;
+            flex-wrap: wrap;
+            margin-bottom: 1.5rem;
+            color: #94a3b8;
+            font-size: 0.9rem;
+        }
+
+        .controls a {
+            color: #60a5fa;
+            text-decoration: none;
+        }
+
+        .controls a.active {
+            color: #e2e8f0;
+            font-weight: 600;
+        }
+
+        .controls select {
+            background: #1e293b;
+            color: #e2e8f0;
+            border: 1px solid #334155;
+            border-radius: 6px;
+            padding: 0.25rem 0.5rem;
+        }
+
+        .matrix-wrap {
+            overflow-x: auto;
+            background: #1e293b;
+            border: 1px solid #334155;
+            border-radius: 12px;
+            padding: 1rem;
+        }
+
+        table {
+            border-collapse: separate;
+            border-spacing: 2px;
+            font-size: 0.85rem;
+        }
+
+        th {
+            color: #94a3b8;
+            font-weight: 600;
+            padding: 0.35rem 0.5rem;
+            white-space: nowrap;
+        }
+
+        th.col {
+            writing-mode: vertical-rl;
+            transform: rotate(180deg);
+            text-align: left;
+        }
+
+        th.row {
+            text-align: right;
+        }
+
+        td {
+            min-width: 2.75rem;
+            height: 2.25rem;
+            text-align: center;
+            border-radius: 4px;
+            background: #0f172a;
+        }
+
+        td a {
+            display: block;
+            color: #f8fafc;
+            text-decoration: none;
+            line-height: 2.25rem;
+        }
+
+        td a:hover {
+            outline: 2px solid #60a5fa;
+            border-radius: 4px;
+        }
+
+        td.self {
+            background: #334155;
+        }
+
+        td.unplayed {
+            color: #475569;
+        }
+
+        tr.highlight th.row,
+        th.col.highlight {
+            color: #fbbf24;
+        }
+
+        tr.highlight td {
+            box-shadow: inset 0 0 0 1px #fbbf24;
+        }
+
+        .rating {
+            color: #64748b;
+            font-weight: 400;
+            margin-left: 0.35rem;
+        }
+
+        .bot {
+            color: #a78bfa;
+            font-size: 0.7rem;
+            margin-left: 0.25rem;
+        }
+
+        .weak {
+            margin-top: 2rem;
+            background: #1e293b;
+            border: 1px solid #334155;
+            border-radius: 12px;
+            padding: 1.5rem;
+        }
+
+        .weak h2 {
+            font-size: 1.1rem;
+            margin-bottom: 0.75rem;
+        }
+
+        .weak li {
+            list-style: none;
+            padding: 0.25rem 0;
+            color: #cbd5e1;
+        }
+
+        .weak a {
+            color: #60a5fa;
+            text-decoration: none;
+        }
+
+        .empty {
+            color: #94a3b8;
+            padding: 2rem;
+            text-align: center;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <a href="{{.Prefix}}/" class="back-link">← Back to Leaderboard</a>
+        <h1>Head-to-Head</h1>
+        <p class="subtitle">{{.Arena.Name}} · each cell is the row player's share of games won against the column player; click it for the match</p>
+
+        <form class="controls" method="get">
+            <span>Sort:
+                <a href="?sort=rating{{if .Player}}&player={{.Player}}{{end}}" {{if eq .SortBy "rating"}}class="active"{{end}}>rating</a> ·
+                <a href="?sort=name{{if .Player}}&player={{.Player}}{{end}}" {{if eq .SortBy "name"}}class="active"{{end}}>name</a>
+            </span>
+            <input type="hidden" name="sort" value="{{.SortBy}}">
+            <label>Highlight
+                <select name="player" onchange="this.form.submit()">
+                    <option value="">nobody</option>
+                    {{range .Matrix.Players}}<option value="{{.Username}}" {{if eq .Username $.Player}}selected{{end}}>{{.Username}}</option>{{end}}
+                </select>
+            </label>
+            <a href="{{.Prefix}}/api/v1/matrix?sort={{.SortBy}}">JSON</a>
+        </form>
+
+        {{if .Matrix.Players}}
+        <div class="matrix-wrap">
+            <table>
+                <tr>
+                    <th></th>
+                    {{range $j, $p := .Matrix.Players}}<th class="col{{if eq $j $.Row}} highlight{{end}}">{{$p.Username}}</th>{{end}}
+                </tr>
+                {{range $i, $p := .Matrix.Players}}
+                <tr{{if eq $i $.Row}} class="highlight"{{end}}>
+                    <th class="row"><a href="?sort={{$.SortBy}}&player={{$p.Username}}" style="color: inherit; text-decoration: none;">{{$p.Username}}</a>{{if $p.IsBot}}<span class="bot">BOT</span>{{end}}<span class="rating">{{$p.Rating}}</span></th>
+                    {{range $j, $cell := index $.Matrix.Cells $i}}
+                    {{if eq $i $j}}<td class="self"></td>
+                    {{else if $cell}}<td style="{{cellColor $cell}}"><a href="{{$.Prefix}}/match/{{$cell.MatchID}}" title="{{$p.Username}} {{$cell.Wins}}–{{$cell.Losses}} {{(index $.Matrix.Players $j).Username}}">{{pct $cell}}</a></td>
+                    {{else}}<td class="unplayed" title="not played yet">·</td>{{end}}
+                    {{end}}
+                </tr>
+                {{end}}
+            </table>
+        </div>
+        {{else}}
+        <div class="matrix-wrap empty">No active submissions yet</div>
+        {{end}}
+
+        {{if ge .Row 0}}
+        <div class="weak">
+            <h2>Where {{.Player}} is weak</h2>
+            {{if .Weak}}
+            <ul>
+                {{range .Weak}}<li><a href="{{$.Prefix}}/match/{{.Cell.MatchID}}">{{.Opponent}}</a> — won {{pct .Cell}}% ({{.Cell.Wins}}–{{.Cell.Losses}})</li>{{end}}
+            </ul>
+            {{else}}
+            <p style="color: #94a3b8;">No losing pairings so far.</p>
+            {{end}}
+        </div>
+        {{end}}
+    </div>
+</body>
+</html>
+`
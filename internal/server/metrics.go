@@ -0,0 +1,60 @@
+package server
+
+import (
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+
+	"battleship-arena/internal/metrics"
+)
+
+var (
+	uploadsTotal = metrics.NewCounter(
+		"battleship_uploads_total",
+		"Submissions uploaded, by protocol",
+		"protocol",
+	)
+	sshSessions = metrics.NewGauge(
+		"battleship_ssh_sessions",
+		"Open SSH sessions, by kind",
+		"kind",
+	)
+	sshSessionsTotal = metrics.NewCounter(
+		"battleship_ssh_sessions_total",
+		"SSH sessions started, by kind",
+		"kind",
+	)
+)
+
+func init() {
+	metrics.NewGaugeFunc("battleship_sse_clients", "Connected server-sent event clients", func() float64 {
+		if SSEServer == nil {
+			return 0
+		}
+		return float64(SSEServer.ClientCount())
+	})
+}
+
+// trackSession counts an SSH session until the returned func is called
+func trackSession(kind string) func() {
+	sshSessions.Inc(kind)
+	sshSessionsTotal.Inc(kind)
+	return func() { sshSessions.Dec(kind) }
+}
+
+// MetricsMiddleware counts the sessions handled by the wish middleware
+// chain: the TUI, SCP and commands. SFTP is counted by its subsystem handler.
+func MetricsMiddleware() wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			kind := "tui"
+			if cmd := s.Command(); len(cmd) > 0 {
+				kind = "command"
+				if cmd[0] == "scp" {
+					kind = "scp"
+				}
+			}
+			defer trackSession(kind)()
+			next(s)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// apiVersion is the version of the /api/v1 contract the OpenAPI document
+// describes. Bump the minor version when adding endpoints or fields.
+const apiVersion = "1.0.0"
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// openAPIDocument describes apiRoutes as an OpenAPI 3.0 document, with the
+// response schemas read off the Go types by reflection. base is the URL
+// prefix the API is served under, which differs per arena.
+func openAPIDocument(base string) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]interface{}{}
+	for _, route := range apiRoutes {
+		var params []interface{}
+		for _, p := range route.Params {
+			param := map[string]interface{}{
+				"name":     p.Name,
+				"in":       p.In,
+				"required": p.In == "path",
+				"schema":   paramSchema(p.Type),
+			}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			params = append(params, param)
+		}
+
+		responses := map[string]interface{}{
+			"200": map[string]interface{}{
+				"description": "OK",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": typeSchema(reflect.TypeOf(route.Response), schemas),
+					},
+				},
+			},
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": typeSchema(reflect.TypeOf(apiErrorBody{}), schemas),
+					},
+				},
+			},
+		}
+
+		operation := map[string]interface{}{
+			"summary":     route.Summary,
+			"operationId": operationID(route.Path),
+			"responses":   responses,
+		}
+		if params != nil {
+			operation["parameters"] = params
+		}
+		paths[route.Path] = map[string]interface{}{"get": operation}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Battleship Arena API",
+			"version":     apiVersion,
+			"description": "Read-only access to an arena's players, submissions, matches, tournaments and queue. Errors come back as {\"error\": {\"code\", \"message\"}}.",
+		},
+		"servers":    []interface{}{map[string]interface{}{"url": base}},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// operationID names an endpoint after its path: /players/{username}/submissions
+// becomes getPlayersUsernameSubmissions
+func operationID(path string) string {
+	id := "get"
+	for _, part := range strings.FieldsFunc(pathParam.ReplaceAllString(path, "$1"), func(r rune) bool {
+		return r == '/' || r == '-' || r == '.'
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+func paramSchema(kind string) map[string]interface{} {
+	if kind == "date-time" {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	return map[string]interface{}{"type": kind}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// typeSchema returns the schema of t, adding named structs to schemas and
+// referring to them there
+func typeSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Ptr:
+		schema := typeSchema(t.Elem(), schemas)
+		if ref, ok := schema["$ref"]; ok {
+			// A $ref can't have siblings in OpenAPI 3.0
+			return map[string]interface{}{"allOf": []interface{}{map[string]interface{}{"$ref": ref}}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object"}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = nil // reserve the name while the fields are read
+			properties := map[string]interface{}{}
+			var required []string
+			structProperties(t, schemas, properties, &required)
+			schema := map[string]interface{}{"type": "object", "properties": properties}
+			if len(required) > 0 {
+				schema["required"] = required
+			}
+			schemas[name] = schema
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	panic("openapi: no schema for " + t.String())
+}
+
+// structProperties adds the JSON fields of t to properties, flattening
+// embedded structs the way encoding/json does
+func structProperties(t reflect.Type, schemas, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			structProperties(field.Type, schemas, properties, required)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = typeSchema(field.Type, schemas)
+		*required = append(*required, name)
+	}
+}
+
+// schemaName drops the api prefix the response types carry in Go:
+// apiMatchPage is MatchPage
+func schemaName(t reflect.Type) string {
+	name := strings.TrimPrefix(t.Name(), "api")
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -2,14 +2,18 @@ package server
 
 import (
 	"fmt"
-	"log"
+	"io"
+	"io/fs"
+	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish/scp"
 	
+	"battleship-arena/internal/bundle"
 	"battleship-arena/internal/storage"
 )
 
@@ -21,7 +25,113 @@ func NewSCPHandlers(uploadDir string) (scp.CopyToClientHandler, scp.CopyFromClie
 		uploadDir:   uploadDir,
 	}
 	
-	return nil, uploadHandler
+	return &downloadHandler{uploadDir: uploadDir}, uploadHandler
+}
+
+// downloadHandler serves "scp host:<path> ." from the user's own directory
+// and generated reports; see userFiles
+type downloadHandler struct {
+	uploadDir string
+}
+
+func (h *downloadHandler) files(s ssh.Session) userFiles {
+	return userFiles{uploadDir: h.uploadDir, username: s.User()}
+}
+
+// Glob expands wildcards in the last element of a path
+func (h *downloadHandler) Glob(s ssh.Session, pattern string) ([]string, error) {
+	if err := requireAccount(s.Context()); err != nil {
+		return nil, err
+	}
+	pattern = cleanPath(pattern)
+	dir, base := path.Split(pattern)
+	if !strings.ContainsAny(base, "*?[") {
+		return []string{pattern}, nil
+	}
+
+	infos, err := h.files(s).ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, info := range infos {
+		if ok, _ := path.Match(base, info.Name()); ok {
+			matches = append(matches, path.Join(dir, info.Name()))
+		}
+	}
+	return matches, nil
+}
+
+// WalkDir visits a directory and everything below it
+func (h *downloadHandler) WalkDir(s ssh.Session, root string, fn fs.WalkDirFunc) error {
+	// scp nests entries by path prefix, so the top of the user's view is
+	// walked as "~", which cleanPath drops again
+	if root = cleanPath(root); root == "" {
+		root = "~"
+	}
+	info, err := h.files(s).Stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	return h.walk(s, root, fs.FileInfoToDirEntry(info), fn)
+}
+
+func (h *downloadHandler) walk(s ssh.Session, name string, entry fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(name, entry, nil); err != nil || !entry.IsDir() {
+		if err == fs.SkipDir {
+			return nil
+		}
+		return err
+	}
+	infos, err := h.files(s).ReadDir(name)
+	if err != nil {
+		return fn(name, entry, err)
+	}
+	for _, info := range infos {
+		if err := h.walk(s, path.Join(name, info.Name()), fs.FileInfoToDirEntry(info), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *downloadHandler) NewDirEntry(s ssh.Session, name string) (*scp.DirEntry, error) {
+	info, err := h.files(s).Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return &scp.DirEntry{
+		Children: []scp.Entry{},
+		Name:     info.Name(),
+		Filepath: name,
+		Mode:     info.Mode().Perm(),
+		Mtime:    info.ModTime().Unix(),
+		Atime:    info.ModTime().Unix(),
+	}, nil
+}
+
+func (h *downloadHandler) NewFileEntry(s ssh.Session, name string) (*scp.FileEntry, func() error, error) {
+	if actor := adminActor(s.Context()); actor != "" {
+		if err := storage.Audit(actor, "download_as", s.User(), fmt.Sprintf("%s via scp", cleanPath(name))); err != nil {
+			slog.Error("writing audit log failed", "err", err)
+			return nil, nil, fmt.Errorf("download refused: audit log unavailable")
+		}
+	}
+
+	f, info, err := h.files(s).Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.Debug("scp download", "user", s.User(), "path", cleanPath(name), "bytes", info.Size())
+	return &scp.FileEntry{
+		Name:     info.Name(),
+		Filepath: name,
+		Mode:     info.Mode().Perm(),
+		Size:     info.Size(),
+		Reader:   f,
+		Mtime:    info.ModTime().Unix(),
+		Atime:    info.ModTime().Unix(),
+	}, f.Close, nil
 }
 
 type validatingHandler struct {
@@ -30,19 +140,52 @@ type validatingHandler struct {
 }
 
 func (h *validatingHandler) Write(s ssh.Session, entry *scp.FileEntry) (int64, error) {
+	n, err := h.write(s, entry)
+	// A failed copy stops there, so a directory it was uploading is left
+	// incomplete
+	if pending := sessionBundles(s); err != nil && pending != nil {
+		pending.fail()
+	}
+	return n, err
+}
+
+func (h *validatingHandler) write(s ssh.Session, entry *scp.FileEntry) (int64, error) {
 	filename := filepath.Base(entry.Name)
-	log.Printf("SCP Write called: entry.Name=%s, filename=%s, size=%d", entry.Name, filename, entry.Size)
+	logger := slog.With("user", s.User(), "protocol", "scp")
+	logger.Debug("scp write", "name", entry.Name, "size", entry.Size)
 	
 	// Skip validation for directory markers
 	if filename == "~" || filename == "." || filename == ".." {
-		log.Printf("Skipping directory marker: %s", filename)
+		logger.Debug("skipping directory marker", "name", filename)
 		return 0, nil
 	}
 	
+	// Files of a memory_functions_* directory are submitted together once
+	// the copy is done
+	if dir, rel, ok := splitBundlePath(cleanPath(entry.Filepath)); ok {
+		n, err := h.writeBundleFile(s, dir, rel, entry)
+		if err != nil {
+			logger.Info("rejected directory upload", "path", entry.Filepath, "err", err)
+		}
+		return n, err
+	}
+	
 	// Validate filename
-	if !strings.HasPrefix(filename, "memory_functions_") || !strings.HasSuffix(filename, ".cpp") {
-		log.Printf("Invalid filename from %s: %s", s.User(), filename)
-		return 0, fmt.Errorf("only memory_functions_*.cpp files are accepted")
+	if !isUploadName(filename) {
+		logger.Info("rejected upload with invalid filename", "file", filename)
+		return 0, errUploadName
+	}
+	
+	if err := requireAccount(s.Context()); err != nil {
+		return 0, err
+	}
+	
+	if err := checkUploadsOpen(); err != nil {
+		return 0, err
+	}
+	
+	if season, err := storage.GetCurrentSeason(); err == nil && season == nil {
+		return 0, fmt.Errorf("submissions are closed between seasons")
 	}
 	
 	// Check if this is an admin override session
@@ -53,50 +196,110 @@ func (h *validatingHandler) Write(s ssh.Session, entry *scp.FileEntry) (int64, e
 	
 	targetUser := s.User()
 	if isAdmin {
-		log.Printf("🔑 Admin override: uploading as %s", targetUser)
+		logger.Info("admin override upload")
+	}
+
+	arena, err := uploadArena(targetUser, filepath.Dir(entry.Filepath))
+	if err != nil {
+		logger.Info("rejected upload", "path", entry.Filepath, "err", err)
+		return 0, err
 	}
 
-	userDir := filepath.Join(h.uploadDir, targetUser)
+	if actor := adminActor(s.Context()); actor != "" {
+		if err := storage.Audit(actor, "upload_as", targetUser, fmt.Sprintf("%s to arena %s via scp", filename, arena.Slug)); err != nil {
+			logger.Error("writing audit log failed", "err", err)
+			return 0, fmt.Errorf("upload refused: audit log unavailable")
+		}
+	}
+
+	userDir := arena.UserDir(h.uploadDir, targetUser)
 	if err := os.MkdirAll(userDir, 0755); err != nil {
-		log.Printf("Failed to create user directory: %v", err)
+		logger.Error("creating user directory failed", "err", err)
 		return 0, err
 	}
 
 	targetPath := filepath.Join(userDir, filename)
 	if _, err := os.Stat(targetPath); err == nil {
-		log.Printf("Removing old file: %s", targetPath)
+		logger.Debug("removing old file", "path", targetPath)
 		os.Remove(targetPath)
 	}
 
 	userEntry := &scp.FileEntry{
 		Name:     filename,
-		Filepath: filepath.Join(targetUser, filename),
+		Filepath: filepath.Join(arena.UserDir("", targetUser), filename),
 		Mode:     entry.Mode,
 		Size:     entry.Size,
 		Reader:   entry.Reader,
 	}
 	
-	log.Printf("Writing to: %s", filepath.Join(h.uploadDir, userEntry.Name))
+	logger.Debug("writing upload", "path", filepath.Join(h.uploadDir, userEntry.Filepath))
 
 	n, err := h.baseHandler.Write(s, userEntry)
 	if err != nil {
-		log.Printf("Write error: %v", err)
+		logger.Error("writing upload failed", "err", err)
 		return n, err
 	}
 
-	log.Printf("Uploaded %s from %s (%d bytes)", filename, targetUser, n)
-	
-	submissionID, err := storage.AddSubmission(targetUser, filename)
+	submissionID, err := submitUpload(h.uploadDir, arena, targetUser, filename)
+	if err != nil && bundle.IsArchive(filename) {
+		// An archive that can't be read is the uploader's to fix
+		logger.Info("rejected upload", "file", filename, "err", err)
+		return n, err
+	}
 	if err != nil {
-		log.Printf("Failed to add submission: %v", err)
+		logger.Error("adding submission failed", "file", filename, "err", err)
 	} else {
-		log.Printf("Queued submission %d for testing", submissionID)
+		logger.Info("uploaded, queued for testing", "submission_id", submissionID, "file", filename, "arena", arena.Slug, "bytes", n)
+		uploadsTotal.Inc("scp")
 	}
 	
 	return n, nil
 }
 
+// writeBundleFile stores one file of a directory uploaded with scp -r
+func (h *validatingHandler) writeBundleFile(s ssh.Session, dir, rel string, entry *scp.FileEntry) (int64, error) {
+	if err := requireAccount(s.Context()); err != nil {
+		return 0, err
+	}
+	pending := sessionBundles(s)
+	if pending == nil {
+		return 0, errUploadName
+	}
+	if entry.Size > uploadLimits.MaxBytes {
+		return 0, fmt.Errorf("%s: larger than %d bytes", entry.Filepath, uploadLimits.MaxBytes)
+	}
+	dst, err := pending.prepare(dir, rel, false)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, entry.Reader)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
 func (h *validatingHandler) Mkdir(s ssh.Session, entry *scp.DirEntry) error {
+	if dir, rel, ok := splitBundlePath(cleanPath(entry.Filepath)); ok {
+		pending := sessionBundles(s)
+		if pending == nil {
+			return errUploadName
+		}
+		dst, err := pending.prepare(dir, rel, true)
+		if err != nil {
+			pending.fail()
+			return err
+		}
+		return os.MkdirAll(dst, 0755)
+	}
+	
 	// Allow mkdir but namespace it to user directory
 	userEntry := &scp.DirEntry{
 		Name: filepath.Join(s.User(), entry.Name),
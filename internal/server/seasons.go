@@ -0,0 +1,390 @@
+package server
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"battleship-arena/internal/storage"
+)
+
+func HandleSeasons(w http.ResponseWriter, r *http.Request) {
+	arena := requestArena(w, r)
+	if arena == nil {
+		return
+	}
+
+	seasons, err := storage.GetSeasons()
+	if err != nil {
+		http.Error(w, "Error loading seasons", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.New("seasons").Parse(seasonsListHTML))
+	data := struct {
+		Arena   *storage.Arena
+		Prefix  string
+		Seasons []storage.Season
+	}{
+		Arena:   arena,
+		Prefix:  arenaPath(arena.Slug),
+		Seasons: seasons,
+	}
+	tmpl.Execute(w, data)
+}
+
+// seasonFromRequest loads the season named by the {id} URL parameter,
+// writing an error response and returning nil if it can't
+func seasonFromRequest(w http.ResponseWriter, r *http.Request) *storage.Season {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid season", http.StatusBadRequest)
+		return nil
+	}
+
+	season, err := storage.GetSeason(id)
+	if err != nil {
+		http.Error(w, "Error loading season", http.StatusInternalServerError)
+		return nil
+	}
+	if season == nil {
+		http.Error(w, "Season not found", http.StatusNotFound)
+		return nil
+	}
+	return season
+}
+
+func HandleSeasonPage(w http.ResponseWriter, r *http.Request) {
+	arena := requestArena(w, r)
+	if arena == nil {
+		return
+	}
+	season := seasonFromRequest(w, r)
+	if season == nil {
+		return
+	}
+
+	// The current season has no frozen standings yet; its leaderboard is live
+	if season.Status == "active" {
+		http.Redirect(w, r, arenaPath(arena.Slug)+"/", http.StatusSeeOther)
+		return
+	}
+
+	standings, err := storage.GetSeasonStandings(season.ID, arena.ID)
+	if err != nil {
+		http.Error(w, "Error loading standings", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl := template.Must(template.New("season").Funcs(template.FuncMap{
+		"medal": func(rank int) string {
+			medals := []string{"🥇", "🥈", "🥉"}
+			if rank >= 1 && rank <= len(medals) {
+				return medals[rank-1]
+			}
+			return ""
+		},
+	}).Parse(seasonPageHTML))
+	data := struct {
+		Arena     *storage.Arena
+		Prefix    string
+		Season    *storage.Season
+		Standings []storage.SeasonStanding
+	}{
+		Arena:     arena,
+		Prefix:    arenaPath(arena.Slug),
+		Season:    season,
+		Standings: standings,
+	}
+	tmpl.Execute(w, data)
+}
+
+func HandleAPISeasonStandings(w http.ResponseWriter, r *http.Request) {
+	arena := requestArena(w, r)
+	if arena == nil {
+		return
+	}
+	season := seasonFromRequest(w, r)
+	if season == nil {
+		return
+	}
+
+	standings, err := storage.GetSeasonStandings(season.ID, arena.ID)
+	if err != nil {
+		http.Error(w, "Error loading standings", http.StatusInternalServerError)
+		return
+	}
+	if standings == nil {
+		standings = []storage.SeasonStanding{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(standings)
+}
+
+const seasonsListHTML = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>Seasons - Battleship Arena</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <link rel="icon" href="data:image/svg+xml,<svg xmlns=%22http://www.w3.org/2000/svg%22 viewBox=%220 0 100 100%22><text y=%22.9em%22 font-size=%2290%22>⚓</text></svg>">
+    <style>
+        * {
+            margin: 0;
+            padding: 0;
+            box-sizing: border-box;
+        }
+
+        body {
+            font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif;
+            background: #0f172a;
+            color: #e2e8f0;
+            min-height: 100vh;
+            padding: 2rem 1rem;
+        }
+
+        .container {
+            max-width: 1200px;
+            margin: 0 auto;
+        }
+
+        h1 {
+            font-size: 2.5rem;
+            font-weight: 700;
+            margin-bottom: 0.5rem;
+            background: linear-gradient(135deg, #60a5fa 0%, #a78bfa 100%);
+            -webkit-background-clip: text;
+            -webkit-text-fill-color: transparent;
+        }
+
+        .back-link {
+            display: inline-block;
+            margin-bottom: 2rem;
+            color: #60a5fa;
+            text-decoration: none;
+            font-size: 0.9rem;
+        }
+
+        .back-link:hover {
+            text-decoration: underline;
+        }
+
+        .seasons-grid {
+            display: grid;
+            grid-template-columns: repeat(auto-fill, minmax(300px, 1fr));
+            gap: 1.5rem;
+        }
+
+        .season-card {
+            background: #1e293b;
+            border: 1px solid #334155;
+            border-radius: 12px;
+            padding: 1.5rem;
+            transition: transform 0.2s, border-color 0.2s;
+            text-decoration: none;
+            color: inherit;
+            display: block;
+        }
+
+        .season-card:hover {
+            transform: translateY(-2px);
+            border-color: #60a5fa;
+        }
+
+        .season-name {
+            font-size: 1.25rem;
+            font-weight: 600;
+            color: #e2e8f0;
+            margin-bottom: 0.25rem;
+        }
+
+        .season-dates {
+            font-size: 0.9rem;
+            color: #94a3b8;
+        }
+
+        .season-live {
+            color: #10b981;
+            font-size: 0.8rem;
+            font-weight: 600;
+            margin-left: 0.5rem;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <a href="{{.Prefix}}/" class="back-link">← Back to Leaderboard</a>
+        <h1>Seasons</h1>
+        <p style="color: #94a3b8; margin-bottom: 2rem;">{{.Arena.Name}} · final standings are frozen when a season closes</p>
+
+        <div class="seasons-grid">
+            {{range .Seasons}}
+            <a href="{{$.Prefix}}{{if eq .Status "active"}}/{{else}}/season/{{.ID}}{{end}}" class="season-card">
+                <div class="season-name">{{.Name}}{{if eq .Status "active"}}<span class="season-live">● LIVE</span>{{end}}</div>
+                <div class="season-dates">
+                    {{.StartedAt.Format "Jan 2, 2006"}} – {{if eq .Status "active"}}now{{else}}{{.EndedAt.Format "Jan 2, 2006"}}{{end}}
+                </div>
+            </a>
+            {{end}}
+        </div>
+    </div>
+</body>
+</html>
+`
+
+const seasonPageHTML = `
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <title>{{.Season.Name}} - Battleship Arena</title>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <link rel="icon" href="data:image/svg+xml,<svg xmlns=%22http://www.w3.org/2000/svg%22 viewBox=%220 0 100 100%22><text y=%22.9em%22 font-size=%2290%22>⚓</text></svg>">
+    <style>
+        * {
+            margin: 0;
+            padding: 0;
+            box-sizing: border-box;
+        }
+
+        body {
+            font-family: 'Inter', -apple-system, BlinkMacSystemFont, 'Segoe UI', sans-serif;
+            background: #0f172a;
+            color: #e2e8f0;
+            min-height: 100vh;
+            padding: 2rem 1rem;
+        }
+
+        .container {
+            max-width: 1200px;
+            margin: 0 auto;
+        }
+
+        h1 {
+            font-size: 2.5rem;
+            font-weight: 700;
+            margin-bottom: 0.5rem;
+            background: linear-gradient(135deg, #60a5fa 0%, #a78bfa 100%);
+            -webkit-background-clip: text;
+            -webkit-text-fill-color: transparent;
+        }
+
+        .back-link {
+            display: inline-block;
+            margin-bottom: 2rem;
+            color: #60a5fa;
+            text-decoration: none;
+            font-size: 0.9rem;
+        }
+
+        .back-link:hover {
+            text-decoration: underline;
+        }
+
+        .standings {
+            background: #1e293b;
+            border: 1px solid #334155;
+            border-radius: 12px;
+            padding: 1rem;
+            overflow-x: auto;
+        }
+
+        table {
+            width: 100%;
+            border-collapse: collapse;
+            font-size: 0.9rem;
+        }
+
+        th {
+            text-align: center;
+            padding: 0.75rem 0.5rem;
+            color: #94a3b8;
+            border-bottom: 1px solid #334155;
+        }
+
+        td {
+            text-align: center;
+            padding: 0.75rem 0.5rem;
+            border-bottom: 1px solid #334155;
+        }
+
+        th.player, td.player {
+            text-align: left;
+        }
+
+        td.player a {
+            color: #e2e8f0;
+            text-decoration: none;
+            font-weight: 600;
+        }
+
+        td.player a:hover {
+            color: #60a5fa;
+        }
+
+        .rd {
+            color: #94a3b8;
+            font-size: 0.8em;
+        }
+
+        .bot-badge {
+            font-size: 0.7rem;
+            color: #a78bfa;
+            border: 1px solid #a78bfa;
+            border-radius: 4px;
+            padding: 0 0.3rem;
+            margin-left: 0.4rem;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <a href="{{.Prefix}}/seasons" class="back-link">← All Seasons</a>
+        <h1>{{.Season.Name}}</h1>
+        <p style="color: #94a3b8; margin-bottom: 2rem;">
+            {{.Arena.Name}} · {{.Season.StartedAt.Format "Jan 2, 2006"}} – {{.Season.EndedAt.Format "Jan 2, 2006"}} · final standings
+        </p>
+
+        <div class="standings">
+            {{if .Standings}}
+            <table>
+                <thead>
+                    <tr>
+                        <th>Rank</th>
+                        <th class="player">Player</th>
+                        <th>Rating</th>
+                        <th>Wins</th>
+                        <th>Losses</th>
+                        <th>Win Rate</th>
+                        <th>Avg Moves</th>
+                        <th>Benchmark</th>
+                    </tr>
+                </thead>
+                <tbody>
+                    {{range .Standings}}
+                    <tr>
+                        <td>{{medal .Rank}} #{{.Rank}}</td>
+                        <td class="player"><a href="{{$.Prefix}}/user/{{.Username}}">{{.Username}}</a>{{if .IsBot}}<span class="bot-badge">BOT</span>{{end}}</td>
+                        <td>{{.Rating}} <span class="rd">±{{.RD}}</span></td>
+                        <td>{{.Wins}}</td>
+                        <td>{{.Losses}}</td>
+                        <td>{{printf "%.1f" .WinPct}}%</td>
+                        <td>{{printf "%.1f" .AvgMoves}}</td>
+                        <td>{{if .HasBenchmark}}{{printf "%.1f" .BenchmarkShots}}{{else}}-{{end}}</td>
+                    </tr>
+                    {{end}}
+                </tbody>
+            </table>
+            {{else}}
+            <p style="color: #94a3b8; text-align: center; padding: 2rem;">No ranked players this season</p>
+            {{end}}
+        </div>
+    </div>
+</body>
+</html>
+`
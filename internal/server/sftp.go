@@ -4,30 +4,47 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"log"
+	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
 	"github.com/pkg/sftp"
 	
+	"battleship-arena/internal/bundle"
 	"battleship-arena/internal/storage"
 )
 
 func SFTPHandler(uploadDir string) func(ssh.Session) {
 	return func(s ssh.Session) {
+		defer trackSession("sftp")()
+		
+		if err := setupSession(s.Context()); err != nil {
+			wish.Fatalln(s, err)
+			return
+		}
+		if err := requireAccount(s.Context()); err != nil {
+			wish.Fatalln(s, err)
+			return
+		}
+		
 		userDir := filepath.Join(uploadDir, s.User())
 		
 		if err := os.MkdirAll(userDir, 0755); err != nil {
-			log.Printf("Failed to create user directory: %v", err)
+			slog.Error("creating user directory failed", "user", s.User(), "err", err)
 			return
 		}
 		
 		handler := &sftpFileHandler{
-			baseDir:  userDir,
-			username: s.User(),
+			uploadDir: uploadDir,
+			files:     userFiles{uploadDir: uploadDir, username: s.User()},
+			bundles:   newPendingBundles(uploadDir, s.User(), adminActor(s.Context()), "sftp"),
+			username:  s.User(),
+			actor:     adminActor(s.Context()),
 		}
 		
 		server := sftp.NewRequestServer(s, sftp.Handlers{
@@ -39,39 +56,100 @@ func SFTPHandler(uploadDir string) func(ssh.Session) {
 		
 		if err := server.Serve(); err == io.EOF {
 			server.Close()
+			// Directories uploaded in the session are complete once the
+			// client has disconnected
+			handler.bundles.submit(s.Stderr())
 		} else if err != nil {
-			log.Printf("sftp server error: %v", err)
+			slog.Error("sftp server error", "user", s.User(), "err", err)
 			wish.Fatalln(s, err)
 		}
 	}
 }
 
 type sftpFileHandler struct {
-	baseDir  string
-	username string
+	uploadDir string
+	files     userFiles
+	bundles   *pendingBundles
+	username  string
+	actor     string // admin acting as username, if any
 }
 
-// Fileread for downloads (disabled)
+// Fileread serves downloads from the user's own directory and reports
 func (h *sftpFileHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
-	return nil, fmt.Errorf("downloads not supported")
+	if h.actor != "" {
+		if err := storage.Audit(h.actor, "download_as", h.username, fmt.Sprintf("%s via sftp", cleanPath(r.Filepath))); err != nil {
+			slog.Error("writing audit log failed", "err", err)
+			return nil, fmt.Errorf("download refused: audit log unavailable")
+		}
+	}
+	f, info, err := h.files.Open(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	slog.Debug("sftp download", "user", h.username, "path", cleanPath(r.Filepath), "bytes", info.Size())
+	return f, nil
+}
+
+// checkUpload applies the upload rules to a file arriving at a path and
+// returns the arena it is for
+func (h *sftpFileHandler) checkUpload(p string) (*storage.Arena, error) {
+	filename := filepath.Base(p)
+	
+	// Validate filename
+	if !isUploadName(filename) {
+		slog.Info("rejected upload with invalid filename", "user", h.username, "protocol", "sftp", "file", filename)
+		return nil, errUploadName
+	}
+	
+	if err := checkUploadsOpen(); err != nil {
+		return nil, err
+	}
+	
+	if season, err := storage.GetCurrentSeason(); err == nil && season == nil {
+		return nil, fmt.Errorf("submissions are closed between seasons")
+	}
+	
+	// Uploads into a subdirectory go to the arena of that name
+	arena, err := uploadArena(h.username, filepath.Dir(p))
+	if err != nil {
+		slog.Info("rejected upload", "user", h.username, "protocol", "sftp", "path", p, "err", err)
+		return nil, err
+	}
+	
+	if h.actor != "" {
+		if err := storage.Audit(h.actor, "upload_as", h.username, fmt.Sprintf("%s to arena %s via sftp", filename, arena.Slug)); err != nil {
+			slog.Error("writing audit log failed", "err", err)
+			return nil, fmt.Errorf("upload refused: audit log unavailable")
+		}
+	}
+	return arena, nil
 }
 
 // Filewrite for uploads
 func (h *sftpFileHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	// Files of a memory_functions_* directory are submitted together when
+	// the session ends
+	if dir, rel, ok := splitBundlePath(cleanPath(r.Filepath)); ok {
+		return h.writeBundleFile(dir, rel)
+	}
+	
 	filename := filepath.Base(r.Filepath)
+	arena, err := h.checkUpload(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
 	
-	// Validate filename
-	if !strings.HasPrefix(filename, "memory_functions_") || !strings.HasSuffix(filename, ".cpp") {
-		log.Printf("Invalid filename from %s: %s", h.username, filename)
-		return nil, fmt.Errorf("only memory_functions_*.cpp files are accepted")
+	arenaDir := arena.UserDir(h.uploadDir, h.username)
+	if err := os.MkdirAll(arenaDir, 0755); err != nil {
+		return nil, err
 	}
 	
-	dstPath := filepath.Join(h.baseDir, filename)
-	log.Printf("SFTP: Creating file %s for user %s", dstPath, h.username)
+	dstPath := filepath.Join(arenaDir, filename)
+	slog.Debug("creating upload", "user", h.username, "protocol", "sftp", "path", dstPath)
 	
 	// Remove old file if it exists to ensure clean overwrite
 	if _, err := os.Stat(dstPath); err == nil {
-		log.Printf("SFTP: Removing old file: %s", dstPath)
+		slog.Debug("removing old file", "path", dstPath)
 		os.Remove(dstPath)
 	}
 	
@@ -89,47 +167,161 @@ func (h *sftpFileHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
 	
 	file, err := os.OpenFile(dstPath, osFlags, 0644)
 	if err != nil {
-		log.Printf("Failed to create file: %v", err)
+		slog.Error("creating upload failed", "user", h.username, "path", dstPath, "err", err)
 		return nil, err
 	}
 	
 	return &fileWriterAt{
-		file:     file,
-		filename: filename,
-		username: h.username,
+		file:      file,
+		filename:  filename,
+		username:  h.username,
+		arena:     arena,
+		uploadDir: h.uploadDir,
 	}, nil
 }
 
-// Filecmd handles file operations
+// writeBundleFile opens one file of a directory upload for writing
+func (h *sftpFileHandler) writeBundleFile(dir, rel string) (io.WriterAt, error) {
+	dst, err := h.bundles.prepare(dir, rel, false)
+	if err != nil {
+		slog.Info("rejected directory upload", "user", h.username, "protocol", "sftp", "dir", dir, "err", err)
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(dst)
+	if err != nil {
+		return nil, clientError(path.Join(dir, rel), err)
+	}
+	return bundleFileWriter{file}, nil
+}
+
+// Filecmd carries out changes to the user's view. Renaming a file to an
+// upload name submits it, removing a queued submission's directory cancels
+// it, and files and arena directories can be tidied up; everything generated
+// is otherwise read-only.
 func (h *sftpFileHandler) Filecmd(r *sftp.Request) error {
+	name := cleanPath(r.Filepath)
 	switch r.Method {
-	case "Setstat", "Rename", "Remove", "Mkdir", "Rmdir":
-		// Allow these operations within user directory
+	case "Setstat":
+		// Clients set times and modes after uploading, which don't matter here
 		return nil
+	case "Rename":
+		return h.rename(name, cleanPath(r.Target))
+	case "Rmdir":
+		if dir, id := path.Split(name); dir == submissionsDir+"/" {
+			return h.cancel(id)
+		}
+		if name == "" || isGenerated(name) {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		// Only empty directories go
+		return clientError(name, syscall.Rmdir(h.files.realPath(name)))
+	case "Remove":
+		if name == "" || isGenerated(name) {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		return clientError(name, syscall.Unlink(h.files.realPath(name)))
+	case "Mkdir":
+		if dir, rel, ok := splitBundlePath(name); ok {
+			dst, err := h.bundles.prepare(dir, rel, true)
+			if err != nil {
+				return err
+			}
+			return os.MkdirAll(dst, 0755)
+		}
+		// Other directories are for uploading to other arenas
+		if name == "" || isGenerated(name) || strings.Contains(name, "/") {
+			return sftp.ErrSSHFxPermissionDenied
+		}
+		arena, err := uploadArena(h.username, name)
+		if err != nil {
+			return err
+		}
+		if arena.IsDefault() {
+			return fmt.Errorf("uploads to %s go in the top directory", arena.Slug)
+		}
+		return clientError(name, os.Mkdir(h.files.realPath(name), 0755))
 	default:
 		return sftp.ErrSSHFxOpUnsupported
 	}
 }
 
+// rename moves a file in the upload directory. Its new name must be one an
+// upload could have, and it is submitted like one, so "rename x.cpp
+// arena/x.cpp" enters the file in another arena.
+func (h *sftpFileHandler) rename(from, to string) error {
+	if from == "" || to == "" || isGenerated(from) || isGenerated(to) {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	// Directory uploads are submitted as a whole, so their files stay put
+	if _, _, ok := splitBundlePath(from); ok {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	if _, _, ok := splitBundlePath(to); ok {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	info, err := os.Stat(h.files.realPath(from))
+	if err != nil {
+		return clientError(from, err)
+	}
+	if info.IsDir() {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	arena, err := h.checkUpload(to)
+	if err != nil {
+		return err
+	}
+
+	filename := path.Base(to)
+	arenaDir := arena.UserDir(h.uploadDir, h.username)
+	if err := os.MkdirAll(arenaDir, 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(h.files.realPath(from), filepath.Join(arenaDir, filename)); err != nil {
+		return clientError(from, err)
+	}
+	submissionID, err := submitUpload(h.uploadDir, arena, h.username, filename)
+	if err != nil {
+		slog.Error("adding submission failed", "user", h.username, "file", filename, "err", err)
+		return err
+	}
+	slog.Info("renamed into place, queued for testing", "submission_id", submissionID, "user", h.username, "protocol", "sftp", "from", from, "file", filename)
+	uploadsTotal.Inc("sftp")
+	return nil
+}
+
+// cancel takes one of the user's queued submissions out of testing
+func (h *sftpFileHandler) cancel(id string) error {
+	sub, err := h.files.submission(id)
+	if err != nil {
+		return err
+	}
+	if h.actor != "" {
+		if err := storage.Audit(h.actor, "cancel_as", h.username, fmt.Sprintf("submission %d (%s) via sftp", sub.ID, sub.Filename)); err != nil {
+			slog.Error("writing audit log failed", "err", err)
+			return fmt.Errorf("cancel refused: audit log unavailable")
+		}
+	}
+	if err := storage.CancelSubmission(sub.ID); err != nil {
+		return err
+	}
+	slog.Info("submission cancelled", "submission_id", sub.ID, "user", h.username, "protocol", "sftp")
+	return nil
+}
+
 // Filelist for directory listings
 func (h *sftpFileHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
 	switch r.Method {
 	case "List":
-		entries, err := os.ReadDir(h.baseDir)
+		infos, err := h.files.ReadDir(r.Filepath)
 		if err != nil {
 			return nil, err
 		}
-		infos := make([]fs.FileInfo, 0, len(entries))
-		for _, entry := range entries {
-			info, err := entry.Info()
-			if err != nil {
-				continue
-			}
-			infos = append(infos, info)
-		}
 		return listerAt(infos), nil
-	case "Stat":
-		info, err := os.Stat(filepath.Join(h.baseDir, r.Filepath))
+	case "Stat", "Lstat":
+		info, err := h.files.Stat(r.Filepath)
 		if err != nil {
 			return nil, err
 		}
@@ -153,9 +345,11 @@ func (l listerAt) ListAt(ls []fs.FileInfo, offset int64) (int, error) {
 }
 
 type fileWriterAt struct {
-	file     *os.File
-	filename string
-	username string
+	file      *os.File
+	filename  string
+	username  string
+	arena     *storage.Arena
+	uploadDir string
 }
 
 func (f *fileWriterAt) WriteAt(p []byte, off int64) (int, error) {
@@ -163,18 +357,35 @@ func (f *fileWriterAt) WriteAt(p []byte, off int64) (int, error) {
 }
 
 func (f *fileWriterAt) Close() error {
-	err := f.file.Close()
-	if err == nil {
-		log.Printf("SFTP: Uploaded %s from %s", f.filename, f.username)
-		
-		// Add submission and trigger testing
-		submissionID, err := storage.AddSubmission(f.username, f.filename)
-		if err != nil {
-			log.Printf("Failed to add submission: %v", err)
-		} else {
-			log.Printf("Queued submission %d for testing", submissionID)
-			// The worker will pick it up automatically
-		}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	// Add submission and trigger testing
+	submissionID, err := submitUpload(f.uploadDir, f.arena, f.username, f.filename)
+	if err != nil && bundle.IsArchive(f.filename) {
+		// An archive that can't be read is the uploader's to fix
+		slog.Info("rejected upload", "user", f.username, "protocol", "sftp", "file", f.filename, "err", err)
+		return err
+	}
+	if err != nil {
+		slog.Error("adding submission failed", "user", f.username, "file", f.filename, "err", err)
+		return nil
+	}
+	// Queuing the compile job wakes the worker
+	slog.Info("uploaded, queued for testing", "submission_id", submissionID, "user", f.username, "protocol", "sftp", "file", f.filename)
+	uploadsTotal.Inc("sftp")
+	return nil
+}
+
+// bundleFileWriter writes one file of a directory upload, within the size
+// limit on the whole directory
+type bundleFileWriter struct {
+	*os.File
+}
+
+func (w bundleFileWriter) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > uploadLimits.MaxBytes {
+		return 0, fmt.Errorf("larger than %d bytes", uploadLimits.MaxBytes)
 	}
-	return err
+	return w.File.WriteAt(p, off)
 }
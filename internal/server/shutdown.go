@@ -0,0 +1,27 @@
+package server
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+var uploadsStopped atomic.Bool
+
+// StopUploads refuses new SCP and SFTP uploads while the server shuts down,
+// so nothing arrives after the worker has stopped taking jobs
+func StopUploads() {
+	uploadsStopped.Store(true)
+}
+
+func checkUploadsOpen() error {
+	if uploadsStopped.Load() {
+		return fmt.Errorf("the server is restarting; try again in a minute")
+	}
+	return nil
+}
+
+// CloseSSE ends every open event stream. The dispatcher keeps running so
+// handlers still unwinding can unregister without panicking.
+func CloseSSE() {
+	SSEServer.Restart()
+}
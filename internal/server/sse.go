@@ -3,7 +3,7 @@ package server
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/alexandrevicenzi/go-sse"
@@ -30,19 +30,28 @@ func InitSSE() {
 }
 
 func NotifyLeaderboardUpdate() {
-	entries, err := storage.GetLeaderboard(50)
+	arenas, err := storage.GetArenas()
 	if err != nil {
-		log.Printf("SSE: failed to get leaderboard: %v", err)
+		slog.Error("sse: loading arenas failed", "err", err)
 		return
 	}
 
-	data, err := json.Marshal(entries)
-	if err != nil {
-		log.Printf("SSE: failed to marshal leaderboard: %v", err)
-		return
-	}
+	// Each arena's page listens on its own channel
+	for _, arena := range arenas {
+		entries, err := storage.QueryLeaderboard(storage.LeaderboardQuery{ArenaID: arena.ID, Limit: 50, SortBy: storage.SortByRating})
+		if err != nil {
+			slog.Error("sse: loading leaderboard failed", "arena", arena.Slug, "err", err)
+			continue
+		}
 
-	SSEServer.SendMessage("/events/updates", sse.SimpleMessage(string(data)))
+		data, err := json.Marshal(entries)
+		if err != nil {
+			slog.Error("sse: encoding leaderboard failed", "err", err)
+			continue
+		}
+
+		SSEServer.SendMessage(arenaChannel(arena.Slug), sse.SimpleMessage(string(data)))
+	}
 }
 
 func BroadcastProgress(player string, currentMatch, totalMatches int, startTime time.Time, queuedPlayers []string) {
@@ -73,16 +82,16 @@ func BroadcastProgress(player string, currentMatch, totalMatches int, startTime
 	
 	data, err := json.Marshal(progress)
 	if err != nil {
-		log.Printf("Failed to marshal progress: %v", err)
+		slog.Error("sse: encoding progress failed", "err", err)
 		return
 	}
 	
 	// Only log every 10th match to reduce noise
 	if currentMatch%10 == 0 || currentMatch == totalMatches {
-		log.Printf("Progress: %s [%d/%d] %.0f%%", player, currentMatch, totalMatches, percentComplete)
+		slog.Debug("round-robin progress", "user", player, "match", currentMatch, "total", totalMatches)
 	}
 	
-	SSEServer.SendMessage("/events/updates", sse.SimpleMessage(string(data)))
+	sendToAllArenas(data)
 }
 
 func formatDuration(d time.Duration) string {
@@ -112,5 +121,18 @@ func BroadcastProgressComplete() {
 	}
 	
 	// Silent - no log needed for routine completion
-	SSEServer.SendMessage("/events/updates", sse.SimpleMessage(string(data)))
+	sendToAllArenas(data)
+}
+
+// sendToAllArenas pushes a message to every arena's page; the worker queue is
+// shared, so progress is shown everywhere
+func sendToAllArenas(data []byte) {
+	arenas, err := storage.GetArenas()
+	if err != nil {
+		slog.Error("sse: loading arenas failed", "err", err)
+		return
+	}
+	for _, arena := range arenas {
+		SSEServer.SendMessage(arenaChannel(arena.Slug), sse.SimpleMessage(string(data)))
+	}
 }
@@ -0,0 +1,611 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"battleship-arena/internal/storage"
+)
+
+// Generated entries at the top of every user's view. Arenas can't be named
+// after them, so they never hide an upload directory.
+const (
+	reportsDir      = "reports"
+	submissionsDir  = "submissions"
+	matchesDir      = "matches"
+	leaderboardFile = "leaderboard.csv"
+)
+
+// Files in each submissions/<id>/ directory, beside the source
+const (
+	compileLogFile = "compile.log"
+	reportFile     = "report.json"
+)
+
+// sourceFile names a submission's source after its entrypoint, so C and
+// Python uploads keep their extension: source.cpp, source.c or source.py
+func sourceFile(sub storage.Submission) string {
+	return "source" + filepath.Ext(sub.Filename)
+}
+
+// userFiles is what a user sees over SCP and SFTP: everything in their own
+// upload directory, and generated from the database
+//
+//	reports/latest.json, compile.log   their latest submission
+//	reports/<id>.json                  any of their submissions
+//	submissions/<id>/                  source.<ext>, compile.log, report.json
+//	matches/<id>.json                  every match their submissions played
+//	leaderboard.csv                    the main arena's standings
+type userFiles struct {
+	uploadDir string
+	username  string
+}
+
+// download is an open file in a user's view
+type download interface {
+	io.Reader
+	io.ReaderAt
+	io.Closer
+}
+
+func (u userFiles) root() string {
+	return filepath.Join(u.uploadDir, u.username)
+}
+
+// realPath is where a path outside the generated entries is on disk
+func (u userFiles) realPath(name string) string {
+	return filepath.Join(u.root(), filepath.FromSlash(name))
+}
+
+// hasOwnDir reports whether the username names a directory of its own, and
+// not the upload directory, its parent or the kept sources
+func (u userFiles) hasOwnDir() bool {
+	return u.username != "" && !strings.HasPrefix(u.username, ".") && !strings.ContainsAny(u.username, `/\`)
+}
+
+// cleanPath turns a client's path into one relative to the user's view,
+// with "" for the top. Nothing can climb out of it with "..".
+func cleanPath(name string) string {
+	name = strings.TrimPrefix(filepath.ToSlash(name), "~")
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// isGenerated reports whether a cleaned path is under one of the generated
+// entries rather than in the upload directory
+func isGenerated(name string) bool {
+	top, _, _ := strings.Cut(name, "/")
+	return top == reportsDir || top == submissionsDir || top == matchesDir || top == leaderboardFile
+}
+
+// generated is a file or directory made up from the database
+type generated struct {
+	name    string
+	dir     bool
+	content []byte
+}
+
+func (g generated) info() fs.FileInfo {
+	return virtualInfo{name: g.name, size: int64(len(g.content)), dir: g.dir}
+}
+
+// generate looks up a generated path, which must be one isGenerated accepts
+func (u userFiles) generate(name string) (generated, error) {
+	parts := strings.Split(name, "/")
+	base := parts[len(parts)-1]
+	dir := generated{name: base, dir: true}
+
+	switch parts[0] {
+	case leaderboardFile:
+		if len(parts) == 1 {
+			content, err := leaderboardCSV()
+			return generated{name: base, content: content}, err
+		}
+
+	case reportsDir:
+		switch len(parts) {
+		case 1:
+			return dir, nil
+		case 2:
+			content, err := u.report(base)
+			return generated{name: base, content: content}, err
+		}
+
+	case submissionsDir:
+		if len(parts) == 1 {
+			return dir, nil
+		}
+		sub, err := u.submission(parts[1])
+		if err != nil {
+			return generated{}, err
+		}
+		switch len(parts) {
+		case 2:
+			return dir, nil
+		case 3:
+			content, err := u.submissionFile(sub, base)
+			return generated{name: base, content: content}, err
+		}
+
+	case matchesDir:
+		switch len(parts) {
+		case 1:
+			return dir, nil
+		case 2:
+			content, err := u.matchFile(base)
+			return generated{name: base, content: content}, err
+		}
+	}
+	return generated{}, fs.ErrNotExist
+}
+
+func (u userFiles) Stat(name string) (fs.FileInfo, error) {
+	if !u.hasOwnDir() {
+		return nil, fs.ErrPermission
+	}
+	name = cleanPath(name)
+	switch {
+	case name == "":
+		if info, err := os.Stat(u.root()); err == nil {
+			return info, nil
+		}
+		return virtualInfo{name: u.username, dir: true}, nil
+	case isGenerated(name):
+		g, err := u.generate(name)
+		if err != nil {
+			return nil, err
+		}
+		return g.info(), nil
+	}
+	info, err := os.Stat(u.realPath(name))
+	return info, clientError(name, err)
+}
+
+func (u userFiles) ReadDir(name string) ([]fs.FileInfo, error) {
+	if !u.hasOwnDir() {
+		return nil, fs.ErrPermission
+	}
+	name = cleanPath(name)
+	if isGenerated(name) {
+		return u.readGeneratedDir(name)
+	}
+
+	entries, err := os.ReadDir(u.realPath(name))
+	if err != nil && !(name == "" && errors.Is(err, fs.ErrNotExist)) {
+		return nil, clientError(name, err)
+	}
+	var infos []fs.FileInfo
+	if name == "" {
+		for _, top := range []string{reportsDir, submissionsDir, matchesDir, leaderboardFile} {
+			g, err := u.generate(top)
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, g.info())
+		}
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || (name == "" && isGenerated(entry.Name())) {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// readGeneratedDir lists a generated directory, generating each file in it
+// for its size
+func (u userFiles) readGeneratedDir(name string) ([]fs.FileInfo, error) {
+	g, err := u.generate(name)
+	if err != nil {
+		return nil, err
+	}
+	if !g.dir {
+		return nil, fmt.Errorf("%s is not a directory", name)
+	}
+
+	var names []string
+	parts := strings.Split(name, "/")
+	switch {
+	case name == reportsDir:
+		subs, err := storage.GetUserSubmissions(u.username)
+		if err != nil {
+			return nil, err
+		}
+		if len(subs) > 0 {
+			names = append(names, "latest.json", compileLogFile)
+		}
+		// Only recent submissions are listed; older ones open by ID
+		for _, sub := range subs {
+			names = append(names, fmt.Sprintf("%d.json", sub.ID))
+		}
+
+	case name == submissionsDir:
+		subs, err := userSubmissions(u.username)
+		if err != nil {
+			return nil, err
+		}
+		for _, sub := range subs {
+			names = append(names, strconv.Itoa(sub.ID))
+		}
+
+	case parts[0] == submissionsDir:
+		sub, err := u.submission(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		names = []string{sourceFile(sub), compileLogFile, reportFile}
+
+	case name == matchesDir:
+		ids, err := u.matchIDs()
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			names = append(names, fmt.Sprintf("%d.json", id))
+		}
+	}
+
+	infos := []fs.FileInfo{}
+	for _, child := range names {
+		g, err := u.generate(path.Join(name, child))
+		if errors.Is(err, fs.ErrNotExist) {
+			// e.g. the source of a submission from before versions were kept
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, g.info())
+	}
+	return infos, nil
+}
+
+func (u userFiles) Open(name string) (download, fs.FileInfo, error) {
+	if !u.hasOwnDir() {
+		return nil, nil, fs.ErrPermission
+	}
+	name = cleanPath(name)
+	if isGenerated(name) {
+		g, err := u.generate(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if g.dir {
+			return nil, nil, fmt.Errorf("%s is a directory", name)
+		}
+		return memFile{bytes.NewReader(g.content)}, g.info(), nil
+	}
+	if name == "" {
+		return nil, nil, fmt.Errorf("%s is a directory", name)
+	}
+
+	f, err := os.Open(u.realPath(name))
+	if err != nil {
+		return nil, nil, clientError(name, err)
+	}
+	info, err := f.Stat()
+	if err == nil && info.IsDir() {
+		err = fmt.Errorf("%s is a directory", name)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+// clientError puts the path the client asked for in place of where it is on
+// the server
+func clientError(name string, err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return &fs.PathError{Op: pathErr.Op, Path: name, Err: pathErr.Err}
+	}
+	return err
+}
+
+// userSubmissions returns every submission a user has made, arena by arena
+// and newest first within each
+func userSubmissions(username string) ([]storage.SubmissionWithStats, error) {
+	arenas, err := storage.GetArenas()
+	if err != nil {
+		return nil, err
+	}
+	var all []storage.SubmissionWithStats
+	for _, arena := range arenas {
+		subs, err := storage.GetUserSubmissionsWithStats(arena.ID, username, -1)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, subs...)
+	}
+	return all, nil
+}
+
+// submission looks up one of the user's submissions by ID
+func (u userFiles) submission(id string) (storage.Submission, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return storage.Submission{}, fs.ErrNotExist
+	}
+	sub, err := storage.GetSubmissionByID(n)
+	if err != nil || sub.Username != u.username {
+		return storage.Submission{}, fs.ErrNotExist
+	}
+	return sub, nil
+}
+
+func (u userFiles) submissionFile(sub storage.Submission, name string) ([]byte, error) {
+	switch name {
+	case sourceFile(sub):
+		content, err := storage.ReadSource(u.uploadDir, sub)
+		if err != nil {
+			return nil, fs.ErrNotExist
+		}
+		return content, nil
+	case compileLogFile:
+		output, err := storage.GetCompileLog(sub.ID)
+		return []byte(output), err
+	case reportFile:
+		return submissionReportJSON(sub)
+	}
+	return nil, fs.ErrNotExist
+}
+
+// report generates one of the files under reports/
+func (u userFiles) report(name string) ([]byte, error) {
+	if name == "latest.json" || name == compileLogFile {
+		subs, err := storage.GetUserSubmissions(u.username)
+		if err != nil {
+			return nil, err
+		}
+		if len(subs) == 0 {
+			return nil, fs.ErrNotExist
+		}
+		if name == compileLogFile {
+			return u.submissionFile(subs[0], compileLogFile)
+		}
+		return submissionReportJSON(subs[0])
+	}
+
+	id, ok := strings.CutSuffix(name, ".json")
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	sub, err := u.submission(id)
+	if err != nil {
+		return nil, err
+	}
+	return submissionReportJSON(sub)
+}
+
+// matchIDs lists the matches the user's submissions played, oldest first
+func (u userFiles) matchIDs() ([]int, error) {
+	subs, err := userSubmissions(u.username)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for i := len(subs) - 1; i >= 0; i-- {
+		matches, err := storage.GetSubmissionMatches(subs[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids, nil
+}
+
+type matchJSON struct {
+	apiMatch
+	Valid   bool              `json:"valid"`
+	URL     string            `json:"url"`
+	Details *matchDetailsJSON `json:"details"`
+}
+
+type matchDetailsJSON struct {
+	Games          int                 `json:"games"`
+	Ties           int                 `json:"ties"`
+	Seed           int64               `json:"seed"`
+	EngineVersion  string              `json:"engine_version"`
+	RuntimeMS      int64               `json:"runtime_ms"`
+	MoveCounts     []storage.MoveCount `json:"move_counts"`
+	Player1Invalid int                 `json:"player1_invalid_moves"`
+	Player2Invalid int                 `json:"player2_invalid_moves"`
+}
+
+// matchFile generates matches/<id>.json for a match one of the user's
+// submissions played
+func (u userFiles) matchFile(name string) ([]byte, error) {
+	id, ok := strings.CutSuffix(name, ".json")
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fs.ErrNotExist
+	}
+	m, err := storage.GetMatch(n)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil || (m.Player1 != u.username && m.Player2 != u.username) {
+		return nil, fs.ErrNotExist
+	}
+
+	file := matchJSON{
+		apiMatch: toAPIMatch(*m),
+		Valid:    m.Valid,
+		URL:      fmt.Sprintf("%s/match/%d", strings.TrimSuffix(externalURL, "/"), m.ID),
+	}
+	details, err := storage.GetMatchDetails(m.ID)
+	if err != nil {
+		return nil, err
+	}
+	if details != nil {
+		file.Details = &matchDetailsJSON{
+			Games:          details.Games,
+			Ties:           details.Ties,
+			Seed:           details.Seed,
+			EngineVersion:  details.EngineVersion,
+			RuntimeMS:      details.Runtime.Milliseconds(),
+			MoveCounts:     details.MoveCounts,
+			Player1Invalid: details.Player1Invalid,
+			Player2Invalid: details.Player2Invalid,
+		}
+	}
+	return marshalFile(file)
+}
+
+// leaderboardCSV is the main arena's leaderboard, as on the web
+func leaderboardCSV() ([]byte, error) {
+	entries, err := storage.QueryLeaderboard(storage.LeaderboardQuery{Limit: -1, SortBy: storage.SortByRating})
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write([]string{"rank", "username", "rating", "rd", "wins", "losses", "win_pct", "avg_moves", "benchmark_shots", "last_played", "bot"})
+	for i, e := range entries {
+		shots, lastPlayed := "", ""
+		if e.HasBenchmark {
+			shots = strconv.FormatFloat(e.BenchmarkShots, 'f', 2, 64)
+		}
+		if !e.LastPlayed.IsZero() {
+			lastPlayed = e.LastPlayed.UTC().Format(time.RFC3339)
+		}
+		w.Write([]string{
+			strconv.Itoa(i + 1),
+			e.Username,
+			strconv.Itoa(e.Rating),
+			strconv.Itoa(e.RD),
+			strconv.Itoa(e.Wins),
+			strconv.Itoa(e.Losses),
+			strconv.FormatFloat(e.WinPct, 'f', 1, 64),
+			strconv.FormatFloat(e.AvgMoves, 'f', 1, 64),
+			shots,
+			lastPlayed,
+			strconv.FormatBool(e.IsBot),
+		})
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+type submissionReport struct {
+	Submission apiSubmission   `json:"submission"`
+	CompileLog string          `json:"compile_log"`
+	Log        []reportLogLine `json:"log"`
+	Matches    []reportMatch   `json:"matches"`
+}
+
+type reportLogLine struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"`
+	Line  string    `json:"line"`
+}
+
+type reportMatch struct {
+	ID       int       `json:"id"`
+	Opponent string    `json:"opponent"`
+	Wins     int       `json:"wins"`
+	Losses   int       `json:"losses"`
+	AvgMoves int       `json:"avg_moves"`
+	Valid    bool      `json:"valid"`
+	PlayedAt time.Time `json:"played_at"`
+	URL      string    `json:"url"`
+}
+
+// submissionReportJSON collects what happened to a submission: its stats,
+// the compile output, its log and every match it played
+func submissionReportJSON(sub storage.Submission) ([]byte, error) {
+	report := submissionReport{
+		Submission: toAPISubmission(sub),
+		Log:        []reportLogLine{},
+		Matches:    []reportMatch{},
+	}
+	subs, err := storage.GetUserSubmissionsWithStats(sub.ArenaID, sub.Username, -1)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range subs {
+		if s.ID == sub.ID {
+			report.Submission = toAPISubmissionWithStats(s)
+		}
+	}
+
+	if report.CompileLog, err = storage.GetCompileLog(sub.ID); err != nil {
+		return nil, err
+	}
+	lines, err := storage.GetSubmissionLog(sub.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		report.Log = append(report.Log, reportLogLine{l.LoggedAt, l.Level, l.Line})
+	}
+	matches, err := storage.GetSubmissionMatches(sub.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matches {
+		report.Matches = append(report.Matches, reportMatch{
+			ID:       m.ID,
+			Opponent: m.Opponent,
+			Wins:     m.Wins,
+			Losses:   m.Losses,
+			AvgMoves: m.AvgMoves,
+			Valid:    m.IsValid,
+			PlayedAt: m.Timestamp,
+			URL:      fmt.Sprintf("%s/match/%d", strings.TrimSuffix(externalURL, "/"), m.ID),
+		})
+	}
+	return marshalFile(report)
+}
+
+func marshalFile(v interface{}) ([]byte, error) {
+	content, err := json.MarshalIndent(v, "", "  ")
+	return append(content, '\n'), err
+}
+
+// memFile is a generated file being downloaded
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error { return nil }
+
+// virtualInfo describes a generated file or directory
+type virtualInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (v virtualInfo) Name() string       { return v.name }
+func (v virtualInfo) Size() int64        { return v.size }
+func (v virtualInfo) ModTime() time.Time { return time.Now() }
+func (v virtualInfo) IsDir() bool        { return v.dir }
+func (v virtualInfo) Sys() interface{}   { return nil }
+
+func (v virtualInfo) Mode() fs.FileMode {
+	if v.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
@@ -3,9 +3,10 @@ package server
 import (
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 	
 	"github.com/go-chi/chi/v5"
 	gossh "golang.org/x/crypto/ssh"
@@ -13,6 +14,20 @@ import (
 	"battleship-arena/internal/storage"
 )
 
+// recentMatches is how many matches a profile lists
+const recentMatches = 20
+
+// profileMatch is a match seen from the profile owner's side
+type profileMatch struct {
+	ID        int
+	Opponent  string
+	Wins      int
+	Losses    int
+	Won       bool
+	AvgMoves  int
+	Timestamp time.Time
+}
+
 func HandleUserProfile(w http.ResponseWriter, r *http.Request) {
 	username := chi.URLParam(r, "username")
 	if username == "" {
@@ -30,8 +45,13 @@ func HandleUserProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	arena := requestArena(w, r)
+	if arena == nil {
+		return
+	}
+	
 	// Get user's submission stats
-	entries, _ := storage.GetLeaderboard(100)
+	entries, _ := storage.QueryLeaderboard(storage.LeaderboardQuery{ArenaID: arena.ID, Limit: 100, SortBy: storage.SortByRating})
 	var userEntry *storage.LeaderboardEntry
 	for _, e := range entries {
 		if e.Username == username {
@@ -41,30 +61,71 @@ func HandleUserProfile(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Get user's submissions with stats
-	submissions, err := storage.GetUserSubmissionsWithStats(username)
+	submissions, err := storage.GetUserSubmissionsWithStats(arena.ID, username, 10)
 	if err != nil {
-		log.Printf("Error getting submissions for %s: %v", username, err)
+		slog.Error("loading submissions failed", "user", username, "err", err)
 		submissions = []storage.SubmissionWithStats{}
 	}
 	if submissions == nil {
 		submissions = []storage.SubmissionWithStats{}
 	}
-	log.Printf("Found %d submissions for %s", len(submissions), username)
 	
-	// Parse public key for display
-	publicKeyDisplay := formatPublicKey(user.PublicKey)
+	played, _, err := storage.QueryMatches(storage.MatchQuery{ArenaID: arena.ID, Player: username, Limit: recentMatches})
+	if err != nil {
+		slog.Error("loading matches failed", "user", username, "err", err)
+	}
+	var matches []profileMatch
+	for _, m := range played {
+		pm := profileMatch{ID: m.ID, Opponent: m.Player2, Wins: m.Player1Wins, Losses: m.Player2Wins, AvgMoves: m.Player1Moves, Timestamp: m.Timestamp}
+		if m.Player2 == username {
+			pm.Opponent, pm.Wins, pm.Losses, pm.AvgMoves = m.Player1, m.Player2Wins, m.Player1Wins, m.Player2Moves
+		}
+		pm.Won = m.Winner == username
+		matches = append(matches, pm)
+	}
+	
+	seasonHistory, err := storage.GetUserSeasonHistory(username)
+	if err != nil {
+		slog.Error("loading season history failed", "user", username, "err", err)
+	}
 	
-	tmpl := template.Must(template.New("user").Parse(userProfileHTML))
+	// Fingerprints of every registered key; accounts created by an admin
+	// may have none, so fall back to whatever the account was created with
+	var keyDisplays []string
+	keys, err := storage.GetUserKeys(username)
+	if err != nil {
+		slog.Error("loading keys failed", "user", username, "err", err)
+	}
+	for _, k := range keys {
+		keyDisplays = append(keyDisplays, formatPublicKey(k.PublicKey))
+	}
+	if len(keyDisplays) == 0 {
+		keyDisplays = []string{formatPublicKey(user.PublicKey)}
+	}
+	
+	tmpl := template.Must(template.New("user").Funcs(template.FuncMap{
+		"arenaPath": arenaPath,
+	}).Parse(userProfileHTML))
 	data := struct {
+		Arena            *storage.Arena
+		Prefix           string
 		User             *storage.User
 		Entry            *storage.LeaderboardEntry
 		Submissions      []storage.SubmissionWithStats
-		PublicKeyDisplay string
+		Matches          []profileMatch
+		SeasonHistory    []storage.SeasonStanding
+		KeyDisplays      []string
+		IsBot            bool
 	}{
+		Arena:            arena,
+		Prefix:           arenaPath(arena.Slug),
 		User:             user,
 		Entry:            userEntry,
 		Submissions:      submissions,
-		PublicKeyDisplay: publicKeyDisplay,
+		Matches:          matches,
+		SeasonHistory:    seasonHistory,
+		KeyDisplays:      keyDisplays,
+		IsBot:            storage.IsReferenceBot(username),
 	}
 	tmpl.Execute(w, data)
 }
@@ -223,6 +284,10 @@ const userProfileHTML = `
             word-break: break-all;
         }
         
+        .key-display + .key-display {
+            margin-top: 0.5rem;
+        }
+        
         .metadata {
             display: grid;
             grid-template-columns: repeat(2, 1fr);
@@ -235,11 +300,11 @@ const userProfileHTML = `
 </head>
 <body>
     <div class="container">
-        <a href="/" class="back-link">← Back to Leaderboard</a>
+        <a href="{{.Prefix}}/" class="back-link">← Back to {{.Arena.Name}}</a>
         
         <div class="profile-header">
             <div class="username">{{.User.Name}}</div>
-            <div class="handle">@{{.User.Username}}</div>
+            <div class="handle">@{{.User.Username}}{{if .IsBot}} <span style="font-size: 0.75em; color: #a78bfa;">🤖 reference bot</span>{{end}}</div>
             {{if .User.Bio}}
             <div class="bio">{{.User.Bio}}</div>
             {{end}}
@@ -266,6 +331,12 @@ const userProfileHTML = `
                 <div class="stat-label">Win Rate</div>
                 <div class="stat-value">{{printf "%.1f" .Entry.WinPct}}%</div>
             </div>
+            {{if .Entry.HasBenchmark}}
+            <div class="stat-card">
+                <div class="stat-label">Benchmark (avg shots)</div>
+                <div class="stat-value">{{printf "%.1f" .Entry.BenchmarkShots}}</div>
+            </div>
+            {{end}}
         </div>
         {{end}}
         
@@ -283,6 +354,7 @@ const userProfileHTML = `
                             <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Losses</th>
                             <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Win Rate</th>
                             <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Avg Moves</th>
+                            <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Benchmark</th>
                             <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Status</th>
                             <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Active</th>
                         </tr>
@@ -305,6 +377,7 @@ const userProfileHTML = `
                                 {{else}}-{{end}}
                             </td>
                             <td style="padding: 0.75rem 0.5rem; text-align: center;">{{if .HasMatches}}{{printf "%.1f" .AvgMoves}}{{else}}-{{end}}</td>
+                            <td style="padding: 0.75rem 0.5rem; text-align: center;">{{if .HasBenchmark}}{{printf "%.1f" .BenchmarkShots}}{{else}}-{{end}}</td>
                             <td style="padding: 0.75rem 0.5rem; text-align: center;">
                                 {{if eq .Status "completed"}}<span style="color: #10b981;">✓</span>{{end}}
                                 {{if eq .Status "pending"}}<span style="color: #fbbf24;">⏳</span>{{end}}
@@ -322,14 +395,84 @@ const userProfileHTML = `
         </div>
         {{end}}
         
+        {{if .Matches}}
+        <div class="key-section" style="margin-bottom: 2rem;">
+            <h2 class="section-title">⚔️ Recent Matches</h2>
+            <div style="overflow-x: auto;">
+                <table style="width: 100%; border-collapse: collapse; font-size: 0.875rem;">
+                    <thead>
+                        <tr style="border-bottom: 1px solid #334155;">
+                            <th style="text-align: left; padding: 0.75rem 0.5rem; color: #94a3b8;">Opponent</th>
+                            <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Result</th>
+                            <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Games</th>
+                            <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Avg Moves</th>
+                            <th style="text-align: left; padding: 0.75rem 0.5rem; color: #94a3b8;">Played</th>
+                            <th style="padding: 0.75rem 0.5rem;"></th>
+                        </tr>
+                    </thead>
+                    <tbody>
+                        {{range .Matches}}
+                        <tr style="border-bottom: 1px solid #334155;">
+                            <td style="padding: 0.75rem 0.5rem;"><a href="{{$.Prefix}}/user/{{.Opponent}}" class="link">{{.Opponent}}</a></td>
+                            <td style="padding: 0.75rem 0.5rem; text-align: center;">{{if .Won}}<span style="color: #10b981;">Won</span>{{else}}<span style="color: #ef4444;">Lost</span>{{end}}</td>
+                            <td style="padding: 0.75rem 0.5rem; text-align: center;">{{.Wins}}–{{.Losses}}</td>
+                            <td style="padding: 0.75rem 0.5rem; text-align: center;">{{.AvgMoves}}</td>
+                            <td style="padding: 0.75rem 0.5rem; color: #94a3b8;">{{.Timestamp.Format "Jan 2, 3:04 PM"}}</td>
+                            <td style="padding: 0.75rem 0.5rem; text-align: right;"><a href="{{$.Prefix}}/match/{{.ID}}" class="link">Details →</a></td>
+                        </tr>
+                        {{end}}
+                    </tbody>
+                </table>
+            </div>
+        </div>
+        {{end}}
+        
+        {{if .SeasonHistory}}
+        <div class="key-section" style="margin-bottom: 2rem;">
+            <h2 class="section-title">🏆 Past Seasons</h2>
+            <div style="overflow-x: auto;">
+                <table style="width: 100%; border-collapse: collapse; font-size: 0.875rem;">
+                    <thead>
+                        <tr style="border-bottom: 1px solid #334155;">
+                            <th style="text-align: left; padding: 0.75rem 0.5rem; color: #94a3b8;">Season</th>
+                            <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Final Rank</th>
+                            <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Rating</th>
+                            <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Wins</th>
+                            <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Losses</th>
+                            <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Win Rate</th>
+                            <th style="text-align: center; padding: 0.75rem 0.5rem; color: #94a3b8;">Benchmark</th>
+                        </tr>
+                    </thead>
+                    <tbody>
+                        {{range .SeasonHistory}}
+                        <tr style="border-bottom: 1px solid #334155;">
+                            <td style="padding: 0.75rem 0.5rem;"><a href="{{arenaPath .ArenaSlug}}/season/{{.SeasonID}}" class="link">{{.SeasonName}}</a> <span style="color: #94a3b8;">· {{.ArenaName}}</span></td>
+                            <td style="padding: 0.75rem 0.5rem; text-align: center;">#{{.Rank}}</td>
+                            <td style="padding: 0.75rem 0.5rem; text-align: center;">{{.Rating}} <span style="color: #94a3b8; font-size: 0.8em;">±{{.RD}}</span></td>
+                            <td style="padding: 0.75rem 0.5rem; text-align: center;">{{.Wins}}</td>
+                            <td style="padding: 0.75rem 0.5rem; text-align: center;">{{.Losses}}</td>
+                            <td style="padding: 0.75rem 0.5rem; text-align: center;">{{printf "%.1f" .WinPct}}%</td>
+                            <td style="padding: 0.75rem 0.5rem; text-align: center;">{{if .HasBenchmark}}{{printf "%.1f" .BenchmarkShots}}{{else}}-{{end}}</td>
+                        </tr>
+                        {{end}}
+                    </tbody>
+                </table>
+            </div>
+        </div>
+        {{end}}
+        
+        {{if not .IsBot}}
         <div class="key-section">
-            <h2 class="section-title">SSH Public Key</h2>
-            <div class="key-display">{{.PublicKeyDisplay}}</div>
+            <h2 class="section-title">SSH Public Key{{if gt (len .KeyDisplays) 1}}s{{end}}</h2>
+            {{range .KeyDisplays}}
+            <div class="key-display">{{.}}</div>
+            {{end}}
             <div class="metadata">
                 <div>Member since: {{.User.CreatedAt.Format "Jan 2, 2006"}}</div>
                 <div>Last login: {{.User.LastLoginAt.Format "Jan 2, 3:04 PM"}}</div>
             </div>
         </div>
+        {{end}}
     </div>
 </body>
 </html>
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"log/slog"
 	"net/http"
+	"net/url"
 
 	"github.com/go-chi/chi/v5"
 
@@ -59,6 +61,28 @@ const leaderboardHTML = `
             color: #94a3b8;
         }
         
+        .arena-nav {
+            display: flex;
+            justify-content: center;
+            flex-wrap: wrap;
+            gap: 0.5rem;
+            margin-top: 1rem;
+        }
+        
+        .arena-nav a {
+            padding: 0.3rem 0.8rem;
+            border: 1px solid #334155;
+            border-radius: 999px;
+            color: #94a3b8;
+            text-decoration: none;
+            font-size: 0.85rem;
+        }
+        
+        .arena-nav a.active {
+            border-color: #3b82f6;
+            color: #e2e8f0;
+        }
+        
         .status-bar {
             display: flex;
             align-items: center;
@@ -130,6 +154,11 @@ const leaderboardHTML = `
             padding: 1.5rem;
             background: linear-gradient(135deg, #1e293b 0%, #334155 100%);
             border-bottom: 1px solid #334155;
+            display: flex;
+            align-items: center;
+            justify-content: space-between;
+            gap: 1rem;
+            flex-wrap: wrap;
         }
         
         .leaderboard-header h2 {
@@ -137,6 +166,36 @@ const leaderboardHTML = `
             font-weight: 700;
         }
         
+        .sort-toggle {
+            display: flex;
+            gap: 0.5rem;
+            font-size: 0.875rem;
+        }
+        
+        .sort-toggle a {
+            color: #94a3b8;
+            text-decoration: none;
+            padding: 0.25rem 0.75rem;
+            border: 1px solid #334155;
+            border-radius: 9999px;
+        }
+        
+        .bot-badge {
+            font-size: 0.7em;
+            font-weight: 600;
+            color: #a78bfa;
+            background: rgba(167, 139, 250, 0.15);
+            border-radius: 0.375rem;
+            padding: 0.1rem 0.4rem;
+            margin-left: 0.25rem;
+        }
+        
+        .sort-toggle a.active {
+            color: #e2e8f0;
+            border-color: #60a5fa;
+            background: rgba(96, 165, 250, 0.15);
+        }
+        
         table {
             width: 100%;
             border-collapse: collapse;
@@ -161,6 +220,7 @@ const leaderboardHTML = `
         th:nth-child(4), th:nth-child(5) { width: 100px; }  /* Wins, Losses */
         th:nth-child(6) { width: 120px; }  /* Win Rate */
         th:nth-child(7) { width: 120px; }  /* Avg Moves */
+        th:nth-child(8) { width: 120px; }  /* Benchmark */
         th:last-child { width: 150px; }  /* Last Active */
         
         tbody tr {
@@ -540,10 +600,13 @@ const leaderboardHTML = `
     </style>
     <script>
         let eventSource;
+        const sortBy = '{{.SortBy}}';
+        const hideBots = {{.HideBots}};
+        const arenaPath = {{.Prefix}};
         
         function connectSSE() {
             console.log('Connecting to SSE...');
-            eventSource = new EventSource('/events/updates');
+            eventSource = new EventSource('/events' + arenaPath + '/updates');
             
             eventSource.onopen = () => {
                 console.log('SSE connection established');
@@ -588,8 +651,21 @@ const leaderboardHTML = `
             const tbody = document.querySelector('tbody');
             if (!tbody) return;
             
+            if (hideBots) {
+                entries = entries.filter(e => !e.IsBot);
+            }
+            
+            if (sortBy === 'benchmark') {
+                // Live updates arrive rating-sorted; keep the benchmark order
+                entries = entries.slice().sort((a, b) => {
+                    if (a.IsBroken !== b.IsBroken) return a.IsBroken ? 1 : -1;
+                    if (a.HasBenchmark !== b.HasBenchmark) return a.HasBenchmark ? -1 : 1;
+                    return a.BenchmarkShots - b.BenchmarkShots || b.Rating - a.Rating;
+                });
+            }
+            
             if (entries.length === 0) {
-                tbody.innerHTML = '<tr><td colspan="8"><div class="empty-state"><div class="empty-state-icon">🎯</div><div>No submissions yet. Be the first to compete!</div></div></td></tr>';
+                tbody.innerHTML = '<tr><td colspan="9"><div class="empty-state"><div class="empty-state-icon">🎯</div><div>No submissions yet. Be the first to compete!</div></div></td></tr>';
                 return;
             }
             
@@ -615,21 +691,23 @@ const leaderboardHTML = `
                     minute: '2-digit'
                 });
                 
-                const nameDisplay = e.Username + (isPending ? ' <span style="font-size: 0.8em;">(pending)</span>' : '');
+                const nameDisplay = e.Username + (e.IsBot ? ' <span class="bot-badge">BOT</span>' : '') + (isPending ? ' <span style="font-size: 0.8em;">(pending)</span>' : '');
                 const ratingDisplay = isPending ? '-' : '<strong>' + e.Rating + '</strong> <span style="color: #94a3b8; font-size: 0.85em;">±' + e.RD + '</span>';
                 const winsDisplay = isPending ? '-' : e.Wins.toLocaleString();
                 const lossesDisplay = isPending ? '-' : e.Losses.toLocaleString();
                 const winRateDisplay = isPending ? '-' : '<span class="win-rate ' + winRateClass + '">' + winRate + '%</span>';
                 const avgMovesDisplay = isPending ? '-' : e.AvgMoves.toFixed(1);
+                const benchmarkDisplay = e.HasBenchmark ? e.BenchmarkShots.toFixed(1) : '-';
                 
                 return '<tr' + rowClass + '>' +
                     '<td class="rank rank-' + rank + '">' + rankDisplay + '</td>' +
-                    '<td class="player-name"><a href="/user/' + e.Username + '" style="color: inherit; text-decoration: none;">' + nameDisplay + '</a></td>' +
+                    '<td class="player-name"><a href="' + arenaPath + '/user/' + e.Username + '" style="color: inherit; text-decoration: none;">' + nameDisplay + '</a></td>' +
                     '<td>' + ratingDisplay + '</td>' +
                     '<td>' + winsDisplay + '</td>' +
                     '<td>' + lossesDisplay + '</td>' +
                     '<td>' + winRateDisplay + '</td>' +
                     '<td>' + avgMovesDisplay + '</td>' +
+                    '<td>' + benchmarkDisplay + '</td>' +
                     '<td style="color: #64748b;">' + lastPlayed + '</td>' +
                     '</tr>';
             }).join('');
@@ -709,7 +787,14 @@ const leaderboardHTML = `
     <div class="container">
         <header>
             <h1>⚓ BATTLESHIP ARENA</h1>
-            <p class="subtitle">AI Strategy Competition</p>
+            <p class="subtitle">{{.Arena.Name}}{{if .Season}} · {{.Season.Name}}{{else}} · between seasons{{end}}</p>
+            {{if gt (len .Arenas) 1}}
+            <nav class="arena-nav">
+                {{range .Arenas}}
+                <a href="{{arenaPath .Slug}}/"{{if eq .ID $.Arena.ID}} class="active"{{end}}>{{.Name}}</a>
+                {{end}}
+            </nav>
+            {{end}}
         </header>
         
         <div class="status-bar">
@@ -731,6 +816,11 @@ const leaderboardHTML = `
         <div class="leaderboard">
             <div class="leaderboard-header">
                 <h2>🏆 Leaderboard</h2>
+                <div class="sort-toggle">
+                    <a href="{{leaderboardURL .Prefix "rating" .HideBots}}"{{if ne .SortBy "benchmark"}} class="active"{{end}}>By Rating</a>
+                    <a href="{{leaderboardURL .Prefix "benchmark" .HideBots}}"{{if eq .SortBy "benchmark"}} class="active"{{end}}>By Benchmark</a>
+                    <a href="{{leaderboardURL .Prefix .SortBy (not .HideBots)}}"{{if not .HideBots}} class="active"{{end}}>🤖 Bots</a>
+                </div>
             </div>
             <table>
                 <thead>
@@ -742,6 +832,7 @@ const leaderboardHTML = `
                         <th>Losses</th>
                         <th>Win Rate</th>
                         <th><span class="tooltip" data-tooltip="Average moves to win (lower is better)">Avg Moves</span></th>
+                        <th><span class="tooltip" data-tooltip="Average shots to sink all ships on the shared board set (lower is better)">Benchmark</span></th>
                         <th>Last Active</th>
                     </tr>
                 </thead>
@@ -750,18 +841,19 @@ const leaderboardHTML = `
                     {{range $i, $e := .Entries}}
                     <tr{{if $e.IsPending}} class="pending"{{else if $e.IsBroken}} class="broken"{{end}}>
                         <td class="rank rank-{{add $i 1}}">{{if $e.IsBroken}}💥{{else if $e.IsPending}}⏳{{else if lt $i 3}}{{medal $i}}{{else}}{{add $i 1}}{{end}}</td>
-                        <td class="player-name"><a href="/user/{{$e.Username}}" style="color: inherit; text-decoration: none;">{{$e.Username}}{{if $e.IsPending}} <span style="font-size: 0.8em;">(pending)</span>{{else if $e.IsBroken}} <span style="font-size: 0.8em; color: #ef4444;">(compilation failed)</span>{{end}}</a></td>
+                        <td class="player-name"><a href="{{$.Prefix}}/user/{{$e.Username}}" style="color: inherit; text-decoration: none;">{{$e.Username}}{{if $e.IsBot}} <span class="bot-badge">BOT</span>{{end}}{{if $e.IsPending}} <span style="font-size: 0.8em;">(pending)</span>{{else if $e.IsBroken}} <span style="font-size: 0.8em; color: #ef4444;">(compilation failed)</span>{{end}}</a></td>
                         <td>{{if or $e.IsPending $e.IsBroken}}-{{else}}<strong>{{$e.Rating}}</strong> <span style="color: #94a3b8; font-size: 0.85em;">±{{$e.RD}}</span>{{end}}</td>
                         <td>{{if or $e.IsPending $e.IsBroken}}-{{else}}{{$e.Wins}}{{end}}</td>
                         <td>{{if or $e.IsPending $e.IsBroken}}-{{else}}{{$e.Losses}}{{end}}</td>
                         <td>{{if or $e.IsPending $e.IsBroken}}-{{else}}<span class="win-rate {{winRateClass $e}}">{{winRate $e}}%</span>{{end}}</td>
                         <td>{{if or $e.IsPending $e.IsBroken}}-{{else}}{{printf "%.1f" $e.AvgMoves}}{{end}}</td>
+                        <td>{{if $e.HasBenchmark}}{{printf "%.1f" $e.BenchmarkShots}}{{else}}-{{end}}</td>
                         <td style="color: #64748b;">{{if $e.IsPending}}Waiting...{{else if $e.IsBroken}}Failed{{else}}{{$e.LastPlayed.Format "Jan 2, 3:04 PM"}}{{end}}</td>
                     </tr>
                     {{end}}
                     {{else}}
                     <tr>
-                        <td colspan="8">
+                        <td colspan="9">
                             <div class="empty-state">
                                 <div class="empty-state-icon">🎯</div>
                                 <div>No submissions yet. Be the first to compete!</div>
@@ -802,11 +894,17 @@ const leaderboardHTML = `
                 <li>Your AI plays 1000 games against each opponent</li>
                 <li>Rankings use Glicko-2 rating system (like chess)</li>
                 <li>Lower average moves = more efficient strategy</li>
+                <li>Every AI is also benchmarked solo on the same seeded boards</li>
+                <li>Reference bots (marked BOT) play every new submission to anchor the ratings</li>
                 <li>Live updates as matches complete</li>
             </ul>
             
             <p style="margin-top: 1rem; color: #94a3b8;">
                 <a href="/users" style="color: #60a5fa; text-decoration: none;">View all players →</a>
+                &nbsp;·&nbsp;
+                <a href="{{.Prefix}}/matrix" style="color: #60a5fa; text-decoration: none;">Head-to-head matrix →</a>
+                &nbsp;·&nbsp;
+                <a href="{{.Prefix}}/seasons" style="color: #60a5fa; text-decoration: none;">Past seasons →</a>
             </p>
         </div>
     </div>
@@ -840,6 +938,8 @@ var tmpl = template.Must(template.New("leaderboard").Funcs(template.FuncMap{
 	"add": func(a, b int) int {
 		return a + b
 	},
+	"arenaPath":      arenaPath,
+	"leaderboardURL": leaderboardURL,
 	"medal": func(i int) string {
 		medals := []string{"🥇", "🥈", "🥉"}
 		if i < len(medals) {
@@ -864,8 +964,46 @@ func formatFloat(f float64, decimals int) string {
 	return fmt.Sprintf("%.1f", f)
 }
 
+// leaderboardSort reads the ?sort= query parameter, defaulting to rating
+func leaderboardSort(r *http.Request) string {
+	if r.URL.Query().Get("sort") == storage.SortByBenchmark {
+		return storage.SortByBenchmark
+	}
+	return storage.SortByRating
+}
+
+// leaderboardQuery builds a leaderboard query from ?sort= and ?bots=hide
+func leaderboardQuery(r *http.Request, limit int) storage.LeaderboardQuery {
+	return storage.LeaderboardQuery{
+		Limit:    limit,
+		SortBy:   leaderboardSort(r),
+		HideBots: r.URL.Query().Get("bots") == "hide",
+	}
+}
+
+func leaderboardURL(prefix, sortBy string, hideBots bool) string {
+	params := url.Values{}
+	if sortBy == storage.SortByBenchmark {
+		params.Set("sort", sortBy)
+	}
+	if hideBots {
+		params.Set("bots", "hide")
+	}
+	if len(params) == 0 {
+		return prefix + "/"
+	}
+	return prefix + "/?" + params.Encode()
+}
+
 func HandleLeaderboard(w http.ResponseWriter, r *http.Request) {
-	entries, err := storage.GetLeaderboard(50)
+	arena := requestArena(w, r)
+	if arena == nil {
+		return
+	}
+	
+	query := leaderboardQuery(r, leaderboardSize)
+	query.ArenaID = arena.ID
+	entries, err := storage.QueryLeaderboard(query)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to load leaderboard: %v", err), http.StatusInternalServerError)
 		return
@@ -877,23 +1015,45 @@ func HandleLeaderboard(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get matches for bracket
-	matches, err := storage.GetAllMatches()
+	matches, err := storage.GetAllMatches(arena.ID)
 	if err != nil {
 		matches = []storage.MatchResult{}
 	}
+	
+	arenas, err := storage.GetArenas()
+	if err != nil {
+		slog.Error("loading arenas failed", "err", err)
+	}
+
+	season, err := storage.GetCurrentSeason()
+	if err != nil {
+		slog.Error("loading current season failed", "err", err)
+	}
 
 	data := struct {
 		Entries      []storage.LeaderboardEntry
+		Arena        *storage.Arena
+		Arenas       []storage.Arena
+		Prefix       string
+		Season       *storage.Season
 		Matches      []storage.MatchResult
 		TotalPlayers int
 		TotalGames   int
 		ServerURL    string
+		SortBy       string
+		HideBots     bool
 	}{
 		Entries:      entries,
+		Arena:        arena,
+		Arenas:       arenas,
+		Prefix:       arenaPath(arena.Slug),
+		Season:       season,
 		Matches:      matches,
 		TotalPlayers: len(entries),
 		TotalGames:   calculateTotalGames(entries),
 		ServerURL:    GetServerURL(),
+		SortBy:       query.SortBy,
+		HideBots:     query.HideBots,
 	}
 
 	if err := tmpl.Execute(w, data); err != nil {
@@ -902,7 +1062,14 @@ func HandleLeaderboard(w http.ResponseWriter, r *http.Request) {
 }
 
 func HandleAPILeaderboard(w http.ResponseWriter, r *http.Request) {
-	entries, err := storage.GetLeaderboard(50)
+	arena := requestArena(w, r)
+	if arena == nil {
+		return
+	}
+	
+	query := leaderboardQuery(r, leaderboardSize)
+	query.ArenaID = arena.ID
+	entries, err := storage.QueryLeaderboard(query)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to load leaderboard: %v", err), http.StatusInternalServerError)
 		return
@@ -931,21 +1098,20 @@ func HandleRatingHistory(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Username required", http.StatusBadRequest)
 		return
 	}
+	
+	arena := requestArena(w, r)
+	if arena == nil {
+		return
+	}
 
-	// Get submission ID for this username
-	var submissionID int
-	err := storage.DB.QueryRow(
-		"SELECT id FROM submissions WHERE username = ? AND is_active = 1",
-		username,
-	).Scan(&submissionID)
-
-	if err != nil {
+	sub, err := storage.GetActiveSubmission(arena.ID, username)
+	if err != nil || sub == nil {
 		http.Error(w, "Player not found", http.StatusNotFound)
 		return
 	}
 
 	// Get rating history
-	history, err := storage.GetRatingHistory(submissionID)
+	history, err := storage.GetRatingHistory(sub.ID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get rating history: %v", err), http.StatusInternalServerError)
 		return
@@ -962,8 +1128,13 @@ func HandlePlayerPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	arena := requestArena(w, r)
+	if arena == nil {
+		return
+	}
+
 	tmpl := template.Must(template.New("player").Parse(playerPageHTML))
-	tmpl.Execute(w, map[string]string{"Username": username})
+	tmpl.Execute(w, map[string]string{"Username": username, "Prefix": arenaPath(arena.Slug)})
 }
 
 const playerPageHTML = `
@@ -1064,7 +1235,7 @@ const playerPageHTML = `
 </head>
 <body>
     <div class="container">
-        <a href="/" class="back-link">← Back to Leaderboard</a>
+        <a href="{{.Prefix}}/" class="back-link">← Back to Leaderboard</a>
         <h1>{{.Username}}</h1>
         <p style="color: #94a3b8; margin-bottom: 2rem;">Player Statistics</p>
         
@@ -1100,15 +1271,16 @@ const playerPageHTML = `
     
     <script>
         const username = "{{.Username}}";
+        const arenaPath = {{.Prefix}};
         
         async function loadData() {
             try {
                 // Load rating history
-                const historyRes = await fetch('/api/rating-history/' + username);
+                const historyRes = await fetch(arenaPath + '/api/rating-history/' + username);
                 const history = await historyRes.json();
                 
                 // Load current stats from leaderboard
-                const leaderboardRes = await fetch('/api/leaderboard');
+                const leaderboardRes = await fetch(arenaPath + '/api/leaderboard');
                 const leaderboard = await leaderboardRes.json();
                 const player = leaderboard.find(p => p.Username === username);
                 
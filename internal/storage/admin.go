@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// IsAdmin reports whether the account holds the admin role. Admin rights
+// are only exercised over SSH with one of the account's admin keys; see
+// IsAdminKey.
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// GrantAdmin gives a user the admin role and marks which of their keys carry
+// it. With no fingerprint every key they have now becomes an admin key; keys
+// added later never are, so a student machine can't pick up admin rights.
+func GrantAdmin(username, fingerprint string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.exec("UPDATE users SET role = ? WHERE username = ?", RoleAdmin, username)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("no user named %q", username)
+	}
+
+	if fingerprint == "" {
+		result, err = tx.exec("UPDATE user_keys SET is_admin = 1 WHERE username = ?", username)
+	} else {
+		result, err = tx.exec("UPDATE user_keys SET is_admin = 1 WHERE username = ? AND fingerprint = ?", username, fingerprint)
+	}
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("%s has no matching keys to grant admin to", username)
+	}
+	return tx.Commit()
+}
+
+// RevokeAdmin takes the admin role and every admin key away from a user
+func RevokeAdmin(username string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.exec("UPDATE users SET role = ? WHERE username = ?", RoleUser, username); err != nil {
+		return err
+	}
+	if _, err := tx.exec("UPDATE user_keys SET is_admin = 0 WHERE username = ?", username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsAdminKey reports whether a key belongs to an admin and was granted admin
+// rights. Both must hold: demoting a user disables all their keys at once.
+func IsAdminKey(publicKey string) (bool, error) {
+	var count int
+	err := db.queryRow(
+		`SELECT COUNT(*) FROM user_keys k JOIN users u ON u.username = k.username
+		 WHERE k.public_key = ? AND k.is_admin = 1 AND u.role = ? AND u.revoked_at IS NULL`,
+		publicKey, RoleAdmin,
+	).Scan(&count)
+	return count > 0, err
+}
+
+func GetAdmins() ([]User, error) {
+	users, err := GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+	var admins []User
+	for _, u := range users {
+		if u.IsAdmin() {
+			admins = append(admins, u)
+		}
+	}
+	return admins, nil
+}
+
+type AuditEntry struct {
+	ID        int
+	Actor     string
+	Action    string
+	Target    string
+	Detail    string
+	CreatedAt time.Time
+}
+
+// Audit records an admin action. Actor is the admin's username, "passcode"
+// for the legacy shared passcode, or "cli:<os user>" for the command line.
+// Actions taken over SSH are refused if their entry can't be written, since
+// an unaudited admin action is worse than a refused one.
+func Audit(actor, action, target, detail string) error {
+	_, err := db.exec(
+		"INSERT INTO audit_log (actor, action, target, detail, created_at) VALUES (?, ?, ?, ?, ?)",
+		actor, action, target, detail, time.Now(),
+	)
+	return err
+}
+
+// GetAuditLog returns the most recent entries first
+func GetAuditLog(limit int) ([]AuditEntry, error) {
+	rows, err := db.query(
+		"SELECT id, actor, action, target, detail, created_at FROM audit_log ORDER BY id DESC LIMIT ?",
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var target, detail sql.NullString
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &target, &detail, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Target = target.String
+		e.Detail = detail.String
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// GetQueue returns the submissions waiting for or in the middle of testing,
+// oldest first
+func GetQueue() ([]Submission, error) {
+	return querySubmissions(
+		"SELECT id, username, filename, upload_time, status, is_active, arena_id, COALESCE(content_hash, ''), COALESCE(restored_from, 0) FROM submissions WHERE status IN ('pending', 'testing') AND is_active = 1 ORDER BY upload_time",
+	)
+}
+
+// GetRecentSubmissions lists the latest uploads across every user and arena
+func GetRecentSubmissions(limit int) ([]Submission, error) {
+	return querySubmissions(
+		"SELECT id, username, filename, upload_time, status, is_active, arena_id, COALESCE(content_hash, ''), COALESCE(restored_from, 0) FROM submissions ORDER BY upload_time DESC, id DESC LIMIT ?",
+		limit,
+	)
+}
+
+func querySubmissions(query string, args ...interface{}) ([]Submission, error) {
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var submissions []Submission
+	for rows.Next() {
+		var s Submission
+		if err := rows.Scan(&s.ID, &s.Username, &s.Filename, &s.UploadTime, &s.Status, &s.IsActive, &s.ArenaID, &s.ContentHash, &s.RestoredFrom); err != nil {
+			return nil, err
+		}
+		submissions = append(submissions, s)
+	}
+	return submissions, rows.Err()
+}
+
+// CancelSubmission takes a queued submission out of testing. One that is
+// already compiling or playing stops at the worker's next check.
+func CancelSubmission(id int) error {
+	result, err := db.exec("UPDATE submissions SET status = 'cancelled' WHERE id = ? AND status IN ('pending', 'testing')", id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("submission %d is not queued", id)
+	}
+	return nil
+}
+
+// IsCancelled reports whether an admin cancelled a submission while it was
+// being tested
+func IsCancelled(id int) bool {
+	var status string
+	err := db.queryRow("SELECT status FROM submissions WHERE id = ?", id).Scan(&status)
+	return err == nil && status == "cancelled"
+}
+
+// RequeueSubmission throws away a submission's matches and sends it back
+// through compilation and the round-robin
+func RequeueSubmission(id int) error {
+	sub, err := GetSubmissionByID(id)
+	if err != nil {
+		return err
+	}
+	if !sub.IsActive {
+		return fmt.Errorf("submission %d has been replaced; only the active submission can be rerun", id)
+	}
+
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.exec("UPDATE matches SET is_valid = 0 WHERE player1_id = ? OR player2_id = ?", id, id); err != nil {
+		return err
+	}
+	if _, err := tx.exec("UPDATE submissions SET status = 'pending', compile_log = NULL WHERE id = ?", id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	_, err = EnqueueJob(JobCompile, CompileJobKey(id), CompilePayload{SubmissionID: id})
+	return err
+}
+
+func SaveCompileLog(id int, output string) error {
+	_, err := db.exec("UPDATE submissions SET compile_log = ? WHERE id = ?", output, id)
+	return err
+}
+
+func GetCompileLog(id int) (string, error) {
+	var output sql.NullString
+	err := db.queryRow("SELECT compile_log FROM submissions WHERE id = ?", id).Scan(&output)
+	return output.String, err
+}
+
+// SubmissionMatch is one head-to-head result seen from a submission's side
+type SubmissionMatch struct {
+	ID        int
+	Opponent  string
+	Wins      int
+	Losses    int
+	AvgMoves  int
+	IsValid   bool
+	Timestamp time.Time
+}
+
+func GetSubmissionMatches(id int) ([]SubmissionMatch, error) {
+	rows, err := db.query(
+		`SELECT m.id, o.username,
+			CASE WHEN m.player1_id = ? THEN m.player1_wins ELSE m.player2_wins END,
+			CASE WHEN m.player1_id = ? THEN m.player2_wins ELSE m.player1_wins END,
+			m.player1_moves, m.is_valid, m.timestamp
+		 FROM matches m
+		 JOIN submissions o ON o.id = CASE WHEN m.player1_id = ? THEN m.player2_id ELSE m.player1_id END
+		 WHERE m.player1_id = ? OR m.player2_id = ?
+		 ORDER BY m.timestamp DESC, m.id DESC`,
+		id, id, id, id, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []SubmissionMatch
+	for rows.Next() {
+		var m SubmissionMatch
+		var moves sql.NullInt64
+		if err := rows.Scan(&m.ID, &m.Opponent, &m.Wins, &m.Losses, &moves, &m.IsValid, &m.Timestamp); err != nil {
+			return nil, err
+		}
+		m.AvgMoves = int(moves.Int64)
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// InvalidateMatch drops a match from the ratings; call
+// RecalculateAllGlicko2Ratings afterwards to apply it
+func InvalidateMatch(id int) error {
+	result, err := db.exec("UPDATE matches SET is_valid = 0 WHERE id = ? AND is_valid = 1", id)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("match %d is not valid", id)
+	}
+	return nil
+}
+
+// ErrDeletedUsername is returned when registering the username of a deleted
+// account
+var ErrDeletedUsername = errors.New("username belonged to a deleted account")
+
+// DeleteUser removes an account and its keys. Submissions and matches stay
+// for the history pages but leave every ladder, and the username stays
+// reserved so whoever registers next can't inherit them.
+func DeleteUser(username string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.exec("DELETE FROM users WHERE username = ?", username)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("no user named %q", username)
+	}
+	for _, stmt := range []string{
+		"DELETE FROM user_keys WHERE username = ?",
+		"DELETE FROM arena_members WHERE username = ?",
+		"UPDATE submissions SET is_active = 0 WHERE username = ?",
+	} {
+		if _, err := tx.exec(stmt, username); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.exec("INSERT INTO deleted_users (username, deleted_at) VALUES (?, ?)", username, time.Now()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsDeletedUsername reports whether a username belonged to a deleted account
+func IsDeletedUsername(username string) (bool, error) {
+	var count int
+	err := db.queryRow("SELECT COUNT(*) FROM deleted_users WHERE username = ?", username).Scan(&count)
+	return count > 0, err
+}
+
+// GetFailedSubmissions lists recent uploads that failed to compile in the
+// sandbox, newest first
+func GetFailedSubmissions(limit int) ([]Submission, error) {
+	return querySubmissions(
+		"SELECT id, username, filename, upload_time, status, is_active, arena_id, COALESCE(content_hash, ''), COALESCE(restored_from, 0) FROM submissions WHERE status = 'compilation_failed' ORDER BY upload_time DESC, id DESC LIMIT ?",
+		limit,
+	)
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeletedUsernameStaysReserved(t *testing.T) {
+	useFileDB(t)
+
+	if _, err := RegisterUser("alice", "Alice", "", "", aliceKey, ""); err != nil {
+		t.Fatal(err)
+	}
+	id := addCompiled(t, "alice")
+	if err := DeleteUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RegisterUser("alice", "Someone Else", "", "", "ssh-ed25519 placeholder", ""); !errors.Is(err, ErrDeletedUsername) {
+		t.Fatalf("re-registering alice: got %v, want ErrDeletedUsername", err)
+	}
+	if deleted, err := IsDeletedUsername("alice"); err != nil || !deleted {
+		t.Errorf("IsDeletedUsername(alice) = %v, %v; want true", deleted, err)
+	}
+	if user, err := GetUserByUsername("alice"); err != nil || user != nil {
+		t.Errorf("alice still finds %+v, %v", user, err)
+	}
+
+	// Her upload stays in the history, off the ladder
+	sub, err := GetSubmissionByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Username != "alice" || sub.IsActive {
+		t.Errorf("submission after delete = %+v, want alice's, inactive", sub)
+	}
+	if err := DeleteUser("alice"); err == nil {
+		t.Error("deleted alice twice")
+	}
+}
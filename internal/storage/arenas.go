@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// DefaultArenaSlug names the arena that existed before arenas did; it keeps
+// the root URLs and the plain ~/ upload path working
+const DefaultArenaSlug = "main"
+
+// DefaultGamesPerMatch is how many games a head-to-head match plays unless an
+// arena's rules say otherwise. It comes from engine.games_per_match and is
+// copied into each arena when the arena is created, so set it before InitDB.
+var DefaultGamesPerMatch = 1000
+
+const (
+	ArenaRoleMember = "member"
+	ArenaRoleAdmin  = "admin"
+)
+
+var arenaSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// reservedArenaSlugs are generated directories in each user's SCP and SFTP
+// view, which an arena's upload directory would be hidden behind
+var reservedArenaSlugs = map[string]bool{"reports": true, "submissions": true, "matches": true}
+
+type Arena struct {
+	ID            int
+	Slug          string
+	Name          string
+	EnginePath    string // empty means the server-wide engine
+	GamesPerMatch int
+	RosterOnly    bool // only listed members may submit
+	CreatedAt     time.Time
+}
+
+// IsDefault reports whether this is the arena served from the root URLs
+func (a *Arena) IsDefault() bool {
+	return a.Slug == DefaultArenaSlug
+}
+
+// UserDir is where a user's uploads for this arena live. The default arena
+// keeps the original <upload>/<user>/ layout; other arenas get a
+// subdirectory named after the arena, which is also the SCP/SFTP target path.
+func (a *Arena) UserDir(uploadDir, username string) string {
+	if a.IsDefault() {
+		return filepath.Join(uploadDir, username)
+	}
+	return filepath.Join(uploadDir, username, a.Slug)
+}
+
+type ArenaMember struct {
+	ArenaID  int
+	Username string
+	Role     string
+	AddedAt  time.Time
+}
+
+// ensureDefaultArena creates the default arena and adopts any rows written
+// before arenas existed into it
+func ensureDefaultArena(db *SQLStore) error {
+	_, err := db.exec(
+		"INSERT INTO arenas (slug, name, engine_path, games_per_match, roster_only) VALUES (?, 'Main Arena', '', ?, 0) ON CONFLICT DO NOTHING",
+		DefaultArenaSlug, DefaultGamesPerMatch,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"submissions", "tournaments", "season_standings"} {
+		_, err := db.exec(
+			fmt.Sprintf("UPDATE %s SET arena_id = (SELECT id FROM arenas WHERE slug = ?) WHERE arena_id IS NULL", table),
+			DefaultArenaSlug,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const arenaColumns = "id, slug, name, engine_path, games_per_match, roster_only, created_at"
+
+func scanArena(row interface{ Scan(...interface{}) error }) (*Arena, error) {
+	var a Arena
+	err := row.Scan(&a.ID, &a.Slug, &a.Name, &a.EnginePath, &a.GamesPerMatch, &a.RosterOnly, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetArena looks an arena up by slug, returning nil if there is none
+func GetArena(slug string) (*Arena, error) {
+	arena, err := scanArena(db.queryRow("SELECT "+arenaColumns+" FROM arenas WHERE slug = ?", slug))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return arena, err
+}
+
+func GetArenaByID(id int) (*Arena, error) {
+	arena, err := scanArena(db.queryRow("SELECT "+arenaColumns+" FROM arenas WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return arena, err
+}
+
+func GetDefaultArena() (*Arena, error) {
+	arena, err := GetArena(DefaultArenaSlug)
+	if err == nil && arena == nil {
+		err = fmt.Errorf("default arena %q is missing", DefaultArenaSlug)
+	}
+	return arena, err
+}
+
+func GetArenas() ([]Arena, error) {
+	return queryArenas("SELECT " + arenaColumns + " FROM arenas ORDER BY id")
+}
+
+// GetUserArenas returns the arenas a user can submit to: every open arena plus
+// the roster-only ones they are a member of
+func GetUserArenas(username string) ([]Arena, error) {
+	return queryArenas(
+		`SELECT `+arenaColumns+` FROM arenas
+		 WHERE roster_only = 0
+		 OR id IN (SELECT arena_id FROM arena_members WHERE username = ?)
+		 ORDER BY id`,
+		username,
+	)
+}
+
+func queryArenas(query string, args ...interface{}) ([]Arena, error) {
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var arenas []Arena
+	for rows.Next() {
+		a, err := scanArena(rows)
+		if err != nil {
+			return nil, err
+		}
+		arenas = append(arenas, *a)
+	}
+	return arenas, rows.Err()
+}
+
+// CreateArena registers a new arena. Each arena needs its own engine
+// directory since compiled submissions are written into it by filename.
+func CreateArena(slug, name, enginePath string, gamesPerMatch int, rosterOnly bool) (*Arena, error) {
+	if !arenaSlugPattern.MatchString(slug) {
+		return nil, fmt.Errorf("invalid arena name %q: use lowercase letters, digits and dashes", slug)
+	}
+	if reservedArenaSlugs[slug] {
+		return nil, fmt.Errorf("arena name %q is reserved", slug)
+	}
+	if enginePath == "" {
+		return nil, fmt.Errorf("arena %q needs its own engine directory", slug)
+	}
+	if gamesPerMatch <= 0 {
+		gamesPerMatch = DefaultGamesPerMatch
+	}
+
+	var count int
+	if err := db.queryRow("SELECT COUNT(*) FROM arenas WHERE engine_path = ?", enginePath).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("engine directory %s is already used by another arena", enginePath)
+	}
+
+	if name == "" {
+		name = slug
+	}
+	id, err := db.insert(
+		"INSERT INTO arenas (slug, name, engine_path, games_per_match, roster_only) VALUES (?, ?, ?, ?, ?)",
+		slug, name, enginePath, gamesPerMatch, rosterOnly,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return GetArenaByID(int(id))
+}
+
+// AddArenaMember adds a user to an arena's roster, or changes their role if
+// they are already on it
+func AddArenaMember(arenaID int, username, role string) error {
+	if role != ArenaRoleMember && role != ArenaRoleAdmin {
+		return fmt.Errorf("invalid arena role %q", role)
+	}
+	_, err := db.exec(
+		`INSERT INTO arena_members (arena_id, username, role) VALUES (?, ?, ?)
+		 ON CONFLICT(arena_id, username) DO UPDATE SET role = excluded.role`,
+		arenaID, username, role,
+	)
+	return err
+}
+
+func RemoveArenaMember(arenaID int, username string) error {
+	_, err := db.exec("DELETE FROM arena_members WHERE arena_id = ? AND username = ?", arenaID, username)
+	return err
+}
+
+func GetArenaMembers(arenaID int) ([]ArenaMember, error) {
+	rows, err := db.query(
+		"SELECT arena_id, username, role, added_at FROM arena_members WHERE arena_id = ? ORDER BY role, username",
+		arenaID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []ArenaMember
+	for rows.Next() {
+		var m ArenaMember
+		if err := rows.Scan(&m.ArenaID, &m.Username, &m.Role, &m.AddedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func arenaRole(arenaID int, username string) (string, error) {
+	var role string
+	err := db.queryRow("SELECT role FROM arena_members WHERE arena_id = ? AND username = ?", arenaID, username).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// CanSubmit reports whether a user may upload to an arena
+func CanSubmit(arena *Arena, username string) (bool, error) {
+	if !arena.RosterOnly {
+		return true, nil
+	}
+	role, err := arenaRole(arena.ID, username)
+	return role != "", err
+}
+
+func IsArenaAdmin(arenaID int, username string) bool {
+	role, err := arenaRole(arenaID, username)
+	return err == nil && role == ArenaRoleAdmin
+}
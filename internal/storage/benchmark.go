@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+)
+
+// BoardSetVersion names the fixed set of seeded boards every submission is
+// benchmarked on; the runner generates the boards and bumps the version
+// whenever they change. Only results on this set are shown.
+const BoardSetVersion = "seeded-500-v1"
+
+type Benchmark struct {
+	ID           int
+	SubmissionID int
+	BoardSet     string
+	Boards       int
+	AvgShots     float64
+	MinShots     int
+	MaxShots     int
+	Timestamp    time.Time
+}
+
+// SaveBenchmark stores the solo benchmark result for a submission, replacing
+// any earlier result for the same board set
+func SaveBenchmark(submissionID int, boardSet string, boards int, avgShots float64, minShots, maxShots int) error {
+	_, err := db.exec(
+		`INSERT INTO benchmarks (submission_id, board_set, boards, avg_shots, min_shots, max_shots, timestamp)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(submission_id, board_set) DO UPDATE SET
+		 	boards = excluded.boards,
+		 	avg_shots = excluded.avg_shots,
+		 	min_shots = excluded.min_shots,
+		 	max_shots = excluded.max_shots,
+		 	timestamp = excluded.timestamp`,
+		submissionID, boardSet, boards, avgShots, minShots, maxShots, time.Now(),
+	)
+	return err
+}
+
+// GetBenchmark returns the most recent benchmark for a submission, or nil if
+// it has never been benchmarked
+func GetBenchmark(submissionID int) (*Benchmark, error) {
+	var b Benchmark
+	err := db.queryRow(
+		`SELECT id, submission_id, board_set, boards, avg_shots, min_shots, max_shots, timestamp
+		 FROM benchmarks WHERE submission_id = ? ORDER BY id DESC LIMIT 1`,
+		submissionID,
+	).Scan(&b.ID, &b.SubmissionID, &b.BoardSet, &b.Boards, &b.AvgShots, &b.MinShots, &b.MaxShots, &b.Timestamp)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// GetSubmissionsNeedingBenchmark returns active, compiled submissions that have
+// no result for the given board set (new uploads, or a board set version bump)
+func GetSubmissionsNeedingBenchmark(boardSet string) ([]Submission, error) {
+	rows, err := db.query(
+		`SELECT id, username, filename, upload_time, status, arena_id, COALESCE(content_hash, ''), COALESCE(restored_from, 0) FROM submissions s
+		 WHERE s.is_active = 1 AND s.status = 'completed'
+		 AND NOT EXISTS (SELECT 1 FROM benchmarks b WHERE b.submission_id = s.id AND b.board_set = ?)
+		 ORDER BY upload_time`,
+		boardSet,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var submissions []Submission
+	for rows.Next() {
+		var s Submission
+		if err := rows.Scan(&s.ID, &s.Username, &s.Filename, &s.UploadTime, &s.Status, &s.ArenaID, &s.ContentHash, &s.RestoredFrom); err != nil {
+			return nil, err
+		}
+		submissions = append(submissions, s)
+	}
+
+	return submissions, rows.Err()
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BotUsernamePrefix starts every reference bot's username. It is reserved:
+// players can't register a name with it, so a bot never shares an account
+// with a person.
+const BotUsernamePrefix = "bot-"
+
+// ErrReservedUsername is returned when a player tries to register a username
+// kept for reference bots
+var ErrReservedUsername = errors.New("usernames starting with " + BotUsernamePrefix + " are reserved for reference bots")
+
+// IsReservedUsername reports whether username is kept for reference bots
+func IsReservedUsername(username string) bool {
+	return strings.HasPrefix(strings.ToLower(username), BotUsernamePrefix)
+}
+
+// pinnedBotRD is the rating deviation reported for bots pinned to a fixed
+// rating. It is kept low so opponents treat the pin as a confident anchor.
+const pinnedBotRD = 50.0
+
+type ReferenceBot struct {
+	Username     string
+	Source       string
+	PinnedRating float64
+	IsPinned     bool
+	CreatedAt    time.Time
+}
+
+// RegisterReferenceBot records a system-owned reference AI and makes sure it
+// has a user row, so it shows up like any other player. A pinnedRating of 0
+// leaves the bot's rating free to move. It fails rather than take over a
+// player's account that already has the bot's name.
+func RegisterReferenceBot(username, source string, pinnedRating float64) error {
+	user, err := GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user != nil && !IsReferenceBot(username) {
+		return fmt.Errorf("username %s belongs to a player, not a reference bot", username)
+	}
+
+	var pinned interface{}
+	if pinnedRating > 0 {
+		pinned = pinnedRating
+	}
+
+	_, err = db.exec(
+		`INSERT INTO reference_bots (username, source, pinned_rating) VALUES (?, ?, ?)
+		 ON CONFLICT(username) DO UPDATE SET source = excluded.source, pinned_rating = excluded.pinned_rating`,
+		username, source, pinned,
+	)
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		// Straight to the store: the package-level RegisterUser turns away
+		// the reserved name
+		_, err = store.RegisterUser(username, username, fmt.Sprintf("Reference bot built from %s", source), "", "reference-bot-"+username, "")
+	}
+	return err
+}
+
+func GetReferenceBots() ([]ReferenceBot, error) {
+	rows, err := db.query("SELECT username, source, pinned_rating, created_at FROM reference_bots ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bots []ReferenceBot
+	for rows.Next() {
+		var b ReferenceBot
+		var pinned sql.NullFloat64
+		if err := rows.Scan(&b.Username, &b.Source, &pinned, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		b.PinnedRating = pinned.Float64
+		b.IsPinned = pinned.Valid
+		bots = append(bots, b)
+	}
+
+	return bots, rows.Err()
+}
+
+func IsReferenceBot(username string) bool {
+	var count int
+	err := db.queryRow("SELECT COUNT(*) FROM reference_bots WHERE username = ?", username).Scan(&count)
+	return err == nil && count > 0
+}
+
+// GetPinnedRatings maps active submission IDs of pinned bots to their fixed rating
+func (s *SQLStore) GetPinnedRatings() (map[int]float64, error) {
+	rows, err := s.query(`
+		SELECT s.id, rb.pinned_rating
+		FROM submissions s
+		JOIN reference_bots rb ON rb.username = s.username
+		WHERE s.is_active = 1 AND rb.pinned_rating IS NOT NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pinned := make(map[int]float64)
+	for rows.Next() {
+		var id int
+		var rating float64
+		if err := rows.Scan(&id, &rating); err != nil {
+			return nil, err
+		}
+		pinned[id] = rating
+	}
+
+	return pinned, rows.Err()
+}
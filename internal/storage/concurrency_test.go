@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// useFileDB points the package-level functions at a fresh SQLite file, which
+// runs in WAL mode like a real server's
+func useFileDB(t *testing.T) *SQLStore {
+	t.Helper()
+	s, err := InitDB(filepath.Join(t.TempDir(), "arena.db"))
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	Use(s)
+	t.Cleanup(func() {
+		s.Close()
+		Use(nil)
+	})
+
+	var mode string
+	if err := s.queryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Fatalf("journal mode is %q, want wal", mode)
+	}
+	return s
+}
+
+// TestConcurrentUploadsMatchesAndReads has uploads, status changes and match
+// results land while the leaderboard and submissions are read, as they do
+// when the worker runs beside the web handlers. Run it with -race.
+func TestConcurrentUploadsMatchesAndReads(t *testing.T) {
+	s := useFileDB(t)
+
+	const (
+		players      = 6
+		uploadsEach  = 4
+		churnWriters = 4
+		churnUploads = 5
+		readers      = 4
+	)
+
+	var (
+		failures atomic.Int32
+		maxID    atomic.Int64
+	)
+	fail := func(format string, args ...interface{}) {
+		failures.Add(1)
+		t.Errorf(format, args...)
+	}
+
+	// Readers hammer the read paths until the writers are done
+	stop := make(chan struct{})
+	var readWG sync.WaitGroup
+	for r := 0; r < readers; r++ {
+		readWG.Add(1)
+		go func(r int) {
+			defer readWG.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := QueryLeaderboard(LeaderboardQuery{Limit: 50, SortBy: SortByRating}); err != nil {
+					fail("reader %d: QueryLeaderboard: %v", r, err)
+					return
+				}
+				if n := maxID.Load(); n > 0 {
+					if _, err := GetSubmissionByID(int(int64(i)%n) + 1); err != nil {
+						fail("reader %d: GetSubmissionByID: %v", r, err)
+						return
+					}
+				}
+			}
+		}(r)
+	}
+
+	upload := func(username string) (int, bool) {
+		id, err := AddSubmission(0, username, "memory_functions_"+username+".cpp", "", nil)
+		if err != nil {
+			fail("AddSubmission(%s): %v", username, err)
+			return 0, false
+		}
+		for {
+			n := maxID.Load()
+			if id <= n || maxID.CompareAndSwap(n, id) {
+				break
+			}
+		}
+		if err := UpdateSubmissionStatus(int(id), "completed"); err != nil {
+			fail("UpdateSubmissionStatus(%d): %v", id, err)
+			return 0, false
+		}
+		return int(id), true
+	}
+
+	// Every player uploads a few times, each upload replacing the last, while
+	// several writers upload for the same churn account at once
+	active := make([]int, players)
+	var writeWG sync.WaitGroup
+	for p := 0; p < players; p++ {
+		writeWG.Add(1)
+		go func(p int) {
+			defer writeWG.Done()
+			for u := 0; u < uploadsEach; u++ {
+				if id, ok := upload(fmt.Sprintf("player%d", p)); ok {
+					active[p] = id
+				}
+			}
+		}(p)
+	}
+	for w := 0; w < churnWriters; w++ {
+		writeWG.Add(1)
+		go func() {
+			defer writeWG.Done()
+			for u := 0; u < churnUploads; u++ {
+				upload("churn")
+			}
+		}()
+	}
+	writeWG.Wait()
+
+	// Every pair of final submissions plays once, while churn keeps uploading
+	var matchWG sync.WaitGroup
+	for i := 0; i < players; i++ {
+		for j := i + 1; j < players; j++ {
+			matchWG.Add(1)
+			go func(p1, p2 int) {
+				defer matchWG.Done()
+				if _, err := AddMatch(p1, p2, p1, 600, 400, 50, 55, nil); err != nil {
+					fail("AddMatch(%d, %d): %v", p1, p2, err)
+				}
+			}(active[i], active[j])
+		}
+	}
+	for w := 0; w < churnWriters; w++ {
+		matchWG.Add(1)
+		go func() {
+			defer matchWG.Done()
+			upload("churn")
+		}()
+	}
+	matchWG.Wait()
+	close(stop)
+	readWG.Wait()
+	if failures.Load() > 0 {
+		t.FailNow()
+	}
+
+	pairs := players * (players - 1) / 2
+	totalUploads := players*uploadsEach + churnWriters*churnUploads + churnWriters
+	if got := countRows(t, s, "submissions"); got != totalUploads {
+		t.Errorf("%d submissions stored, want %d", got, totalUploads)
+	}
+	var activeCount, churnActive, validMatches int
+	if err := s.queryRow("SELECT COUNT(*) FROM submissions WHERE is_active = 1").Scan(&activeCount); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.queryRow("SELECT COUNT(*) FROM submissions WHERE is_active = 1 AND username = 'churn'").Scan(&churnActive); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.queryRow("SELECT COUNT(*) FROM matches WHERE is_valid = 1").Scan(&validMatches); err != nil {
+		t.Fatal(err)
+	}
+	if activeCount != players+1 || churnActive != 1 {
+		t.Errorf("%d active submissions (%d for churn), want %d (1 for churn)", activeCount, churnActive, players+1)
+	}
+	if validMatches != pairs {
+		t.Errorf("%d valid matches, want %d", validMatches, pairs)
+	}
+
+	entries, err := QueryLeaderboard(LeaderboardQuery{Limit: 50, SortBy: SortByRating})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != players+1 {
+		t.Fatalf("leaderboard has %d entries, want %d", len(entries), players+1)
+	}
+	var wins, losses int
+	for _, e := range entries {
+		wins += e.Wins
+		losses += e.Losses
+		if e.Username == "churn" {
+			if !e.IsPending || e.Wins+e.Losses != 0 {
+				t.Errorf("churn = %+v, want pending with no games", e)
+			}
+			continue
+		}
+		if e.Wins+e.Losses != (players-1)*1000 {
+			t.Errorf("%s played %d games, want %d", e.Username, e.Wins+e.Losses, (players-1)*1000)
+		}
+	}
+	if wins != pairs*600+pairs*400 || losses != wins {
+		t.Errorf("leaderboard totals %d wins and %d losses, want %d each", wins, losses, pairs*1000)
+	}
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// copyTables is every table Copy moves, parents before the rows that point
+// at them
+var copyTables = []string{
+	"seasons",
+	"arenas",
+	"users",
+	"user_keys",
+	"roster",
+	"invite_codes",
+	"arena_members",
+	"reference_bots",
+	"submissions",
+	"submission_files",
+	"matches",
+	"match_details",
+	"match_replays",
+	"rating_history",
+	"benchmarks",
+	"tournaments",
+	"bracket_matches",
+	"season_standings",
+	"jobs",
+	"submission_logs",
+	"audit_log",
+	"admin_login_tokens",
+	"admin_sessions",
+}
+
+// CopiedTable is how many rows Copy moved for one table
+type CopiedTable struct {
+	Name string
+	Rows int
+}
+
+// Copy moves every row from src to dst, which may be different kinds of
+// database. src must be fully migrated. dst is migrated first and must then
+// be empty, so a copy never merges two arenas. It runs in one transaction on
+// dst, which is left untouched if anything fails.
+func Copy(src, dst *SQLStore) ([]CopiedTable, error) {
+	states, err := MigrationStatus(src)
+	if err != nil {
+		return nil, fmt.Errorf("source: %v", err)
+	}
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			return nil, fmt.Errorf("source is missing migration %d (%s); run migrate up on it first", s.Version, s.Name)
+		}
+	}
+	if _, err := Migrate(dst); err != nil {
+		return nil, fmt.Errorf("destination: %v", err)
+	}
+
+	for _, table := range copyTables {
+		var n int
+		if err := dst.queryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+			return nil, fmt.Errorf("destination: %v", err)
+		}
+		if n > 0 {
+			return nil, fmt.Errorf("destination is not empty: %s has %d rows", table, n)
+		}
+	}
+
+	tx, err := dst.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var copied []CopiedTable
+	for _, table := range copyTables {
+		n, err := copyTable(src, tx, table)
+		if err != nil {
+			return nil, fmt.Errorf("copying %s: %v", table, err)
+		}
+		copied = append(copied, CopiedTable{Name: table, Rows: n})
+	}
+	return copied, tx.Commit()
+}
+
+// copyTable copies the columns a table has on both sides. Old SQLite files
+// gained some columns through ALTER TABLE, so their order can differ.
+func copyTable(src *SQLStore, tx *sqlTx, table string) (int, error) {
+	dstColumns, err := tableColumns(tx.query("SELECT * FROM " + table + " WHERE 1 = 0"))
+	if err != nil {
+		return 0, err
+	}
+	srcColumns, err := tableColumns(src.query("SELECT * FROM " + table + " WHERE 1 = 0"))
+	if err != nil {
+		return 0, err
+	}
+	var columns []string
+	for _, c := range srcColumns {
+		if contains(dstColumns, c) {
+			columns = append(columns, `"`+c+`"`)
+		}
+	}
+
+	rows, err := src.query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), table))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		table, strings.Join(columns, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return n, err
+		}
+		// Text can come back as bytes, which PostgreSQL would take for bytea
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		if _, err := tx.exec(insert, values...); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+
+	// Rows kept their IDs, so PostgreSQL's sequence has to catch up; SQLite
+	// moves AUTOINCREMENT past explicit IDs by itself
+	if tx.dialect == dialectPostgres && contains(columns, `"id"`) {
+		_, err := tx.exec(fmt.Sprintf(
+			"SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %s", table, table))
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func tableColumns(rows *sql.Rows, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -2,14 +2,13 @@ package storage
 
 import (
 	"database/sql"
+	"fmt"
 	"math"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var DB *sql.DB
-
 type LeaderboardEntry struct {
 	Username   string
 	Wins       int
@@ -22,6 +21,26 @@ type LeaderboardEntry struct {
 	LastPlayed time.Time
 	IsPending  bool
 	IsBroken   bool
+
+	// Solo benchmark: average shots to sink every ship on the shared board set
+	BenchmarkShots    float64
+	BenchmarkBoardSet string
+	HasBenchmark      bool
+
+	IsBot bool
+}
+
+// Leaderboard sort orders
+const (
+	SortByRating    = "rating"
+	SortByBenchmark = "benchmark"
+)
+
+type LeaderboardQuery struct {
+	ArenaID  int // 0 selects the default arena
+	Limit    int
+	SortBy   string
+	HideBots bool
 }
 
 type Submission struct {
@@ -31,6 +50,22 @@ type Submission struct {
 	UploadTime time.Time
 	Status     string
 	IsActive   bool
+	ArenaID    int
+
+	// ContentHash is the SHA-256 of the uploaded source, which is kept under
+	// that name so old versions survive later uploads. It's empty for
+	// submissions from before sources were kept.
+	ContentHash string
+	// RestoredFrom is the submission this one was restored from, or 0
+	RestoredFrom int
+}
+
+// SubmissionFile is one file of a submission uploaded as an archive or a
+// directory, kept under its content hash like a single source. Filename is
+// the entrypoint at the top of those files.
+type SubmissionFile struct {
+	Path        string
+	ContentHash string
 }
 
 type SubmissionWithStats struct {
@@ -43,6 +78,9 @@ type SubmissionWithStats struct {
 	AvgMoves   float64
 	LastPlayed time.Time
 	HasMatches bool
+
+	BenchmarkShots float64
+	HasBenchmark   bool
 }
 
 type Tournament struct {
@@ -51,6 +89,7 @@ type Tournament struct {
 	Status       string
 	CurrentRound int
 	WinnerID     int
+	ArenaID      int
 }
 
 type BracketMatch struct {
@@ -85,115 +124,56 @@ type RatingHistoryPoint struct {
 	MatchID    int
 }
 
-func InitDB(path string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", path+"?parseTime=true")
+// InitDB opens the database named by dsn, brings its schema up to date and
+// seeds the rows every server expects
+func InitDB(dsn string) (*SQLStore, error) {
+	s, err := Open(dsn)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := Migrate(s); err != nil {
+		return s, err
+	}
 
-	schema := `
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT UNIQUE NOT NULL,
-		name TEXT NOT NULL,
-		bio TEXT,
-		link TEXT,
-		public_key TEXT UNIQUE NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		last_login_at TIMESTAMP
-	);
-
-	CREATE TABLE IF NOT EXISTS submissions (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT NOT NULL,
-		filename TEXT NOT NULL,
-		upload_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		status TEXT DEFAULT 'pending',
-		is_active BOOLEAN DEFAULT 1,
-		glicko_rating REAL DEFAULT 1500.0,
-		glicko_rd REAL DEFAULT 350.0,
-		glicko_volatility REAL DEFAULT 0.06
-	);
-
-	CREATE TABLE IF NOT EXISTS tournaments (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		status TEXT DEFAULT 'active',
-		current_round INTEGER DEFAULT 1,
-		winner_id INTEGER,
-		FOREIGN KEY (winner_id) REFERENCES submissions(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS bracket_matches (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		tournament_id INTEGER,
-		round INTEGER,
-		position INTEGER,
-		player1_id INTEGER,
-		player2_id INTEGER,
-		winner_id INTEGER,
-		player1_wins INTEGER DEFAULT 0,
-		player2_wins INTEGER DEFAULT 0,
-		player1_moves INTEGER,
-		player2_moves INTEGER,
-		status TEXT DEFAULT 'pending',
-		timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (tournament_id) REFERENCES tournaments(id),
-		FOREIGN KEY (player1_id) REFERENCES submissions(id),
-		FOREIGN KEY (player2_id) REFERENCES submissions(id),
-		FOREIGN KEY (winner_id) REFERENCES submissions(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS matches (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		player1_id INTEGER,
-		player2_id INTEGER,
-		winner_id INTEGER,
-		player1_wins INTEGER DEFAULT 0,
-		player2_wins INTEGER DEFAULT 0,
-		player1_moves INTEGER,
-		player2_moves INTEGER,
-		is_valid BOOLEAN DEFAULT 1,
-		timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (player1_id) REFERENCES submissions(id),
-		FOREIGN KEY (player2_id) REFERENCES submissions(id),
-		FOREIGN KEY (winner_id) REFERENCES submissions(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS rating_history (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		submission_id INTEGER NOT NULL,
-		rating REAL NOT NULL,
-		rd REAL NOT NULL,
-		volatility REAL NOT NULL,
-		match_id INTEGER,
-		timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		FOREIGN KEY (submission_id) REFERENCES submissions(id),
-		FOREIGN KEY (match_id) REFERENCES matches(id)
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_bracket_matches_tournament ON bracket_matches(tournament_id);
-	CREATE INDEX IF NOT EXISTS idx_bracket_matches_status ON bracket_matches(status);
-	CREATE INDEX IF NOT EXISTS idx_tournaments_status ON tournaments(status);
-	CREATE INDEX IF NOT EXISTS idx_matches_player1 ON matches(player1_id);
-	CREATE INDEX IF NOT EXISTS idx_matches_player2 ON matches(player2_id);
-	CREATE INDEX IF NOT EXISTS idx_matches_valid ON matches(is_valid);
-	CREATE INDEX IF NOT EXISTS idx_submissions_username ON submissions(username);
-	CREATE INDEX IF NOT EXISTS idx_submissions_status ON submissions(status);
-	CREATE INDEX IF NOT EXISTS idx_submissions_active ON submissions(is_active);
-	CREATE UNIQUE INDEX IF NOT EXISTS idx_matches_unique_pair ON matches(player1_id, player2_id, is_valid) WHERE is_valid = 1;
-	CREATE INDEX IF NOT EXISTS idx_rating_history_submission ON rating_history(submission_id, timestamp);
-	`
-
-	_, err = db.Exec(schema)
-	return db, err
+	if err := ensureUserKeys(s); err != nil {
+		return s, err
+	}
+	if err := ensureDefaultArena(s); err != nil {
+		return s, err
+	}
+	return s, ensureCurrentSeason(s)
 }
 
 func GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
+	return QueryLeaderboard(LeaderboardQuery{Limit: limit, SortBy: SortByRating})
+}
+
+// latestBenchmarkJoin attaches each submission's benchmark result on the
+// board set passed as its argument. Results from older board sets aren't
+// comparable, so a submission not yet re-benchmarked shows none.
+const latestBenchmarkJoin = `LEFT JOIN benchmarks b ON b.id = (SELECT id FROM benchmarks WHERE submission_id = s.id AND board_set = ? ORDER BY id DESC LIMIT 1)`
+
+func (s *SQLStore) QueryLeaderboard(q LeaderboardQuery) ([]LeaderboardEntry, error) {
 	// Get submissions with matches
 	// Rankings use Glicko-2 with proper rating periods:
 	// - All round-robin matches are batched together before rating updates
 	// - This prevents last-submitter bias from path-dependent rating changes
+	orderBy := "is_broken ASC, is_pending ASC, rating DESC, total_wins DESC, avg_moves ASC"
+	if q.SortBy == SortByBenchmark {
+		// Fewest shots first; submissions still waiting on a benchmark sink to the bottom
+		orderBy = "is_broken ASC, no_benchmark ASC, benchmark_shots ASC, rating DESC"
+	}
+
+	arenaID, err := s.resolveArenaID(q.ArenaID)
+	if err != nil {
+		return nil, err
+	}
+	
+	botFilter := "AND s.arena_id = ?"
+	if q.HideBots {
+		botFilter += " AND s.username NOT IN (SELECT username FROM reference_bots)"
+	}
+
 	query := `
 	SELECT 
 		s.username,
@@ -204,11 +184,16 @@ func GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
 		AVG(CASE WHEN m.player1_id = s.id THEN m.player1_moves ELSE m.player2_moves END) as avg_moves,
 		MAX(m.timestamp) as last_played,
 		0 as is_pending,
-		0 as is_broken
+		0 as is_broken,
+		COALESCE(b.avg_shots, 0) as benchmark_shots,
+		COALESCE(b.board_set, '') as board_set,
+		CASE WHEN b.id IS NULL THEN 1 ELSE 0 END as no_benchmark,
+		EXISTS(SELECT 1 FROM reference_bots rb WHERE rb.username = s.username) as is_bot
 	FROM submissions s
 	LEFT JOIN matches m ON (m.player1_id = s.id OR m.player2_id = s.id) AND m.is_valid = 1
-	WHERE s.is_active = 1 AND s.status NOT IN ('compilation_failed')
-	GROUP BY s.username, s.glicko_rating, s.glicko_rd
+	` + latestBenchmarkJoin + `
+	WHERE s.is_active = 1 AND s.status NOT IN ('compilation_failed') ` + botFilter + `
+	GROUP BY s.username, s.glicko_rating, s.glicko_rd, b.id
 	HAVING COUNT(m.id) > 0
 	
 	UNION ALL
@@ -222,11 +207,16 @@ func GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
 		999.0 as avg_moves,
 		s.upload_time as last_played,
 		1 as is_pending,
-		0 as is_broken
+		0 as is_broken,
+		COALESCE(b.avg_shots, 0) as benchmark_shots,
+		COALESCE(b.board_set, '') as board_set,
+		CASE WHEN b.id IS NULL THEN 1 ELSE 0 END as no_benchmark,
+		EXISTS(SELECT 1 FROM reference_bots rb WHERE rb.username = s.username) as is_bot
 	FROM submissions s
 	LEFT JOIN matches m ON (m.player1_id = s.id OR m.player2_id = s.id) AND m.is_valid = 1
-	WHERE s.is_active = 1 AND s.status IN ('pending', 'testing', 'completed')
-	GROUP BY s.username, s.upload_time
+	` + latestBenchmarkJoin + `
+	WHERE s.is_active = 1 AND s.status IN ('pending', 'testing', 'completed') ` + botFilter + `
+	GROUP BY s.username, s.upload_time, b.id
 	HAVING COUNT(m.id) = 0
 	
 	UNION ALL
@@ -240,15 +230,19 @@ func GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
 		999.0 as avg_moves,
 		s.upload_time as last_played,
 		0 as is_pending,
-		1 as is_broken
+		1 as is_broken,
+		0 as benchmark_shots,
+		'' as board_set,
+		1 as no_benchmark,
+		EXISTS(SELECT 1 FROM reference_bots rb WHERE rb.username = s.username) as is_bot
 	FROM submissions s
-	WHERE s.is_active = 1 AND s.status = 'compilation_failed'
+	WHERE s.is_active = 1 AND s.status = 'compilation_failed' ` + botFilter + `
 	
-	ORDER BY is_broken ASC, is_pending ASC, rating DESC, total_wins DESC, avg_moves ASC
+	ORDER BY ` + orderBy + `
 	LIMIT ?
 	`
 
-	rows, err := DB.Query(query, limit)
+	rows, err := s.query(query, BoardSetVersion, arenaID, BoardSetVersion, arenaID, arenaID, noLimit(q.Limit))
 	if err != nil {
 		return nil, err
 	}
@@ -259,8 +253,9 @@ func GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
 		var e LeaderboardEntry
 		var lastPlayed string
 		var rating, rd float64
-		var isPending, isBroken int
-		err := rows.Scan(&e.Username, &rating, &rd, &e.Wins, &e.Losses, &e.AvgMoves, &lastPlayed, &isPending, &isBroken)
+		var isPending, isBroken, noBenchmark int
+		err := rows.Scan(&e.Username, &rating, &rd, &e.Wins, &e.Losses, &e.AvgMoves, &lastPlayed, &isPending, &isBroken,
+			&e.BenchmarkShots, &e.BenchmarkBoardSet, &noBenchmark, &e.IsBot)
 		if err != nil {
 			return nil, err
 		}
@@ -269,67 +264,179 @@ func GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
 		e.RD = int(rd)
 		e.IsPending = isPending == 1
 		e.IsBroken = isBroken == 1
+		e.HasBenchmark = noBenchmark == 0
 		
 		totalGames := e.Wins + e.Losses
 		if totalGames > 0 {
 			e.WinPct = float64(e.Wins) / float64(totalGames) * 100.0
 		}
 		
-		e.LastPlayed, _ = time.Parse("2006-01-02 15:04:05", lastPlayed)
+		e.LastPlayed = parseDBTime(lastPlayed)
 		entries = append(entries, e)
 	}
 
 	return entries, rows.Err()
 }
 
-func AddSubmission(username, filename string) (int64, error) {
-	_, err := DB.Exec(
+// resolveArenaID maps the zero arena ID onto the default arena
+func (s *SQLStore) resolveArenaID(arenaID int) (int, error) {
+	if arenaID != 0 {
+		return arenaID, nil
+	}
+	err := s.queryRow("SELECT id FROM arenas WHERE slug = ?", DefaultArenaSlug).Scan(&arenaID)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("default arena %q is missing", DefaultArenaSlug)
+	}
+	return arenaID, err
+}
+
+// AddSubmission records a new upload, with its files if it has more than
+// one, and its compile job, replacing the user's previous submission in the
+// same arena. It is one transaction, so concurrent uploads can't leave a user
+// with two active submissions or one that is never compiled.
+func (s *SQLStore) AddSubmission(arenaID int, username, filename, contentHash string, files []SubmissionFile) (int64, error) {
+	return s.addSubmission(arenaID, username, filename, contentHash, files, 0)
+}
+
+// RestoreSubmission makes an older version of a submission active again, as
+// a new submission with the same source that is tested from scratch
+func (s *SQLStore) RestoreSubmission(id int) (int64, error) {
+	old, err := s.GetSubmissionByID(id)
+	if err != nil {
+		return 0, err
+	}
+	if old.ContentHash == "" {
+		return 0, fmt.Errorf("submission %d was uploaded before sources were kept and can't be restored", id)
+	}
+	files, err := s.GetSubmissionFiles(id)
+	if err != nil {
+		return 0, err
+	}
+	return s.addSubmission(old.ArenaID, old.Username, old.Filename, old.ContentHash, files, old.ID)
+}
+
+// GetSubmissionFiles lists a multi-file submission's files by path; it is
+// empty for a single source
+func (s *SQLStore) GetSubmissionFiles(submissionID int) ([]SubmissionFile, error) {
+	rows, err := s.query("SELECT path, content_hash FROM submission_files WHERE submission_id = ? ORDER BY path", submissionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []SubmissionFile
+	for rows.Next() {
+		var f SubmissionFile
+		if err := rows.Scan(&f.Path, &f.ContentHash); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+func (s *SQLStore) addSubmission(arenaID int, username, filename, contentHash string, files []SubmissionFile, restoredFrom int) (int64, error) {
+	seasonID, err := s.currentSeasonID()
+	if err != nil {
+		return 0, err
+	}
+	arenaID, err = s.resolveArenaID(arenaID)
+	if err != nil {
+		return 0, err
+	}
+	
+	tx, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	
+	_, err = tx.exec(
 		`UPDATE matches SET is_valid = 0 
-		 WHERE player1_id IN (SELECT id FROM submissions WHERE username = ?)
-		 OR player2_id IN (SELECT id FROM submissions WHERE username = ?)`,
-		username, username,
+		 WHERE season_id = ?
+		 AND (player1_id IN (SELECT id FROM submissions WHERE username = ? AND arena_id = ?)
+		 OR player2_id IN (SELECT id FROM submissions WHERE username = ? AND arena_id = ?))`,
+		seasonID, username, arenaID, username, arenaID,
 	)
 	if err != nil {
 		return 0, err
 	}
 	
-	_, err = DB.Exec(
-		"UPDATE submissions SET is_active = 0 WHERE username = ?",
-		username,
+	_, err = tx.exec(
+		"UPDATE submissions SET is_active = 0 WHERE username = ? AND arena_id = ?",
+		username, arenaID,
 	)
 	if err != nil {
 		return 0, err
 	}
 	
-	result, err := DB.Exec(
-		"INSERT INTO submissions (username, filename, is_active, glicko_rating, glicko_rd, glicko_volatility) VALUES (?, ?, 1, 1500.0, 350.0, 0.06)",
-		username, filename,
+	var restored interface{}
+	if restoredFrom != 0 {
+		restored = restoredFrom
+	}
+	id, err := tx.insert(
+		"INSERT INTO submissions (username, filename, is_active, glicko_rating, glicko_rd, glicko_volatility, season_id, arena_id, content_hash, restored_from) VALUES (?, ?, 1, 1500.0, 350.0, 0.06, ?, ?, ?, ?)",
+		username, filename, seasonID, arenaID, contentHash, restored,
 	)
 	if err != nil {
+		if isUniqueViolation(err) {
+			err = fmt.Errorf("another upload by %s is being saved; try again", username)
+		}
+		return 0, err
+	}
+	
+	for _, f := range files {
+		if _, err := tx.exec("INSERT INTO submission_files (submission_id, path, content_hash) VALUES (?, ?, ?)", id, f.Path, f.ContentHash); err != nil {
+			return 0, err
+		}
+	}
+	
+	if _, err := enqueueJob(tx, JobCompile, CompileJobKey(int(id)), CompilePayload{SubmissionID: int(id)}); err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	
+	// Queueing the compile job wakes the worker
+	wakeWorker()
+	return id, nil
 }
 
-func AddMatch(player1ID, player2ID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves int) (int64, error) {
-	result, err := DB.Exec(
-		"INSERT INTO matches (player1_id, player2_id, winner_id, player1_wins, player2_wins, player1_moves, player2_moves) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		player1ID, player2ID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves,
+// AddMatch records a head-to-head and, unless details is nil, how it was
+// played
+func (s *SQLStore) AddMatch(player1ID, player2ID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves int, details *MatchDetails) (int64, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	
+	// Matches belong to the season of the submissions that played them
+	id, err := tx.insert(
+		`INSERT INTO matches (player1_id, player2_id, winner_id, player1_wins, player2_wins, player1_moves, player2_moves, season_id)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, (SELECT season_id FROM submissions WHERE id = ?))`,
+		player1ID, player2ID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves, player1ID,
 	)
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	if details != nil {
+		if err := addMatchDetails(tx, id, details); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
 }
 
-func UpdateSubmissionStatus(id int, status string) error {
-	_, err := DB.Exec("UPDATE submissions SET status = ? WHERE id = ?", status, id)
+func (s *SQLStore) UpdateSubmissionStatus(id int, status string) error {
+	_, err := s.exec("UPDATE submissions SET status = ? WHERE id = ?", status, id)
 	return err
 }
 
-func GetPendingSubmissions() ([]Submission, error) {
-	rows, err := DB.Query(
-		"SELECT id, username, filename, upload_time, status FROM submissions WHERE status = 'pending' AND is_active = 1 ORDER BY upload_time",
+func (s *SQLStore) GetPendingSubmissions() ([]Submission, error) {
+	rows, err := s.query(
+		"SELECT id, username, filename, upload_time, status, arena_id, COALESCE(content_hash, ''), COALESCE(restored_from, 0) FROM submissions WHERE status = 'pending' AND is_active = 1 ORDER BY upload_time",
 	)
 	if err != nil {
 		return nil, err
@@ -338,20 +445,21 @@ func GetPendingSubmissions() ([]Submission, error) {
 
 	var submissions []Submission
 	for rows.Next() {
-		var s Submission
-		err := rows.Scan(&s.ID, &s.Username, &s.Filename, &s.UploadTime, &s.Status)
+		var sub Submission
+		err := rows.Scan(&sub.ID, &sub.Username, &sub.Filename, &sub.UploadTime, &sub.Status, &sub.ArenaID, &sub.ContentHash, &sub.RestoredFrom)
 		if err != nil {
 			return nil, err
 		}
-		submissions = append(submissions, s)
+		submissions = append(submissions, sub)
 	}
 
 	return submissions, rows.Err()
 }
 
-func GetActiveSubmissions() ([]Submission, error) {
-	rows, err := DB.Query(
-		"SELECT id, username, filename, upload_time, status FROM submissions WHERE is_active = 1 AND status = 'completed' ORDER BY username",
+func (s *SQLStore) GetActiveSubmissions(arenaID int) ([]Submission, error) {
+	rows, err := s.query(
+		"SELECT id, username, filename, upload_time, status, arena_id, COALESCE(content_hash, ''), COALESCE(restored_from, 0) FROM submissions WHERE is_active = 1 AND status = 'completed' AND arena_id = ? ORDER BY username",
+		arenaID,
 	)
 	if err != nil {
 		return nil, err
@@ -360,20 +468,20 @@ func GetActiveSubmissions() ([]Submission, error) {
 
 	var submissions []Submission
 	for rows.Next() {
-		var s Submission
-		err := rows.Scan(&s.ID, &s.Username, &s.Filename, &s.UploadTime, &s.Status)
+		var sub Submission
+		err := rows.Scan(&sub.ID, &sub.Username, &sub.Filename, &sub.UploadTime, &sub.Status, &sub.ArenaID, &sub.ContentHash, &sub.RestoredFrom)
 		if err != nil {
 			return nil, err
 		}
-		submissions = append(submissions, s)
+		submissions = append(submissions, sub)
 	}
 
 	return submissions, rows.Err()
 }
 
-func GetUserSubmissions(username string) ([]Submission, error) {
-	rows, err := DB.Query(
-		"SELECT id, username, filename, upload_time, status, is_active FROM submissions WHERE username = ? ORDER BY upload_time DESC LIMIT 10",
+func (s *SQLStore) GetUserSubmissions(username string) ([]Submission, error) {
+	rows, err := s.query(
+		"SELECT id, username, filename, upload_time, status, is_active, arena_id, COALESCE(content_hash, ''), COALESCE(restored_from, 0) FROM submissions WHERE username = ? ORDER BY upload_time DESC, id DESC LIMIT 10",
 		username,
 	)
 	if err != nil {
@@ -383,18 +491,25 @@ func GetUserSubmissions(username string) ([]Submission, error) {
 
 	var submissions []Submission
 	for rows.Next() {
-		var s Submission
-		err := rows.Scan(&s.ID, &s.Username, &s.Filename, &s.UploadTime, &s.Status, &s.IsActive)
+		var sub Submission
+		err := rows.Scan(&sub.ID, &sub.Username, &sub.Filename, &sub.UploadTime, &sub.Status, &sub.IsActive, &sub.ArenaID, &sub.ContentHash, &sub.RestoredFrom)
 		if err != nil {
 			return nil, err
 		}
-		submissions = append(submissions, s)
+		submissions = append(submissions, sub)
 	}
 
 	return submissions, rows.Err()
 }
 
-func GetUserSubmissionsWithStats(username string) ([]SubmissionWithStats, error) {
+// GetUserSubmissionsWithStats returns a user's submissions in an arena,
+// newest first, up to limit of them or all if limit is negative
+func (s *SQLStore) GetUserSubmissionsWithStats(arenaID int, username string, limit int) ([]SubmissionWithStats, error) {
+	arenaID, err := s.resolveArenaID(arenaID)
+	if err != nil {
+		return nil, err
+	}
+	
 	query := `
 	SELECT 
 		s.id,
@@ -403,22 +518,27 @@ func GetUserSubmissionsWithStats(username string) ([]SubmissionWithStats, error)
 		s.upload_time,
 		s.status,
 		s.is_active,
+		s.arena_id,
+		COALESCE(s.content_hash, ''),
+		COALESCE(s.restored_from, 0),
 		COALESCE(s.glicko_rating, 1500.0) as rating,
 		COALESCE(s.glicko_rd, 350.0) as rd,
 		COALESCE(SUM(CASE WHEN m.player1_id = s.id THEN m.player1_wins WHEN m.player2_id = s.id THEN m.player2_wins ELSE 0 END), 0) as total_wins,
 		COALESCE(SUM(CASE WHEN m.player1_id = s.id THEN m.player2_wins WHEN m.player2_id = s.id THEN m.player1_wins ELSE 0 END), 0) as total_losses,
 		COALESCE(AVG(CASE WHEN m.player1_id = s.id THEN m.player1_moves ELSE m.player2_moves END), 0) as avg_moves,
 		MAX(m.timestamp) as last_played,
-		COUNT(m.id) as match_count
+		COUNT(m.id) as match_count,
+		b.avg_shots as benchmark_shots
 	FROM submissions s
 	LEFT JOIN matches m ON (m.player1_id = s.id OR m.player2_id = s.id) AND m.is_valid = 1
-	WHERE s.username = ?
-	GROUP BY s.id, s.username, s.filename, s.upload_time, s.status, s.is_active, s.glicko_rating, s.glicko_rd
-	ORDER BY s.upload_time DESC
-	LIMIT 10
+	` + latestBenchmarkJoin + `
+	WHERE s.username = ? AND s.arena_id = ?
+	GROUP BY s.id, s.username, s.filename, s.upload_time, s.status, s.is_active, s.content_hash, s.restored_from, s.glicko_rating, s.glicko_rd, b.id
+	ORDER BY s.upload_time DESC, s.id DESC
+	LIMIT ?
 	`
 	
-	rows, err := DB.Query(query, username)
+	rows, err := s.query(query, BoardSetVersion, username, arenaID, noLimit(limit))
 	if err != nil {
 		return nil, err
 	}
@@ -426,50 +546,53 @@ func GetUserSubmissionsWithStats(username string) ([]SubmissionWithStats, error)
 
 	var submissions []SubmissionWithStats
 	for rows.Next() {
-		var s SubmissionWithStats
+		var sub SubmissionWithStats
 		var lastPlayed *string
 		var rating, rd float64
 		var matchCount int
+		var benchmarkShots sql.NullFloat64
 		
 		err := rows.Scan(
-			&s.ID, &s.Username, &s.Filename, &s.UploadTime, &s.Status, &s.IsActive,
-			&rating, &rd, &s.Wins, &s.Losses, &s.AvgMoves, &lastPlayed, &matchCount,
+			&sub.ID, &sub.Username, &sub.Filename, &sub.UploadTime, &sub.Status, &sub.IsActive, &sub.ArenaID,
+			&sub.ContentHash, &sub.RestoredFrom, &rating, &rd, &sub.Wins, &sub.Losses, &sub.AvgMoves, &lastPlayed, &matchCount, &benchmarkShots,
 		)
 		if err != nil {
 			return nil, err
 		}
 		
-		s.Rating = int(rating)
-		s.RD = int(rd)
-		s.HasMatches = matchCount > 0
+		sub.Rating = int(rating)
+		sub.RD = int(rd)
+		sub.HasMatches = matchCount > 0
+		sub.BenchmarkShots = benchmarkShots.Float64
+		sub.HasBenchmark = benchmarkShots.Valid
 		
-		totalGames := s.Wins + s.Losses
+		totalGames := sub.Wins + sub.Losses
 		if totalGames > 0 {
-			s.WinPct = float64(s.Wins) / float64(totalGames) * 100.0
+			sub.WinPct = float64(sub.Wins) / float64(totalGames) * 100.0
 		}
 		
 		if lastPlayed != nil {
-			s.LastPlayed, _ = time.Parse("2006-01-02 15:04:05", *lastPlayed)
+			sub.LastPlayed = parseDBTime(*lastPlayed)
 		}
 		
-		submissions = append(submissions, s)
+		submissions = append(submissions, sub)
 	}
 
 	return submissions, rows.Err()
 }
 
-func GetSubmissionByID(id int) (Submission, error) {
+func (s *SQLStore) GetSubmissionByID(id int) (Submission, error) {
 	var sub Submission
-	err := DB.QueryRow(
-		"SELECT id, username, filename, upload_time, status FROM submissions WHERE id = ?",
+	err := s.queryRow(
+		"SELECT id, username, filename, upload_time, status, is_active, arena_id, COALESCE(content_hash, ''), COALESCE(restored_from, 0) FROM submissions WHERE id = ?",
 		id,
-	).Scan(&sub.ID, &sub.Username, &sub.Filename, &sub.UploadTime, &sub.Status)
+	).Scan(&sub.ID, &sub.Username, &sub.Filename, &sub.UploadTime, &sub.Status, &sub.IsActive, &sub.ArenaID, &sub.ContentHash, &sub.RestoredFrom)
 	return sub, err
 }
 
-func HasMatchBetween(player1ID, player2ID int) (bool, error) {
+func (s *SQLStore) HasMatchBetween(player1ID, player2ID int) (bool, error) {
 	var count int
-	err := DB.QueryRow(
+	err := s.queryRow(
 		`SELECT COUNT(*) FROM matches 
 		 WHERE is_valid = 1 
 		 AND ((player1_id = ? AND player2_id = ?) OR (player1_id = ? AND player2_id = ?))`,
@@ -478,7 +601,12 @@ func HasMatchBetween(player1ID, player2ID int) (bool, error) {
 	return count > 0, err
 }
 
-func GetAllMatches() ([]MatchResult, error) {
+func (s *SQLStore) GetAllMatches(arenaID int) ([]MatchResult, error) {
+	arenaID, err := s.resolveArenaID(arenaID)
+	if err != nil {
+		return nil, err
+	}
+	
 	query := `
 	SELECT 
 		s1.username as player1,
@@ -489,11 +617,11 @@ func GetAllMatches() ([]MatchResult, error) {
 	JOIN submissions s1 ON m.player1_id = s1.id
 	JOIN submissions s2 ON m.player2_id = s2.id
 	JOIN submissions sw ON m.winner_id = sw.id
-	WHERE s1.is_active = 1 AND s2.is_active = 1 AND m.is_valid = 1
+	WHERE s1.is_active = 1 AND s2.is_active = 1 AND m.is_valid = 1 AND s1.arena_id = ?
 	ORDER BY m.timestamp DESC
 	`
 	
-	rows, err := DB.Query(query)
+	rows, err := s.query(query, arenaID)
 	if err != nil {
 		return nil, err
 	}
@@ -512,16 +640,16 @@ func GetAllMatches() ([]MatchResult, error) {
 	return matches, rows.Err()
 }
 
-func RecordRatingHistory(submissionID int, matchID int, rating, rd, volatility float64) error {
-	_, err := DB.Exec(
+func (s *SQLStore) RecordRatingHistory(submissionID int, matchID int, rating, rd, volatility float64) error {
+	_, err := s.exec(
 		"INSERT INTO rating_history (submission_id, match_id, rating, rd, volatility) VALUES (?, ?, ?, ?, ?)",
 		submissionID, matchID, rating, rd, volatility,
 	)
 	return err
 }
 
-func GetRatingHistory(submissionID int) ([]RatingHistoryPoint, error) {
-	rows, err := DB.Query(`
+func (s *SQLStore) GetRatingHistory(submissionID int) ([]RatingHistoryPoint, error) {
+	rows, err := s.query(`
 		SELECT rating, rd, volatility, timestamp, match_id 
 		FROM rating_history 
 		WHERE submission_id = ? 
@@ -552,8 +680,8 @@ func GetRatingHistory(submissionID int) ([]RatingHistoryPoint, error) {
 	return history, rows.Err()
 }
 
-func GetQueuedPlayerNames() []string {
-	rows, err := DB.Query(
+func (s *SQLStore) GetQueuedPlayerNames() []string {
+	rows, err := s.query(
 		"SELECT username FROM submissions WHERE (status = 'pending' OR status = 'testing') AND is_active = 1 ORDER BY upload_time",
 	)
 	if err != nil {
@@ -571,6 +699,126 @@ func GetQueuedPlayerNames() []string {
 	return names
 }
 
+// GetActiveSubmission returns the user's current submission in an arena, or
+// nil if they have none
+func (s *SQLStore) GetActiveSubmission(arenaID int, username string) (*Submission, error) {
+	arenaID, err := s.resolveArenaID(arenaID)
+	if err != nil {
+		return nil, err
+	}
+	var sub Submission
+	err = s.queryRow(
+		"SELECT id, username, filename, upload_time, status, is_active, arena_id, COALESCE(content_hash, ''), COALESCE(restored_from, 0) FROM submissions WHERE username = ? AND is_active = 1 AND arena_id = ?",
+		username, arenaID,
+	).Scan(&sub.ID, &sub.Username, &sub.Filename, &sub.UploadTime, &sub.Status, &sub.IsActive, &sub.ArenaID, &sub.ContentHash, &sub.RestoredFrom)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// MatchRecord is one valid match seen from one player's side
+type MatchRecord struct {
+	MatchID      int
+	OpponentID   int
+	Wins         int
+	OpponentWins int
+}
+
+// GetMatchRecords returns a player's valid matches, oldest first
+func (s *SQLStore) GetMatchRecords(playerID int) ([]MatchRecord, error) {
+	rows, err := s.query(`
+		SELECT 
+			id,
+			CASE WHEN player1_id = ? THEN player2_id ELSE player1_id END as opponent_id,
+			CASE WHEN player1_id = ? THEN player1_wins ELSE player2_wins END as my_wins,
+			CASE WHEN player1_id = ? THEN player2_wins ELSE player1_wins END as opponent_wins
+		FROM matches
+		WHERE (player1_id = ? OR player2_id = ?) AND is_valid = 1
+		ORDER BY timestamp ASC
+	`, playerID, playerID, playerID, playerID, playerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var records []MatchRecord
+	for rows.Next() {
+		var r MatchRecord
+		if err := rows.Scan(&r.MatchID, &r.OpponentID, &r.Wins, &r.OpponentWins); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// GetAverageMoves returns the moves a submission averaged over all its
+// matches, or 0 if it has none
+func (s *SQLStore) GetAverageMoves(submissionID int) (float64, error) {
+	var avgMoves sql.NullFloat64
+	err := s.queryRow(`
+		SELECT AVG(CASE 
+			WHEN m.player1_id = ? THEN m.player1_moves 
+			ELSE m.player2_moves 
+		END)
+		FROM matches m
+		WHERE m.player1_id = ? OR m.player2_id = ?
+	`, submissionID, submissionID, submissionID).Scan(&avgMoves)
+	return avgMoves.Float64, err
+}
+
+func (s *SQLStore) GetRating(submissionID int) (Glicko2Player, error) {
+	var p Glicko2Player
+	err := s.queryRow(
+		"SELECT COALESCE(glicko_rating, 1500.0), COALESCE(glicko_rd, 350.0), COALESCE(glicko_volatility, 0.06) FROM submissions WHERE id = ?",
+		submissionID,
+	).Scan(&p.Rating, &p.RD, &p.Volatility)
+	return p, err
+}
+
+func (s *SQLStore) SetRatings(ratings map[int]Glicko2Player) error {
+	tx, err := s.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	for id, p := range ratings {
+		_, err := tx.exec(
+			"UPDATE submissions SET glicko_rating = ?, glicko_rd = ?, glicko_volatility = ? WHERE id = ?",
+			p.Rating, p.RD, p.Volatility, id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetRatings returns the ratings of every active, compiled submission
+func (s *SQLStore) GetRatings() (map[int]Glicko2Player, error) {
+	rows, err := s.query("SELECT id, glicko_rating, glicko_rd, glicko_volatility FROM submissions WHERE is_active = 1 AND status = 'completed'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	ratings := make(map[int]Glicko2Player)
+	for rows.Next() {
+		var id int
+		var p Glicko2Player
+		if err := rows.Scan(&id, &p.Rating, &p.RD, &p.Volatility); err != nil {
+			return nil, err
+		}
+		ratings[id] = p
+	}
+	return ratings, rows.Err()
+}
+
 // Glicko-2 constants
 const (
 	glickoTau     = 0.5
@@ -691,20 +939,12 @@ func updateGlicko2(player Glicko2Player, results []Glicko2Result) Glicko2Player
 }
 
 func UpdateGlicko2Ratings(player1ID, player2ID, player1Wins, player2Wins int) error {
-	var p1Rating, p1RD, p1Vol, p2Rating, p2RD, p2Vol float64
-	
-	err := DB.QueryRow(
-		"SELECT COALESCE(glicko_rating, 1500.0), COALESCE(glicko_rd, 350.0), COALESCE(glicko_volatility, 0.06) FROM submissions WHERE id = ?",
-		player1ID,
-	).Scan(&p1Rating, &p1RD, &p1Vol)
+	p1, err := GetRating(player1ID)
 	if err != nil {
 		return err
 	}
 	
-	err = DB.QueryRow(
-		"SELECT COALESCE(glicko_rating, 1500.0), COALESCE(glicko_rd, 350.0), COALESCE(glicko_volatility, 0.06) FROM submissions WHERE id = ?",
-		player2ID,
-	).Scan(&p2Rating, &p2RD, &p2Vol)
+	p2, err := GetRating(player2ID)
 	if err != nil {
 		return err
 	}
@@ -713,110 +953,128 @@ func UpdateGlicko2Ratings(player1ID, player2ID, player1Wins, player2Wins int) er
 	player1Score := float64(player1Wins) / float64(totalGames)
 	player2Score := float64(player2Wins) / float64(totalGames)
 	
-	p1 := Glicko2Player{Rating: p1Rating, RD: p1RD, Volatility: p1Vol}
-	p1Results := []Glicko2Result{{OpponentRating: p2Rating, OpponentRD: p2RD, Score: player1Score}}
+	p1Results := []Glicko2Result{{OpponentRating: p2.Rating, OpponentRD: p2.RD, Score: player1Score}}
 	p1New := updateGlicko2(p1, p1Results)
 	
-	p2 := Glicko2Player{Rating: p2Rating, RD: p2RD, Volatility: p2Vol}
-	p2Results := []Glicko2Result{{OpponentRating: p1Rating, OpponentRD: p1RD, Score: player2Score}}
+	p2Results := []Glicko2Result{{OpponentRating: p1.Rating, OpponentRD: p1.RD, Score: player2Score}}
 	p2New := updateGlicko2(p2, p2Results)
 	
-	_, err = DB.Exec(
-		"UPDATE submissions SET glicko_rating = ?, glicko_rd = ?, glicko_volatility = ? WHERE id = ?",
-		p1New.Rating, p1New.RD, p1New.Volatility, player1ID,
-	)
+	return SetRatings(map[int]Glicko2Player{player1ID: p1New, player2ID: p2New})
+}
+
+// RecalculateAllGlicko2Ratings recalculates all Glicko-2 ratings from scratch
+// using proper rating periods where all matches for a player are batched together.
+// The new ratings are worked out in memory and written in one go, so a failure
+// leaves the old ones in place rather than some reset and some not.
+func RecalculateAllGlicko2Ratings() error {
+	initialRatings, pinned, err := initialGlicko2Ratings()
 	if err != nil {
 		return err
 	}
 	
-	_, err = DB.Exec(
-		"UPDATE submissions SET glicko_rating = ?, glicko_rd = ?, glicko_volatility = ? WHERE id = ?",
-		p2New.Rating, p2New.RD, p2New.Volatility, player2ID,
-	)
-	return err
+	// For each player, collect ALL their match results and update once (proper rating period)
+	newRatings := make(map[int]Glicko2Player, len(initialRatings))
+	for playerID, player := range initialRatings {
+		newRatings[playerID] = player
+		if _, ok := pinned[playerID]; ok {
+			continue
+		}
+		if newRatings[playerID], err = periodRating(playerID, initialRatings, 0); err != nil {
+			return err
+		}
+	}
+	
+	return SetRatings(newRatings)
 }
 
-// RecalculateAllGlicko2Ratings recalculates all Glicko-2 ratings from scratch
-// using proper rating periods where all matches for a player are batched together
-func RecalculateAllGlicko2Ratings() error {
-	// Reset all active submissions to initial ratings
-	_, err := DB.Exec(`
-		UPDATE submissions 
-		SET glicko_rating = 1500.0, glicko_rd = 350.0, glicko_volatility = 0.06
-		WHERE is_active = 1 AND status = 'completed'
-	`)
+// initialGlicko2Ratings is where every active submission starts the rating
+// period, and which of them are pinned
+func initialGlicko2Ratings() (map[int]Glicko2Player, map[int]float64, error) {
+	// Reference bots pinned to a fixed rating act as anchors: opponents are
+	// rated against the pin and the bot itself is never updated
+	pinned, err := GetPinnedRatings()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	
-	// Snapshot all player ratings BEFORE any updates (critical for proper rating period)
-	initialRatings := make(map[int]Glicko2Player)
-	rows, err := DB.Query("SELECT id, glicko_rating, glicko_rd, glicko_volatility FROM submissions WHERE is_active = 1 AND status = 'completed'")
+	// Every active submission starts the rating period from the initial rating
+	current, err := GetRatings()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	for rows.Next() {
-		var id int
-		var rating, rd, volatility float64
-		if err := rows.Scan(&id, &rating, &rd, &volatility); err != nil {
-			return err
+	initialRatings := make(map[int]Glicko2Player, len(current))
+	for id := range current {
+		initialRatings[id] = Glicko2Player{Rating: 1500.0, RD: 350.0, Volatility: 0.06}
+		if pin, ok := pinned[id]; ok {
+			initialRatings[id] = Glicko2Player{Rating: pin, RD: pinnedBotRD, Volatility: 0.06}
 		}
-		initialRatings[id] = Glicko2Player{Rating: rating, RD: rd, Volatility: volatility}
 	}
-	rows.Close()
+	return initialRatings, pinned, nil
+}
+
+// periodRating rates a player on all their matches at once, leaving out
+// skipMatchID
+func periodRating(playerID int, initialRatings map[int]Glicko2Player, skipMatchID int) (Glicko2Player, error) {
+	// Collect ALL match results for this player in this rating period
+	records, err := GetMatchRecords(playerID)
+	if err != nil {
+		return Glicko2Player{}, fmt.Errorf("matches of submission %d: %v", playerID, err)
+	}
 	
-	// For each player, collect ALL their match results and update once (proper rating period)
-	for playerID, player := range initialRatings {
-		// Collect ALL match results for this player in this rating period
-		var results []Glicko2Result
+	var results []Glicko2Result
+	for _, record := range records {
+		// Get opponent's rating from initial snapshot (not from DB which may be updated)
+		opponent, ok := initialRatings[record.OpponentID]
+		if !ok || record.MatchID == skipMatchID {
+			continue
+		}
 		
-		rows, err := DB.Query(`
-			SELECT 
-				CASE WHEN player1_id = ? THEN player2_id ELSE player1_id END as opponent_id,
-				CASE WHEN player1_id = ? THEN player1_wins ELSE player2_wins END as my_wins,
-				CASE WHEN player1_id = ? THEN player2_wins ELSE player1_wins END as opponent_wins
-			FROM matches
-			WHERE (player1_id = ? OR player2_id = ?) AND is_valid = 1
-			ORDER BY timestamp ASC
-		`, playerID, playerID, playerID, playerID, playerID)
+		totalGames := record.Wins + record.OpponentWins
+		score := float64(record.Wins) / float64(totalGames)
 		
-		if err != nil {
+		results = append(results, Glicko2Result{
+			OpponentRating: opponent.Rating,
+			OpponentRD:     opponent.RD,
+			Score:          score,
+		})
+	}
+	
+	player := initialRatings[playerID]
+	if len(results) == 0 {
+		return player, nil
+	}
+	return updateGlicko2(player, results), nil
+}
+
+// MatchRatingChanges is how much a match moves each side's rating, keyed by
+// submission ID. Ratings come from one rating period over every match, so
+// this is the rating with the match less the rating without it. Sides that
+// aren't rated, because they were replaced or are pinned, are left out.
+func MatchRatingChanges(match *Match) (map[int]float64, error) {
+	changes := make(map[int]float64)
+	if !match.Valid {
+		return changes, nil
+	}
+	initialRatings, pinned, err := initialGlicko2Ratings()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range []int{match.Player1ID, match.Player2ID} {
+		if _, ok := initialRatings[id]; !ok {
 			continue
 		}
-		
-		for rows.Next() {
-			var opponentID, myWins, opponentWins int
-			if err := rows.Scan(&opponentID, &myWins, &opponentWins); err != nil {
-				continue
-			}
-			
-			// Get opponent's rating from initial snapshot (not from DB which may be updated)
-			opponent, ok := initialRatings[opponentID]
-			if !ok {
-				continue
-			}
-			
-			totalGames := myWins + opponentWins
-			score := float64(myWins) / float64(totalGames)
-			
-			results = append(results, Glicko2Result{
-				OpponentRating: opponent.Rating,
-				OpponentRD:     opponent.RD,
-				Score:          score,
-			})
+		if _, ok := pinned[id]; ok {
+			continue
 		}
-		rows.Close()
-		
-		// Update this player's rating based on ALL results at once (proper rating period)
-		if len(results) > 0 {
-			newPlayer := updateGlicko2(player, results)
-			
-			DB.Exec(
-				"UPDATE submissions SET glicko_rating = ?, glicko_rd = ?, glicko_volatility = ? WHERE id = ?",
-				newPlayer.Rating, newPlayer.RD, newPlayer.Volatility, playerID,
-			)
+		with, err := periodRating(id, initialRatings, 0)
+		if err != nil {
+			return nil, err
+		}
+		without, err := periodRating(id, initialRatings, match.ID)
+		if err != nil {
+			return nil, err
 		}
+		changes[id] = with.Rating - without.Rating
 	}
-	
-	return nil
+	return changes, nil
 }
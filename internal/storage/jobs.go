@@ -0,0 +1,425 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Job types the worker knows how to run
+const (
+	JobCompile         = "compile"          // compile a submission, then fan out its other jobs
+	JobRoundRobinPair  = "round_robin_pair" // one head-to-head between two submissions
+	JobTournamentMatch = "tournament_match" // one bracket match
+	JobBenchmark       = "benchmark"        // solo benchmark against the shared board set
+)
+
+// Job states. A job that keeps failing ends up "dead" and stays there until
+// an admin retries it.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobDead    = "dead"
+)
+
+// DefaultJobAttempts is how many times a job runs before it is dead-lettered
+const DefaultJobAttempts = 3
+
+type Job struct {
+	ID           int
+	Type         string
+	Key          string // identifies the work, so it is never queued twice
+	Payload      string // JSON arguments for the job type
+	Status       string
+	Attempts     int
+	MaxAttempts  int
+	RunAfter     time.Time
+	LeaseOwner   string
+	LeaseExpires time.Time
+	LastError    string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Decode unpacks the job's payload
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(j.Payload), v)
+}
+
+// CompilePayload is the payload of compile and benchmark jobs
+type CompilePayload struct {
+	SubmissionID int `json:"submission_id"`
+}
+
+type PairPayload struct {
+	SubmissionID int `json:"submission_id"`
+	OpponentID   int `json:"opponent_id"`
+}
+
+type TournamentMatchPayload struct {
+	TournamentID int `json:"tournament_id"`
+	MatchID      int `json:"match_id"`
+}
+
+func CompileJobKey(submissionID int) string {
+	return fmt.Sprintf("compile:%d", submissionID)
+}
+
+func PairJobKey(submissionID, opponentID int) string {
+	return fmt.Sprintf("pair:%d:%d", submissionID, opponentID)
+}
+
+func TournamentMatchJobKey(matchID int) string {
+	return fmt.Sprintf("tournament_match:%d", matchID)
+}
+
+func BenchmarkJobKey(submissionID int, boardSet string) string {
+	return fmt.Sprintf("benchmark:%d:%s", submissionID, boardSet)
+}
+
+// jobSignal wakes the worker whenever a job is queued, so uploads start
+// testing straight away instead of on the next poll
+var jobSignal = make(chan struct{}, 1)
+
+// JobSignal is the channel the worker waits on between jobs
+func JobSignal() <-chan struct{} {
+	return jobSignal
+}
+
+func wakeWorker() {
+	select {
+	case jobSignal <- struct{}{}:
+	default:
+	}
+}
+
+// EnqueueJob queues work unless a job with the same key is already queued
+// or running. It reports whether a new job was added.
+func EnqueueJob(jobType, key string, payload interface{}) (bool, error) {
+	if db == nil {
+		// The queue is a table; a MemoryStore has no worker to feed
+		return false, nil
+	}
+	added, err := enqueueJob(db, jobType, key, payload)
+	if added {
+		wakeWorker()
+	}
+	return added, err
+}
+
+// enqueueJob adds a job on conn, which may be a transaction; waking the
+// worker is left to the caller, once the job is committed
+func enqueueJob(conn interface {
+	exec(string, ...interface{}) (sql.Result, error)
+}, jobType, key string, payload interface{}) (bool, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	result, err := conn.exec(
+		`INSERT INTO jobs (type, key, payload, status, attempts, max_attempts, run_after, created_at, updated_at)
+		 SELECT ?, ?, ?, ?, 0, ?, ?, ?, ?
+		 WHERE NOT EXISTS (SELECT 1 FROM jobs WHERE key = ? AND status IN (?, ?))`,
+		jobType, key, string(data), JobQueued, DefaultJobAttempts, now, now, now,
+		key, JobQueued, JobRunning,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// HasJob reports whether work with this key was ever queued, whatever became
+// of it
+func HasJob(key string) (bool, error) {
+	var count int
+	err := db.queryRow("SELECT COUNT(*) FROM jobs WHERE key = ?", key).Scan(&count)
+	return count > 0, err
+}
+
+// ClaimJob leases the oldest runnable job to owner. Jobs whose lease ran out
+// without a heartbeat are runnable again. It returns nil when there is
+// nothing to do.
+func ClaimJob(owner string, lease time.Duration) (*Job, error) {
+	tx, err := db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	job, err := scanJob(tx.queryRow(
+		`SELECT `+jobColumns+` FROM jobs
+		 WHERE (status = ? AND run_after <= ?) OR (status = ? AND lease_expires < ?)
+		 ORDER BY id LIMIT 1`,
+		JobQueued, now, JobRunning, now,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job.Status = JobRunning
+	job.Attempts++
+	job.LeaseOwner = owner
+	job.LeaseExpires = now.Add(lease)
+	_, err = tx.exec(
+		"UPDATE jobs SET status = ?, attempts = ?, lease_owner = ?, lease_expires = ?, updated_at = ? WHERE id = ?",
+		job.Status, job.Attempts, owner, job.LeaseExpires, now, job.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return job, tx.Commit()
+}
+
+// HeartbeatJob extends a lease while the job is still being worked on
+func HeartbeatJob(id int, owner string, lease time.Duration) error {
+	_, err := db.exec(
+		"UPDATE jobs SET lease_expires = ?, updated_at = ? WHERE id = ? AND lease_owner = ? AND status = ?",
+		time.Now().Add(lease), time.Now(), id, owner, JobRunning,
+	)
+	return err
+}
+
+// ErrLeaseLost is returned when a worker finishes a job whose lease ran out
+// and was claimed by another worker, which now owns the result
+var ErrLeaseLost = errors.New("job lease was lost to another worker")
+
+// finishJob applies an update to a job only while owner still holds its
+// lease, reporting ErrLeaseLost otherwise
+func finishJob(id int, owner, set string, args ...interface{}) error {
+	args = append(args, id, owner, JobRunning)
+	result, err := db.exec("UPDATE jobs SET "+set+" WHERE id = ? AND lease_owner = ? AND status = ?", args...)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func CompleteJob(id int, owner string) error {
+	return finishJob(id, owner,
+		"status = ?, lease_owner = NULL, lease_expires = NULL, last_error = NULL, updated_at = ?",
+		JobDone, time.Now(),
+	)
+}
+
+// FailJob records a failed attempt. The job is retried after a delay that
+// grows with each attempt, or dead-lettered once it is out of attempts.
+// It reports whether the job is now dead.
+func FailJob(job *Job, owner string, jobErr error) (bool, error) {
+	now := time.Now()
+	if job.Attempts >= job.MaxAttempts {
+		err := finishJob(job.ID, owner,
+			"status = ?, lease_owner = NULL, lease_expires = NULL, last_error = ?, updated_at = ?",
+			JobDead, jobErr.Error(), now,
+		)
+		return err == nil, err
+	}
+
+	backoff := time.Duration(job.Attempts*job.Attempts) * 30 * time.Second
+	return false, finishJob(job.ID, owner,
+		"status = ?, lease_owner = NULL, lease_expires = NULL, last_error = ?, run_after = ?, updated_at = ?",
+		JobQueued, jobErr.Error(), now.Add(backoff), now,
+	)
+}
+
+// ReleaseJob puts a job interrupted by a shutdown back in the queue. The
+// attempt it was on isn't counted against it.
+func ReleaseJob(id int, owner string) error {
+	now := time.Now()
+	return finishJob(id, owner,
+		"status = ?, attempts = CASE WHEN attempts > 0 THEN attempts - 1 ELSE 0 END, lease_owner = NULL, lease_expires = NULL, run_after = ?, updated_at = ?",
+		JobQueued, now, now,
+	)
+}
+
+// RetryJob gives a dead job a fresh set of attempts
+func RetryJob(id int) error {
+	now := time.Now()
+	result, err := db.exec(
+		"UPDATE jobs SET status = ?, attempts = 0, run_after = ?, updated_at = ? WHERE id = ? AND status = ?",
+		JobQueued, now, now, id, JobDead,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("job %d is not dead", id)
+	}
+	wakeWorker()
+	return nil
+}
+
+// IsJobPending reports whether work with this key is queued or running
+func IsJobPending(key string) (bool, error) {
+	var count int
+	err := db.queryRow("SELECT COUNT(*) FROM jobs WHERE key = ? AND status IN (?, ?)", key, JobQueued, JobRunning).Scan(&count)
+	return count > 0, err
+}
+
+// HasPendingJobs reports whether any job is queued or running
+func HasPendingJobs() (bool, error) {
+	var count int
+	err := db.queryRow("SELECT COUNT(*) FROM jobs WHERE status IN (?, ?)", JobQueued, JobRunning).Scan(&count)
+	return count > 0, err
+}
+
+// RoundRobinProgress counts the head-to-head jobs of a submission's latest
+// round-robin: how many there are, how many have finished, and when the
+// first was queued. Jobs from before a rerun are left out.
+func RoundRobinProgress(submissionID int) (total, finished int, started time.Time, err error) {
+	const since = "id > COALESCE((SELECT MAX(id) FROM jobs WHERE key = ?), 0)"
+	pattern := fmt.Sprintf("pair:%d:%%", submissionID)
+	compileKey := CompileJobKey(submissionID)
+
+	err = db.queryRow(
+		`SELECT COUNT(*), COALESCE(SUM(CASE WHEN status IN (?, ?) THEN 1 ELSE 0 END), 0)
+		 FROM jobs WHERE type = ? AND key LIKE ? AND `+since,
+		JobDone, JobDead, JobRoundRobinPair, pattern, compileKey,
+	).Scan(&total, &finished)
+	if err != nil || total == 0 {
+		return total, finished, time.Now(), err
+	}
+	err = db.queryRow(
+		"SELECT created_at FROM jobs WHERE type = ? AND key LIKE ? AND "+since+" ORDER BY id LIMIT 1",
+		JobRoundRobinPair, pattern, compileKey,
+	).Scan(&started)
+	return total, finished, started, err
+}
+
+// CountJobs reports how many jobs are in a state
+func CountJobs(status string) (int, error) {
+	var count int
+	err := db.queryRow("SELECT COUNT(*) FROM jobs WHERE status = ?", status).Scan(&count)
+	return count, err
+}
+
+// GetJobs lists jobs in a state, or every job when status is empty, newest
+// first
+func GetJobs(status string, limit int) ([]Job, error) {
+	query := "SELECT " + jobColumns + " FROM jobs"
+	args := []interface{}{}
+	if status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// RecoverJobs runs at startup, before the worker claims anything. Running
+// jobs whose lease has run out go back in the queue, and submissions left in
+// "testing" without a live compile job go back to "pending". Leases that are
+// still live may belong to another worker and are left alone; if their owner
+// crashed, ClaimJob picks the job up once the lease lapses. Pending
+// submissions without a compile job, such as uploads from before the job
+// queue, get one, as do unplayed matches of active tournaments. It returns
+// how many jobs were requeued or added for submissions.
+func RecoverJobs() (int, error) {
+	now := time.Now()
+	result, err := db.exec(
+		"UPDATE jobs SET status = ?, lease_owner = NULL, lease_expires = NULL, run_after = ?, updated_at = ? WHERE status = ? AND (lease_expires IS NULL OR lease_expires < ?)",
+		JobQueued, now, now, JobRunning, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	recovered, _ := result.RowsAffected()
+
+	if _, err := db.exec(
+		`UPDATE submissions SET status = 'pending' WHERE status = 'testing'
+		 AND NOT EXISTS (SELECT 1 FROM jobs j WHERE j.key = 'compile:' || submissions.id AND j.status = ?)`,
+		JobRunning,
+	); err != nil {
+		return 0, err
+	}
+
+	pending, err := GetPendingSubmissions()
+	if err != nil {
+		return 0, err
+	}
+	for _, sub := range pending {
+		added, err := EnqueueJob(JobCompile, CompileJobKey(sub.ID), CompilePayload{SubmissionID: sub.ID})
+		if err != nil {
+			return 0, err
+		}
+		if added {
+			recovered++
+		}
+	}
+
+	// Tournaments started before the job queue have no jobs for their matches
+	rows, err := db.query("SELECT id FROM tournaments WHERE status = 'active'")
+	if err != nil {
+		return 0, err
+	}
+	var tournaments []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		tournaments = append(tournaments, id)
+	}
+	rows.Close()
+	for _, id := range tournaments {
+		if err := EnqueueBracketMatches(id); err != nil {
+			return 0, err
+		}
+	}
+
+	if recovered > 0 {
+		wakeWorker()
+	}
+	return int(recovered), nil
+}
+
+const jobColumns = "id, type, key, payload, status, attempts, max_attempts, run_after, lease_owner, lease_expires, last_error, created_at, updated_at"
+
+func scanJob(row interface{ Scan(...interface{}) error }) (*Job, error) {
+	var j Job
+	var leaseOwner, lastError sql.NullString
+	var leaseExpires sql.NullTime
+	err := row.Scan(
+		&j.ID, &j.Type, &j.Key, &j.Payload, &j.Status, &j.Attempts, &j.MaxAttempts,
+		&j.RunAfter, &leaseOwner, &leaseExpires, &lastError, &j.CreatedAt, &j.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	j.LeaseOwner = leaseOwner.String
+	j.LastError = lastError.String
+	if leaseExpires.Valid {
+		j.LeaseExpires = leaseExpires.Time
+	}
+	return &j, nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLostLeaseCannotFinishJob(t *testing.T) {
+	useFileDB(t)
+
+	if _, err := EnqueueJob(JobCompile, CompileJobKey(1), CompilePayload{SubmissionID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	stale, err := ClaimJob("worker-a", time.Millisecond)
+	if err != nil || stale == nil {
+		t.Fatalf("first claim = %+v, %v", stale, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	// worker-a hung past its lease, so worker-b picks the job up
+	job, err := ClaimJob("worker-b", time.Minute)
+	if err != nil || job == nil || job.ID != stale.ID {
+		t.Fatalf("reclaim = %+v, %v; want job %d", job, err, stale.ID)
+	}
+
+	if err := CompleteJob(stale.ID, "worker-a"); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("CompleteJob by the old owner: got %v, want ErrLeaseLost", err)
+	}
+	if dead, err := FailJob(stale, "worker-a", errors.New("crashed")); dead || !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("FailJob by the old owner = %v, %v; want ErrLeaseLost", dead, err)
+	}
+	if err := ReleaseJob(stale.ID, "worker-a"); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("ReleaseJob by the old owner: got %v, want ErrLeaseLost", err)
+	}
+
+	jobs, err := GetJobs("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Status != JobRunning || jobs[0].LeaseOwner != "worker-b" || jobs[0].Attempts != 2 {
+		t.Fatalf("jobs = %+v, want one running under worker-b on attempt 2", jobs)
+	}
+
+	if err := CompleteJob(job.ID, "worker-b"); err != nil {
+		t.Fatalf("CompleteJob by the new owner: %v", err)
+	}
+	if err := CompleteJob(job.ID, "worker-b"); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("completing a done job again: got %v, want ErrLeaseLost", err)
+	}
+}
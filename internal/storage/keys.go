@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+type UserKey struct {
+	ID          int
+	Username    string
+	PublicKey   string // "type base64", as the auth handler sees it
+	Fingerprint string
+	Label       string
+	AddedAt     time.Time
+	LastUsedAt  time.Time
+	IsAdmin     bool // carries its owner's admin role
+}
+
+// ParsePublicKey reads a key in authorized_keys format, as pasted from a
+// .pub file. It returns the key in the normalized form used for lookups and
+// the trailing comment, which makes a handy default label.
+func ParsePublicKey(text string) (key, fingerprint, comment string, err error) {
+	parsed, comment, _, _, err := gossh.ParseAuthorizedKey([]byte(strings.TrimSpace(text)))
+	if err != nil {
+		return "", "", "", fmt.Errorf("not a valid SSH public key")
+	}
+	key = strings.TrimSpace(string(gossh.MarshalAuthorizedKey(parsed)))
+	return key, gossh.FingerprintSHA256(parsed), comment, nil
+}
+
+// ensureUserKeys copies the single key every account had before user_keys
+// existed. Users who already have keys are skipped, so this only does work
+// once per account; placeholder keys from admin-created accounts don't parse
+// and are left out.
+func ensureUserKeys(db *SQLStore) error {
+	rows, err := db.query(
+		"SELECT username, public_key, created_at FROM users WHERE username NOT IN (SELECT username FROM user_keys)",
+	)
+	if err != nil {
+		return err
+	}
+
+	type legacyKey struct {
+		username, publicKey string
+		createdAt           time.Time
+	}
+	var legacy []legacyKey
+	for rows.Next() {
+		var k legacyKey
+		if err := rows.Scan(&k.username, &k.publicKey, &k.createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy = append(legacy, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, k := range legacy {
+		key, fingerprint, _, err := ParsePublicKey(k.publicKey)
+		if err != nil {
+			continue
+		}
+		_, err = db.exec(
+			"INSERT INTO user_keys (username, public_key, fingerprint, label, added_at) VALUES (?, ?, ?, '', ?) ON CONFLICT DO NOTHING",
+			k.username, key, fingerprint, k.createdAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertUserKey(exec interface {
+	insert(string, ...interface{}) (int64, error)
+}, username, publicKey, label string) (*UserKey, error) {
+	key, fingerprint, comment, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if label == "" {
+		label = comment
+	}
+
+	now := time.Now()
+	id, err := exec.insert(
+		"INSERT INTO user_keys (username, public_key, fingerprint, label, added_at) VALUES (?, ?, ?, ?, ?)",
+		username, key, fingerprint, label, now,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("key %s is already registered", fingerprint)
+		}
+		return nil, err
+	}
+
+	return &UserKey{
+		ID:          int(id),
+		Username:    username,
+		PublicKey:   key,
+		Fingerprint: fingerprint,
+		Label:       label,
+		AddedAt:     now,
+	}, nil
+}
+
+// AddUserKey registers another key for an account. A key can only belong to
+// one user, since it is what identifies them at login.
+func AddUserKey(username, publicKey, label string) (*UserKey, error) {
+	return insertUserKey(db, username, publicKey, label)
+}
+
+func GetUserKeys(username string) ([]UserKey, error) {
+	rows, err := db.query(
+		"SELECT id, username, public_key, fingerprint, label, added_at, last_used_at, is_admin FROM user_keys WHERE username = ? ORDER BY added_at, id",
+		username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []UserKey
+	for rows.Next() {
+		var k UserKey
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Username, &k.PublicKey, &k.Fingerprint, &k.Label, &k.AddedAt, &lastUsed, &k.IsAdmin); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			k.LastUsedAt = lastUsed.Time
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RemoveUserKey deletes one of a user's keys, named by its fingerprint or by
+// its position in GetUserKeys counting from 1. The last key can't be removed,
+// or the account would be locked out.
+func RemoveUserKey(username, which string) (*UserKey, error) {
+	keys, err := GetUserKeys(username)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *UserKey
+	for i := range keys {
+		if keys[i].Fingerprint == which || keys[i].Fingerprint == "SHA256:"+which || fmt.Sprint(i+1) == which {
+			target = &keys[i]
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("no key %q", which)
+	}
+	if len(keys) == 1 {
+		return nil, fmt.Errorf("can't remove your only key; add another one first")
+	}
+
+	if _, err := db.exec("DELETE FROM user_keys WHERE id = ? AND username = ?", target.ID, username); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// MarkKeyUsed records a successful login with a key
+func MarkKeyUsed(publicKey string) error {
+	_, err := db.exec("UPDATE user_keys SET last_used_at = ? WHERE public_key = ?", time.Now(), strings.TrimSpace(publicKey))
+	return err
+}
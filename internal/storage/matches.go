@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Match is one round-robin head-to-head between two submissions
+type Match struct {
+	ID           int
+	Player1ID    int
+	Player2ID    int
+	Player1      string
+	Player2      string
+	WinnerID     int
+	Winner       string
+	Player1Wins  int
+	Player2Wins  int
+	Player1Moves int
+	Player2Moves int
+	Timestamp    time.Time
+	Valid        bool // false once either side has been replaced
+	ArenaID      int
+}
+
+// MatchDetails is how a match was played, as the runner recorded it.
+// Matches played before it was recorded have none.
+type MatchDetails struct {
+	Games          int
+	Ties           int
+	Seed           int64 // seeds the boards and both players' rand()
+	EngineVersion  string
+	Runtime        time.Duration
+	MoveCounts     []MoveCount // games by length, shortest first
+	Player1Invalid int         // moves the engine replaced with random ones
+	Player2Invalid int
+	Output         string // anything else the match binary printed
+	Replays        []Replay
+}
+
+// MoveCount is how the games that lasted Moves turns ended
+type MoveCount struct {
+	Moves       int `json:"moves"`
+	Player1Wins int `json:"player1_wins"`
+	Player2Wins int `json:"player2_wins"`
+	Ties        int `json:"ties"`
+}
+
+// Shot results
+const (
+	ShotMiss = 'M'
+	ShotHit  = 'H'
+	ShotSunk = 'S'
+)
+
+// Shot is one move at the opponent's board, numbered from 0
+type Shot struct {
+	Row    int
+	Col    int
+	Result byte
+}
+
+// Replay is every shot of one game the runner kept
+type Replay struct {
+	Game   int    // numbered from 1
+	Winner int    // 1 or 2, 0 for a tie
+	Shots  []Shot // player 1's and player 2's shots in turn
+}
+
+// ParseShots reads shots written as a row letter, a column number and a
+// result, space separated: "A1M B7H B8S"
+func ParseShots(s string) ([]Shot, error) {
+	var shots []Shot
+	for _, field := range strings.Fields(s) {
+		var shot Shot
+		var row rune
+		if _, err := fmt.Sscanf(field, "%c%d%c", &row, &shot.Col, &shot.Result); err != nil {
+			return nil, fmt.Errorf("bad shot %q", field)
+		}
+		shot.Row = int(row - 'A')
+		shot.Col--
+		switch shot.Result {
+		case ShotMiss, ShotHit, ShotSunk:
+		default:
+			return nil, fmt.Errorf("bad shot %q", field)
+		}
+		shots = append(shots, shot)
+	}
+	return shots, nil
+}
+
+func formatShots(shots []Shot) string {
+	fields := make([]string, len(shots))
+	for i, shot := range shots {
+		fields[i] = fmt.Sprintf("%c%d%c", 'A'+shot.Row, shot.Col+1, shot.Result)
+	}
+	return strings.Join(fields, " ")
+}
+
+// MatchQuery selects valid matches in an arena. Empty fields don't filter.
+type MatchQuery struct {
+	ArenaID  int    // 0 selects the default arena
+	Player   string // matches this user played, on either side
+	Opponent string // with Player, only those against this user
+	Since    time.Time
+	Until    time.Time // exclusive
+	Limit    int       // negative for no limit
+	Offset   int
+}
+
+const matchColumns = `m.id, m.player1_id, m.player2_id, s1.username, s2.username,
+	COALESCE(m.winner_id, 0), COALESCE(sw.username, ''), m.player1_wins, m.player2_wins,
+	COALESCE(m.player1_moves, 0), COALESCE(m.player2_moves, 0), m.timestamp, m.is_valid, s1.arena_id`
+
+const matchTables = `matches m
+	JOIN submissions s1 ON m.player1_id = s1.id
+	JOIN submissions s2 ON m.player2_id = s2.id
+	LEFT JOIN submissions sw ON m.winner_id = sw.id`
+
+func scanMatch(row interface{ Scan(...interface{}) error }) (*Match, error) {
+	var m Match
+	err := row.Scan(&m.ID, &m.Player1ID, &m.Player2ID, &m.Player1, &m.Player2,
+		&m.WinnerID, &m.Winner, &m.Player1Wins, &m.Player2Wins,
+		&m.Player1Moves, &m.Player2Moves, &m.Timestamp, &m.Valid, &m.ArenaID)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// QueryMatches returns one page of matches, newest first, and how many there
+// are in all
+func (s *SQLStore) QueryMatches(q MatchQuery) ([]Match, int, error) {
+	arenaID, err := s.resolveArenaID(q.ArenaID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := []string{"m.is_valid = 1", "s1.arena_id = ?"}
+	args := []interface{}{arenaID}
+	switch {
+	case q.Player != "" && q.Opponent != "":
+		where = append(where, "((s1.username = ? AND s2.username = ?) OR (s1.username = ? AND s2.username = ?))")
+		args = append(args, q.Player, q.Opponent, q.Opponent, q.Player)
+	case q.Player != "" || q.Opponent != "":
+		player := q.Player + q.Opponent
+		where = append(where, "(s1.username = ? OR s2.username = ?)")
+		args = append(args, player, player)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "m.timestamp >= ?")
+		args = append(args, q.Since.UTC())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "m.timestamp < ?")
+		args = append(args, q.Until.UTC())
+	}
+	filter := " FROM " + matchTables + " WHERE " + strings.Join(where, " AND ")
+
+	var total int
+	if err := s.queryRow("SELECT COUNT(*)"+filter, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.query("SELECT "+matchColumns+filter+" ORDER BY m.id DESC LIMIT ? OFFSET ?",
+		append(args, noLimit(q.Limit), q.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var matches []Match
+	for rows.Next() {
+		m, err := scanMatch(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		matches = append(matches, *m)
+	}
+	return matches, total, rows.Err()
+}
+
+// GetMatch returns a match whether or not it is still valid, or nil if there
+// is no such match
+func (s *SQLStore) GetMatch(id int) (*Match, error) {
+	m, err := scanMatch(s.queryRow("SELECT "+matchColumns+" FROM "+matchTables+" WHERE m.id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return m, err
+}
+
+// addMatchDetails records how a match was played, in the transaction that
+// records the match
+func addMatchDetails(tx *sqlTx, matchID int64, d *MatchDetails) error {
+	moveCounts, err := json.Marshal(d.MoveCounts)
+	if err != nil {
+		return err
+	}
+	_, err = tx.exec(
+		`INSERT INTO match_details (match_id, games, ties, seed, engine_version, runtime_ms, move_counts, player1_invalid, player2_invalid, output)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		matchID, d.Games, d.Ties, d.Seed, d.EngineVersion, d.Runtime.Milliseconds(), string(moveCounts),
+		d.Player1Invalid, d.Player2Invalid, d.Output,
+	)
+	if err != nil {
+		return err
+	}
+	for _, replay := range d.Replays {
+		_, err := tx.exec("INSERT INTO match_replays (match_id, game, winner, shots) VALUES (?, ?, ?, ?)",
+			matchID, replay.Game, replay.Winner, formatShots(replay.Shots))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMatchDetails returns how a match was played, or nil if that wasn't
+// recorded
+func (s *SQLStore) GetMatchDetails(matchID int) (*MatchDetails, error) {
+	var d MatchDetails
+	var runtimeMS int64
+	var moveCounts string
+	err := s.queryRow(
+		`SELECT games, ties, seed, engine_version, runtime_ms, move_counts, player1_invalid, player2_invalid, output
+		 FROM match_details WHERE match_id = ?`, matchID,
+	).Scan(&d.Games, &d.Ties, &d.Seed, &d.EngineVersion, &runtimeMS, &moveCounts, &d.Player1Invalid, &d.Player2Invalid, &d.Output)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.Runtime = time.Duration(runtimeMS) * time.Millisecond
+	if err := json.Unmarshal([]byte(moveCounts), &d.MoveCounts); err != nil {
+		return nil, fmt.Errorf("move counts of match %d: %v", matchID, err)
+	}
+
+	rows, err := s.query("SELECT game, winner, shots FROM match_replays WHERE match_id = ? ORDER BY game", matchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var replay Replay
+		var shots string
+		if err := rows.Scan(&replay.Game, &replay.Winner, &shots); err != nil {
+			return nil, err
+		}
+		if replay.Shots, err = ParseShots(shots); err != nil {
+			return nil, fmt.Errorf("replay %d of match %d: %v", replay.Game, matchID, err)
+		}
+		d.Replays = append(d.Replays, replay)
+	}
+	return &d, rows.Err()
+}
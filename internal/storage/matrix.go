@@ -0,0 +1,87 @@
+package storage
+
+import "sort"
+
+// Matrix sort orders
+const (
+	MatrixByRating = "rating"
+	MatrixByName   = "name"
+)
+
+// MatrixPlayer is one row, and the matching column, of a head-to-head matrix
+type MatrixPlayer struct {
+	Username     string
+	SubmissionID int
+	Rating       int
+	IsBot        bool
+}
+
+// MatrixCell is how the row player did against the column player
+type MatrixCell struct {
+	MatchID int
+	Wins    int // games the row player won
+	Losses  int
+}
+
+// WinPct is the share of games the row player won
+func (c *MatrixCell) WinPct() float64 {
+	return winPct(c.Wins, c.Losses)
+}
+
+// Matrix is every active submission's result against every other.
+// Cells[i][j] is Players[i] against Players[j], nil where they haven't
+// played (yet) and on the diagonal.
+type Matrix struct {
+	Players []MatrixPlayer
+	Cells   [][]*MatrixCell
+}
+
+// GetMatrix builds the head-to-head matrix of an arena's active, compiled
+// submissions, ordered by rating (highest first) or by name
+func GetMatrix(arenaID int, sortBy string) (*Matrix, error) {
+	entries, err := QueryLeaderboard(LeaderboardQuery{ArenaID: arenaID, Limit: -1})
+	if err != nil {
+		return nil, err
+	}
+	subs, err := GetActiveSubmissions(arenaID)
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[string]int, len(subs))
+	for _, sub := range subs {
+		active[sub.Username] = sub.ID
+	}
+
+	matrix := &Matrix{}
+	for _, e := range entries {
+		if id, ok := active[e.Username]; ok {
+			matrix.Players = append(matrix.Players, MatrixPlayer{Username: e.Username, SubmissionID: id, Rating: e.Rating, IsBot: e.IsBot})
+		}
+	}
+	if sortBy == MatrixByName {
+		sort.Slice(matrix.Players, func(i, j int) bool { return matrix.Players[i].Username < matrix.Players[j].Username })
+	}
+
+	index := make(map[int]int, len(matrix.Players))
+	matrix.Cells = make([][]*MatrixCell, len(matrix.Players))
+	for i, p := range matrix.Players {
+		index[p.SubmissionID] = i
+		matrix.Cells[i] = make([]*MatrixCell, len(matrix.Players))
+	}
+
+	matches, _, err := QueryMatches(MatchQuery{ArenaID: arenaID, Limit: -1})
+	if err != nil {
+		return nil, err
+	}
+	// Newest first, so a replayed pairing shows its latest result
+	for _, m := range matches {
+		i, ok1 := index[m.Player1ID]
+		j, ok2 := index[m.Player2ID]
+		if !ok1 || !ok2 || matrix.Cells[i][j] != nil {
+			continue
+		}
+		matrix.Cells[i][j] = &MatrixCell{MatchID: m.ID, Wins: m.Player1Wins, Losses: m.Player2Wins}
+		matrix.Cells[j][i] = &MatrixCell{MatchID: m.ID, Wins: m.Player2Wins, Losses: m.Player1Wins}
+	}
+	return matrix, nil
+}
@@ -0,0 +1,870 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store kept in maps, for tests of code built on the
+// package-level functions. It has a single arena with ID 1 that arena ID 0
+// stands for and no seasons, benchmarks or reference bots. Functions outside
+// Store return ErrNotSupported under it, and EnqueueJob queues nothing.
+type MemoryStore struct {
+	mu          sync.Mutex
+	nextID      map[string]int
+	submissions []*memSubmission
+	matches     []*memMatch
+	history     map[int][]RatingHistoryPoint
+	users       []*User
+	tournaments []*Tournament
+	bracket     []*BracketMatch
+}
+
+type memSubmission struct {
+	Submission
+	rating Glicko2Player
+	files  []SubmissionFile
+}
+
+type memMatch struct {
+	id                         int
+	player1ID, player2ID       int
+	winnerID                   int
+	player1Wins, player2Wins   int
+	player1Moves, player2Moves int
+	valid                      bool
+	timestamp                  time.Time
+	details                    *MatchDetails
+}
+
+// memArenaID is the one arena a MemoryStore has
+const memArenaID = 1
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{nextID: make(map[string]int), history: make(map[int][]RatingHistoryPoint)}
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// id hands out IDs from one sequence per table, as the SQL store does
+func (m *MemoryStore) id(table string) int {
+	m.nextID[table]++
+	return m.nextID[table]
+}
+
+func memArena(arenaID int) int {
+	if arenaID == 0 {
+		return memArenaID
+	}
+	return arenaID
+}
+
+func (m *MemoryStore) submission(id int) *memSubmission {
+	for _, s := range m.submissions {
+		if s.ID == id {
+			return s
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) AddSubmission(arenaID int, username, filename, contentHash string, files []SubmissionFile) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.addSubmission(memArena(arenaID), username, filename, contentHash, files, 0), nil
+}
+
+func (m *MemoryStore) RestoreSubmission(id int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.submission(id)
+	if old == nil {
+		return 0, sql.ErrNoRows
+	}
+	if old.ContentHash == "" {
+		return 0, fmt.Errorf("submission %d was uploaded before sources were kept and can't be restored", id)
+	}
+	return m.addSubmission(old.ArenaID, old.Username, old.Filename, old.ContentHash, old.files, old.ID), nil
+}
+
+func (m *MemoryStore) GetSubmissionFiles(submissionID int) ([]SubmissionFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.submission(submissionID); s != nil {
+		return append([]SubmissionFile(nil), s.files...), nil
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) addSubmission(arenaID int, username, filename, contentHash string, files []SubmissionFile, restoredFrom int) int64 {
+	for _, s := range m.submissions {
+		if s.Username != username || s.ArenaID != arenaID {
+			continue
+		}
+		s.IsActive = false
+		for _, match := range m.matches {
+			if match.player1ID == s.ID || match.player2ID == s.ID {
+				match.valid = false
+			}
+		}
+	}
+
+	s := &memSubmission{
+		Submission: Submission{
+			ID:         m.id("submissions"),
+			Username:   username,
+			Filename:   filename,
+			UploadTime: time.Now(),
+			Status:     "pending",
+			IsActive:   true,
+			ArenaID:    arenaID,
+
+			ContentHash:  contentHash,
+			RestoredFrom: restoredFrom,
+		},
+		rating: Glicko2Player{Rating: 1500, RD: 350, Volatility: 0.06},
+		files:  append([]SubmissionFile(nil), files...),
+	}
+	m.submissions = append(m.submissions, s)
+	return int64(s.ID)
+}
+
+func (m *MemoryStore) UpdateSubmissionStatus(id int, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.submission(id); s != nil {
+		s.Status = status
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetSubmissionByID(id int) (Submission, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.submission(id); s != nil {
+		return s.Submission, nil
+	}
+	return Submission{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) GetActiveSubmission(arenaID int, username string) (*Submission, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.submissions {
+		if s.IsActive && s.Username == username && s.ArenaID == memArena(arenaID) {
+			sub := s.Submission
+			return &sub, nil
+		}
+	}
+	return nil, nil
+}
+
+// filter returns the submissions keep accepts, oldest first
+func (m *MemoryStore) filter(keep func(s *memSubmission) bool) []Submission {
+	var subs []Submission
+	for _, s := range m.submissions {
+		if keep(s) {
+			subs = append(subs, s.Submission)
+		}
+	}
+	return subs
+}
+
+func (m *MemoryStore) GetPendingSubmissions() ([]Submission, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.filter(func(s *memSubmission) bool {
+		return s.IsActive && s.Status == "pending"
+	}), nil
+}
+
+func (m *MemoryStore) GetActiveSubmissions(arenaID int) ([]Submission, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subs := m.filter(func(s *memSubmission) bool {
+		return s.IsActive && s.Status == "completed" && s.ArenaID == arenaID
+	})
+	sort.SliceStable(subs, func(i, j int) bool { return subs[i].Username < subs[j].Username })
+	return subs, nil
+}
+
+// latestFirst reverses subs and keeps at most limit of them, or all if limit
+// is negative, as the SQL store does
+func latestFirst(subs []Submission, limit int) []Submission {
+	var latest []Submission
+	for i := len(subs) - 1; i >= 0 && (limit < 0 || len(latest) < limit); i-- {
+		latest = append(latest, subs[i])
+	}
+	return latest
+}
+
+func (m *MemoryStore) GetUserSubmissions(username string) ([]Submission, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return latestFirst(m.filter(func(s *memSubmission) bool {
+		return s.Username == username
+	}), 10), nil
+}
+
+// memStats totals a submission's valid matches
+type memStats struct {
+	wins, losses int
+	moves, count int
+	lastPlayed   time.Time
+}
+
+func (m *MemoryStore) stats(id int) memStats {
+	var st memStats
+	for _, match := range m.matches {
+		if !match.valid {
+			continue
+		}
+		switch id {
+		case match.player1ID:
+			st.wins += match.player1Wins
+			st.losses += match.player2Wins
+			st.moves += match.player1Moves
+		case match.player2ID:
+			st.wins += match.player2Wins
+			st.losses += match.player1Wins
+			st.moves += match.player2Moves
+		default:
+			continue
+		}
+		st.count++
+		if match.timestamp.After(st.lastPlayed) {
+			st.lastPlayed = match.timestamp
+		}
+	}
+	return st
+}
+
+func winPct(wins, losses int) float64 {
+	if wins+losses == 0 {
+		return 0
+	}
+	return float64(wins) / float64(wins+losses) * 100.0
+}
+
+func (m *MemoryStore) GetUserSubmissionsWithStats(arenaID int, username string, limit int) ([]SubmissionWithStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subs := latestFirst(m.filter(func(s *memSubmission) bool {
+		return s.Username == username && s.ArenaID == memArena(arenaID)
+	}), limit)
+	var withStats []SubmissionWithStats
+	for _, sub := range subs {
+		st := m.stats(sub.ID)
+		rating := m.submission(sub.ID).rating
+		s := SubmissionWithStats{
+			Submission: sub,
+			Rating:     int(rating.Rating),
+			RD:         int(rating.RD),
+			Wins:       st.wins,
+			Losses:     st.losses,
+			WinPct:     winPct(st.wins, st.losses),
+			LastPlayed: st.lastPlayed,
+			HasMatches: st.count > 0,
+		}
+		if st.count > 0 {
+			s.AvgMoves = float64(st.moves) / float64(st.count)
+		}
+		withStats = append(withStats, s)
+	}
+	return withStats, nil
+}
+
+func (m *MemoryStore) GetQueuedPlayerNames() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := []string{}
+	for _, s := range m.submissions {
+		if s.IsActive && (s.Status == "pending" || s.Status == "testing") {
+			names = append(names, s.Username)
+		}
+	}
+	return names
+}
+
+func (m *MemoryStore) AddMatch(player1ID, player2ID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves int, details *MatchDetails) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	match := &memMatch{
+		id:           m.id("matches"),
+		player1ID:    player1ID,
+		player2ID:    player2ID,
+		winnerID:     winnerID,
+		player1Wins:  player1Wins,
+		player2Wins:  player2Wins,
+		player1Moves: player1Moves,
+		player2Moves: player2Moves,
+		valid:        true,
+		timestamp:    time.Now(),
+		details:      details,
+	}
+	m.matches = append(m.matches, match)
+	return int64(match.id), nil
+}
+
+func (m *MemoryStore) HasMatchBetween(player1ID, player2ID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, match := range m.matches {
+		if match.valid && ((match.player1ID == player1ID && match.player2ID == player2ID) ||
+			(match.player1ID == player2ID && match.player2ID == player1ID)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemoryStore) GetAllMatches(arenaID int) ([]MatchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var results []MatchResult
+	for i := len(m.matches) - 1; i >= 0; i-- {
+		match := m.matches[i]
+		p1, p2, winner := m.submission(match.player1ID), m.submission(match.player2ID), m.submission(match.winnerID)
+		if !match.valid || p1 == nil || p2 == nil || winner == nil {
+			continue
+		}
+		if !p1.IsActive || !p2.IsActive || p1.ArenaID != memArena(arenaID) {
+			continue
+		}
+		results = append(results, MatchResult{
+			Player1Username: p1.Username,
+			Player2Username: p2.Username,
+			WinnerUsername:  winner.Username,
+			AvgMoves:        match.player1Moves,
+		})
+	}
+	return results, nil
+}
+
+func (m *MemoryStore) match(match *memMatch) Match {
+	p1, p2 := m.submission(match.player1ID), m.submission(match.player2ID)
+	result := Match{
+		ID:           match.id,
+		Player1ID:    match.player1ID,
+		Player2ID:    match.player2ID,
+		Player1:      p1.Username,
+		Player2:      p2.Username,
+		WinnerID:     match.winnerID,
+		Player1Wins:  match.player1Wins,
+		Player2Wins:  match.player2Wins,
+		Player1Moves: match.player1Moves,
+		Player2Moves: match.player2Moves,
+		Timestamp:    match.timestamp,
+		Valid:        match.valid,
+		ArenaID:      p1.ArenaID,
+	}
+	if winner := m.submission(match.winnerID); winner != nil {
+		result.Winner = winner.Username
+	}
+	return result
+}
+
+func (m *MemoryStore) QueryMatches(q MatchQuery) ([]Match, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var found []Match
+	for i := len(m.matches) - 1; i >= 0; i-- {
+		match := m.matches[i]
+		p1, p2 := m.submission(match.player1ID), m.submission(match.player2ID)
+		if !match.valid || p1 == nil || p2 == nil || p1.ArenaID != memArena(q.ArenaID) {
+			continue
+		}
+		played := func(username string) bool { return p1.Username == username || p2.Username == username }
+		if (q.Player != "" && !played(q.Player)) || (q.Opponent != "" && !played(q.Opponent)) {
+			continue
+		}
+		if (!q.Since.IsZero() && match.timestamp.Before(q.Since)) || (!q.Until.IsZero() && !match.timestamp.Before(q.Until)) {
+			continue
+		}
+		found = append(found, m.match(match))
+	}
+
+	total := len(found)
+	if q.Offset >= len(found) {
+		return nil, total, nil
+	}
+	found = found[q.Offset:]
+	if q.Limit >= 0 && q.Limit < len(found) {
+		found = found[:q.Limit]
+	}
+	return found, total, nil
+}
+
+func (m *MemoryStore) GetMatch(id int) (*Match, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, match := range m.matches {
+		if match.id == id && m.submission(match.player1ID) != nil && m.submission(match.player2ID) != nil {
+			found := m.match(match)
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) GetMatchDetails(matchID int) (*MatchDetails, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, match := range m.matches {
+		if match.id == matchID {
+			return match.details, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) GetMatchRecords(playerID int) ([]MatchRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var records []MatchRecord
+	for _, match := range m.matches {
+		if !match.valid {
+			continue
+		}
+		switch playerID {
+		case match.player1ID:
+			records = append(records, MatchRecord{MatchID: match.id, OpponentID: match.player2ID, Wins: match.player1Wins, OpponentWins: match.player2Wins})
+		case match.player2ID:
+			records = append(records, MatchRecord{MatchID: match.id, OpponentID: match.player1ID, Wins: match.player2Wins, OpponentWins: match.player1Wins})
+		}
+	}
+	return records, nil
+}
+
+func (m *MemoryStore) GetAverageMoves(submissionID int) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	moves, count := 0, 0
+	for _, match := range m.matches {
+		switch submissionID {
+		case match.player1ID:
+			moves += match.player1Moves
+		case match.player2ID:
+			moves += match.player2Moves
+		default:
+			continue
+		}
+		count++
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	return float64(moves) / float64(count), nil
+}
+
+// QueryLeaderboard ranks like the SQL store: rated submissions, then ones
+// waiting for their first match, then ones that failed to compile
+func (m *MemoryStore) QueryLeaderboard(q LeaderboardQuery) ([]LeaderboardEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var entries []LeaderboardEntry
+	for _, s := range m.submissions {
+		if !s.IsActive || s.ArenaID != memArena(q.ArenaID) {
+			continue
+		}
+		st := m.stats(s.ID)
+		e := LeaderboardEntry{Username: s.Username, AvgMoves: 999.0, LastPlayed: s.UploadTime}
+		switch {
+		case s.Status == "compilation_failed":
+			e.IsBroken = true
+		case st.count > 0:
+			e.Rating = int(s.rating.Rating)
+			e.RD = int(s.rating.RD)
+			e.Wins = st.wins
+			e.Losses = st.losses
+			e.WinPct = winPct(st.wins, st.losses)
+			e.AvgMoves = float64(st.moves) / float64(st.count)
+			e.LastPlayed = st.lastPlayed
+		case s.Status == "pending" || s.Status == "testing" || s.Status == "completed":
+			e.Rating, e.RD = 1500, 350
+			e.IsPending = true
+		default:
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IsBroken != b.IsBroken {
+			return b.IsBroken
+		}
+		if q.SortBy != SortByBenchmark && a.IsPending != b.IsPending {
+			return b.IsPending
+		}
+		if a.Rating != b.Rating {
+			return a.Rating > b.Rating
+		}
+		if a.Wins != b.Wins {
+			return a.Wins > b.Wins
+		}
+		return a.AvgMoves < b.AvgMoves
+	})
+	if limit := noLimit(q.Limit); len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (m *MemoryStore) GetRating(submissionID int) (Glicko2Player, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.submission(submissionID); s != nil {
+		return s.rating, nil
+	}
+	return Glicko2Player{}, sql.ErrNoRows
+}
+
+func (m *MemoryStore) SetRatings(ratings map[int]Glicko2Player) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, p := range ratings {
+		if s := m.submission(id); s != nil {
+			s.rating = p
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetRatings() (map[int]Glicko2Player, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ratings := make(map[int]Glicko2Player)
+	for _, s := range m.submissions {
+		if s.IsActive && s.Status == "completed" {
+			ratings[s.ID] = s.rating
+		}
+	}
+	return ratings, nil
+}
+
+// GetPinnedRatings is always empty: a MemoryStore has no reference bots
+func (m *MemoryStore) GetPinnedRatings() (map[int]float64, error) {
+	return map[int]float64{}, nil
+}
+
+func (m *MemoryStore) RecordRatingHistory(submissionID int, matchID int, rating, rd, volatility float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.history[submissionID] = append(m.history[submissionID], RatingHistoryPoint{
+		Rating:     int(rating),
+		RD:         int(rd),
+		Volatility: volatility,
+		Timestamp:  time.Now(),
+		MatchID:    matchID,
+	})
+	return nil
+}
+
+func (m *MemoryStore) GetRatingHistory(submissionID int) ([]RatingHistoryPoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]RatingHistoryPoint(nil), m.history[submissionID]...), nil
+}
+
+// RegisterUser creates an account; a MemoryStore has no invite codes, so
+// any code given is rejected
+func (m *MemoryStore) RegisterUser(username, name, bio, link, publicKey, inviteCode string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if inviteCode != "" {
+		return nil, fmt.Errorf("invite code is not valid")
+	}
+	for _, u := range m.users {
+		if u.Username == username {
+			return nil, fmt.Errorf("UNIQUE constraint failed: users.username")
+		}
+	}
+	now := time.Now()
+	u := &User{
+		ID:          m.id("users"),
+		Username:    username,
+		Name:        name,
+		Bio:         bio,
+		Link:        link,
+		PublicKey:   strings.TrimSpace(publicKey),
+		CreatedAt:   now,
+		LastLoginAt: now,
+		Role:        "user",
+	}
+	m.users = append(m.users, u)
+	copied := *u
+	return &copied, nil
+}
+
+func (m *MemoryStore) user(match func(u *User) bool) *User {
+	for _, u := range m.users {
+		if match(u) {
+			copied := *u
+			return &copied
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetUserByUsername(username string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.user(func(u *User) bool { return u.Username == username }), nil
+}
+
+func (m *MemoryStore) GetUserByPublicKey(publicKey string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	publicKey = strings.TrimSpace(publicKey)
+	return m.user(func(u *User) bool { return u.PublicKey == publicKey }), nil
+}
+
+func (m *MemoryStore) UpdateUserLastLogin(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Username == username {
+			u.LastLoginAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) UpdateUserProfile(username, name, bio, link string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Username == username {
+			u.Name, u.Bio, u.Link = name, bio, link
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetAllUsers() ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var users []User
+	for i := len(m.users) - 1; i >= 0; i-- {
+		users = append(users, *m.users[i])
+	}
+	return users, nil
+}
+
+// latestTournament returns the arena's newest tournament that keep accepts
+func (m *MemoryStore) latestTournament(arenaID int, keep func(t *Tournament) bool) *Tournament {
+	for i := len(m.tournaments) - 1; i >= 0; i-- {
+		t := m.tournaments[i]
+		if t.ArenaID == arenaID && keep(t) {
+			copied := *t
+			return &copied
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetActiveTournament(arenaID int) (*Tournament, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.latestTournament(arenaID, func(t *Tournament) bool { return t.Status == "active" }), nil
+}
+
+func (m *MemoryStore) GetLatestTournament(arenaID int) (*Tournament, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.latestTournament(arenaID, func(t *Tournament) bool { return true }), nil
+}
+
+func (m *MemoryStore) GetTournaments(arenaID int) ([]Tournament, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tournaments []Tournament
+	for i := len(m.tournaments) - 1; i >= 0; i-- {
+		if m.tournaments[i].ArenaID == arenaID {
+			tournaments = append(tournaments, *m.tournaments[i])
+		}
+	}
+	return tournaments, nil
+}
+
+func (m *MemoryStore) GetTournament(id int) (*Tournament, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.tournaments {
+		if t.ID == id {
+			copied := *t
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) CreateTournament(arenaID int) (*Tournament, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := &Tournament{
+		ID:           m.id("tournaments"),
+		CreatedAt:    time.Now(),
+		Status:       "active",
+		CurrentRound: 1,
+		ArenaID:      arenaID,
+	}
+	m.tournaments = append(m.tournaments, t)
+	copied := *t
+	return &copied, nil
+}
+
+func (m *MemoryStore) DeleteTournament(tournamentID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tournaments []*Tournament
+	for _, t := range m.tournaments {
+		if t.ID != tournamentID {
+			tournaments = append(tournaments, t)
+		}
+	}
+	m.tournaments = tournaments
+
+	var bracket []*BracketMatch
+	for _, b := range m.bracket {
+		if b.TournamentID != tournamentID {
+			bracket = append(bracket, b)
+		}
+	}
+	m.bracket = bracket
+	return nil
+}
+
+func (m *MemoryStore) tournament(id int) *Tournament {
+	for _, t := range m.tournaments {
+		if t.ID == id {
+			return t
+		}
+	}
+	return &Tournament{}
+}
+
+func (m *MemoryStore) UpdateTournamentRound(tournamentID, round int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tournament(tournamentID).CurrentRound = round
+	return nil
+}
+
+func (m *MemoryStore) CompleteTournament(tournamentID, winnerID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.tournament(tournamentID)
+	t.Status = "completed"
+	t.WinnerID = winnerID
+	return nil
+}
+
+func (m *MemoryStore) AddBracketMatch(tournamentID, round, position, player1ID, player2ID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bracket = append(m.bracket, &BracketMatch{
+		ID:           m.id("bracket_matches"),
+		TournamentID: tournamentID,
+		Round:        round,
+		Position:     position,
+		Player1ID:    player1ID,
+		Player2ID:    player2ID,
+		Status:       "pending",
+	})
+	return nil
+}
+
+func (m *MemoryStore) AddByeMatch(tournamentID, round, position, player1ID, player2ID, winnerID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bracket = append(m.bracket, &BracketMatch{
+		ID:           m.id("bracket_matches"),
+		TournamentID: tournamentID,
+		Round:        round,
+		Position:     position,
+		Player1ID:    player1ID,
+		Player2ID:    player2ID,
+		WinnerID:     winnerID,
+		Status:       "completed",
+	})
+	return nil
+}
+
+// bracketMatches returns a tournament's matches that keep accepts, by round
+// and position, with player names filled in
+func (m *MemoryStore) bracketMatches(tournamentID int, keep func(b *BracketMatch) bool) []BracketMatch {
+	var matches []BracketMatch
+	for _, b := range m.bracket {
+		if b.TournamentID != tournamentID || !keep(b) {
+			continue
+		}
+		match := *b
+		if s := m.submission(b.Player1ID); s != nil {
+			match.Player1Name = s.Username
+		}
+		if s := m.submission(b.Player2ID); s != nil {
+			match.Player2Name = s.Username
+		}
+		matches = append(matches, match)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Round != matches[j].Round {
+			return matches[i].Round < matches[j].Round
+		}
+		return matches[i].Position < matches[j].Position
+	})
+	return matches
+}
+
+func (m *MemoryStore) GetPendingBracketMatches(tournamentID int) ([]BracketMatch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.bracketMatches(tournamentID, func(b *BracketMatch) bool { return b.Status == "pending" }), nil
+}
+
+func (m *MemoryStore) GetAllBracketMatches(tournamentID int) ([]BracketMatch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.bracketMatches(tournamentID, func(b *BracketMatch) bool { return true }), nil
+}
+
+func (m *MemoryStore) UpdateBracketMatchResult(matchID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, b := range m.bracket {
+		if b.ID == matchID {
+			b.WinnerID = winnerID
+			b.Player1Wins, b.Player2Wins = player1Wins, player2Wins
+			b.Player1Moves, b.Player2Moves = player1Moves, player2Moves
+			b.Status = "completed"
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) IsRoundComplete(tournamentID, round int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, b := range m.bracket {
+		if b.TournamentID == tournamentID && b.Round == round && b.Status != "completed" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
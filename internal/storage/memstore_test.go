@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+// useMemoryStore points the package-level functions at a fresh MemoryStore
+// for the rest of the test
+func useMemoryStore(t *testing.T) *MemoryStore {
+	t.Helper()
+	m := NewMemoryStore()
+	Use(m)
+	t.Cleanup(func() { Use(nil) })
+	return m
+}
+
+// addCompiled uploads a submission and marks it compiled
+func addCompiled(t *testing.T, username string) int {
+	t.Helper()
+	id, err := AddSubmission(0, username, "memory_functions_"+username+".cpp", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateSubmissionStatus(int(id), "completed"); err != nil {
+		t.Fatal(err)
+	}
+	return int(id)
+}
+
+func TestMemoryStoreLeaderboard(t *testing.T) {
+	useMemoryStore(t)
+
+	alice := addCompiled(t, "alice")
+	bob := addCompiled(t, "bob")
+	if _, err := AddMatch(alice, bob, alice, 700, 300, 45, 60, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecalculateAllGlicko2Ratings(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := GetLeaderboard(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("leaderboard has %d entries, want 2", len(entries))
+	}
+	if entries[0].Username != "alice" || entries[0].Wins != 700 || entries[0].Losses != 300 {
+		t.Errorf("first place = %+v, want alice at 700-300", entries[0])
+	}
+	if entries[0].Rating <= entries[1].Rating {
+		t.Errorf("winner rated %d, loser %d", entries[0].Rating, entries[1].Rating)
+	}
+
+	// A new upload replaces alice's entry and voids her matches
+	replacement := addCompiled(t, "alice")
+	active, err := GetActiveSubmission(0, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active == nil || active.ID != replacement {
+		t.Fatalf("active submission = %+v, want %d", active, replacement)
+	}
+	if played, err := HasMatchBetween(alice, bob); err != nil || played {
+		t.Errorf("HasMatchBetween after re-upload = %v, %v; want false", played, err)
+	}
+	entries, err = GetLeaderboard(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Wins != 0 || !e.IsPending {
+			t.Errorf("%s still shows %d wins after alice re-uploaded", e.Username, e.Wins)
+		}
+	}
+}
+
+func TestMemoryStoreUsers(t *testing.T) {
+	useMemoryStore(t)
+
+	if _, err := RegisterUser("alice", "Alice", "", "", "key-a", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RegisterUser("alice", "Other Alice", "", "", "key-b", ""); err == nil {
+		t.Error("registered alice twice")
+	}
+	if _, err := RegisterUser(BotUsernamePrefix+"random", "Imposter", "", "", "key-c", ""); !errors.Is(err, ErrReservedUsername) {
+		t.Errorf("registering a bot name: got %v, want ErrReservedUsername", err)
+	}
+
+	user, err := GetUserByPublicKey("key-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user == nil || user.Username != "alice" {
+		t.Errorf("key-a finds %+v, want alice", user)
+	}
+}
+
+func TestMemoryStoreUnsupported(t *testing.T) {
+	useMemoryStore(t)
+
+	if _, err := GetDefaultArena(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("GetDefaultArena: got %v, want ErrNotSupported", err)
+	}
+	if _, err := ClaimJob("test", 0); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("ClaimJob: got %v, want ErrNotSupported", err)
+	}
+	if err := RegisterReferenceBot(BotUsernamePrefix+"random", "memory_functions_random.cpp", 0); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("RegisterReferenceBot: got %v, want ErrNotSupported", err)
+	}
+	if added, err := EnqueueJob(JobCompile, CompileJobKey(1), CompilePayload{SubmissionID: 1}); added || err != nil {
+		t.Errorf("EnqueueJob = %v, %v; want nothing queued", added, err)
+	}
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+
+	"battleship-arena/internal/metrics"
+)
+
+var dbQueryDuration = metrics.NewHistogram(
+	"battleship_db_query_duration_seconds",
+	"Time spent in SQLite statements, from execution until the rows are closed",
+	metrics.ExponentialBuckets(0.0001, 4, 9),
+	"op",
+)
+
+func init() {
+	// Statements are timed in the driver, whichever database runs them
+	sql.Register("sqlite3_timed", timedDriver{&sqlite3.SQLiteDriver{}})
+	sql.Register("postgres_timed", timedDriver{&pq.Driver{}})
+
+	metrics.NewGaugeFunc("battleship_job_queue_depth", "Jobs waiting to run", func() float64 {
+		return countJobs(JobQueued)
+	})
+	metrics.NewGaugeFunc("battleship_jobs_running", "Jobs claimed by a worker", func() float64 {
+		return countJobs(JobRunning)
+	})
+	metrics.NewGaugeFunc("battleship_jobs_dead", "Jobs that ran out of attempts", func() float64 {
+		return countJobs(JobDead)
+	})
+}
+
+func countJobs(status string) float64 {
+	if db == nil {
+		return 0
+	}
+	count, _ := CountJobs(status)
+	return float64(count)
+}
+
+type timedDriver struct {
+	driver.Driver
+}
+
+func (d timedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{conn}, nil
+}
+
+// timedConn times statements run directly on the connection, which is how
+// database/sql runs them when the driver supports it, as both of ours do
+type timedConn struct {
+	driver.Conn
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	defer dbQueryDuration.Since(time.Now(), "exec")
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		dbQueryDuration.Since(start, "query")
+		return nil, err
+	}
+	return &timedRows{rows, start}, nil
+}
+
+func (c *timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+type timedRows struct {
+	driver.Rows
+	start time.Time
+}
+
+func (r *timedRows) Close() error {
+	dbQueryDuration.Since(r.start, "query")
+	return r.Rows.Close()
+}
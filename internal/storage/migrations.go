@@ -0,0 +1,557 @@
+package storage
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Migration moves the schema up one version. Migrations run in order, each
+// in its own transaction, and are recorded in schema_migrations.
+//
+// Databases from before versioning already have some of these tables and
+// columns, so the early migrations use IF NOT EXISTS and ensureColumn and
+// are safe to run over them. New migrations are appended to the end; never
+// edit one that has shipped.
+type Migration struct {
+	Version int
+	Name    string
+	up      func(tx *sqlTx) error
+}
+
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT UNIQUE NOT NULL,
+			name TEXT NOT NULL,
+			bio TEXT,
+			link TEXT,
+			public_key TEXT UNIQUE NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_login_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS submissions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			filename TEXT NOT NULL,
+			upload_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			status TEXT DEFAULT 'pending',
+			is_active BOOLEAN DEFAULT 1,
+			glicko_rating REAL DEFAULT 1500.0,
+			glicko_rd REAL DEFAULT 350.0,
+			glicko_volatility REAL DEFAULT 0.06
+		);
+
+		CREATE TABLE IF NOT EXISTS tournaments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			status TEXT DEFAULT 'active',
+			current_round INTEGER DEFAULT 1,
+			winner_id INTEGER,
+			FOREIGN KEY (winner_id) REFERENCES submissions(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS bracket_matches (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			tournament_id INTEGER,
+			round INTEGER,
+			position INTEGER,
+			player1_id INTEGER,
+			player2_id INTEGER,
+			winner_id INTEGER,
+			player1_wins INTEGER DEFAULT 0,
+			player2_wins INTEGER DEFAULT 0,
+			player1_moves INTEGER,
+			player2_moves INTEGER,
+			status TEXT DEFAULT 'pending',
+			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (tournament_id) REFERENCES tournaments(id),
+			FOREIGN KEY (player1_id) REFERENCES submissions(id),
+			FOREIGN KEY (player2_id) REFERENCES submissions(id),
+			FOREIGN KEY (winner_id) REFERENCES submissions(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS matches (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			player1_id INTEGER,
+			player2_id INTEGER,
+			winner_id INTEGER,
+			player1_wins INTEGER DEFAULT 0,
+			player2_wins INTEGER DEFAULT 0,
+			player1_moves INTEGER,
+			player2_moves INTEGER,
+			is_valid BOOLEAN DEFAULT 1,
+			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (player1_id) REFERENCES submissions(id),
+			FOREIGN KEY (player2_id) REFERENCES submissions(id),
+			FOREIGN KEY (winner_id) REFERENCES submissions(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS rating_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			submission_id INTEGER NOT NULL,
+			rating REAL NOT NULL,
+			rd REAL NOT NULL,
+			volatility REAL NOT NULL,
+			match_id INTEGER,
+			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (submission_id) REFERENCES submissions(id),
+			FOREIGN KEY (match_id) REFERENCES matches(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_bracket_matches_tournament ON bracket_matches(tournament_id);
+		CREATE INDEX IF NOT EXISTS idx_bracket_matches_status ON bracket_matches(status);
+		CREATE INDEX IF NOT EXISTS idx_tournaments_status ON tournaments(status);
+		CREATE INDEX IF NOT EXISTS idx_matches_player1 ON matches(player1_id);
+		CREATE INDEX IF NOT EXISTS idx_matches_player2 ON matches(player2_id);
+		CREATE INDEX IF NOT EXISTS idx_matches_valid ON matches(is_valid);
+		CREATE INDEX IF NOT EXISTS idx_submissions_username ON submissions(username);
+		CREATE INDEX IF NOT EXISTS idx_submissions_status ON submissions(status);
+		CREATE INDEX IF NOT EXISTS idx_submissions_active ON submissions(is_active);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_matches_unique_pair ON matches(player1_id, player2_id, is_valid) WHERE is_valid = 1;
+		CREATE INDEX IF NOT EXISTS idx_rating_history_submission ON rating_history(submission_id, timestamp);
+		`),
+	},
+	{
+		Version: 2,
+		Name:    "benchmarks",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS benchmarks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			submission_id INTEGER NOT NULL,
+			board_set TEXT NOT NULL,
+			boards INTEGER NOT NULL,
+			avg_shots REAL NOT NULL,
+			min_shots INTEGER,
+			max_shots INTEGER,
+			timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (submission_id) REFERENCES submissions(id)
+		);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_benchmarks_submission_set ON benchmarks(submission_id, board_set);
+		`),
+	},
+	{
+		Version: 3,
+		Name:    "reference bots",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS reference_bots (
+			username TEXT PRIMARY KEY,
+			source TEXT NOT NULL,
+			pinned_rating REAL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		`),
+	},
+	{
+		Version: 4,
+		Name:    "seasons",
+		up: func(tx *sqlTx) error {
+			if err := tx.ddl(`
+			CREATE TABLE IF NOT EXISTS seasons (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				status TEXT DEFAULT 'active',
+				started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				ended_at TIMESTAMP
+			);
+
+			CREATE TABLE IF NOT EXISTS season_standings (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				season_id INTEGER NOT NULL,
+				rank INTEGER NOT NULL,
+				username TEXT NOT NULL,
+				rating INTEGER,
+				rd INTEGER,
+				wins INTEGER,
+				losses INTEGER,
+				win_pct REAL,
+				avg_moves REAL,
+				benchmark_shots REAL,
+				has_benchmark BOOLEAN DEFAULT 0,
+				is_bot BOOLEAN DEFAULT 0,
+				FOREIGN KEY (season_id) REFERENCES seasons(id)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_season_standings_season ON season_standings(season_id, rank);
+			CREATE INDEX IF NOT EXISTS idx_season_standings_username ON season_standings(username);
+			`); err != nil {
+				return err
+			}
+			for _, table := range []string{"submissions", "matches", "tournaments"} {
+				if err := ensureColumn(tx, table, "season_id", "INTEGER REFERENCES seasons(id)"); err != nil {
+					return err
+				}
+				if err := tx.ddl(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_season ON %s(season_id)", table, table)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 5,
+		Name:    "arenas",
+		up: func(tx *sqlTx) error {
+			if err := tx.ddl(`
+			CREATE TABLE IF NOT EXISTS arenas (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				slug TEXT UNIQUE NOT NULL,
+				name TEXT NOT NULL,
+				engine_path TEXT NOT NULL DEFAULT '',
+				games_per_match INTEGER NOT NULL DEFAULT 1000,
+				roster_only BOOLEAN DEFAULT 0,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+
+			CREATE TABLE IF NOT EXISTS arena_members (
+				arena_id INTEGER NOT NULL,
+				username TEXT NOT NULL,
+				role TEXT NOT NULL DEFAULT 'member',
+				added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (arena_id, username),
+				FOREIGN KEY (arena_id) REFERENCES arenas(id)
+			);
+			`); err != nil {
+				return err
+			}
+			for _, table := range []string{"submissions", "tournaments", "season_standings"} {
+				if err := ensureColumn(tx, table, "arena_id", "INTEGER REFERENCES arenas(id)"); err != nil {
+					return err
+				}
+				if err := tx.ddl(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_arena ON %s(arena_id)", table, table)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 6,
+		Name:    "registration",
+		up: func(tx *sqlTx) error {
+			if err := tx.ddl(`
+			CREATE TABLE IF NOT EXISTS roster (
+				username TEXT PRIMARY KEY,
+				email TEXT NOT NULL DEFAULT '',
+				name TEXT NOT NULL DEFAULT '',
+				added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+
+			CREATE TABLE IF NOT EXISTS invite_codes (
+				code TEXT PRIMARY KEY,
+				note TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				used_by TEXT,
+				used_at TIMESTAMP
+			);
+			`); err != nil {
+				return err
+			}
+			return ensureColumn(tx, "users", "revoked_at", "TIMESTAMP")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "multiple keys per user",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS user_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			public_key TEXT UNIQUE NOT NULL,
+			fingerprint TEXT NOT NULL,
+			label TEXT NOT NULL DEFAULT '',
+			added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_user_keys_username ON user_keys(username);
+		`),
+	},
+	{
+		Version: 8,
+		Name:    "admin roles and audit log",
+		up: func(tx *sqlTx) error {
+			if err := tx.ddl(`
+			CREATE TABLE IF NOT EXISTS audit_log (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				actor TEXT NOT NULL,
+				action TEXT NOT NULL,
+				target TEXT,
+				detail TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			`); err != nil {
+				return err
+			}
+			if err := ensureColumn(tx, "users", "role", "TEXT NOT NULL DEFAULT 'user'"); err != nil {
+				return err
+			}
+			return ensureColumn(tx, "user_keys", "is_admin", "BOOLEAN NOT NULL DEFAULT 0")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "compile logs and deleted usernames",
+		up: func(tx *sqlTx) error {
+			if err := tx.ddl(`
+			CREATE TABLE IF NOT EXISTS deleted_users (
+				username TEXT PRIMARY KEY,
+				deleted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			);
+			`); err != nil {
+				return err
+			}
+			return ensureColumn(tx, "submissions", "compile_log", "TEXT")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "admin dashboard sessions",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS admin_login_tokens (
+			token_hash TEXT PRIMARY KEY,
+			username TEXT NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS admin_sessions (
+			token_hash TEXT PRIMARY KEY,
+			username TEXT NOT NULL,
+			csrf_token TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL
+		);
+		`),
+	},
+	{
+		Version: 11,
+		Name:    "job queue",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			type TEXT NOT NULL,
+			key TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'queued',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL DEFAULT 3,
+			run_after TIMESTAMP NOT NULL,
+			lease_owner TEXT,
+			lease_expires TIMESTAMP,
+			last_error TEXT,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, run_after);
+		CREATE INDEX IF NOT EXISTS idx_jobs_key ON jobs(key);
+		`),
+	},
+	{
+		Version: 12,
+		Name:    "submission logs",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS submission_logs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			submission_id INTEGER NOT NULL,
+			logged_at TIMESTAMP NOT NULL,
+			level TEXT NOT NULL,
+			line TEXT NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_submission_logs_submission ON submission_logs(submission_id, id);
+		`),
+	},
+	{
+		Version: 13,
+		Name:    "one active submission per user and arena",
+		// Concurrent uploads could leave a user with two active submissions;
+		// the newest one wins
+		up: execSQL(`
+		UPDATE submissions SET is_active = 0
+		WHERE is_active = 1 AND id NOT IN (
+			SELECT MAX(id) FROM submissions WHERE is_active = 1 GROUP BY username, arena_id
+		);
+
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_submissions_one_active ON submissions(username, arena_id) WHERE is_active = 1;
+		`),
+	},
+	{
+		Version: 14,
+		Name:    "match details and replays",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS match_details (
+			match_id INTEGER PRIMARY KEY REFERENCES matches(id),
+			games INTEGER NOT NULL,
+			ties INTEGER NOT NULL,
+			seed INTEGER NOT NULL,
+			engine_version TEXT NOT NULL,
+			runtime_ms INTEGER NOT NULL,
+			move_counts TEXT NOT NULL,
+			player1_invalid INTEGER NOT NULL DEFAULT 0,
+			player2_invalid INTEGER NOT NULL DEFAULT 0,
+			output TEXT NOT NULL DEFAULT ''
+		);
+
+		CREATE TABLE IF NOT EXISTS match_replays (
+			match_id INTEGER NOT NULL REFERENCES matches(id),
+			game INTEGER NOT NULL,
+			winner INTEGER NOT NULL,
+			shots TEXT NOT NULL,
+			PRIMARY KEY (match_id, game)
+		);
+		`),
+	},
+	{
+		Version: 15,
+		Name:    "submission source history",
+		up: func(tx *sqlTx) error {
+			if err := ensureColumn(tx, "submissions", "content_hash", "TEXT"); err != nil {
+				return err
+			}
+			return ensureColumn(tx, "submissions", "restored_from", "INTEGER REFERENCES submissions(id)")
+		},
+	},
+	{
+		Version: 16,
+		Name:    "multi-file submissions",
+		up: execSQL(`
+		CREATE TABLE IF NOT EXISTS submission_files (
+			submission_id INTEGER NOT NULL REFERENCES submissions(id),
+			path TEXT NOT NULL,
+			content_hash TEXT NOT NULL,
+			PRIMARY KEY (submission_id, path)
+		);
+		`),
+	},
+}
+
+// execSQL is a migration that runs a fixed script
+func execSQL(script string) func(tx *sqlTx) error {
+	return func(tx *sqlTx) error {
+		return tx.ddl(script)
+	}
+}
+
+// ddl runs schema statements written for SQLite, translated for the
+// database the transaction is on
+func (t *sqlTx) ddl(script string) error {
+	_, err := t.exec(t.dialect.ddl(script))
+	return err
+}
+
+// MigrationState is a migration and when it was applied, if it has been
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// LatestSchemaVersion is the version this build migrates databases to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func ensureMigrationsTable(db *SQLStore) error {
+	_, err := db.exec(db.dialect.ddl(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`))
+	return err
+}
+
+// appliedMigrations maps each applied version to when it was applied
+func appliedMigrations(db *SQLStore) (map[int]time.Time, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	rows, err := db.query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatus lists every migration this build knows and whether it has
+// been applied. It fails if the database was migrated by a newer build.
+func MigrationStatus(db *SQLStore) ([]MigrationState, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	for version := range applied {
+		if version > LatestSchemaVersion() {
+			return nil, fmt.Errorf("database schema is at version %d but this build only knows up to %d; upgrade battleship-arena", version, LatestSchemaVersion())
+		}
+	}
+
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i].Migration = m
+		if at, ok := applied[m.Version]; ok {
+			states[i].AppliedAt = &at
+		}
+	}
+	return states, nil
+}
+
+// Migrate applies every pending migration in order and returns the ones it
+// applied. A migration that fails is rolled back, and later ones are not
+// attempted.
+func Migrate(db *SQLStore) ([]Migration, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, state := range states {
+		if state.AppliedAt != nil {
+			continue
+		}
+		if err := applyMigration(db, state.Migration); err != nil {
+			return done, fmt.Errorf("migration %d (%s): %v", state.Version, state.Name, err)
+		}
+		slog.Info("applied migration", "version", state.Version, "name", state.Name)
+		done = append(done, state.Migration)
+	}
+	return done, nil
+}
+
+func applyMigration(db *SQLStore, m Migration) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.exec(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Name, time.Now(),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const aliceKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAILMM0iY7qOndGcBgoxywrohXQtqfXYtvRtcvhNPjS4ye"
+
+// loadBaseline writes the pre-versioning fixture into a fresh SQLite file
+// and returns its path
+func loadBaseline(t *testing.T) string {
+	t.Helper()
+	script, err := os.ReadFile(filepath.Join("testdata", "baseline_schema.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "arena.db")
+	raw, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	if _, err := raw.Exec(string(script)); err != nil {
+		t.Fatalf("loading baseline: %v", err)
+	}
+	return path
+}
+
+func countRows(t *testing.T, s *SQLStore, table string) int {
+	t.Helper()
+	var n int
+	if err := s.queryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatalf("counting %s: %v", table, err)
+	}
+	return n
+}
+
+func TestMigrateBaselineDatabase(t *testing.T) {
+	path := loadBaseline(t)
+
+	s, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	defer s.Close()
+
+	var latest int
+	if err := s.queryRow("SELECT MAX(version) FROM schema_migrations").Scan(&latest); err != nil {
+		t.Fatal(err)
+	}
+	if latest != LatestSchemaVersion() {
+		t.Errorf("schema at version %d, want %d", latest, LatestSchemaVersion())
+	}
+	states, err := MigrationStatus(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			t.Errorf("migration %d (%s) not applied", state.Version, state.Name)
+		}
+	}
+
+	want := map[string]int{"users": 2, "submissions": 3, "matches": 2, "rating_history": 2, "tournaments": 1, "bracket_matches": 1}
+	for table, n := range want {
+		if got := countRows(t, s, table); got != n {
+			t.Errorf("%s has %d rows after migrating, want %d", table, got, n)
+		}
+	}
+
+	sub, err := s.GetSubmissionByID(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Username != "alice" || !sub.IsActive || sub.Status != "completed" {
+		t.Errorf("submission 2 = %+v, want alice's active completed upload", sub)
+	}
+	if sub.ArenaID == 0 {
+		t.Error("old submission was not moved into the default arena")
+	}
+	rating, err := s.GetRating(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rating.Rating != 1612.5 {
+		t.Errorf("rating of submission 2 = %v, want 1612.5", rating.Rating)
+	}
+	match, err := s.GetMatch(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match == nil || match.WinnerID != 2 {
+		t.Errorf("match 2 = %+v, want a win for submission 2", match)
+	}
+
+	// The key that lived on the users row now lives in user_keys
+	user, err := s.GetUserByPublicKey(aliceKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user == nil || user.Username != "alice" {
+		t.Errorf("alice's key finds %+v", user)
+	}
+
+	// A second run has nothing left to do
+	done, err := Migrate(s)
+	if err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+	if len(done) != 0 {
+		t.Errorf("second Migrate applied %d migrations, want none", len(done))
+	}
+	if got := countRows(t, s, "schema_migrations"); got != len(migrations) {
+		t.Errorf("schema_migrations has %d rows, want %d", got, len(migrations))
+	}
+	if got := countRows(t, s, "submissions"); got != 3 {
+		t.Errorf("submissions has %d rows after a second run, want 3", got)
+	}
+}
+
+func TestMigrateRestartIsNoOp(t *testing.T) {
+	path := loadBaseline(t)
+
+	s, err := InitDB(path)
+	if err != nil {
+		t.Fatalf("first InitDB: %v", err)
+	}
+	users, seasons := countRows(t, s, "user_keys"), countRows(t, s, "seasons")
+	s.Close()
+
+	s, err = InitDB(path)
+	if err != nil {
+		t.Fatalf("second InitDB: %v", err)
+	}
+	defer s.Close()
+	if got := countRows(t, s, "user_keys"); got != users {
+		t.Errorf("user_keys went from %d to %d rows on restart", users, got)
+	}
+	if got := countRows(t, s, "seasons"); got != seasons {
+		t.Errorf("seasons went from %d to %d rows on restart", seasons, got)
+	}
+}
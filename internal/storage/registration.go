@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type RosterEntry struct {
+	Username string
+	Email    string
+	Name     string
+	AddedAt  time.Time
+}
+
+type InviteCode struct {
+	Code      string
+	Note      string
+	CreatedAt time.Time
+	UsedBy    string // empty until redeemed
+	UsedAt    time.Time
+}
+
+// ImportRoster reads a CSV of allowed students with a header row naming any
+// of the columns username, email and name. When a row has no username, the
+// local part of the email address is used. Existing entries are updated, so
+// re-importing a corrected file is safe. It returns the number of rows read.
+func ImportRoster(r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("reading roster header: %v", err)
+	}
+	columns := map[string]int{}
+	for i, col := range header {
+		columns[strings.ToLower(strings.TrimSpace(col))] = i
+	}
+	_, hasUsername := columns["username"]
+	_, hasEmail := columns["email"]
+	if !hasUsername && !hasEmail {
+		return 0, fmt.Errorf("roster needs a username or email column")
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	tx, err := db.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	count := 0
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("roster line %d: %v", line, err)
+		}
+
+		// Spreadsheet exports often end in rows of bare commas
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		username, email, name := field(record, "username"), field(record, "email"), field(record, "name")
+		if username == "" {
+			username, _, _ = strings.Cut(email, "@")
+		}
+		if username == "" {
+			return 0, fmt.Errorf("roster line %d: no username or email", line)
+		}
+
+		_, err = tx.exec(
+			`INSERT INTO roster (username, email, name) VALUES (?, ?, ?)
+			 ON CONFLICT(username) DO UPDATE SET email = excluded.email, name = excluded.name`,
+			username, email, name,
+		)
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	return count, tx.Commit()
+}
+
+func IsOnRoster(username string) (bool, error) {
+	var count int
+	err := db.queryRow("SELECT COUNT(*) FROM roster WHERE username = ?", username).Scan(&count)
+	return count > 0, err
+}
+
+func GetRoster() ([]RosterEntry, error) {
+	rows, err := db.query("SELECT username, email, name, added_at FROM roster ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []RosterEntry
+	for rows.Next() {
+		var e RosterEntry
+		if err := rows.Scan(&e.Username, &e.Email, &e.Name, &e.AddedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// inviteAlphabet leaves out characters that are easy to misread when a code
+// is copied off a slide or a printout
+const inviteAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func newInviteCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, 9)
+	for i, b := range buf {
+		if i == 4 {
+			code = append(code, '-')
+		}
+		code = append(code, inviteAlphabet[int(b)%len(inviteAlphabet)])
+	}
+	return string(code), nil
+}
+
+// NormalizeInviteCode lets users type codes in lower case or without the dash
+func NormalizeInviteCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	if len(code) == 8 {
+		code = code[:4] + "-" + code[4:]
+	}
+	return code
+}
+
+// CreateInviteCodes generates n single-use invite codes
+func CreateInviteCodes(n int, note string) ([]string, error) {
+	var codes []string
+	for len(codes) < n {
+		code, err := newInviteCode()
+		if err != nil {
+			return nil, err
+		}
+		result, err := db.exec("INSERT INTO invite_codes (code, note) VALUES (?, ?) ON CONFLICT DO NOTHING", code, note)
+		if err != nil {
+			return nil, err
+		}
+		if rows, _ := result.RowsAffected(); rows == 1 {
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
+func GetInviteCodes() ([]InviteCode, error) {
+	rows, err := db.query("SELECT code, note, created_at, used_by, used_at FROM invite_codes ORDER BY created_at, code")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []InviteCode
+	for rows.Next() {
+		var c InviteCode
+		var usedBy sql.NullString
+		var usedAt sql.NullTime
+		if err := rows.Scan(&c.Code, &c.Note, &c.CreatedAt, &usedBy, &usedAt); err != nil {
+			return nil, err
+		}
+		c.UsedBy = usedBy.String
+		if usedAt.Valid {
+			c.UsedAt = usedAt.Time
+		}
+		codes = append(codes, c)
+	}
+	return codes, rows.Err()
+}
+
+// CheckInviteCode reports why a code can't be used, or nil if it can
+func CheckInviteCode(code string) error {
+	var usedBy sql.NullString
+	err := db.queryRow("SELECT used_by FROM invite_codes WHERE code = ?", NormalizeInviteCode(code)).Scan(&usedBy)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("unknown invite code")
+	}
+	if err != nil {
+		return err
+	}
+	if usedBy.Valid {
+		return fmt.Errorf("invite code has already been used")
+	}
+	return nil
+}
+
+// RegisterUser creates an account, redeeming an invite code in the same
+// transaction when one is given so a code can never admit two users
+func (s *SQLStore) RegisterUser(username, name, bio, link, publicKey, inviteCode string) (*User, error) {
+	tx, err := s.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var deleted int
+	if err := tx.queryRow("SELECT COUNT(*) FROM deleted_users WHERE username = ?", username).Scan(&deleted); err != nil {
+		return nil, err
+	}
+	if deleted > 0 {
+		return nil, ErrDeletedUsername
+	}
+
+	now := time.Now()
+	if inviteCode != "" {
+		result, err := tx.exec(
+			"UPDATE invite_codes SET used_by = ?, used_at = ? WHERE code = ? AND used_by IS NULL",
+			username, now, NormalizeInviteCode(inviteCode),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return nil, fmt.Errorf("invite code is not valid")
+		}
+	}
+
+	id, err := tx.insert(
+		`INSERT INTO users (username, name, bio, link, public_key, created_at, last_login_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		username, name, bio, link, publicKey, now, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// Admin-created accounts carry a placeholder instead of a real key
+	if _, _, _, err := ParsePublicKey(publicKey); err == nil {
+		if _, err := insertUserKey(tx, username, publicKey, ""); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &User{
+		ID:          int(id),
+		Username:    username,
+		Name:        name,
+		Bio:         bio,
+		Link:        link,
+		PublicKey:   publicKey,
+		CreatedAt:   now,
+		LastLoginAt: now,
+	}, nil
+}
+
+// RevokeUser locks an account out of SSH and withdraws its submissions from
+// every ladder. The account and its history are kept so it can be restored.
+func RevokeUser(username string) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.exec("UPDATE users SET revoked_at = ? WHERE username = ?", time.Now(), username)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("no user named %q", username)
+	}
+	if _, err := tx.exec("UPDATE submissions SET is_active = 0 WHERE username = ?", username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RestoreUser lifts a revocation; the user has to upload again to rejoin
+func RestoreUser(username string) error {
+	result, err := db.exec("UPDATE users SET revoked_at = NULL WHERE username = ?", username)
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("no user named %q", username)
+	}
+	return nil
+}
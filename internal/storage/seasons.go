@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type Season struct {
+	ID        int
+	Name      string
+	Status    string
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+type SeasonStanding struct {
+	SeasonID       int
+	SeasonName     string
+	ArenaSlug      string
+	ArenaName      string
+	Rank           int
+	Username       string
+	Rating         int
+	RD             int
+	Wins           int
+	Losses         int
+	WinPct         float64
+	AvgMoves       float64
+	BenchmarkShots float64
+	HasBenchmark   bool
+	IsBot          bool
+}
+
+// ensureCurrentSeason opens "Season 1" on a fresh database and adopts any
+// rows written before seasons existed into it
+func ensureCurrentSeason(db *SQLStore) error {
+	var count int
+	if err := db.queryRow("SELECT COUNT(*) FROM seasons").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	id, err := db.insert("INSERT INTO seasons (name, status, started_at) VALUES ('Season 1', 'active', ?)", time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"submissions", "matches", "tournaments"} {
+		if _, err := db.exec(fmt.Sprintf("UPDATE %s SET season_id = ? WHERE season_id IS NULL", table), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanSeason(row interface{ Scan(...interface{}) error }) (*Season, error) {
+	var s Season
+	var endedAt sql.NullTime
+	err := row.Scan(&s.ID, &s.Name, &s.Status, &s.StartedAt, &endedAt)
+	if err != nil {
+		return nil, err
+	}
+	if endedAt.Valid {
+		s.EndedAt = endedAt.Time
+	}
+	return &s, nil
+}
+
+// GetCurrentSeason returns the open season, or nil between seasons
+func GetCurrentSeason() (*Season, error) {
+	season, err := scanSeason(db.queryRow(
+		"SELECT id, name, status, started_at, ended_at FROM seasons WHERE status = 'active' ORDER BY id DESC LIMIT 1",
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return season, err
+}
+
+func GetSeason(id int) (*Season, error) {
+	season, err := scanSeason(db.queryRow(
+		"SELECT id, name, status, started_at, ended_at FROM seasons WHERE id = ?", id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return season, err
+}
+
+func GetSeasons() ([]Season, error) {
+	rows, err := db.query("SELECT id, name, status, started_at, ended_at FROM seasons ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seasons []Season
+	for rows.Next() {
+		s, err := scanSeason(rows)
+		if err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, *s)
+	}
+	return seasons, rows.Err()
+}
+
+// currentSeasonID returns the open season's ID, or an error if none is open
+func (s *SQLStore) currentSeasonID() (int, error) {
+	var id int
+	err := s.queryRow("SELECT id FROM seasons WHERE status = 'active' ORDER BY id DESC LIMIT 1").Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("no active season; an admin must open one")
+	}
+	return id, err
+}
+
+// CloseSeason freezes every arena's leaderboard as the season's final
+// standings, retires every active submission and cancels any running tournament
+func CloseSeason() (*Season, error) {
+	season, err := GetCurrentSeason()
+	if err != nil {
+		return nil, err
+	}
+	if season == nil {
+		return nil, fmt.Errorf("no active season to close")
+	}
+
+	if err := RecalculateAllGlicko2Ratings(); err != nil {
+		return nil, err
+	}
+	arenas, err := GetArenas()
+	if err != nil {
+		return nil, err
+	}
+	standings := make(map[int][]LeaderboardEntry)
+	for _, arena := range arenas {
+		entries, err := QueryLeaderboard(LeaderboardQuery{ArenaID: arena.ID, Limit: -1, SortBy: SortByRating})
+		if err != nil {
+			return nil, err
+		}
+		standings[arena.ID] = entries
+	}
+
+	tx, err := db.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for arenaID, entries := range standings {
+		rank := 0
+		for _, e := range entries {
+			if e.IsPending || e.IsBroken {
+				continue
+			}
+			rank++
+			_, err := tx.exec(
+				`INSERT INTO season_standings
+				 (season_id, arena_id, rank, username, rating, rd, wins, losses, win_pct, avg_moves, benchmark_shots, has_benchmark, is_bot)
+				 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				season.ID, arenaID, rank, e.Username, e.Rating, e.RD, e.Wins, e.Losses, e.WinPct, e.AvgMoves, e.BenchmarkShots, e.HasBenchmark, e.IsBot,
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if _, err := tx.exec("UPDATE submissions SET is_active = 0 WHERE season_id = ? AND is_active = 1", season.ID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.exec("UPDATE tournaments SET status = 'cancelled' WHERE season_id = ? AND status = 'active'", season.ID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.exec("UPDATE seasons SET status = 'closed', ended_at = ? WHERE id = ?", time.Now(), season.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetSeason(season.ID)
+}
+
+// OpenSeason starts a new season; the previous one must be closed first
+func OpenSeason(name string) (*Season, error) {
+	current, err := GetCurrentSeason()
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, fmt.Errorf("season %q is still active; close it first", current.Name)
+	}
+
+	id, err := db.insert("INSERT INTO seasons (name, status, started_at) VALUES (?, 'active', ?)", name, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return GetSeason(int(id))
+}
+
+// GetSeasonStandings returns an arena's frozen final standings for a closed season
+func GetSeasonStandings(seasonID, arenaID int) ([]SeasonStanding, error) {
+	return querySeasonStandings("WHERE ss.season_id = ? AND ss.arena_id = ? ORDER BY ss.rank", seasonID, arenaID)
+}
+
+// GetUserSeasonHistory lists a player's final standing in every closed season
+// across all arenas
+func GetUserSeasonHistory(username string) ([]SeasonStanding, error) {
+	return querySeasonStandings("WHERE ss.username = ? ORDER BY ss.season_id DESC, a.id", username)
+}
+
+func querySeasonStandings(where string, args ...interface{}) ([]SeasonStanding, error) {
+	rows, err := db.query(`
+		SELECT ss.season_id, se.name, a.slug, a.name, ss.rank, ss.username, ss.rating, ss.rd, ss.wins, ss.losses,
+		       ss.win_pct, ss.avg_moves, ss.benchmark_shots, ss.has_benchmark, ss.is_bot
+		FROM season_standings ss
+		JOIN seasons se ON se.id = ss.season_id
+		JOIN arenas a ON a.id = ss.arena_id
+		`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var standings []SeasonStanding
+	for rows.Next() {
+		var s SeasonStanding
+		err := rows.Scan(&s.SeasonID, &s.SeasonName, &s.ArenaSlug, &s.ArenaName, &s.Rank, &s.Username, &s.Rating, &s.RD, &s.Wins, &s.Losses,
+			&s.WinPct, &s.AvgMoves, &s.BenchmarkShots, &s.HasBenchmark, &s.IsBot)
+		if err != nil {
+			return nil, err
+		}
+		standings = append(standings, s)
+	}
+	return standings, rows.Err()
+}
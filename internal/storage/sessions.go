@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	// AdminLoginTTL is how long a login link from "ssh host admin-login" works
+	AdminLoginTTL = 5 * time.Minute
+	// AdminSessionTTL is how long a web admin session lasts after login
+	AdminSessionTTL = 12 * time.Hour
+)
+
+type AdminSession struct {
+	Username  string
+	CSRFToken string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Only hashes of tokens are stored, so a copy of the database can't be used
+// to log in
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAdminLoginToken issues a single-use token that can be exchanged for
+// a web admin session. It is handed out over SSH to sessions that logged in
+// with an admin key, so the web login rests on the same key.
+func CreateAdminLoginToken(username string) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = db.exec(
+		"INSERT INTO admin_login_tokens (token_hash, username, expires_at) VALUES (?, ?, ?)",
+		hashToken(token), username, time.Now().Add(AdminLoginTTL),
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RedeemAdminLoginToken uses up a login token and starts a session for its
+// owner, who must still be an admin
+func RedeemAdminLoginToken(token string) (*AdminSession, string, error) {
+	var username string
+	err := db.queryRow(
+		"SELECT username FROM admin_login_tokens WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?",
+		hashToken(token), time.Now(),
+	).Scan(&username)
+	if err == sql.ErrNoRows {
+		return nil, "", fmt.Errorf("login link is invalid, used or expired")
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	result, err := db.exec("UPDATE admin_login_tokens SET used_at = ? WHERE token_hash = ? AND used_at IS NULL", time.Now(), hashToken(token))
+	if err != nil {
+		return nil, "", err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, "", fmt.Errorf("login link is invalid, used or expired")
+	}
+
+	if err := checkAdmin(username); err != nil {
+		return nil, "", err
+	}
+
+	sessionToken, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+	csrfToken, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	session := &AdminSession{
+		Username:  username,
+		CSRFToken: csrfToken,
+		CreatedAt: now,
+		ExpiresAt: now.Add(AdminSessionTTL),
+	}
+	_, err = db.exec(
+		"INSERT INTO admin_sessions (token_hash, username, csrf_token, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		hashToken(sessionToken), username, csrfToken, session.CreatedAt, session.ExpiresAt,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	return session, sessionToken, nil
+}
+
+// GetAdminSession looks up a session cookie. It returns nil once the session
+// has expired or its owner has lost the admin role.
+func GetAdminSession(token string) (*AdminSession, error) {
+	var s AdminSession
+	err := db.queryRow(
+		"SELECT username, csrf_token, created_at, expires_at FROM admin_sessions WHERE token_hash = ? AND expires_at > ?",
+		hashToken(token), time.Now(),
+	).Scan(&s.Username, &s.CSRFToken, &s.CreatedAt, &s.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if checkAdmin(s.Username) != nil {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func DeleteAdminSession(token string) error {
+	_, err := db.exec("DELETE FROM admin_sessions WHERE token_hash = ?", hashToken(token))
+	return err
+}
+
+func checkAdmin(username string) error {
+	user, err := GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.IsAdmin() || user.IsRevoked() {
+		return fmt.Errorf("%s is not an admin", username)
+	}
+	return nil
+}
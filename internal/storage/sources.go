@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"battleship-arena/internal/bundle"
+)
+
+// sourcesDir holds every source ever uploaded, under the upload directory
+// and named by content hash, so a new upload never overwrites an old version
+const sourcesDir = ".sources"
+
+// SourcePath is where the source with the given content hash is kept
+func SourcePath(uploadDir, hash string) string {
+	return filepath.Join(uploadDir, sourcesDir, hash[:2], hash+".cpp")
+}
+
+// SaveSource keeps a copy of an uploaded source and returns its content
+// hash. Saving the same source twice keeps one copy.
+func SaveSource(uploadDir string, content []byte) (string, error) {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	path := SourcePath(uploadDir, hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	// Write under a temporary name so a crash can't leave a partial source
+	// behind the hash
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// SubmissionSourcePath is where the source a submission was uploaded with is
+// kept. Submissions from before sources were kept only have the file in the
+// user's directory, which a later upload of the same name overwrote.
+func SubmissionSourcePath(uploadDir string, sub Submission) (string, error) {
+	if sub.ContentHash != "" {
+		return SourcePath(uploadDir, sub.ContentHash), nil
+	}
+	var later int
+	err := db.queryRow(
+		"SELECT COUNT(*) FROM submissions WHERE username = ? AND arena_id = ? AND filename = ? AND id > ?",
+		sub.Username, sub.ArenaID, sub.Filename, sub.ID,
+	).Scan(&later)
+	if err != nil {
+		return "", err
+	}
+	if later > 0 {
+		return "", fmt.Errorf("the source of submission %d was replaced before versions were kept", sub.ID)
+	}
+	arena, err := GetArenaByID(sub.ArenaID)
+	if err != nil {
+		return "", err
+	}
+	if arena == nil {
+		return "", fmt.Errorf("arena %d not found", sub.ArenaID)
+	}
+	return filepath.Join(arena.UserDir(uploadDir, sub.Username), sub.Filename), nil
+}
+
+// ReadSource returns the source a submission was uploaded with
+func ReadSource(uploadDir string, sub Submission) ([]byte, error) {
+	path, err := SubmissionSourcePath(uploadDir, sub)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		err = fmt.Errorf("the source of submission %d is missing", sub.ID)
+	}
+	return content, err
+}
+
+// AddUpload keeps a copy of a file just written to the user's directory and
+// queues it as their new submission
+func AddUpload(uploadDir string, arena *Arena, username, filename string) (int64, error) {
+	content, err := os.ReadFile(filepath.Join(arena.UserDir(uploadDir, username), filename))
+	if err != nil {
+		return 0, err
+	}
+	hash, err := SaveSource(uploadDir, content)
+	if err != nil {
+		return 0, fmt.Errorf("keeping a copy of %s: %v", filename, err)
+	}
+	return AddSubmission(arena.ID, username, filename, hash, nil)
+}
+
+// AddBundle keeps a copy of every file of a multi-file upload and queues it
+// as the user's new submission, under the name of its entrypoint
+func AddBundle(uploadDir string, arena *Arena, username string, b *bundle.Bundle) (int64, error) {
+	var entrypointHash string
+	files := make([]SubmissionFile, 0, len(b.Files))
+	for _, f := range b.Files {
+		hash, err := SaveSource(uploadDir, f.Content)
+		if err != nil {
+			return 0, fmt.Errorf("keeping a copy of %s: %v", f.Path, err)
+		}
+		if f.Path == b.Entrypoint {
+			entrypointHash = hash
+		}
+		files = append(files, SubmissionFile{Path: f.Path, ContentHash: hash})
+	}
+	return AddSubmission(arena.ID, username, b.Entrypoint, entrypointHash, files)
+}
+
+// BundleDir is the directory in the user's upload directory that a
+// multi-file submission with the given entrypoint is uploaded as
+func BundleDir(entrypoint string) string {
+	return strings.TrimSuffix(entrypoint, filepath.Ext(entrypoint))
+}
+
+// RestoreVersion makes an older submission the user's active one again. Its
+// source goes back in their directory, as if they had uploaded it; the files
+// of a multi-file submission replace its directory.
+func RestoreVersion(uploadDir string, sub Submission) (int64, error) {
+	if sub.ContentHash == "" {
+		return 0, fmt.Errorf("submission %d was uploaded before sources were kept and can't be restored", sub.ID)
+	}
+	content, err := ReadSource(uploadDir, sub)
+	if err != nil {
+		return 0, err
+	}
+	arena, err := GetArenaByID(sub.ArenaID)
+	if err != nil {
+		return 0, err
+	}
+	if arena == nil {
+		return 0, fmt.Errorf("arena %d not found", sub.ArenaID)
+	}
+	files, err := GetSubmissionFiles(sub.ID)
+	if err != nil {
+		return 0, err
+	}
+	userDir := arena.UserDir(uploadDir, sub.Username)
+	if len(files) > 0 {
+		if err := restoreFiles(uploadDir, filepath.Join(userDir, BundleDir(sub.Filename)), files); err != nil {
+			return 0, err
+		}
+		return RestoreSubmission(sub.ID)
+	}
+	if err := os.MkdirAll(userDir, 0755); err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(filepath.Join(userDir, sub.Filename), content, 0644); err != nil {
+		return 0, err
+	}
+	return RestoreSubmission(sub.ID)
+}
+
+// restoreFiles writes a multi-file submission's kept files into dir,
+// replacing what was there
+func restoreFiles(uploadDir, dir string, files []SubmissionFile) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	for _, f := range files {
+		content, err := os.ReadFile(SourcePath(uploadDir, f.ContentHash))
+		if err != nil {
+			return fmt.Errorf("the source of %s is missing", f.Path)
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst, content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// dialect covers the differences between the databases SQLStore runs on.
+// Queries are written once, for SQLite with ? placeholders, and rewritten
+// for PostgreSQL as they are run.
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+func (d dialect) String() string {
+	if d == dialectPostgres {
+		return "postgres"
+	}
+	return "sqlite"
+}
+
+// rebind numbers the ? placeholders for PostgreSQL, skipping any inside
+// string literals
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+		case r == '?' && !inString:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// args converts Go values to what the schema stores. Booleans are INTEGER
+// columns on both databases, but only SQLite converts them itself.
+func (d dialect) args(args []interface{}) []interface{} {
+	if d != dialectPostgres {
+		return args
+	}
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		if b, ok := arg.(bool); ok {
+			if b {
+				arg = 1
+			} else {
+				arg = 0
+			}
+		}
+		converted[i] = arg
+	}
+	return converted
+}
+
+var (
+	pgAutoIncrement = regexp.MustCompile(`INTEGER PRIMARY KEY AUTOINCREMENT`)
+	pgBoolean       = regexp.MustCompile(`\bBOOLEAN\b`)
+	pgReal          = regexp.MustCompile(`\bREAL\b`)
+	pgTimestamp     = regexp.MustCompile(`\bTIMESTAMP\b`)
+	pgForeignKey    = regexp.MustCompile(`,\s*FOREIGN KEY \(\w+\) REFERENCES \w+\(\w+\)`)
+	pgReferences    = regexp.MustCompile(` REFERENCES \w+\(\w+\)`)
+)
+
+// ddl rewrites schema statements for PostgreSQL. Booleans stay integers so
+// queries can compare them with 1 and 0 everywhere, timestamps keep their
+// time zone, and foreign keys are left out because SQLite never enforced
+// them and the code relies on that.
+func (d dialect) ddl(script string) string {
+	if d != dialectPostgres {
+		return script
+	}
+	script = pgAutoIncrement.ReplaceAllString(script, "BIGSERIAL PRIMARY KEY")
+	script = pgBoolean.ReplaceAllString(script, "INTEGER")
+	script = pgReal.ReplaceAllString(script, "DOUBLE PRECISION")
+	script = pgTimestamp.ReplaceAllString(script, "TIMESTAMPTZ")
+	script = pgForeignKey.ReplaceAllString(script, "")
+	return pgReferences.ReplaceAllString(script, "")
+}
+
+// sqliteBusyTimeout is how many milliseconds a SQLite statement waits for
+// another connection's lock before failing with "database is locked"
+const sqliteBusyTimeout = 10000
+
+// SQLStore keeps the arena in SQLite or PostgreSQL
+type SQLStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// Open connects to the database named by dsn without touching its schema:
+// a postgres:// URL, or otherwise the path of a SQLite file
+func Open(dsn string) (*SQLStore, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		db, err := sql.Open("postgres_timed", dsn)
+		if err != nil {
+			return nil, err
+		}
+		return &SQLStore{db: db, dialect: dialectPostgres}, nil
+	}
+
+	// WAL lets the web handlers read while the worker writes. Transactions
+	// take the write lock up front and wait for it, rather than failing when
+	// a read inside one turns into a write while another writer is active.
+	db, err := sql.Open("sqlite3_timed", dsn+"?parseTime=true&_journal_mode=WAL&_busy_timeout="+strconv.Itoa(sqliteBusyTimeout)+"&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db, dialect: dialectSQLite}, nil
+}
+
+// Backend names the database kind, "sqlite" or "postgres"
+func (s *SQLStore) Backend() string {
+	return s.dialect.String()
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// ErrNotSupported is returned by the functions outside Store when the store
+// in use isn't SQL, as with a MemoryStore in tests
+var ErrNotSupported = errors.New("not supported by this store")
+
+// The query helpers below may be called on a nil SQLStore, which is what the
+// package-level db is under any other Store; they fail with ErrNotSupported.
+
+func (s *SQLStore) exec(query string, args ...interface{}) (sql.Result, error) {
+	if s == nil {
+		return nil, ErrNotSupported
+	}
+	return s.db.Exec(s.dialect.rebind(query), s.dialect.args(args)...)
+}
+
+func (s *SQLStore) query(query string, args ...interface{}) (*sql.Rows, error) {
+	if s == nil {
+		return nil, ErrNotSupported
+	}
+	return s.db.Query(s.dialect.rebind(query), s.dialect.args(args)...)
+}
+
+func (s *SQLStore) queryRow(query string, args ...interface{}) row {
+	if s == nil {
+		return row{err: ErrNotSupported}
+	}
+	return row{Row: s.db.QueryRow(s.dialect.rebind(query), s.dialect.args(args)...)}
+}
+
+// row is a *sql.Row, or the error that kept its query from running
+type row struct {
+	*sql.Row
+	err error
+}
+
+func (r row) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.Row.Scan(dest...)
+}
+
+// insert runs an INSERT into a table with an id column and returns the new
+// row's id; PostgreSQL has no LastInsertId, so it asks for it instead
+func (s *SQLStore) insert(query string, args ...interface{}) (int64, error) {
+	if s == nil {
+		return 0, ErrNotSupported
+	}
+	return insertID(s.dialect, s.db, query, args)
+}
+
+func (s *SQLStore) begin() (*sqlTx, error) {
+	if s == nil {
+		return nil, ErrNotSupported
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{tx: tx, dialect: s.dialect}, nil
+}
+
+// sqlTx is a transaction that rewrites its queries like SQLStore
+type sqlTx struct {
+	tx      *sql.Tx
+	dialect dialect
+}
+
+func (t *sqlTx) exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.tx.Exec(t.dialect.rebind(query), t.dialect.args(args)...)
+}
+
+func (t *sqlTx) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.tx.Query(t.dialect.rebind(query), t.dialect.args(args)...)
+}
+
+func (t *sqlTx) queryRow(query string, args ...interface{}) *sql.Row {
+	return t.tx.QueryRow(t.dialect.rebind(query), t.dialect.args(args)...)
+}
+
+func (t *sqlTx) insert(query string, args ...interface{}) (int64, error) {
+	return insertID(t.dialect, t.tx, query, args)
+}
+
+func (t *sqlTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *sqlTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+func insertID(d dialect, conn interface {
+	Exec(string, ...interface{}) (sql.Result, error)
+	QueryRow(string, ...interface{}) *sql.Row
+}, query string, args []interface{}) (int64, error) {
+	if d == dialectPostgres {
+		var id int64
+		err := conn.QueryRow(d.rebind(query)+" RETURNING id", d.args(args)...).Scan(&id)
+		return id, err
+	}
+	result, err := conn.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// isUniqueViolation reports whether err is an insert clashing with a UNIQUE
+// constraint, which SQLite and PostgreSQL word differently
+func isUniqueViolation(err error) bool {
+	return strings.Contains(strings.ToUpper(err.Error()), "UNIQUE")
+}
+
+// parseDBTime reads a timestamp the driver handed back as text, as SQLite
+// does for aggregates like MAX(timestamp)
+func parseDBTime(value string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04:05.999999999-07:00", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// noLimit stands in for an unlimited LIMIT, which PostgreSQL won't take as -1
+func noLimit(limit int) int {
+	if limit < 0 {
+		return 1<<31 - 1
+	}
+	return limit
+}
+
+// ensureColumn adds a column to an existing table if it isn't there yet
+func ensureColumn(tx *sqlTx, table, column, definition string) error {
+	if tx.dialect == dialectPostgres {
+		_, err := tx.exec(tx.dialect.ddl(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, column, definition)))
+		return err
+	}
+
+	rows, err := tx.query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = tx.exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
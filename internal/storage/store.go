@@ -0,0 +1,313 @@
+package storage
+
+// Store keeps the arena's core records: submissions, matches, users,
+// ratings and tournaments. SQLStore is the real one; MemoryStore stands in
+// for it in tests.
+//
+// The package-level functions of the same names call the store set by Use,
+// so callers never handle a Store themselves.
+type Store interface {
+	// Submissions
+	AddSubmission(arenaID int, username, filename, contentHash string, files []SubmissionFile) (int64, error)
+	RestoreSubmission(id int) (int64, error)
+	GetSubmissionFiles(submissionID int) ([]SubmissionFile, error)
+	UpdateSubmissionStatus(id int, status string) error
+	GetSubmissionByID(id int) (Submission, error)
+	GetActiveSubmission(arenaID int, username string) (*Submission, error)
+	GetPendingSubmissions() ([]Submission, error)
+	GetActiveSubmissions(arenaID int) ([]Submission, error)
+	GetUserSubmissions(username string) ([]Submission, error)
+	GetUserSubmissionsWithStats(arenaID int, username string, limit int) ([]SubmissionWithStats, error)
+	GetQueuedPlayerNames() []string
+
+	// Matches
+	AddMatch(player1ID, player2ID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves int, details *MatchDetails) (int64, error)
+	HasMatchBetween(player1ID, player2ID int) (bool, error)
+	GetAllMatches(arenaID int) ([]MatchResult, error)
+	GetMatchRecords(playerID int) ([]MatchRecord, error)
+	GetAverageMoves(submissionID int) (float64, error)
+	QueryMatches(q MatchQuery) ([]Match, int, error)
+	GetMatch(id int) (*Match, error)
+	GetMatchDetails(matchID int) (*MatchDetails, error)
+
+	// Ratings
+	QueryLeaderboard(q LeaderboardQuery) ([]LeaderboardEntry, error)
+	GetRating(submissionID int) (Glicko2Player, error)
+	SetRatings(ratings map[int]Glicko2Player) error
+	GetRatings() (map[int]Glicko2Player, error)
+	GetPinnedRatings() (map[int]float64, error)
+	RecordRatingHistory(submissionID int, matchID int, rating, rd, volatility float64) error
+	GetRatingHistory(submissionID int) ([]RatingHistoryPoint, error)
+
+	// Users
+	RegisterUser(username, name, bio, link, publicKey, inviteCode string) (*User, error)
+	GetUserByUsername(username string) (*User, error)
+	GetUserByPublicKey(publicKey string) (*User, error)
+	UpdateUserLastLogin(username string) error
+	UpdateUserProfile(username, name, bio, link string) error
+	GetAllUsers() ([]User, error)
+
+	// Tournaments
+	GetActiveTournament(arenaID int) (*Tournament, error)
+	GetLatestTournament(arenaID int) (*Tournament, error)
+	GetTournaments(arenaID int) ([]Tournament, error)
+	GetTournament(id int) (*Tournament, error)
+	CreateTournament(arenaID int) (*Tournament, error)
+	DeleteTournament(tournamentID int) error
+	UpdateTournamentRound(tournamentID, round int) error
+	CompleteTournament(tournamentID, winnerID int) error
+	AddBracketMatch(tournamentID, round, position, player1ID, player2ID int) error
+	AddByeMatch(tournamentID, round, position, player1ID, player2ID, winnerID int) error
+	GetPendingBracketMatches(tournamentID int) ([]BracketMatch, error)
+	GetAllBracketMatches(tournamentID int) ([]BracketMatch, error)
+	UpdateBracketMatchResult(matchID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves int) error
+	IsRoundComplete(tournamentID, round int) (bool, error)
+
+	Close() error
+}
+
+var (
+	store Store
+
+	// db backs everything outside Store: jobs, arenas, seasons, keys and the
+	// rest, which only run on SQL. Under any other store it is nil and they
+	// fail with ErrNotSupported.
+	db *SQLStore
+)
+
+// Use makes s the store the package-level functions work on
+func Use(s Store) {
+	store = s
+	db, _ = s.(*SQLStore)
+}
+
+// Close closes the store in use
+func Close() error {
+	return store.Close()
+}
+
+// AddSubmission queues a new upload, replacing the user's previous submission
+// in the same arena; their entries in other arenas are left alone. Uploads
+// go through AddUpload or AddBundle, which keep a copy of the sources first.
+func AddSubmission(arenaID int, username, filename, contentHash string, files []SubmissionFile) (int64, error) {
+	return store.AddSubmission(arenaID, username, filename, contentHash, files)
+}
+
+// RestoreSubmission queues an older submission's source as the user's new
+// submission. RestoreVersion also puts the source back in their directory.
+func RestoreSubmission(id int) (int64, error) {
+	return store.RestoreSubmission(id)
+}
+
+// GetSubmissionFiles lists the files of a submission uploaded as an archive
+// or a directory, or nothing for a single source
+func GetSubmissionFiles(submissionID int) ([]SubmissionFile, error) {
+	return store.GetSubmissionFiles(submissionID)
+}
+
+func UpdateSubmissionStatus(id int, status string) error {
+	return store.UpdateSubmissionStatus(id, status)
+}
+
+func GetSubmissionByID(id int) (Submission, error) {
+	return store.GetSubmissionByID(id)
+}
+
+// GetActiveSubmission returns the user's current submission in an arena, or
+// nil if they have none
+func GetActiveSubmission(arenaID int, username string) (*Submission, error) {
+	return store.GetActiveSubmission(arenaID, username)
+}
+
+func GetPendingSubmissions() ([]Submission, error) {
+	return store.GetPendingSubmissions()
+}
+
+func GetActiveSubmissions(arenaID int) ([]Submission, error) {
+	return store.GetActiveSubmissions(arenaID)
+}
+
+func GetUserSubmissions(username string) ([]Submission, error) {
+	return store.GetUserSubmissions(username)
+}
+
+// GetUserSubmissionsWithStats returns a user's submissions in an arena,
+// newest first, up to limit of them or all if limit is negative
+func GetUserSubmissionsWithStats(arenaID int, username string, limit int) ([]SubmissionWithStats, error) {
+	return store.GetUserSubmissionsWithStats(arenaID, username, limit)
+}
+
+func GetQueuedPlayerNames() []string {
+	return store.GetQueuedPlayerNames()
+}
+
+// AddMatch records a head-to-head and, unless details is nil, how it was
+// played
+func AddMatch(player1ID, player2ID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves int, details *MatchDetails) (int64, error) {
+	return store.AddMatch(player1ID, player2ID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves, details)
+}
+
+func HasMatchBetween(player1ID, player2ID int) (bool, error) {
+	return store.HasMatchBetween(player1ID, player2ID)
+}
+
+func GetAllMatches(arenaID int) ([]MatchResult, error) {
+	return store.GetAllMatches(arenaID)
+}
+
+// GetMatchRecords returns a player's valid matches, oldest first
+func GetMatchRecords(playerID int) ([]MatchRecord, error) {
+	return store.GetMatchRecords(playerID)
+}
+
+// GetAverageMoves returns the moves a submission averaged over all its
+// matches, or 0 if it has none
+func GetAverageMoves(submissionID int) (float64, error) {
+	return store.GetAverageMoves(submissionID)
+}
+
+// QueryMatches returns one page of matches, newest first, and how many there
+// are in all
+func QueryMatches(q MatchQuery) ([]Match, int, error) {
+	return store.QueryMatches(q)
+}
+
+// GetMatch returns a match whether or not it is still valid, or nil if there
+// is no such match
+func GetMatch(id int) (*Match, error) {
+	return store.GetMatch(id)
+}
+
+// GetMatchDetails returns how a match was played, or nil if that wasn't
+// recorded
+func GetMatchDetails(matchID int) (*MatchDetails, error) {
+	return store.GetMatchDetails(matchID)
+}
+
+func QueryLeaderboard(q LeaderboardQuery) ([]LeaderboardEntry, error) {
+	return store.QueryLeaderboard(q)
+}
+
+func GetRating(submissionID int) (Glicko2Player, error) {
+	return store.GetRating(submissionID)
+}
+
+// SetRatings writes several submissions' ratings at once, so readers never
+// see some updated and others not
+func SetRatings(ratings map[int]Glicko2Player) error {
+	return store.SetRatings(ratings)
+}
+
+// GetRatings returns the ratings of every active, compiled submission
+func GetRatings() (map[int]Glicko2Player, error) {
+	return store.GetRatings()
+}
+
+// GetPinnedRatings maps active submission IDs of pinned bots to their fixed rating
+func GetPinnedRatings() (map[int]float64, error) {
+	return store.GetPinnedRatings()
+}
+
+func RecordRatingHistory(submissionID int, matchID int, rating, rd, volatility float64) error {
+	return store.RecordRatingHistory(submissionID, matchID, rating, rd, volatility)
+}
+
+func GetRatingHistory(submissionID int) ([]RatingHistoryPoint, error) {
+	return store.GetRatingHistory(submissionID)
+}
+
+// RegisterUser creates an account, redeeming an invite code in the same
+// transaction when one is given so a code can never admit two users.
+// Usernames reserved for reference bots are refused.
+func RegisterUser(username, name, bio, link, publicKey, inviteCode string) (*User, error) {
+	if IsReservedUsername(username) {
+		return nil, ErrReservedUsername
+	}
+	return store.RegisterUser(username, name, bio, link, publicKey, inviteCode)
+}
+
+func GetUserByUsername(username string) (*User, error) {
+	return store.GetUserByUsername(username)
+}
+
+// GetUserByPublicKey finds the account any of whose registered keys matches
+func GetUserByPublicKey(publicKey string) (*User, error) {
+	return store.GetUserByPublicKey(publicKey)
+}
+
+func UpdateUserLastLogin(username string) error {
+	return store.UpdateUserLastLogin(username)
+}
+
+func UpdateUserProfile(username, name, bio, link string) error {
+	return store.UpdateUserProfile(username, name, bio, link)
+}
+
+func GetAllUsers() ([]User, error) {
+	return store.GetAllUsers()
+}
+
+func GetActiveTournament(arenaID int) (*Tournament, error) {
+	return store.GetActiveTournament(arenaID)
+}
+
+func GetLatestTournament(arenaID int) (*Tournament, error) {
+	return store.GetLatestTournament(arenaID)
+}
+
+// GetTournaments lists an arena's tournaments, newest first
+func GetTournaments(arenaID int) ([]Tournament, error) {
+	return store.GetTournaments(arenaID)
+}
+
+// GetTournament returns a tournament, or nil if there is no such tournament
+func GetTournament(id int) (*Tournament, error) {
+	return store.GetTournament(id)
+}
+
+func CreateTournament(arenaID int) (*Tournament, error) {
+	return store.CreateTournament(arenaID)
+}
+
+// DeleteTournament removes a tournament and its bracket
+func DeleteTournament(tournamentID int) error {
+	return store.DeleteTournament(tournamentID)
+}
+
+func UpdateTournamentRound(tournamentID, round int) error {
+	return store.UpdateTournamentRound(tournamentID, round)
+}
+
+func CompleteTournament(tournamentID, winnerID int) error {
+	return store.CompleteTournament(tournamentID, winnerID)
+}
+
+func AddBracketMatch(tournamentID, round, position, player1ID, player2ID int) error {
+	return store.AddBracketMatch(tournamentID, round, position, player1ID, player2ID)
+}
+
+// AddByeMatch records a match one player advances from without playing
+func AddByeMatch(tournamentID, round, position, player1ID, player2ID, winnerID int) error {
+	return store.AddByeMatch(tournamentID, round, position, player1ID, player2ID, winnerID)
+}
+
+func GetPendingBracketMatches(tournamentID int) ([]BracketMatch, error) {
+	return store.GetPendingBracketMatches(tournamentID)
+}
+
+func GetAllBracketMatches(tournamentID int) ([]BracketMatch, error) {
+	return store.GetAllBracketMatches(tournamentID)
+}
+
+func UpdateBracketMatchResult(matchID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves int) error {
+	return store.UpdateBracketMatchResult(matchID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves)
+}
+
+func IsRoundComplete(tournamentID, round int) (bool, error) {
+	return store.IsRoundComplete(tournamentID, round)
+}
+
+var (
+	_ Store = (*SQLStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,53 @@
+package storage
+
+import "time"
+
+// SubmissionLogLine is one log line recorded while a submission was being
+// compiled, benchmarked or played
+type SubmissionLogLine struct {
+	SubmissionID int
+	LoggedAt     time.Time
+	Level        string
+	Line         string
+}
+
+// AppendSubmissionLogs stores a batch of log lines in one transaction
+func AppendSubmissionLogs(lines []SubmissionLogLine) error {
+	tx, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, l := range lines {
+		if _, err := tx.exec(
+			"INSERT INTO submission_logs (submission_id, logged_at, level, line) VALUES (?, ?, ?, ?)",
+			l.SubmissionID, l.LoggedAt, l.Level, l.Line,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetSubmissionLog returns a submission's log lines, oldest first
+func GetSubmissionLog(submissionID int) ([]SubmissionLogLine, error) {
+	rows, err := db.query(
+		"SELECT submission_id, logged_at, level, line FROM submission_logs WHERE submission_id = ? ORDER BY id",
+		submissionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []SubmissionLogLine
+	for rows.Next() {
+		var l SubmissionLogLine
+		if err := rows.Scan(&l.SubmissionID, &l.LoggedAt, &l.Level, &l.Line); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
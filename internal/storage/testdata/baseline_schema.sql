@@ -0,0 +1,117 @@
+-- A database as left by the last release before schema versioning: the
+-- original InitDB schema and a little data. migrations_test.go migrates it.
+
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL,
+	name TEXT NOT NULL,
+	bio TEXT,
+	link TEXT,
+	public_key TEXT UNIQUE NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_login_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS submissions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	upload_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	status TEXT DEFAULT 'pending',
+	is_active BOOLEAN DEFAULT 1,
+	glicko_rating REAL DEFAULT 1500.0,
+	glicko_rd REAL DEFAULT 350.0,
+	glicko_volatility REAL DEFAULT 0.06
+);
+
+CREATE TABLE IF NOT EXISTS tournaments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	status TEXT DEFAULT 'active',
+	current_round INTEGER DEFAULT 1,
+	winner_id INTEGER,
+	FOREIGN KEY (winner_id) REFERENCES submissions(id)
+);
+
+CREATE TABLE IF NOT EXISTS bracket_matches (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	tournament_id INTEGER,
+	round INTEGER,
+	position INTEGER,
+	player1_id INTEGER,
+	player2_id INTEGER,
+	winner_id INTEGER,
+	player1_wins INTEGER DEFAULT 0,
+	player2_wins INTEGER DEFAULT 0,
+	player1_moves INTEGER,
+	player2_moves INTEGER,
+	status TEXT DEFAULT 'pending',
+	timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (tournament_id) REFERENCES tournaments(id),
+	FOREIGN KEY (player1_id) REFERENCES submissions(id),
+	FOREIGN KEY (player2_id) REFERENCES submissions(id),
+	FOREIGN KEY (winner_id) REFERENCES submissions(id)
+);
+
+CREATE TABLE IF NOT EXISTS matches (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	player1_id INTEGER,
+	player2_id INTEGER,
+	winner_id INTEGER,
+	player1_wins INTEGER DEFAULT 0,
+	player2_wins INTEGER DEFAULT 0,
+	player1_moves INTEGER,
+	player2_moves INTEGER,
+	is_valid BOOLEAN DEFAULT 1,
+	timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (player1_id) REFERENCES submissions(id),
+	FOREIGN KEY (player2_id) REFERENCES submissions(id),
+	FOREIGN KEY (winner_id) REFERENCES submissions(id)
+);
+
+CREATE TABLE IF NOT EXISTS rating_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	submission_id INTEGER NOT NULL,
+	rating REAL NOT NULL,
+	rd REAL NOT NULL,
+	volatility REAL NOT NULL,
+	match_id INTEGER,
+	timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (submission_id) REFERENCES submissions(id),
+	FOREIGN KEY (match_id) REFERENCES matches(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bracket_matches_tournament ON bracket_matches(tournament_id);
+CREATE INDEX IF NOT EXISTS idx_bracket_matches_status ON bracket_matches(status);
+CREATE INDEX IF NOT EXISTS idx_tournaments_status ON tournaments(status);
+CREATE INDEX IF NOT EXISTS idx_matches_player1 ON matches(player1_id);
+CREATE INDEX IF NOT EXISTS idx_matches_player2 ON matches(player2_id);
+CREATE INDEX IF NOT EXISTS idx_matches_valid ON matches(is_valid);
+CREATE INDEX IF NOT EXISTS idx_submissions_username ON submissions(username);
+CREATE INDEX IF NOT EXISTS idx_submissions_status ON submissions(status);
+CREATE INDEX IF NOT EXISTS idx_submissions_active ON submissions(is_active);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_matches_unique_pair ON matches(player1_id, player2_id, is_valid) WHERE is_valid = 1;
+CREATE INDEX IF NOT EXISTS idx_rating_history_submission ON rating_history(submission_id, timestamp);
+
+INSERT INTO users (id, username, name, bio, link, public_key, created_at, last_login_at) VALUES
+	(1, 'alice', 'Alice Archer', 'hunts in parity', '', 'ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAILMM0iY7qOndGcBgoxywrohXQtqfXYtvRtcvhNPjS4ye', '2025-01-10 09:00:00', '2025-02-01 12:00:00'),
+	(2, 'bob', 'Bob Baker', '', '', 'admin-override-bob', '2025-01-11 09:00:00', NULL);
+
+INSERT INTO submissions (id, username, filename, upload_time, status, is_active, glicko_rating, glicko_rd, glicko_volatility) VALUES
+	(1, 'alice', 'memory_functions_alice.cpp', '2025-01-12 10:00:00', 'completed', 0, 1480.0, 120.0, 0.06),
+	(2, 'alice', 'memory_functions_alice.cpp', '2025-01-20 10:00:00', 'completed', 1, 1612.5, 80.0, 0.059),
+	(3, 'bob', 'memory_functions_bob.cpp', '2025-01-21 10:00:00', 'completed', 1, 1387.5, 80.0, 0.061);
+
+INSERT INTO matches (id, player1_id, player2_id, winner_id, player1_wins, player2_wins, player1_moves, player2_moves, is_valid, timestamp) VALUES
+	(1, 1, 3, 3, 420, 580, 61, 55, 0, '2025-01-21 10:05:00'),
+	(2, 2, 3, 2, 640, 360, 48, 57, 1, '2025-01-21 10:06:00');
+
+INSERT INTO rating_history (id, submission_id, rating, rd, volatility, match_id, timestamp) VALUES
+	(1, 2, 1612.5, 80.0, 0.059, 2, '2025-01-21 10:06:00'),
+	(2, 3, 1387.5, 80.0, 0.061, 2, '2025-01-21 10:06:00');
+
+INSERT INTO tournaments (id, created_at, status, current_round, winner_id) VALUES
+	(1, '2025-01-25 15:00:00', 'completed', 1, 2);
+
+INSERT INTO bracket_matches (id, tournament_id, round, position, player1_id, player2_id, winner_id, player1_wins, player2_wins, player1_moves, player2_moves, status, timestamp) VALUES
+	(1, 1, 1, 0, 2, 3, 2, 3, 1, 47, 58, 'completed', '2025-01-25 15:10:00');
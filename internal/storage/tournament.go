@@ -3,17 +3,18 @@ package storage
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
 	"sort"
 )
 
-func GetActiveTournament() (*Tournament, error) {
+func (s *SQLStore) GetActiveTournament(arenaID int) (*Tournament, error) {
 	var t Tournament
 	var winnerID sql.NullInt64
-	err := DB.QueryRow(
-		"SELECT id, created_at, status, current_round, winner_id FROM tournaments WHERE status = 'active' ORDER BY id DESC LIMIT 1",
-	).Scan(&t.ID, &t.CreatedAt, &t.Status, &t.CurrentRound, &winnerID)
+	err := s.queryRow(
+		"SELECT id, created_at, status, current_round, winner_id, arena_id FROM tournaments WHERE status = 'active' AND arena_id = ? ORDER BY id DESC LIMIT 1",
+		arenaID,
+	).Scan(&t.ID, &t.CreatedAt, &t.Status, &t.CurrentRound, &winnerID, &t.ArenaID)
 	
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -24,12 +25,13 @@ func GetActiveTournament() (*Tournament, error) {
 	return &t, err
 }
 
-func GetLatestTournament() (*Tournament, error) {
+func (s *SQLStore) GetLatestTournament(arenaID int) (*Tournament, error) {
 	var t Tournament
 	var winnerID sql.NullInt64
-	err := DB.QueryRow(
-		"SELECT id, created_at, status, current_round, winner_id FROM tournaments ORDER BY id DESC LIMIT 1",
-	).Scan(&t.ID, &t.CreatedAt, &t.Status, &t.CurrentRound, &winnerID)
+	err := s.queryRow(
+		"SELECT id, created_at, status, current_round, winner_id, arena_id FROM tournaments WHERE arena_id = ? ORDER BY id DESC LIMIT 1",
+		arenaID,
+	).Scan(&t.ID, &t.CreatedAt, &t.Status, &t.CurrentRound, &winnerID, &t.ArenaID)
 	
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -40,39 +42,98 @@ func GetLatestTournament() (*Tournament, error) {
 	return &t, err
 }
 
-func CreateTournament() (*Tournament, error) {
-	result, err := DB.Exec("INSERT INTO tournaments (status, current_round) VALUES ('active', 1)")
+// GetTournaments lists an arena's tournaments, newest first
+func (s *SQLStore) GetTournaments(arenaID int) ([]Tournament, error) {
+	rows, err := s.query(
+		"SELECT id, created_at, status, current_round, COALESCE(winner_id, 0), arena_id FROM tournaments WHERE arena_id = ? ORDER BY id DESC",
+		arenaID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var tournaments []Tournament
+	for rows.Next() {
+		var t Tournament
+		if err := rows.Scan(&t.ID, &t.CreatedAt, &t.Status, &t.CurrentRound, &t.WinnerID, &t.ArenaID); err != nil {
+			return nil, err
+		}
+		tournaments = append(tournaments, t)
+	}
+	return tournaments, rows.Err()
+}
+
+func (s *SQLStore) GetTournament(id int) (*Tournament, error) {
+	var t Tournament
+	err := s.queryRow(
+		"SELECT id, created_at, status, current_round, COALESCE(winner_id, 0), arena_id FROM tournaments WHERE id = ?",
+		id,
+	).Scan(&t.ID, &t.CreatedAt, &t.Status, &t.CurrentRound, &t.WinnerID, &t.ArenaID)
+	
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return &t, err
+}
+
+func (s *SQLStore) CreateTournament(arenaID int) (*Tournament, error) {
+	seasonID, err := s.currentSeasonID()
+	if err != nil {
+		return nil, err
+	}
+	
+	id, err := s.insert("INSERT INTO tournaments (status, current_round, season_id, arena_id) VALUES ('active', 1, ?, ?)", seasonID, arenaID)
 	if err != nil {
 		return nil, err
 	}
 	
-	id, _ := result.LastInsertId()
 	return &Tournament{
 		ID:           int(id),
 		Status:       "active",
 		CurrentRound: 1,
+		ArenaID:      arenaID,
 	}, nil
 }
 
-func UpdateTournamentRound(tournamentID, round int) error {
-	_, err := DB.Exec("UPDATE tournaments SET current_round = ? WHERE id = ?", round, tournamentID)
+func (s *SQLStore) DeleteTournament(tournamentID int) error {
+	if _, err := s.exec("DELETE FROM bracket_matches WHERE tournament_id = ?", tournamentID); err != nil {
+		return err
+	}
+	_, err := s.exec("DELETE FROM tournaments WHERE id = ?", tournamentID)
 	return err
 }
 
-func CompleteTournament(tournamentID, winnerID int) error {
-	_, err := DB.Exec("UPDATE tournaments SET status = 'completed', winner_id = ? WHERE id = ?", winnerID, tournamentID)
+func (s *SQLStore) UpdateTournamentRound(tournamentID, round int) error {
+	_, err := s.exec("UPDATE tournaments SET current_round = ? WHERE id = ?", round, tournamentID)
 	return err
 }
 
-func AddBracketMatch(tournamentID, round, position, player1ID, player2ID int) error {
-	_, err := DB.Exec(
+func (s *SQLStore) CompleteTournament(tournamentID, winnerID int) error {
+	_, err := s.exec("UPDATE tournaments SET status = 'completed', winner_id = ? WHERE id = ?", winnerID, tournamentID)
+	return err
+}
+
+func (s *SQLStore) AddBracketMatch(tournamentID, round, position, player1ID, player2ID int) error {
+	_, err := s.exec(
 		"INSERT INTO bracket_matches (tournament_id, round, position, player1_id, player2_id, status) VALUES (?, ?, ?, ?, ?, 'pending')",
 		tournamentID, round, position, player1ID, player2ID,
 	)
 	return err
 }
 
-func GetPendingBracketMatches(tournamentID int) ([]BracketMatch, error) {
+// AddByeMatch records a match one player advances from without playing
+func (s *SQLStore) AddByeMatch(tournamentID, round, position, player1ID, player2ID, winnerID int) error {
+	_, err := s.exec(
+		`INSERT INTO bracket_matches (tournament_id, round, position, player1_id, player2_id, winner_id,
+		    player1_wins, player2_wins, player1_moves, player2_moves, status)
+		 VALUES (?, ?, ?, ?, ?, ?, 0, 0, 0, 0, 'completed')`,
+		tournamentID, round, position, player1ID, player2ID, winnerID,
+	)
+	return err
+}
+
+func (s *SQLStore) GetPendingBracketMatches(tournamentID int) ([]BracketMatch, error) {
 	query := `
 	SELECT 
 		bm.id, bm.tournament_id, bm.round, bm.position,
@@ -87,7 +148,7 @@ func GetPendingBracketMatches(tournamentID int) ([]BracketMatch, error) {
 	ORDER BY bm.round, bm.position
 	`
 	
-	rows, err := DB.Query(query, tournamentID)
+	rows, err := s.query(query, tournamentID)
 	if err != nil {
 		return nil, err
 	}
@@ -123,7 +184,7 @@ func GetPendingBracketMatches(tournamentID int) ([]BracketMatch, error) {
 	return matches, rows.Err()
 }
 
-func GetAllBracketMatches(tournamentID int) ([]BracketMatch, error) {
+func (s *SQLStore) GetAllBracketMatches(tournamentID int) ([]BracketMatch, error) {
 	query := `
 	SELECT 
 		bm.id, bm.tournament_id, bm.round, bm.position,
@@ -138,7 +199,7 @@ func GetAllBracketMatches(tournamentID int) ([]BracketMatch, error) {
 	ORDER BY bm.round, bm.position
 	`
 	
-	rows, err := DB.Query(query, tournamentID)
+	rows, err := s.query(query, tournamentID)
 	if err != nil {
 		return nil, err
 	}
@@ -180,8 +241,8 @@ func GetAllBracketMatches(tournamentID int) ([]BracketMatch, error) {
 	return matches, rows.Err()
 }
 
-func UpdateBracketMatchResult(matchID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves int) error {
-	_, err := DB.Exec(
+func (s *SQLStore) UpdateBracketMatchResult(matchID, winnerID, player1Wins, player2Wins, player1Moves, player2Moves int) error {
+	_, err := s.exec(
 		`UPDATE bracket_matches 
 		SET winner_id = ?, player1_wins = ?, player2_wins = ?, 
 		    player1_moves = ?, player2_moves = ?, status = 'completed' 
@@ -191,9 +252,9 @@ func UpdateBracketMatchResult(matchID, winnerID, player1Wins, player2Wins, playe
 	return err
 }
 
-func IsRoundComplete(tournamentID, round int) (bool, error) {
+func (s *SQLStore) IsRoundComplete(tournamentID, round int) (bool, error) {
 	var pendingCount int
-	err := DB.QueryRow(
+	err := s.queryRow(
 		"SELECT COUNT(*) FROM bracket_matches WHERE tournament_id = ? AND round = ? AND status != 'completed'",
 		tournamentID, round,
 	).Scan(&pendingCount)
@@ -209,16 +270,7 @@ func SeedSubmissions(submissions []Submission) []Submission {
 	
 	var entries []seedEntry
 	for _, sub := range submissions {
-		var avgMoves float64
-		err := DB.QueryRow(`
-			SELECT AVG(CASE 
-				WHEN m.player1_id = ? THEN m.player1_moves 
-				ELSE m.player2_moves 
-			END)
-			FROM matches m
-			WHERE m.player1_id = ? OR m.player2_id = ?
-		`, sub.ID, sub.ID, sub.ID).Scan(&avgMoves)
-		
+		avgMoves, err := GetAverageMoves(sub.ID)
 		if err != nil || avgMoves == 0 {
 			avgMoves = 100
 		}
@@ -239,7 +291,7 @@ func SeedSubmissions(submissions []Submission) []Submission {
 }
 
 func CreateBracket(tournament *Tournament) error {
-	submissions, err := GetActiveSubmissions()
+	submissions, err := GetActiveSubmissions(tournament.ArenaID)
 	if err != nil {
 		return err
 	}
@@ -250,16 +302,14 @@ func CreateBracket(tournament *Tournament) error {
 	
 	seeded := SeedSubmissions(submissions)
 	
-	log.Printf("Tournament %d: Seeded %d players", tournament.ID, len(seeded))
-	for i, sub := range seeded {
-		log.Printf("  Seed %d: %s", i+1, sub.Username)
-	}
-	
 	numPlayers := len(seeded)
 	bracketSize := int(math.Pow(2, math.Ceil(math.Log2(float64(numPlayers)))))
 	
-	log.Printf("Tournament %d: Bracket size=%d, players=%d", 
-		tournament.ID, bracketSize, numPlayers)
+	logger := slog.With("tournament_id", tournament.ID)
+	logger.Info("seeded tournament", "players", numPlayers, "bracket_size", bracketSize)
+	for i, sub := range seeded {
+		logger.Debug("tournament seed", "seed", i+1, "submission_id", sub.ID, "user", sub.Username)
+	}
 	
 	numFirstRoundMatches := bracketSize / 2
 	
@@ -272,20 +322,12 @@ func CreateBracket(tournament *Tournament) error {
 				player1ID := seeded[topSeedIdx].ID
 				player1Name := seeded[topSeedIdx].Username
 				
-				err = AddBracketMatch(tournament.ID, 1, matchPos, player1ID, 0)
+				err = AddByeMatch(tournament.ID, 1, matchPos, player1ID, 0, player1ID)
 				if err != nil {
 					return err
 				}
 				
-				DB.Exec(`
-					UPDATE bracket_matches 
-					SET winner_id = ?, status = 'completed', 
-					    player1_wins = 0, player2_wins = 0,
-					    player1_moves = 0, player2_moves = 0
-					WHERE tournament_id = ? AND round = 1 AND position = ?
-				`, player1ID, tournament.ID, matchPos)
-				
-				log.Printf("  Match %d: %s vs BYE (auto-advance)", matchPos, player1Name)
+				logger.Debug("bracket match", "round", 1, "position", matchPos, "player1", player1Name, "player2", "BYE")
 			}
 			break
 		}
@@ -313,103 +355,96 @@ func CreateBracket(tournament *Tournament) error {
 			continue
 		}
 		
-		err = AddBracketMatch(tournament.ID, 1, matchPos, player1ID, player2ID)
-		if err != nil {
-			return err
-		}
-		
 		if player1ID == 0 || player2ID == 0 {
 			winnerID := player1ID
 			if player1ID == 0 {
 				winnerID = player2ID
 			}
 			
-			DB.Exec(`
-				UPDATE bracket_matches 
-				SET winner_id = ?, status = 'completed', 
-				    player1_wins = 0, player2_wins = 0,
-				    player1_moves = 0, player2_moves = 0
-				WHERE tournament_id = ? AND round = 1 AND position = ?
-			`, winnerID, tournament.ID, matchPos)
+			err = AddByeMatch(tournament.ID, 1, matchPos, player1ID, player2ID, winnerID)
+			if err != nil {
+				return err
+			}
 			
-			log.Printf("  Match %d: %s vs %s (BYE - winner: %s)", 
-				matchPos, player1Name, player2Name, 
-				map[bool]string{true: player1Name, false: player2Name}[player1ID == winnerID])
+			logger.Debug("bracket match", "round", 1, "position", matchPos, "player1", player1Name, "player2", player2Name,
+				"bye_winner", map[bool]string{true: player1Name, false: player2Name}[player1ID == winnerID])
 		} else {
-			log.Printf("  Match %d: %s (seed %d) vs %s (seed %d)", 
-				matchPos, player1Name, topSeedIdx+1, player2Name, bottomSeedIdx+1)
+			err = AddBracketMatch(tournament.ID, 1, matchPos, player1ID, player2ID)
+			if err != nil {
+				return err
+			}
+			
+			logger.Debug("bracket match", "round", 1, "position", matchPos,
+				"player1", player1Name, "seed1", topSeedIdx+1, "player2", player2Name, "seed2", bottomSeedIdx+1)
 		}
 	}
 	
-	return nil
+	return EnqueueBracketMatches(tournament.ID)
 }
 
 func AdvanceWinners(tournamentID, currentRound int) error {
-	query := `
-		SELECT id, position, winner_id 
-		FROM bracket_matches 
-		WHERE tournament_id = ? AND round = ? AND status = 'completed'
-		ORDER BY position
-	`
-	
-	rows, err := DB.Query(query, tournamentID, currentRound)
+	matches, err := GetAllBracketMatches(tournamentID)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-	
-	var winners []struct {
-		matchID  int
-		position int
-		winnerID int
-	}
 	
-	for rows.Next() {
-		var w struct {
-			matchID  int
-			position int
-			winnerID int
+	// Matches come back ordered by round and position
+	var winners []int
+	for _, m := range matches {
+		if m.Round == currentRound && m.Status == "completed" {
+			winners = append(winners, m.WinnerID)
 		}
-		rows.Scan(&w.matchID, &w.position, &w.winnerID)
-		winners = append(winners, w)
 	}
 	
 	if len(winners) == 1 {
-		log.Printf("Tournament %d complete! Winner: ID %d", tournamentID, winners[0].winnerID)
-		return CompleteTournament(tournamentID, winners[0].winnerID)
+		slog.Info("tournament complete", "tournament_id", tournamentID, "winner_id", winners[0])
+		return CompleteTournament(tournamentID, winners[0])
 	}
 	
 	nextRound := currentRound + 1
-	log.Printf("Advancing to round %d with %d winners", nextRound, len(winners))
+	logger := slog.With("tournament_id", tournamentID)
+	logger.Info("advancing tournament", "round", nextRound, "winners", len(winners))
 	
 	for i := 0; i < len(winners); i += 2 {
 		if i+1 >= len(winners) {
-			log.Printf("  Round %d Match %d: BYE (winner: ID %d)", nextRound, i/2, winners[i].winnerID)
-			err = AddBracketMatch(tournamentID, nextRound, i/2, winners[i].winnerID, 0)
+			logger.Debug("bracket match", "round", nextRound, "position", i/2, "player1_id", winners[i], "player2", "BYE")
+			err = AddByeMatch(tournamentID, nextRound, i/2, winners[i], 0, winners[i])
 			if err != nil {
 				return err
 			}
-			DB.Exec(`
-				UPDATE bracket_matches 
-				SET winner_id = ?, status = 'completed',
-				    player1_wins = 0, player2_wins = 0,
-				    player1_moves = 0, player2_moves = 0
-				WHERE tournament_id = ? AND round = ? AND position = ?
-			`, winners[i].winnerID, tournamentID, nextRound, i/2)
 		} else {
-			log.Printf("  Round %d Match %d: ID %d vs ID %d", nextRound, i/2, winners[i].winnerID, winners[i+1].winnerID)
-			err = AddBracketMatch(tournamentID, nextRound, i/2, winners[i].winnerID, winners[i+1].winnerID)
+			logger.Debug("bracket match", "round", nextRound, "position", i/2, "player1_id", winners[i], "player2_id", winners[i+1])
+			err = AddBracketMatch(tournamentID, nextRound, i/2, winners[i], winners[i+1])
 			if err != nil {
 				return err
 			}
 		}
 	}
 	
-	return UpdateTournamentRound(tournamentID, nextRound)
+	if err := UpdateTournamentRound(tournamentID, nextRound); err != nil {
+		return err
+	}
+	return EnqueueBracketMatches(tournamentID)
 }
 
-func EnsureTournamentExists() (*Tournament, error) {
-	tournament, err := GetActiveTournament()
+// EnqueueBracketMatches queues a job for every bracket match still to be
+// played. Byes are completed when they are created, so they never get one.
+func EnqueueBracketMatches(tournamentID int) error {
+	matches, err := GetPendingBracketMatches(tournamentID)
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		payload := TournamentMatchPayload{TournamentID: tournamentID, MatchID: m.ID}
+		if _, err := EnqueueJob(JobTournamentMatch, TournamentMatchJobKey(m.ID), payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func EnsureTournamentExists(arenaID int) (*Tournament, error) {
+	tournament, err := GetActiveTournament(arenaID)
 	if err != nil {
 		return nil, err
 	}
@@ -418,18 +453,18 @@ func EnsureTournamentExists() (*Tournament, error) {
 		return tournament, nil
 	}
 	
-	latestTournament, err := GetLatestTournament()
+	latestTournament, err := GetLatestTournament(arenaID)
 	if err != nil {
 		return nil, err
 	}
 	
-	submissions, err := GetActiveSubmissions()
+	submissions, err := GetActiveSubmissions(arenaID)
 	if err != nil {
 		return nil, err
 	}
 	
 	if len(submissions) < 2 {
-		log.Printf("Not enough players for tournament (%d/2), waiting...", len(submissions))
+		slog.Info("not enough players for a tournament", "arena_id", arenaID, "players", len(submissions))
 		return nil, fmt.Errorf("need at least 2 players")
 	}
 	
@@ -443,13 +478,12 @@ func EnsureTournamentExists() (*Tournament, error) {
 		}
 		
 		if !hasNewSubmission {
-			log.Printf("No new submissions since last tournament, not creating new tournament")
+			slog.Info("no new submissions since the last tournament", "arena_id", arenaID)
 			return nil, fmt.Errorf("no new submissions")
 		}
 	}
 	
-	log.Printf("Creating tournament with %d players...", len(submissions))
-	tournament, err = CreateTournament()
+	tournament, err = CreateTournament(arenaID)
 	if err != nil {
 		return nil, err
 	}
@@ -458,7 +492,29 @@ func EnsureTournamentExists() (*Tournament, error) {
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("Created tournament %d with bracket", tournament.ID)
+	slog.Info("created tournament", "tournament_id", tournament.ID, "arena_id", arenaID, "players", len(submissions))
+	
+	return tournament, nil
+}
+
+// StartTournament creates a tournament and its bracket right away, for
+// admins who don't want to wait for new submissions
+func StartTournament(arenaID int) (*Tournament, error) {
+	active, err := GetActiveTournament(arenaID)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return nil, fmt.Errorf("tournament %d is still running", active.ID)
+	}
 	
+	tournament, err := CreateTournament(arenaID)
+	if err != nil {
+		return nil, err
+	}
+	if err := CreateBracket(tournament); err != nil {
+		DeleteTournament(tournament.ID)
+		return nil, err
+	}
 	return tournament, nil
 }
@@ -15,16 +15,24 @@ type User struct {
 	PublicKey   string
 	CreatedAt   time.Time
 	LastLoginAt time.Time
+	RevokedAt   time.Time // zero unless an admin revoked the account
+	Role        string
 }
 
-func GetUserByUsername(username string) (*User, error) {
+// IsRevoked reports whether an admin has locked this account out
+func (u *User) IsRevoked() bool {
+	return !u.RevokedAt.IsZero()
+}
+
+func (s *SQLStore) GetUserByUsername(username string) (*User, error) {
 	var u User
 	var lastLogin sql.NullTime
-	err := DB.QueryRow(
-		`SELECT id, username, name, bio, link, public_key, created_at, last_login_at 
+	var revoked sql.NullTime
+	err := s.queryRow(
+		`SELECT id, username, name, bio, link, public_key, created_at, last_login_at, revoked_at, role
 		 FROM users WHERE username = ?`,
 		username,
-	).Scan(&u.ID, &u.Username, &u.Name, &u.Bio, &u.Link, &u.PublicKey, &u.CreatedAt, &lastLogin)
+	).Scan(&u.ID, &u.Username, &u.Name, &u.Bio, &u.Link, &u.PublicKey, &u.CreatedAt, &lastLogin, &revoked, &u.Role)
 	
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -36,20 +44,26 @@ func GetUserByUsername(username string) (*User, error) {
 	if lastLogin.Valid {
 		u.LastLoginAt = lastLogin.Time
 	}
+	if revoked.Valid {
+		u.RevokedAt = revoked.Time
+	}
 	
 	return &u, nil
 }
 
-func GetUserByPublicKey(publicKey string) (*User, error) {
+// GetUserByPublicKey finds the account any of whose registered keys matches
+func (s *SQLStore) GetUserByPublicKey(publicKey string) (*User, error) {
 	publicKey = strings.TrimSpace(publicKey)
 	
 	var u User
 	var lastLogin sql.NullTime
-	err := DB.QueryRow(
-		`SELECT id, username, name, bio, link, public_key, created_at, last_login_at 
-		 FROM users WHERE TRIM(public_key) = ?`,
+	var revoked sql.NullTime
+	err := s.queryRow(
+		`SELECT u.id, u.username, u.name, u.bio, u.link, u.public_key, u.created_at, u.last_login_at, u.revoked_at, u.role
+		 FROM users u JOIN user_keys k ON k.username = u.username
+		 WHERE k.public_key = ?`,
 		publicKey,
-	).Scan(&u.ID, &u.Username, &u.Name, &u.Bio, &u.Link, &u.PublicKey, &u.CreatedAt, &lastLogin)
+	).Scan(&u.ID, &u.Username, &u.Name, &u.Bio, &u.Link, &u.PublicKey, &u.CreatedAt, &lastLogin, &revoked, &u.Role)
 	
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -61,52 +75,37 @@ func GetUserByPublicKey(publicKey string) (*User, error) {
 	if lastLogin.Valid {
 		u.LastLoginAt = lastLogin.Time
 	}
+	if revoked.Valid {
+		u.RevokedAt = revoked.Time
+	}
 	
 	return &u, nil
 }
 
+// CreateUser adds an account without an invite code; see RegisterUser
 func CreateUser(username, name, bio, link, publicKey string) (*User, error) {
-	result, err := DB.Exec(
-		`INSERT INTO users (username, name, bio, link, public_key, created_at, last_login_at) 
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		username, name, bio, link, publicKey, time.Now(), time.Now(),
-	)
-	if err != nil {
-		return nil, err
-	}
-	
-	id, _ := result.LastInsertId()
-	return &User{
-		ID:          int(id),
-		Username:    username,
-		Name:        name,
-		Bio:         bio,
-		Link:        link,
-		PublicKey:   publicKey,
-		CreatedAt:   time.Now(),
-		LastLoginAt: time.Now(),
-	}, nil
+	return RegisterUser(username, name, bio, link, publicKey, "")
 }
 
-func UpdateUserLastLogin(username string) error {
-	_, err := DB.Exec(
+func (s *SQLStore) UpdateUserLastLogin(username string) error {
+	_, err := s.exec(
 		"UPDATE users SET last_login_at = ? WHERE username = ?",
 		time.Now(), username,
 	)
 	return err
 }
 
-func UpdateUserProfile(username, name, bio, link string) error {
-	_, err := DB.Exec(
+func (s *SQLStore) UpdateUserProfile(username, name, bio, link string) error {
+	_, err := s.exec(
 		"UPDATE users SET name = ?, bio = ?, link = ? WHERE username = ?",
 		name, bio, link, username,
 	)
 	return err
 }
 
-func GetAllUsers() ([]User, error) {
-	rows, err := DB.Query(
-		`SELECT id, username, name, bio, link, public_key, created_at, last_login_at 
+func (s *SQLStore) GetAllUsers() ([]User, error) {
+	rows, err := s.query(
+		`SELECT id, username, name, bio, link, public_key, created_at, last_login_at, revoked_at, role
 		 FROM users ORDER BY created_at DESC`,
 	)
 	if err != nil {
@@ -118,13 +117,17 @@ func GetAllUsers() ([]User, error) {
 	for rows.Next() {
 		var u User
 		var lastLogin sql.NullTime
-		err := rows.Scan(&u.ID, &u.Username, &u.Name, &u.Bio, &u.Link, &u.PublicKey, &u.CreatedAt, &lastLogin)
+	var revoked sql.NullTime
+		err := rows.Scan(&u.ID, &u.Username, &u.Name, &u.Bio, &u.Link, &u.PublicKey, &u.CreatedAt, &lastLogin, &revoked, &u.Role)
 		if err != nil {
 			return nil, err
 		}
 		if lastLogin.Valid {
 			u.LastLoginAt = lastLogin.Time
 		}
+		if revoked.Valid {
+			u.RevokedAt = revoked.Time
+		}
 		users = append(users, u)
 	}
 	
@@ -0,0 +1,546 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"battleship-arena/internal/storage"
+)
+
+type adminTab int
+
+const (
+	adminQueue adminTab = iota
+	adminUsers
+	adminSubmissions
+)
+
+// sourceLines is how much of a submission's source the inspector shows at once
+const sourceLines = 20
+
+// AdminModel is the operator console, available to sessions that logged in
+// with an admin key. Every action it takes is written to the audit log
+// first and refused if that fails.
+type AdminModel struct {
+	renderer  *lipgloss.Renderer
+	username  string
+	width     int
+	height    int
+	uploadDir string
+
+	tab         adminTab
+	cursor      int
+	queue       []storage.Submission
+	users       []storage.User
+	submissions []storage.Submission
+	arenas      []storage.Arena
+	arenaIndex  int
+
+	// Submission inspector
+	inspecting  *storage.Submission
+	matches     []storage.SubmissionMatch
+	matchCursor int
+	compileLog  string
+	source      []string
+	log         []string
+	paging      string // "source" or "log" while scrolling through one
+	scroll      int
+
+	confirmDelete string // username waiting for a second D
+	busy          bool
+	message       string
+}
+
+type adminDataMsg struct {
+	queue       []storage.Submission
+	users       []storage.User
+	submissions []storage.Submission
+}
+
+type adminDoneMsg struct {
+	message string
+	err     error
+}
+
+func NewAdminModel(username string, width, height int, renderer *lipgloss.Renderer) AdminModel {
+	uploadDir := settings.Storage.UploadDir
+	arenas, _ := storage.GetArenas()
+
+	return AdminModel{
+		renderer:  renderer,
+		username:  username,
+		width:     width,
+		height:    height,
+		uploadDir: uploadDir,
+		arenas:    arenas,
+	}
+}
+
+func (m AdminModel) Init() tea.Cmd {
+	return tea.Batch(loadAdminData, tickCmd())
+}
+
+func loadAdminData() tea.Msg {
+	queue, _ := storage.GetQueue()
+	users, _ := storage.GetAllUsers()
+	submissions, _ := storage.GetRecentSubmissions(50)
+	return adminDataMsg{queue: queue, users: users, submissions: submissions}
+}
+
+// act audits an action and then runs it in the background
+func (m AdminModel) act(action, target, detail string, fn func() (string, error)) (AdminModel, tea.Cmd) {
+	m.busy = true
+	m.message = ""
+	username := m.username
+	return m, func() tea.Msg {
+		if err := storage.Audit(username, action, target, detail); err != nil {
+			return adminDoneMsg{err: fmt.Errorf("audit log unavailable, action refused: %v", err)}
+		}
+		message, err := fn()
+		return adminDoneMsg{message: message, err: err}
+	}
+}
+
+func (m AdminModel) listLen() int {
+	switch m.tab {
+	case adminQueue:
+		return len(m.queue)
+	case adminUsers:
+		return len(m.users)
+	default:
+		return len(m.submissions)
+	}
+}
+
+func (m AdminModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if m.busy && msg.String() != "ctrl+c" {
+			return m, nil
+		}
+		if m.inspecting != nil {
+			return m.updateInspector(msg)
+		}
+		return m.updateList(msg)
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+	case adminDataMsg:
+		m.queue = msg.queue
+		m.users = msg.users
+		m.submissions = msg.submissions
+		if n := m.listLen(); m.cursor >= n && n > 0 {
+			m.cursor = n - 1
+		}
+	case adminDoneMsg:
+		m.busy = false
+		if msg.err != nil {
+			m.message = "Error: " + msg.err.Error()
+		} else {
+			m.message = msg.message
+		}
+		if m.inspecting != nil {
+			m = m.inspect(*m.inspecting)
+		}
+		return m, loadAdminData
+	case tickMsg:
+		return m, tea.Batch(loadAdminData, tickCmd())
+	}
+	return m, nil
+}
+
+func (m AdminModel) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+	if key != "D" {
+		m.confirmDelete = ""
+	}
+
+	switch key {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "q", "esc":
+		main := InitialModel(m.username, true, m.width, m.height, m.renderer)
+		return main, main.Init()
+	case "1", "2", "3":
+		m.tab = adminTab(key[0] - '1')
+		m.cursor = 0
+		m.message = ""
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < m.listLen()-1 {
+			m.cursor++
+		}
+	case "a":
+		if len(m.arenas) > 0 {
+			m.arenaIndex = (m.arenaIndex + 1) % len(m.arenas)
+		}
+	case "R":
+		return m.act("recalculate_ratings", "", "from admin console", func() (string, error) {
+			if err := storage.RecalculateAllGlicko2Ratings(); err != nil {
+				return "", err
+			}
+			return "Ratings recalculated", nil
+		})
+	case "T":
+		if len(m.arenas) == 0 {
+			return m, nil
+		}
+		arena := m.arenas[m.arenaIndex]
+		return m.act("start_tournament", arena.Slug, "", func() (string, error) {
+			t, err := storage.StartTournament(arena.ID)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Started tournament %d in %s", t.ID, arena.Name), nil
+		})
+	}
+
+	switch m.tab {
+	case adminQueue:
+		if key == "c" && m.cursor < len(m.queue) {
+			sub := m.queue[m.cursor]
+			return m.act("cancel_submission", sub.Username, fmt.Sprintf("submission %d (%s)", sub.ID, sub.Filename), func() (string, error) {
+				return fmt.Sprintf("Cancelled submission %d", sub.ID), storage.CancelSubmission(sub.ID)
+			})
+		}
+	case adminUsers:
+		if m.cursor >= len(m.users) {
+			break
+		}
+		user := m.users[m.cursor]
+		switch key {
+		case "d":
+			if user.IsRevoked() {
+				return m.act("restore_user", user.Username, "", func() (string, error) {
+					return "Restored " + user.Username, storage.RestoreUser(user.Username)
+				})
+			}
+			return m.act("revoke_user", user.Username, "", func() (string, error) {
+				return "Disabled " + user.Username, storage.RevokeUser(user.Username)
+			})
+		case "D":
+			if user.Username == m.username {
+				m.message = "Error: you can't delete your own account"
+				return m, nil
+			}
+			if m.confirmDelete != user.Username {
+				m.confirmDelete = user.Username
+				m.message = fmt.Sprintf("Press D again to delete %s", user.Username)
+				return m, nil
+			}
+			m.confirmDelete = ""
+			return m.act("delete_user", user.Username, "", func() (string, error) {
+				return "Deleted " + user.Username, storage.DeleteUser(user.Username)
+			})
+		}
+	case adminSubmissions:
+		if key == "enter" && m.cursor < len(m.submissions) {
+			m = m.inspect(m.submissions[m.cursor])
+			m.matchCursor = 0
+			m.paging = ""
+			m.scroll = 0
+			m.message = ""
+		}
+	}
+	return m, nil
+}
+
+// inspect loads everything the inspector shows about a submission
+func (m AdminModel) inspect(sub storage.Submission) AdminModel {
+	if fresh, err := storage.GetSubmissionByID(sub.ID); err == nil {
+		sub = fresh
+	}
+	m.inspecting = &sub
+	m.matches, _ = storage.GetSubmissionMatches(sub.ID)
+	m.compileLog, _ = storage.GetCompileLog(sub.ID)
+	m.log = nil
+	if lines, err := storage.GetSubmissionLog(sub.ID); err == nil {
+		for _, l := range lines {
+			m.log = append(m.log, fmt.Sprintf("%s %-5s %s", l.LoggedAt.Format("01-02 15:04:05"), l.Level, l.Line))
+		}
+	}
+
+	m.source = nil
+	if content, err := storage.ReadSource(m.uploadDir, sub); err == nil {
+		m.source = strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	}
+	if m.matchCursor >= len(m.matches) {
+		m.matchCursor = 0
+	}
+	return m
+}
+
+func (m AdminModel) updateInspector(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	sub := *m.inspecting
+
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "q", "esc":
+		if m.paging != "" {
+			m.paging = ""
+			return m, nil
+		}
+		m.inspecting = nil
+		m.message = ""
+	case "s", "l":
+		view := map[string]string{"s": "source", "l": "log"}[msg.String()]
+		if m.paging == view {
+			m.paging = ""
+		} else {
+			m.paging = view
+		}
+		m.scroll = 0
+	case "up", "k":
+		if m.paging != "" {
+			if m.scroll > 0 {
+				m.scroll--
+			}
+		} else if m.matchCursor > 0 {
+			m.matchCursor--
+		}
+	case "down", "j":
+		if m.paging != "" {
+			if m.scroll < len(m.pagerLines())-sourceLines {
+				m.scroll++
+			}
+		} else if m.matchCursor < len(m.matches)-1 {
+			m.matchCursor++
+		}
+	case "pgdown", " ":
+		if m.paging != "" {
+			m.scroll = min(m.scroll+sourceLines, max(len(m.pagerLines())-sourceLines, 0))
+		}
+	case "pgup":
+		if m.paging != "" {
+			m.scroll = max(m.scroll-sourceLines, 0)
+		}
+	case "r":
+		return m.act("rerun_submission", sub.Username, fmt.Sprintf("submission %d (%s)", sub.ID, sub.Filename), func() (string, error) {
+			if err := storage.RequeueSubmission(sub.ID); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Submission %d queued to rerun", sub.ID), storage.RecalculateAllGlicko2Ratings()
+		})
+	case "i":
+		if m.matchCursor >= len(m.matches) {
+			return m, nil
+		}
+		match := m.matches[m.matchCursor]
+		return m.act("invalidate_match", sub.Username, fmt.Sprintf("match %d vs %s", match.ID, match.Opponent), func() (string, error) {
+			if err := storage.InvalidateMatch(match.ID); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Match %d invalidated and ratings recalculated", match.ID), storage.RecalculateAllGlicko2Ratings()
+		})
+	}
+	return m, nil
+}
+
+func (m AdminModel) View() string {
+	var b strings.Builder
+
+	titleStyle := m.renderer.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("205")).
+		MarginTop(1).
+		MarginBottom(1)
+	b.WriteString(titleStyle.Render("🛠  Battleship Arena Admin") + "\n")
+
+	if m.inspecting != nil {
+		b.WriteString(m.renderInspector())
+	} else {
+		b.WriteString(m.renderTabs())
+		switch m.tab {
+		case adminQueue:
+			b.WriteString(m.renderQueue())
+		case adminUsers:
+			b.WriteString(m.renderUsers())
+		case adminSubmissions:
+			b.WriteString(m.renderAdminSubmissions())
+		}
+	}
+
+	if m.busy {
+		b.WriteString("\n" + m.renderer.NewStyle().Foreground(lipgloss.Color("yellow")).Render("Working..."))
+	} else if m.message != "" {
+		color := "green"
+		if strings.HasPrefix(m.message, "Error") {
+			color = "196"
+		}
+		b.WriteString("\n" + m.renderer.NewStyle().Foreground(lipgloss.Color(color)).Render(m.message))
+	}
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+func (m AdminModel) renderTabs() string {
+	var b strings.Builder
+	tabStyle := m.renderer.NewStyle().Foreground(lipgloss.Color("240"))
+	activeTabStyle := m.renderer.NewStyle().Foreground(lipgloss.Color("86")).Bold(true)
+
+	tabs := []string{"[1] Queue", "[2] Users", "[3] Submissions"}
+	for i, tab := range tabs {
+		if adminTab(i) == m.tab {
+			b.WriteString(activeTabStyle.Render(tab))
+		} else {
+			b.WriteString(tabStyle.Render(tab))
+		}
+		b.WriteString("  ")
+	}
+
+	arenaName := "-"
+	if len(m.arenas) > 0 {
+		arenaName = m.arenas[m.arenaIndex].Name
+	}
+	b.WriteString("\n\n")
+	b.WriteString(tabStyle.Render(fmt.Sprintf("R: recalculate ratings | T: start tournament in %s (a: switch arena) | q: back", arenaName)))
+	b.WriteString("\n\n")
+	return b.String()
+}
+
+// cursorLine highlights the selected row of a list
+func (m AdminModel) cursorLine(selected bool, line string) string {
+	if selected {
+		return m.renderer.NewStyle().Foreground(lipgloss.Color("86")).Bold(true).Render("► "+line) + "\n"
+	}
+	return "  " + line + "\n"
+}
+
+func (m AdminModel) renderQueue() string {
+	if len(m.queue) == 0 {
+		return "Queue is empty\n"
+	}
+	var b strings.Builder
+	headerStyle := m.renderer.NewStyle().Bold(true).Foreground(lipgloss.Color("240"))
+	b.WriteString(headerStyle.Render(fmt.Sprintf("  %-6s %-20s %-35s %-10s %s", "ID", "User", "File", "Status", "Uploaded")) + "\n")
+	for i, sub := range m.queue {
+		line := fmt.Sprintf("%-6d %-20s %-35s %-10s %s", sub.ID, sub.Username, sub.Filename, sub.Status, formatRelativeTime(sub.UploadTime))
+		b.WriteString(m.cursorLine(i == m.cursor, line))
+	}
+	b.WriteString("\n" + headerStyle.Render("c: cancel selected"))
+	return b.String()
+}
+
+func (m AdminModel) renderUsers() string {
+	if len(m.users) == 0 {
+		return "No users\n"
+	}
+	var b strings.Builder
+	headerStyle := m.renderer.NewStyle().Bold(true).Foreground(lipgloss.Color("240"))
+	b.WriteString(headerStyle.Render(fmt.Sprintf("  %-20s %-25s %-8s %-10s %s", "Username", "Name", "Role", "State", "Last login")) + "\n")
+	for i, u := range m.users {
+		state := "active"
+		if u.IsRevoked() {
+			state = "disabled"
+		}
+		lastLogin := "never"
+		if !u.LastLoginAt.IsZero() {
+			lastLogin = formatRelativeTime(u.LastLoginAt)
+		}
+		line := fmt.Sprintf("%-20s %-25s %-8s %-10s %s", u.Username, u.Name, u.Role, state, lastLogin)
+		b.WriteString(m.cursorLine(i == m.cursor, line))
+	}
+	b.WriteString("\n" + headerStyle.Render("d: disable/restore | D: delete"))
+	return b.String()
+}
+
+func (m AdminModel) renderAdminSubmissions() string {
+	if len(m.submissions) == 0 {
+		return "No submissions\n"
+	}
+	var b strings.Builder
+	headerStyle := m.renderer.NewStyle().Bold(true).Foreground(lipgloss.Color("240"))
+	b.WriteString(headerStyle.Render(fmt.Sprintf("  %-6s %-20s %-35s %-20s %s", "ID", "User", "File", "Status", "Uploaded")) + "\n")
+	for i, sub := range m.submissions {
+		status := sub.Status
+		if !sub.IsActive {
+			status += " (old)"
+		}
+		line := fmt.Sprintf("%-6d %-20s %-35s %-20s %s", sub.ID, sub.Username, sub.Filename, status, formatRelativeTime(sub.UploadTime))
+		b.WriteString(m.cursorLine(i == m.cursor, line))
+	}
+	b.WriteString("\n" + headerStyle.Render("enter: inspect"))
+	return b.String()
+}
+
+func (m AdminModel) renderInspector() string {
+	sub := m.inspecting
+	var b strings.Builder
+	labelStyle := m.renderer.NewStyle().Foreground(lipgloss.Color("240"))
+	sectionStyle := m.renderer.NewStyle().Bold(true)
+
+	b.WriteString(sectionStyle.Render(fmt.Sprintf("Submission %d", sub.ID)) + "\n\n")
+	b.WriteString(labelStyle.Render("User: ") + sub.Username + "\n")
+	b.WriteString(labelStyle.Render("File: ") + sub.Filename + "\n")
+	b.WriteString(labelStyle.Render("Status: ") + sub.Status)
+	if !sub.IsActive {
+		b.WriteString(" (replaced)")
+	}
+	b.WriteString("\n" + labelStyle.Render("Uploaded: ") + sub.UploadTime.Format("2006-01-02 15:04") + "\n\n")
+
+	if m.paging != "" {
+		title, empty, key := "Source", "Source file not found", "s"
+		if m.paging == "log" {
+			title, empty, key = "Log", "No log lines yet", "l"
+		}
+		lines := m.pagerLines()
+		b.WriteString(sectionStyle.Render(title) + "\n")
+		if len(lines) == 0 {
+			b.WriteString(empty + "\n\n" + labelStyle.Render(key+"/esc: back"))
+			return b.String()
+		}
+		end := min(m.scroll+sourceLines, len(lines))
+		for i := m.scroll; i < end; i++ {
+			if m.paging == "source" {
+				b.WriteString(labelStyle.Render(fmt.Sprintf("%4d ", i+1)))
+			}
+			b.WriteString(lines[i] + "\n")
+		}
+		b.WriteString("\n" + labelStyle.Render(fmt.Sprintf("lines %d-%d of %d | ↑↓/pgup/pgdn: scroll | %s/esc: back", m.scroll+1, end, len(lines), key)))
+		return b.String()
+	}
+
+	b.WriteString(sectionStyle.Render("Compile log") + "\n")
+	if strings.TrimSpace(m.compileLog) == "" {
+		b.WriteString(labelStyle.Render("(empty)") + "\n")
+	} else {
+		lines := strings.Split(strings.TrimSpace(m.compileLog), "\n")
+		if len(lines) > 10 {
+			lines = append(lines[:10], fmt.Sprintf("... %d more lines", len(lines)-10))
+		}
+		b.WriteString(strings.Join(lines, "\n") + "\n")
+	}
+	b.WriteString("\n")
+
+	b.WriteString(sectionStyle.Render(fmt.Sprintf("Matches (%d)", len(m.matches))) + "\n")
+	for i, match := range m.matches {
+		valid := ""
+		if !match.IsValid {
+			valid = " [invalid]"
+		}
+		line := fmt.Sprintf("#%-6d vs %-20s %4d-%-4d %3d moves%s", match.ID, match.Opponent, match.Wins, match.Losses, match.AvgMoves, valid)
+		b.WriteString(m.cursorLine(i == m.matchCursor, line))
+	}
+	if len(m.matches) == 0 {
+		b.WriteString("No matches\n")
+	}
+
+	b.WriteString("\n" + labelStyle.Render("s: source | l: log | r: rerun matches | i: invalidate selected match | esc: back"))
+	return b.String()
+}
+
+// pagerLines is whatever the inspector is scrolling through
+func (m AdminModel) pagerLines() []string {
+	if m.paging == "log" {
+		return m.log
+	}
+	return m.source
+}
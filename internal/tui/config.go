@@ -0,0 +1,15 @@
+package tui
+
+import (
+	"battleship-arena/internal/config"
+)
+
+// settings holds the server address shown in upload instructions, the
+// upload directory and the refresh interval
+var settings = config.Default()
+
+// Configure applies the config file's settings; call it before serving
+// sessions
+func Configure(cfg config.Config) {
+	settings = cfg
+}
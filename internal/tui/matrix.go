@@ -0,0 +1,131 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"battleship-arena/internal/storage"
+)
+
+// Width of the name column and of each cell in the matrix view
+const (
+	matrixNameWidth = 16
+	matrixCellWidth = 4
+)
+
+func (m model) renderMatrixView() string {
+	if m.matrix == nil {
+		return "Loading matrix..."
+	}
+	return m.renderArena() + "\n" + m.renderMatrix(m.matrix)
+}
+
+// renderMatrix draws the head-to-head grid. Columns are numbered after the
+// rows to fit a terminal; players past what the width allows are left out.
+func (m model) renderMatrix(matrix *storage.Matrix) string {
+	var b strings.Builder
+	b.WriteString(m.renderer.NewStyle().Bold(true).Render("⚔️  Head-to-Head") + "\n")
+	sortLabel := "rating"
+	if m.matrixSort == storage.MatrixByName {
+		sortLabel = "name"
+	}
+	dim := m.renderer.NewStyle().Foreground(lipgloss.Color("240"))
+	b.WriteString(dim.Render(fmt.Sprintf("Row player's win %% against each column — sorted by %s, press s to toggle", sortLabel)) + "\n\n")
+
+	if len(matrix.Players) == 0 {
+		return b.String() + "No active submissions yet"
+	}
+
+	shown := len(matrix.Players)
+	if m.width > 0 {
+		if fit := (m.width - matrixNameWidth - 4) / matrixCellWidth; fit < shown {
+			shown = max(fit, 1)
+		}
+	}
+
+	b.WriteString(strings.Repeat(" ", matrixNameWidth+4))
+	for j := 0; j < shown; j++ {
+		b.WriteString(fmt.Sprintf("%*d", matrixCellWidth, j+1))
+	}
+	b.WriteString("\n")
+
+	for i := 0; i < shown; i++ {
+		p := matrix.Players[i]
+		name := p.Username
+		if len(name) > matrixNameWidth {
+			name = name[:matrixNameWidth-1] + "…"
+		}
+		label := fmt.Sprintf("%2d %-*s ", i+1, matrixNameWidth, name)
+		if p.Username == m.username {
+			label = m.renderer.NewStyle().Foreground(lipgloss.Color("220")).Bold(true).Render(label)
+		}
+		b.WriteString(label)
+
+		for j := 0; j < shown; j++ {
+			cell := matrix.Cells[i][j]
+			switch {
+			case i == j:
+				b.WriteString(dim.Render(fmt.Sprintf("%*s", matrixCellWidth, "—")))
+			case cell == nil:
+				b.WriteString(dim.Render(fmt.Sprintf("%*s", matrixCellWidth, "·")))
+			default:
+				b.WriteString(m.renderer.NewStyle().Foreground(lipgloss.Color(winColor(cell.WinPct()))).
+					Render(fmt.Sprintf("%*.0f", matrixCellWidth, cell.WinPct())))
+			}
+		}
+		b.WriteString("\n")
+	}
+	if shown < len(matrix.Players) {
+		b.WriteString(dim.Render(fmt.Sprintf("... %d more players; widen the terminal or see /matrix on the web", len(matrix.Players)-shown)) + "\n")
+	}
+
+	// Your weakest pairings, so you know what to work on
+	for i, p := range matrix.Players {
+		if p.Username == m.username {
+			b.WriteString("\n" + m.renderWeakSpots(matrix, i))
+		}
+	}
+	return b.String()
+}
+
+// renderWeakSpots lists the opponents a player loses to, worst first
+func (m model) renderWeakSpots(matrix *storage.Matrix, row int) string {
+	type spot struct {
+		opponent string
+		cell     *storage.MatrixCell
+	}
+	var spots []spot
+	for j, cell := range matrix.Cells[row] {
+		if cell != nil && cell.Wins < cell.Losses {
+			spots = append(spots, spot{matrix.Players[j].Username, cell})
+		}
+	}
+	if len(spots) == 0 {
+		return "No losing pairings so far.\n"
+	}
+	sort.SliceStable(spots, func(a, b int) bool { return spots[a].cell.WinPct() < spots[b].cell.WinPct() })
+
+	var b strings.Builder
+	b.WriteString(m.renderer.NewStyle().Bold(true).Render("Weakest against") + "\n")
+	for i, s := range spots {
+		if i == 5 {
+			break
+		}
+		b.WriteString(fmt.Sprintf("  %-20s %3.0f%%  (%d–%d)\n", s.opponent, s.cell.WinPct(), s.cell.Wins, s.cell.Losses))
+	}
+	return b.String()
+}
+
+// winColor is red below 40%, yellow up to 60% and green above
+func winColor(pct float64) string {
+	switch {
+	case pct < 40:
+		return "196"
+	case pct <= 60:
+		return "220"
+	}
+	return "46"
+}
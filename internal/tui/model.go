@@ -2,7 +2,6 @@ package tui
 
 import (
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
@@ -18,7 +17,9 @@ const (
 	viewHome viewMode = iota
 	viewLeaderboard
 	viewProfile
+	viewMatrix
 	viewEditProfile
+	viewKeys
 )
 
 type profileField int
@@ -38,6 +39,8 @@ type model struct {
 	submissions    []storage.Submission
 	leaderboard    []storage.LeaderboardEntry
 	matches        []storage.MatchResult
+	matrix         *storage.Matrix
+	matrixSort     string
 	externalURL    string
 	sshPort        string
 	currentView    viewMode
@@ -47,13 +50,22 @@ type model struct {
 	bioInput       string
 	linkInput      string
 	saveMessage    string
+	sortBy         string
+	hideBots       bool
+	arenas         []storage.Arena
+	arenaIndex     int
+	keys           []storage.UserKey
+	keyCursor      int
+	addingKey      bool
+	keyInput       string
+	keyMessage     string
+	isAdmin        bool
 }
 
-func InitialModel(username string, width, height int, renderer *lipgloss.Renderer) model {
-	externalURL := os.Getenv("BATTLESHIP_EXTERNAL_URL")
-	if externalURL == "" {
-		externalURL = "localhost"
-	}
+// InitialModel builds the main view. isAdmin unlocks the admin console and
+// must only be set for sessions that logged in with an admin key.
+func InitialModel(username string, isAdmin bool, width, height int, renderer *lipgloss.Renderer) model {
+	externalURL := settings.Server.ExternalURL
 	// Strip http:// or https:// prefix to get just the hostname
 	externalURL = strings.TrimPrefix(externalURL, "http://")
 	externalURL = strings.TrimPrefix(externalURL, "https://")
@@ -62,13 +74,14 @@ func InitialModel(username string, width, height int, renderer *lipgloss.Rendere
 		externalURL = externalURL[:idx]
 	}
 	
-	sshPort := os.Getenv("BATTLESHIP_SSH_PORT")
-	if sshPort == "" {
-		sshPort = "2222"
-	}
+	sshPort := settings.Server.SSHPort
 	
 	// Load user profile
 	user, _ := storage.GetUserByUsername(username)
+	keys, _ := storage.GetUserKeys(username)
+	
+	// Arenas this user can play in; the default arena comes first
+	arenas, _ := storage.GetUserArenas(username)
 	
 	// Create styles using session renderer
 	titleStyle := renderer.NewStyle().
@@ -90,11 +103,25 @@ func InitialModel(username string, width, height int, renderer *lipgloss.Rendere
 		currentView:  viewHome,
 		user:         user,
 		editingField: fieldName,
+		sortBy:       storage.SortByRating,
+		matrixSort:   storage.MatrixByRating,
+		arenas:       arenas,
+		keys:         keys,
+		isAdmin:      isAdmin,
+	}
+}
+
+// arena is the arena currently selected with 'a'. The zero value stands for
+// the default arena if the list couldn't be loaded.
+func (m model) arena() storage.Arena {
+	if len(m.arenas) == 0 {
+		return storage.Arena{Slug: storage.DefaultArenaSlug}
 	}
+	return m.arenas[m.arenaIndex]
 }
 
 func (m model) Init() tea.Cmd {
-	return tea.Batch(loadLeaderboard, loadSubmissions(m.username), tickCmd())
+	return tea.Batch(m.loadLeaderboard(), loadSubmissions(m.username), tickCmd())
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -103,6 +130,9 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.currentView == viewEditProfile {
 			return m.updateEditProfile(msg)
 		}
+		if m.currentView == viewKeys {
+			return m.updateKeys(msg)
+		}
 		
 		switch msg.String() {
 		case "ctrl+c", "q":
@@ -113,6 +143,38 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.currentView = viewLeaderboard
 		case "p", "3":
 			m.currentView = viewProfile
+		case "m", "4":
+			m.currentView = viewMatrix
+			return m, m.loadMatrix()
+		case "s":
+			if m.currentView == viewMatrix {
+				if m.matrixSort == storage.MatrixByName {
+					m.matrixSort = storage.MatrixByRating
+				} else {
+					m.matrixSort = storage.MatrixByName
+				}
+				return m, m.loadMatrix()
+			}
+			if m.currentView == viewLeaderboard {
+				if m.sortBy == storage.SortByBenchmark {
+					m.sortBy = storage.SortByRating
+				} else {
+					m.sortBy = storage.SortByBenchmark
+				}
+				return m, m.loadLeaderboard()
+			}
+		case "b":
+			if m.currentView == viewLeaderboard {
+				m.hideBots = !m.hideBots
+				return m, m.loadLeaderboard()
+			}
+		case "a":
+			if len(m.arenas) > 1 {
+				m.arenaIndex = (m.arenaIndex + 1) % len(m.arenas)
+				m.leaderboard = nil
+				m.matrix = nil
+				return m, tea.Batch(m.loadLeaderboard(), m.loadMatches(), m.loadMatrix())
+			}
 		case "e":
 			if m.currentView == viewProfile {
 				m.currentView = viewEditProfile
@@ -125,6 +187,18 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.editingField = fieldName
 				m.saveMessage = ""
 			}
+		case "x":
+			if m.isAdmin {
+				admin := NewAdminModel(m.username, m.width, m.height, m.renderer)
+				return admin, admin.Init()
+			}
+		case "k":
+			if m.currentView == viewProfile {
+				m.currentView = viewKeys
+				m.keys, _ = storage.GetUserKeys(m.username)
+				m.keyCursor = 0
+				m.keyMessage = ""
+			}
 		}
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
@@ -135,8 +209,13 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.submissions = msg.submissions
 	case matchesMsg:
 		m.matches = msg.matches
+	case matrixMsg:
+		m.matrix = msg.matrix
 	case tickMsg:
-		return m, tea.Batch(loadLeaderboard, loadSubmissions(m.username), loadMatches, tickCmd())
+		if m.currentView == viewMatrix {
+			return m, tea.Batch(m.loadMatrix(), loadSubmissions(m.username), tickCmd())
+		}
+		return m, tea.Batch(m.loadLeaderboard(), loadSubmissions(m.username), m.loadMatches(), tickCmd())
 	}
 	return m, nil
 }
@@ -200,7 +279,71 @@ func (m model) updateEditProfile(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// updateKeys handles the SSH key manager: move with ↑↓, d removes the
+// selected key and n pastes a new one
+func (m model) updateKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.addingKey {
+		switch msg.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			m.addingKey = false
+			m.keyInput = ""
+		case tea.KeyEnter:
+			key, err := storage.AddUserKey(m.username, m.keyInput, "")
+			if err != nil {
+				m.keyMessage = "Error: " + err.Error()
+				return m, nil
+			}
+			m.keyMessage = "Added key " + key.Fingerprint
+			m.addingKey = false
+			m.keyInput = ""
+			m.keys, _ = storage.GetUserKeys(m.username)
+		case tea.KeyBackspace:
+			if len(m.keyInput) > 0 {
+				m.keyInput = m.keyInput[:len(m.keyInput)-1]
+			}
+		case tea.KeySpace:
+			m.keyInput += " "
+		case tea.KeyRunes:
+			// Pasted keys arrive as one long run of characters
+			if len(m.keyInput) < 16*1024 {
+				m.keyInput += string(msg.Runes)
+			}
+		}
+		return m, nil
+	}
 
+	switch msg.String() {
+	case "ctrl+c", "q", "esc":
+		m.currentView = viewProfile
+		m.keyMessage = ""
+	case "up":
+		if m.keyCursor > 0 {
+			m.keyCursor--
+		}
+	case "down":
+		if m.keyCursor < len(m.keys)-1 {
+			m.keyCursor++
+		}
+	case "n":
+		m.addingKey = true
+		m.keyInput = ""
+		m.keyMessage = ""
+	case "d":
+		if m.keyCursor < len(m.keys) {
+			key, err := storage.RemoveUserKey(m.username, m.keys[m.keyCursor].Fingerprint)
+			if err != nil {
+				m.keyMessage = "Error: " + err.Error()
+				return m, nil
+			}
+			m.keyMessage = "Removed key " + key.Fingerprint
+			m.keys, _ = storage.GetUserKeys(m.username)
+			if m.keyCursor >= len(m.keys) && m.keyCursor > 0 {
+				m.keyCursor--
+			}
+		}
+	}
+	return m, nil
+}
 
 func (m model) View() string {
 	var b strings.Builder
@@ -209,12 +352,12 @@ func (m model) View() string {
 	b.WriteString(title + "\n")
 	
 	// Skip tabs if in edit mode
-	if m.currentView != viewEditProfile {
+	if m.currentView != viewEditProfile && m.currentView != viewKeys {
 		// Navigation tabs
 		tabStyle := m.renderer.NewStyle().Foreground(lipgloss.Color("240"))
 		activeTabStyle := m.renderer.NewStyle().Foreground(lipgloss.Color("86")).Bold(true)
 		
-		tabs := []string{"[h] Home", "[l] Leaderboard", "[p] Profile"}
+		tabs := []string{"[h] Home", "[l] Leaderboard", "[p] Profile", "[m] Matrix"}
 		for i, tab := range tabs {
 			if viewMode(i) == m.currentView {
 				b.WriteString(activeTabStyle.Render(tab))
@@ -225,6 +368,9 @@ func (m model) View() string {
 				b.WriteString("  ")
 			}
 		}
+		if m.isAdmin {
+			b.WriteString("  " + tabStyle.Render("[x] Admin"))
+		}
 		b.WriteString("\n\n")
 	}
 
@@ -236,11 +382,15 @@ func (m model) View() string {
 		b.WriteString(m.renderLeaderboardView())
 	case viewProfile:
 		b.WriteString(m.renderProfile())
+	case viewMatrix:
+		b.WriteString(m.renderMatrixView())
 	case viewEditProfile:
 		b.WriteString(m.renderEditProfile())
+	case viewKeys:
+		b.WriteString(m.renderKeys())
 	}
 
-	if m.currentView != viewEditProfile {
+	if m.currentView != viewEditProfile && m.currentView != viewKeys {
 		b.WriteString("\n\nPress q to quit")
 	}
 
@@ -250,16 +400,23 @@ func (m model) View() string {
 func (m model) renderHome() string {
 	var b strings.Builder
 	
-	b.WriteString(fmt.Sprintf("User: %s\n\n", m.username))
+	arena := m.arena()
+	b.WriteString(fmt.Sprintf("User: %s\n", m.username))
+	b.WriteString(m.renderArena())
+	b.WriteString("\n")
 
-	// Upload instructions
+	// Upload instructions; each arena has its own target directory
+	target := "~/"
+	if !arena.IsDefault() {
+		target = arena.Slug + "/"
+	}
 	infoStyle := m.renderer.NewStyle().Foreground(lipgloss.Color("86"))
-	b.WriteString(infoStyle.Render(fmt.Sprintf("Upload via: scp -P %s memory_functions_yourname.cpp %s@%s:~/", m.sshPort, m.username, m.externalURL)))
+	b.WriteString(infoStyle.Render(fmt.Sprintf("Upload via: scp -P %s memory_functions_yourname.cpp %s@%s:%s", m.sshPort, m.username, m.externalURL, target)))
 	b.WriteString("\n\n")
 
 	// Show submissions
-	if len(m.submissions) > 0 {
-		b.WriteString(m.renderSubmissions(m.submissions))
+	if submissions := m.arenaSubmissions(); len(submissions) > 0 {
+		b.WriteString(m.renderSubmissions(submissions))
 	} else {
 		b.WriteString("No submissions yet. Upload your first AI!\n")
 	}
@@ -267,9 +424,36 @@ func (m model) renderHome() string {
 	return b.String()
 }
 
+// renderArena shows the selected arena and, if there is a choice, how to switch
+func (m model) renderArena() string {
+	arena := m.arena()
+	name := arena.Name
+	if name == "" {
+		name = arena.Slug
+	}
+	line := "Arena: " + m.renderer.NewStyle().Bold(true).Render(name)
+	if len(m.arenas) > 1 {
+		line += m.renderer.NewStyle().Foreground(lipgloss.Color("240")).Render(
+			fmt.Sprintf("  (%d/%d — press a to switch)", m.arenaIndex+1, len(m.arenas)))
+	}
+	return line + "\n"
+}
+
+// arenaSubmissions filters the user's submissions to the selected arena
+func (m model) arenaSubmissions() []storage.Submission {
+	arena := m.arena()
+	var submissions []storage.Submission
+	for _, sub := range m.submissions {
+		if sub.ArenaID == arena.ID || arena.ID == 0 {
+			submissions = append(submissions, sub)
+		}
+	}
+	return submissions
+}
+
 func (m model) renderLeaderboardView() string {
 	if len(m.leaderboard) > 0 {
-		return m.renderLeaderboard(m.leaderboard)
+		return m.renderArena() + "\n" + m.renderLeaderboard(m.leaderboard)
 	}
 	return "Loading leaderboard..."
 }
@@ -288,14 +472,15 @@ func (m model) renderProfile() string {
 	b.WriteString(labelStyle.Render("Username: ") + m.user.Username + "\n")
 	b.WriteString(labelStyle.Render("Name: ") + m.user.Name + "\n")
 	b.WriteString(labelStyle.Render("Bio: ") + m.user.Bio + "\n")
-	b.WriteString(labelStyle.Render("Link: ") + m.user.Link + "\n\n")
+	b.WriteString(labelStyle.Render("Link: ") + m.user.Link + "\n")
+	b.WriteString(labelStyle.Render("SSH keys: ") + fmt.Sprintf("%d", len(m.keys)) + "\n\n")
 	
 	hintStyle := m.renderer.NewStyle().Foreground(lipgloss.Color("86"))
-	b.WriteString(hintStyle.Render("Press 'e' to edit profile") + "\n\n")
+	b.WriteString(hintStyle.Render("Press 'e' to edit profile, 'k' to manage SSH keys") + "\n\n")
 	
 	// Show user stats from submissions
-	if len(m.submissions) > 0 {
-		b.WriteString(m.renderSubmissions(m.submissions))
+	if submissions := m.arenaSubmissions(); len(submissions) > 0 {
+		b.WriteString(m.renderSubmissions(submissions))
 		b.WriteString("\n")
 	}
 	
@@ -345,17 +530,67 @@ func (m model) renderEditProfile() string {
 }
 
 
+func (m model) renderKeys() string {
+	var b strings.Builder
+	
+	b.WriteString(m.renderer.NewStyle().Bold(true).Render("🔑 SSH Keys") + "\n\n")
+	
+	activeStyle := m.renderer.NewStyle().Foreground(lipgloss.Color("86")).Bold(true)
+	inactiveStyle := m.renderer.NewStyle().Foreground(lipgloss.Color("240"))
+	
+	for i, k := range m.keys {
+		used := "never used"
+		if !k.LastUsedAt.IsZero() {
+			used = "last used " + formatRelativeTime(k.LastUsedAt)
+		}
+		line := fmt.Sprintf("%s  %-20s %s", k.Fingerprint, k.Label, used)
+		if i == m.keyCursor && !m.addingKey {
+			b.WriteString(activeStyle.Render("► "+line) + "\n")
+		} else {
+			b.WriteString(inactiveStyle.Render("  "+line) + "\n")
+		}
+	}
+	if len(m.keys) == 0 {
+		b.WriteString("No keys registered\n")
+	}
+	b.WriteString("\n")
+	
+	if m.addingKey {
+		b.WriteString(activeStyle.Render("Paste a public key (the contents of a .pub file):") + "\n")
+		b.WriteString(m.keyInput + "█\n\n")
+	}
+	
+	if m.keyMessage != "" {
+		msgStyle := m.renderer.NewStyle().Foreground(lipgloss.Color("green"))
+		if strings.HasPrefix(m.keyMessage, "Error") {
+			msgStyle = m.renderer.NewStyle().Foreground(lipgloss.Color("196"))
+		}
+		b.WriteString(msgStyle.Render(m.keyMessage) + "\n\n")
+	}
+	
+	hintStyle := m.renderer.NewStyle().Foreground(lipgloss.Color("240"))
+	if m.addingKey {
+		b.WriteString(hintStyle.Render("Enter: Add key | Esc: Cancel"))
+	} else {
+		b.WriteString(hintStyle.Render("↑↓: Select | n: Add key | d: Remove selected | Esc: Back"))
+	}
+	
+	return b.String()
+}
 
 type leaderboardMsg struct {
 	entries []storage.LeaderboardEntry
 }
 
-func loadLeaderboard() tea.Msg {
-	entries, err := storage.GetLeaderboard(20)
-	if err != nil {
-		return leaderboardMsg{entries: nil}
+func (m model) loadLeaderboard() tea.Cmd {
+	query := storage.LeaderboardQuery{ArenaID: m.arena().ID, Limit: 20, SortBy: m.sortBy, HideBots: m.hideBots}
+	return func() tea.Msg {
+		entries, err := storage.QueryLeaderboard(query)
+		if err != nil {
+			return leaderboardMsg{entries: nil}
+		}
+		return leaderboardMsg{entries: entries}
 	}
-	return leaderboardMsg{entries: entries}
 }
 
 type submissionsMsg struct {
@@ -376,18 +611,36 @@ type matchesMsg struct {
 	matches []storage.MatchResult
 }
 
-func loadMatches() tea.Msg {
-	matches, err := storage.GetAllMatches()
-	if err != nil {
-		return matchesMsg{matches: nil}
+func (m model) loadMatches() tea.Cmd {
+	arenaID := m.arena().ID
+	return func() tea.Msg {
+		matches, err := storage.GetAllMatches(arenaID)
+		if err != nil {
+			return matchesMsg{matches: nil}
+		}
+		return matchesMsg{matches: matches}
+	}
+}
+
+type matrixMsg struct {
+	matrix *storage.Matrix
+}
+
+func (m model) loadMatrix() tea.Cmd {
+	arenaID, sortBy := m.arena().ID, m.matrixSort
+	return func() tea.Msg {
+		matrix, err := storage.GetMatrix(arenaID, sortBy)
+		if err != nil {
+			return matrixMsg{matrix: nil}
+		}
+		return matrixMsg{matrix: matrix}
 	}
-	return matchesMsg{matches: matches}
 }
 
 type tickMsg time.Time
 
 func tickCmd() tea.Cmd {
-	return tea.Tick(time.Second*5, func(t time.Time) tea.Msg {
+	return tea.Tick(settings.TUI.RefreshInterval.Duration, func(t time.Time) tea.Msg {
 		return tickMsg(t)
 	})
 }
@@ -409,7 +662,7 @@ func (m model) renderSubmissions(submissions []storage.Submission) string {
 			statusColor = "blue"
 		case "completed":
 			statusColor = "green"
-		case "failed":
+		case "failed", "compilation_failed", "cancelled":
 			statusColor = "red"
 		default:
 			statusColor = "white"
@@ -447,11 +700,21 @@ func (m model) renderLeaderboard(entries []storage.LeaderboardEntry) string {
 	}
 
 	var b strings.Builder
-	b.WriteString(m.renderer.NewStyle().Bold(true).Render("🏆 Leaderboard") + "\n\n")
+	b.WriteString(m.renderer.NewStyle().Bold(true).Render("🏆 Leaderboard") + "\n")
+	sortLabel := "rating"
+	if m.sortBy == storage.SortByBenchmark {
+		sortLabel = "benchmark (avg shots, lower is better)"
+	}
+	botsLabel := "shown"
+	if m.hideBots {
+		botsLabel = "hidden"
+	}
+	b.WriteString(m.renderer.NewStyle().Foreground(lipgloss.Color("240")).Render(
+		fmt.Sprintf("Sorted by %s — press s to toggle | Bots %s — press b to toggle", sortLabel, botsLabel)) + "\n\n")
 
 	// Header without styling on the whole line
-	b.WriteString(fmt.Sprintf("%-4s %-20s %11s %8s %8s %10s %10s\n", 
-		"Rank", "User", "Rating", "Wins", "Losses", "Win Rate", "Avg Moves"))
+	b.WriteString(fmt.Sprintf("%-4s %-20s %11s %8s %8s %10s %10s %10s\n", 
+		"Rank", "User", "Rating", "Wins", "Losses", "Win Rate", "Avg Moves", "Benchmark"))
 
 	for i, entry := range entries {
 		rank := fmt.Sprintf("#%d", i+1)
@@ -470,8 +733,16 @@ func (m model) renderLeaderboard(entries []storage.LeaderboardEntry) string {
 		
 		// Format line with Glicko-2 rating ± RD
 		ratingStr := fmt.Sprintf("%d±%d", entry.Rating, entry.RD)
-		b.WriteString(fmt.Sprintf("%s %-20s %11s %8d %8d %9.2f%% %9.1f\n",
-			displayRank, entry.Username, ratingStr, entry.Wins, entry.Losses, entry.WinPct, entry.AvgMoves))
+		benchStr := "-"
+		if entry.HasBenchmark {
+			benchStr = fmt.Sprintf("%.1f", entry.BenchmarkShots)
+		}
+		name := entry.Username
+		if entry.IsBot {
+			name += " [bot]"
+		}
+		b.WriteString(fmt.Sprintf("%s %-20s %11s %8d %8d %9.2f%% %9.1f %10s\n",
+			displayRank, name, ratingStr, entry.Wins, entry.Losses, entry.WinPct, entry.AvgMoves, benchStr))
 	}
 
 	return b.String()
@@ -2,7 +2,7 @@ package tui
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -15,7 +15,8 @@ type OnboardingModel struct {
 	renderer  *lipgloss.Renderer
 	username  string
 	publicKey string
-	step      int // 0=name, 1=bio, 2=link, 3=done
+	step      int // -1=invite code, 0=name, 1=bio, 2=link, 3=done
+	invite    string
 	name      string
 	bio       string
 	link      string
@@ -30,12 +31,18 @@ type onboardingCompleteMsg struct {
 	username string
 }
 
-func NewOnboardingModel(username, publicKey string, width, height int, renderer *lipgloss.Renderer) OnboardingModel {
+// NewOnboardingModel starts account setup; users who aren't on the roster of
+// an invite-only server are asked for an invite code first
+func NewOnboardingModel(username, publicKey string, needsInvite bool, width, height int, renderer *lipgloss.Renderer) OnboardingModel {
+	step := 0
+	if needsInvite {
+		step = -1
+	}
 	return OnboardingModel{
 		renderer:  renderer,
 		username:  username,
 		publicKey: publicKey,
-		step:      0,
+		step:      step,
 		width:     width,
 		height:    height,
 		completed: false,
@@ -54,6 +61,16 @@ func (m OnboardingModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		case "enter":
 			switch m.step {
+			case -1: // Invite code
+				if err := storage.CheckInviteCode(m.input); err != nil {
+					m.err = err
+					m.input = ""
+					return m, nil
+				}
+				m.invite = storage.NormalizeInviteCode(m.input)
+				m.input = ""
+				m.err = nil
+				m.step = 0
 			case 0: // Name
 				if strings.TrimSpace(m.input) == "" {
 					m.err = fmt.Errorf("name is required")
@@ -73,11 +90,18 @@ func (m OnboardingModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.step = 3
 				
 				// Create user in database
-				_, err := storage.CreateUser(m.username, m.name, m.bio, m.link, m.publicKey)
+				_, err := storage.RegisterUser(m.username, m.name, m.bio, m.link, m.publicKey, m.invite)
 				if err != nil {
-					log.Printf("Failed to create user: %v", err)
+					slog.Error("creating user failed", "err", err)
 					m.err = fmt.Errorf("failed to create account")
 					m.step = 2
+					// Someone else redeemed the code while this form was open
+					if m.invite != "" && storage.CheckInviteCode(m.invite) != nil {
+						m.err = fmt.Errorf("invite code is no longer valid")
+						m.invite = ""
+						m.input = ""
+						m.step = -1
+					}
 					return m, nil
 				}
 				
@@ -100,7 +124,7 @@ func (m OnboardingModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.height = msg.Height
 	case onboardingCompleteMsg:
 		// Transition to main model
-		mainModel := InitialModel(m.username, m.width, m.height, m.renderer)
+		mainModel := InitialModel(m.username, false, m.width, m.height, m.renderer)
 		return mainModel, mainModel.Init()
 	}
 	return m, nil
@@ -144,6 +168,10 @@ func (m OnboardingModel) View() string {
 	}
 	
 	switch m.step {
+	case -1:
+		b.WriteString(promptStyle.Render("Invite code:") + " (required)\n")
+		b.WriteString(inputStyle.Render(m.input + "█") + "\n\n")
+		b.WriteString(helpStyle.Render("Registration is limited to the class roster; ask your instructor for a code"))
 	case 0:
 		b.WriteString(promptStyle.Render("What's your full name?") + " (required)\n")
 		b.WriteString(inputStyle.Render(m.input + "█") + "\n\n")
@@ -13,8 +13,12 @@ if [ -f "$PROJECT_ROOT/.env" ]; then
     export $(cat "$PROJECT_ROOT/.env" | grep -v '^#' | xargs)
 fi
 
-# Admin passcode (set via environment variable or use default)
-ADMIN_PASSCODE="${BATTLESHIP_ADMIN_PASSCODE:-battleship-admin-override}"
+# Admin passcode (the server only accepts it when BATTLESHIP_ADMIN_PASSCODE is set)
+ADMIN_PASSCODE="${BATTLESHIP_ADMIN_PASSCODE:-}"
+if [ -z "$ADMIN_PASSCODE" ]; then
+    echo "❌ BATTLESHIP_ADMIN_PASSCODE is not set; the passcode login is disabled without it"
+    exit 1
+fi
 
 echo "🚢 Battleship Arena - Batch Upload Script (Admin Mode)"
 echo "======================================================="